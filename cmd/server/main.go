@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
@@ -19,8 +21,13 @@ import (
 	mcpserver "github.com/alexfirilov/itportal-mcp/internal/mcp"
 )
 
+// version is the release this binary was built from, set at build time with
+// -ldflags "-X main.version=1.2.3". It is reported in the ITPortal User-Agent.
+var version = "dev"
+
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	logLevel := new(slog.LevelVar)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
 
 	// Load .env if present; ignore error when file doesn't exist.
 	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
@@ -32,42 +39,145 @@ func main() {
 		logger.Error("configuration error", "error", err)
 		os.Exit(1)
 	}
+	logLevel.Set(cfg.LogLevel)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// Build ITPortal API client.
-	itportalClient := itportal.NewClient(cfg.ITPortalBaseURL, cfg.ITPortalAPIKey,
-		itportal.WithAPIVersion(cfg.ITPortalAPIVersion),
-		itportal.WithEncryptionKey(cfg.ITPortalEncryptionKey),
-	)
-
-	// Build documentation cache (blocks until initial snapshot succeeds).
-	logger.Info("building initial documentation snapshot — this may take a moment…")
-	docCache, err := cache.New(ctx, itportalClient, cfg.SnapshotLimitPerEntity, cfg.SnapshotDeviceLimit, cfg.SnapshotRefreshInterval, logger)
+	// Build an ITPortal API client and documentation cache per instance. Each
+	// cache blocks until its initial snapshot succeeds, unless
+	// SNAPSHOT_STARTUP_NONBLOCKING defers the build to the background.
+	serverOpts := []mcpserver.Option{
+		mcpserver.WithWritePolicy(mcpserver.NewWritePolicy(cfg.MCPReadOnly, cfg.MCPWriteAllowedEntities)),
+		mcpserver.WithMaxResultBytes(cfg.ToolMaxResultBytes),
+		mcpserver.WithInstanceName(cfg.Instances[0].Name),
+		mcpserver.WithRawRequest(cfg.EnableRawRequest),
+		mcpserver.WithDenySecrets(cfg.MCPDenySecrets),
+		mcpserver.WithSearchStemming(cfg.SearchStemming),
+		mcpserver.WithDeviceTypeValidation(cfg.ValidateDeviceType),
+		mcpserver.WithLogger(logger),
+	}
+	userAgent := cfg.ITPortalUserAgent
+	if userAgent == "" {
+		userAgent = itportal.DefaultUserAgent + "/" + version
+	}
+	tlsConfig, err := itportal.LoadTLSConfig(cfg.ITPortalCAFile, cfg.ITPortalInsecureSkipTLS)
+	if err != nil {
+		logger.Error("invalid ITPortal TLS configuration", "error", err)
+		os.Exit(1)
+	}
+	if cfg.ITPortalInsecureSkipTLS {
+		logger.Warn("ITPortal TLS certificate verification is disabled (ITPORTAL_INSECURE_SKIP_VERIFY)")
+	}
+	uploadExts, err := mcpserver.NewUploadExtensions(cfg.UploadAllowedExtensions)
 	if err != nil {
-		logger.Error("failed to build initial documentation snapshot", "error", err)
+		logger.Error("invalid UPLOAD_ALLOWED_EXTENSIONS", "error", err)
 		os.Exit(1)
 	}
-	docCache.StartBackgroundRefresh(ctx)
+	serverOpts = append(serverOpts, mcpserver.WithUploadExtensions(uploadExts))
+	drainer := mcpserver.NewDrainer(cfg.MCPShutdownTimeout)
+	serverOpts = append(serverOpts, mcpserver.WithDrainer(drainer),
+		mcpserver.WithToolLimiter(mcpserver.NewToolLimiter(cfg.MCPMaxConcurrentTools, cfg.MCPToolQueueTimeout)),
+		mcpserver.WithToolTimeout(cfg.MCPToolTimeout))
+	authKeys := []string{cfg.MCPAPIKey}
+	principalKeys := map[string]string{}
+	for _, inst := range cfg.Instances {
+		if inst.MCPAPIKey != "" {
+			authKeys = append(authKeys, inst.MCPAPIKey)
+			principalKeys[inst.MCPAPIKey] = inst.Name
+		}
+	}
+	if len(principalKeys) > 0 {
+		serverOpts = append(serverOpts, mcpserver.WithPrincipalKeys(principalKeys))
+	}
+	var (
+		itportalClient *itportal.Client
+		docCache       *cache.Cache
+		caches         []*cache.Cache
+	)
+	for i, inst := range cfg.Instances {
+		instLogger := logger.With("instance", inst.Name)
+		client := itportal.NewClient(inst.BaseURL, inst.APIKey,
+			itportal.WithAPIVersion(inst.APIVersion),
+			itportal.WithEncryptionKey(inst.EncryptionKey),
+			itportal.WithSubResourceLimits(cfg.SubResourceLimits),
+			itportal.WithLogger(instLogger),
+			itportal.WithTotalHeader(cfg.ITPortalTotalHeader),
+			itportal.WithPagination(cfg.ITPortalPagination),
+			itportal.WithUserAgent(userAgent),
+			itportal.WithTLSConfig(tlsConfig),
+			itportal.WithReferenceTTL(cfg.ITPortalReferenceTTL),
+			itportal.WithProxyURL(cfg.ITPortalProxyURL),
+			itportal.WithIdempotencyHeader(cfg.ITPortalIdempotencyHeader),
+		)
+
+		instLogger.Info("building initial documentation snapshot — this may take a moment…")
+		cacheOpts := []cache.Option{
+			cache.WithTypeLimits(cfg.SnapshotTypeLimits),
+			cache.WithStartupTimeout(cfg.SnapshotStartupTimeout),
+			cache.WithMaxStaleness(cfg.SnapshotMaxStaleness, cfg.SnapshotRefreshOnStale),
+		}
+		if cfg.SnapshotStartupNonBlock {
+			cacheOpts = append(cacheOpts, cache.WithNonBlockingStartup())
+		}
+		if cfg.SnapshotMergeWrites {
+			cacheOpts = append(cacheOpts, cache.WithWriteMerge())
+		}
+		if cfg.SnapshotStableBody {
+			cacheOpts = append(cacheOpts, cache.WithStableBody())
+		}
+		if cfg.SnapshotEmptySections {
+			cacheOpts = append(cacheOpts, cache.WithEmptySections())
+		}
+		if cfg.SnapshotFailureThreshold > 0 {
+			cacheOpts = append(cacheOpts, cache.WithFailureThreshold(cfg.SnapshotFailureThreshold))
+		}
+		if i > 0 {
+			cacheOpts = append(cacheOpts, cache.WithStorePath(cache.InstanceStorePath(inst.Name)))
+		}
+		c, err := cache.New(ctx, client, cfg.SnapshotLimitPerEntity, cfg.SnapshotDeviceLimit, cfg.SnapshotRefreshInterval, instLogger, cacheOpts...)
+		if err != nil {
+			instLogger.Error("failed to build initial documentation snapshot", "error", err)
+			os.Exit(1)
+		}
+		c.StartBackgroundRefresh(ctx)
+		caches = append(caches, c)
+
+		if i == 0 {
+			itportalClient, docCache = client, c
+			continue
+		}
+		serverOpts = append(serverOpts, mcpserver.WithInstance(inst.Name, client, c))
+	}
 
 	// Build MCP server.
-	server := mcpserver.NewServer(itportalClient, docCache)
+	if cfg.NormalizePhones {
+		serverOpts = append(serverOpts, mcpserver.WithPhoneNormalization(cfg.PhoneCountryCode))
+	}
+	if cfg.DefaultCompanyID != 0 {
+		serverOpts = append(serverOpts, mcpserver.WithDefaultCompany(cfg.DefaultCompanyID))
+	}
+	server := mcpserver.NewServer(itportalClient, docCache, serverOpts...)
 
 	// Wrap the streamable-HTTP handler with API key authentication.
 	mcpHandler := sdkmcp.NewStreamableHTTPHandler(func(_ *http.Request) *sdkmcp.Server {
 		return server
 	}, nil)
 
-	authHandler := apiKeyMiddleware(cfg.MCPAPIKey, mcpHandler, logger)
+	authHandler := apiKeyMiddleware(authKeys, mcpHandler, logger)
 
-	// Unauthenticated readiness probe (for container healthchecks / mcpo gating).
-	// Reachable only once the initial snapshot is built and the server is listening.
+	// Unauthenticated liveness probe (for container healthchecks / mcpo gating):
+	// 200 as soon as the server is listening, even before the first snapshot
+	// when SNAPSHOT_STARTUP_NONBLOCKING is set. /readyz below reports readiness.
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	// Readiness: 503 until every instance has a real snapshot (only differs from
+	// /healthz with SNAPSHOT_STARTUP_NONBLOCKING), and while any instance's
+	// refreshes keep failing (SNAPSHOT_FAILURE_THRESHOLD).
+	mux.HandleFunc("/readyz", readyz(caches))
 	mux.Handle("/", authHandler)
 
 	httpServer := &http.Server{
@@ -81,16 +191,20 @@ func main() {
 		defer close(shutdownDone)
 		<-ctx.Done()
 		logger.Info("shutdown signal received")
-		if err := httpServer.Shutdown(context.Background()); err != nil {
-			logger.Error("HTTP server shutdown error", "error", err)
-		}
+		shutdown(httpServer, drainer, cfg.MCPShutdownTimeout, logger)
 	}()
 
 	logger.Info("ITPortal MCP server starting",
+		"version", version,
 		"addr", cfg.ListenAddr,
 		"snapshot_refresh_interval", cfg.SnapshotRefreshInterval.String(),
 		"snapshot_limit_per_entity", cfg.SnapshotLimitPerEntity,
 		"snapshot_device_limit", cfg.SnapshotDeviceLimit,
+		"snapshot_type_limits", cfg.SnapshotTypeLimits,
+		"readonly", cfg.MCPReadOnly,
+		"write_allowed_entities", cfg.MCPWriteAllowedEntities,
+		"raw_request", cfg.EnableRawRequest,
+		"shutdown_timeout", cfg.MCPShutdownTimeout.String(),
 	)
 	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Error("HTTP server error", "error", err)
@@ -101,20 +215,72 @@ func main() {
 	logger.Info("server stopped")
 }
 
-// apiKeyMiddleware enforces shared-secret authentication on all requests. The
+// shutdown stops srv accepting connections, waits up to timeout for in-flight
+// tool calls to finish, then closes the connections still open. Streamable-HTTP
+// sessions hold long-lived streams that never go idle, so waiting for idle
+// connections alone would never return.
+func shutdown(srv *http.Server, d *mcpserver.Drainer, timeout time.Duration, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- srv.Shutdown(ctx) }()
+
+	awaited, err := d.Wait(ctx)
+	if err != nil {
+		logger.Warn("shutdown timeout reached; abandoning running tool calls",
+			"awaited", awaited, "still_running", d.InFlight(), "timeout", timeout.String())
+	} else {
+		logger.Info("in-flight tool calls drained", "awaited", awaited)
+	}
+	if err := srv.Close(); err != nil {
+		logger.Error("HTTP server close error", "error", err)
+	}
+	if err := <-stopped; err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		logger.Error("HTTP server shutdown error", "error", err)
+	}
+}
+
+// readyz answers 503 while any cache has no real snapshot yet or is degraded by
+// repeated refresh failures, and 200 otherwise.
+func readyz(caches []*cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		for _, c := range caches {
+			if !c.Ready() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("snapshot not ready"))
+				return
+			}
+			if c.Degraded() {
+				h := c.RefreshHealth()
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = fmt.Fprintf(w, "degraded: %d consecutive snapshot refreshes failed; last error: %s", h.ConsecutiveFailures, h.LastError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready"))
+	}
+}
+
+// apiKeyMiddleware enforces shared-secret authentication on all requests,
+// accepting any of keys: MCP_API_KEY and the per-instance principal keys. The
 // secret may be presented as "Authorization: Bearer <key>", a raw "Authorization:
 // <key>", or "X-API-Key: <key>" — gateways (LiteLLM, etc.) forward credentials in
 // different shapes, so all common forms are accepted.
-func apiKeyMiddleware(expectedKey string, next http.Handler, logger *slog.Logger) http.Handler {
-	expected := []byte(expectedKey)
+func apiKeyMiddleware(keys []string, next http.Handler, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := extractAPIToken(r)
+		token := mcpserver.APIToken(r.Header)
 		if token == "" {
 			logger.Warn("missing API credential", "remote", r.RemoteAddr)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		if subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+		matched := 0
+		for _, k := range keys {
+			matched |= subtle.ConstantTimeCompare([]byte(token), []byte(k))
+		}
+		if matched != 1 {
 			logger.Warn("invalid API key", "remote", r.RemoteAddr)
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
@@ -122,17 +288,3 @@ func apiKeyMiddleware(expectedKey string, next http.Handler, logger *slog.Logger
 		next.ServeHTTP(w, r)
 	})
 }
-
-// extractAPIToken pulls the shared secret from the Authorization or X-API-Key header.
-func extractAPIToken(r *http.Request) string {
-	if h := strings.TrimSpace(r.Header.Get("Authorization")); h != "" {
-		if len(h) >= 7 && strings.EqualFold(h[:7], "Bearer ") {
-			return strings.TrimSpace(h[7:])
-		}
-		return h // raw token without a scheme
-	}
-	if h := strings.TrimSpace(r.Header.Get("X-API-Key")); h != "" {
-		return h
-	}
-	return ""
-}
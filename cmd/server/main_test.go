@@ -1,16 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+	mcpserver "github.com/alexfirilov/itportal-mcp/internal/mcp"
 )
 
 func TestApiKeyMiddleware(t *testing.T) {
 	const key = "s3cret-key"
 	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
-	h := apiKeyMiddleware(key, next, slog.New(slog.DiscardHandler))
+	h := apiKeyMiddleware([]string{"other-key", key}, next, slog.New(slog.DiscardHandler))
 
 	cases := []struct {
 		name   string
@@ -37,3 +49,117 @@ func TestApiKeyMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// TestShutdownWaitsForSlowToolCall simulates a write that is still talking to
+// ITPortal when SIGTERM arrives: shutdown must let it finish and report it.
+func TestShutdownWaitsForSlowToolCall(t *testing.T) {
+	drainer := mcpserver.NewDrainer(time.Second)
+	started := make(chan struct{})
+	var wrote atomic.Bool
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, done, err := drainer.Track(r.Context())
+		if err != nil {
+			t.Errorf("Track: %v", err)
+			return
+		}
+		defer done()
+		close(started)
+		select {
+		case <-time.After(300 * time.Millisecond):
+			wrote.Store(true)
+		case <-ctx.Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String()+"/", "application/json", nil)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	var logs bytes.Buffer
+	shutdown(srv, drainer, 5*time.Second, slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if !wrote.Load() {
+		t.Error("shutdown cut the in-flight call off before it finished")
+	}
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want 200", got)
+	}
+	if !strings.Contains(logs.String(), "in-flight tool calls drained") || !strings.Contains(logs.String(), "awaited=1") {
+		t.Errorf("drain not logged: %q", logs.String())
+	}
+}
+
+// TestShutdownGivesUpAfterTimeout checks a call outliving the timeout does not
+// hold the process up.
+func TestShutdownGivesUpAfterTimeout(t *testing.T) {
+	drainer := mcpserver.NewDrainer(0)
+	_, done, err := drainer.Track(context.Background())
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	defer done()
+
+	srv := &http.Server{Handler: http.NotFoundHandler()}
+	var logs bytes.Buffer
+	start := time.Now()
+	shutdown(srv, drainer, 50*time.Millisecond, slog.New(slog.NewTextHandler(&logs, nil)))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("shutdown took %v with a 50ms timeout", elapsed)
+	}
+	if !strings.Contains(logs.String(), "still_running=1") {
+		t.Errorf("abandoned call not logged: %q", logs.String())
+	}
+}
+
+func TestReadyzReportsDegradedCache(t *testing.T) {
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[]}}`))
+	}))
+	defer srv.Close()
+	c, err := cache.New(context.Background(), itportal.NewClient(srv.URL, "k"), 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cache.WithStorePath(filepath.Join(t.TempDir(), "s.db")), cache.WithFailureThreshold(2))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	probe := func() (int, string) {
+		rec := httptest.NewRecorder()
+		readyz([]*cache.Cache{c})(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, _ := probe(); code != http.StatusOK {
+		t.Fatalf("healthy cache: /readyz = %d", code)
+	}
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		_, _ = c.Refresh(context.Background())
+	}
+	if code, body := probe(); code != http.StatusServiceUnavailable || !strings.Contains(body, "degraded: 2 consecutive") {
+		t.Errorf("after 2 failures: /readyz = %d %q", code, body)
+	}
+	failing.Store(false)
+	_, _ = c.Refresh(context.Background())
+	if code, body := probe(); code != http.StatusOK {
+		t.Errorf("after recovery: /readyz = %d %q", code, body)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/alexfirilov/itportal-mcp
 go 1.25.0
 
 require (
+	github.com/google/jsonschema-go v0.3.0
 	github.com/joho/godotenv v1.5.1
 	github.com/modelcontextprotocol/go-sdk v1.2.0
 	github.com/yuin/goldmark v1.7.8
@@ -12,7 +13,6 @@ require (
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
-	github.com/google/jsonschema-go v0.3.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/ncruces/go-strftime v1.0.0 // indirect
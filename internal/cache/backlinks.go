@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"sort"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// Backlink is one cached entity that references another, and the reference
+// field it does so through ("company", "site", "facility", "cabinet" or
+// "device").
+type Backlink struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Via  string `json:"via"`
+}
+
+type entityKey struct {
+	typ string
+	id  int
+}
+
+// backlinkIndex maps each referenced entity to the entities referencing it.
+type backlinkIndex map[entityKey][]Backlink
+
+// Backlinks returns the cached entities referencing the entity of itemType with
+// the given ID, ordered by type then name. It is nil when nothing references it.
+func (s *Snapshot) Backlinks(itemType string, id int) []Backlink {
+	idx := s.backlinks
+	if idx == nil {
+		idx = buildBacklinks(s)
+	}
+	return idx[entityKey{itemType, id}]
+}
+
+// buildBacklinks indexes every company, site, facility, cabinet and device
+// reference held by the snapshot's entities.
+func buildBacklinks(s *Snapshot) backlinkIndex {
+	idx := backlinkIndex{}
+	add := func(from Backlink, toType string, toID int) {
+		if toID == 0 {
+			return
+		}
+		k := entityKey{toType, toID}
+		idx[k] = append(idx[k], from)
+	}
+	// refs records from's references; ids are given in via order.
+	refs := func(typ string, id int, name string, company, site, facility, cabinet, device int) {
+		for _, r := range []struct {
+			via string
+			id  int
+		}{{"company", company}, {"site", site}, {"facility", facility}, {"cabinet", cabinet}, {"device", device}} {
+			add(Backlink{Type: typ, ID: id, Name: name, Via: r.via}, r.via, r.id)
+		}
+	}
+
+	for _, si := range s.Sites {
+		refs("site", si.ID, si.Name, refID(si.Company), 0, 0, 0, 0)
+	}
+	for _, d := range s.Devices {
+		refs("device", d.ID, d.Name, refID(d.Company), refID(d.Site), refID(d.Facility), refID(d.Cabinet), 0)
+	}
+	for _, kb := range s.KBs {
+		refs("kb", kb.ID, kb.Name, refID(kb.Company), 0, 0, 0, 0)
+	}
+	for _, c := range s.Contacts {
+		refs("contact", c.ID, contactName(&c), refID(c.Company), refID(c.Site), 0, 0, 0)
+	}
+	for _, ag := range s.Agreements {
+		refs("agreement", ag.ID, agreementName(&ag), refID(ag.Company), refID(ag.Site), 0, 0, 0)
+	}
+	for _, n := range s.IPNetworks {
+		refs("ipnetwork", n.ID, n.Name, refID(n.Company), refID(n.Site), 0, 0, 0)
+	}
+	for _, doc := range s.Documents {
+		refs("document", doc.ID, documentName(&doc), refID(doc.Company), 0, 0, 0, 0)
+	}
+	for _, ac := range s.Accounts {
+		refs("account", ac.ID, accountName(&ac), refID(ac.Company), 0, 0, 0, 0)
+	}
+	for _, f := range s.Facilities {
+		refs("facility", f.ID, f.Name, refID(f.Company), refID(f.Site), 0, 0, 0)
+	}
+	for _, cab := range s.Cabinets {
+		refs("cabinet", cab.ID, cab.Name, refID(cab.Company), refID(cab.Site), refID(cab.Facility), 0, 0)
+	}
+	for _, cfg := range s.Configurations {
+		refs("configuration", cfg.ID, cfg.Name, refID(cfg.Company), 0, 0, 0, refID(cfg.Device))
+	}
+
+	order := make(map[string]int, len(entityKinds))
+	for i, k := range entityKinds {
+		order[k] = i
+	}
+	for _, links := range idx {
+		sort.SliceStable(links, func(i, j int) bool {
+			if links[i].Type != links[j].Type {
+				return order[links[i].Type] < order[links[j].Type]
+			}
+			return links[i].Name < links[j].Name
+		})
+	}
+	return idx
+}
+
+// refID returns the ID a reference field points at, or 0 when it is unset.
+func refID(ref any) int {
+	switch r := ref.(type) {
+	case *itportal.CompanyReference:
+		if r != nil {
+			return r.ID
+		}
+	case *itportal.SiteReference:
+		if r != nil {
+			return r.ID
+		}
+	case *itportal.FacilityReference:
+		if r != nil {
+			return r.ID
+		}
+	case *itportal.CabinetReference:
+		if r != nil {
+			return r.ID
+		}
+	case *itportal.DeviceReference:
+		if r != nil {
+			return r.ID
+		}
+	}
+	return 0
+}
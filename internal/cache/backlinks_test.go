@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestBacklinksFindSiteDevices(t *testing.T) {
+	snap := sampleSnapshot()
+	snap.Devices = append(snap.Devices, itportal.Device{ID: 102, Name: "ap-lobby",
+		Site: &itportal.SiteReference{ID: 10}, Cabinet: &itportal.CabinetReference{ID: 900}})
+	snap.Contacts[0].Site = &itportal.SiteReference{ID: 10}
+	snap.backlinks = buildBacklinks(snap)
+
+	got := snap.Backlinks("site", 10)
+	want := []Backlink{
+		{Type: "device", ID: 102, Name: "ap-lobby", Via: "site"},
+		{Type: "device", ID: 100, Name: "fw01", Via: "site"},
+		{Type: "contact", ID: 300, Name: "Ada Byte", Via: "site"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("site 10 backlinks = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("backlink %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBacklinksOtherReferenceFields(t *testing.T) {
+	snap := sampleSnapshot()
+	cases := []struct {
+		typ  string
+		id   int
+		want Backlink
+	}{
+		{"facility", 800, Backlink{Type: "cabinet", ID: 900, Name: "Rack-A1", Via: "facility"}},
+		{"device", 100, Backlink{Type: "configuration", ID: 1000, Name: "fw01-baseline", Via: "device"}},
+		{"company", 1, Backlink{Type: "site", ID: 10, Name: "Acme HQ", Via: "company"}},
+	}
+	for _, c := range cases {
+		found := false
+		for _, b := range snap.Backlinks(c.typ, c.id) {
+			found = found || b == c.want
+		}
+		if !found {
+			t.Errorf("%s %d backlinks %+v lack %+v", c.typ, c.id, snap.Backlinks(c.typ, c.id), c.want)
+		}
+	}
+	if got := snap.Backlinks("company", 2); len(got) != 0 {
+		t.Errorf("unreferenced company has backlinks: %+v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+)
+
+// ContactMatch is one ranked hit returned by SearchContacts.
+type ContactMatch struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Company string `json:"company,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+	Matched string `json:"matched"`
+	Score   int    `json:"score"`
+	URL     string `json:"url,omitempty"`
+}
+
+// SearchContacts matches query against the cached contacts' first/last name,
+// email, phone numbers and notes. Each contact is scored by its best-matching
+// field: an exact match outranks a prefix, which outranks a substring, and
+// identity fields (name, email, phone) outrank notes. Phone numbers compare on
+// digits only, so "555-0100" finds "(555) 0100". Results are ordered by score,
+// then name. limit <= 0 applies a sane default.
+func (s *Snapshot) SearchContacts(query string, limit int) []ContactMatch {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return nil
+	}
+	if limit <= 0 {
+		limit = 25
+	}
+	// Only phone-shaped queries are compared against phone numbers, so the
+	// digits in an email address or name don't produce spurious phone hits.
+	qDigits := ""
+	if strings.Trim(q, "0123456789 +-.()/") == "" {
+		qDigits = digitsOnly(q)
+	}
+
+	var out []ContactMatch
+	for i := range s.Contacts {
+		c := &s.Contacts[i]
+		best, field := 0, ""
+		consider := func(name string, score int) {
+			if score > best {
+				best, field = score, name
+			}
+		}
+
+		for _, f := range []struct {
+			name, val string
+		}{
+			{"name", c.FullName()},
+			{"firstName", c.FirstName},
+			{"lastName", c.LastName},
+			{"email", c.Email},
+		} {
+			consider(f.name, 10*textScore(q, f.val))
+		}
+		// Require a few digits so short numeric queries don't match every phone.
+		if len(qDigits) >= 4 {
+			for _, f := range []struct {
+				name, val string
+			}{
+				{"directNumber", c.DirectNumber},
+				{"mobile", c.Mobile},
+				{"homePhone", c.HomePhone},
+				{"directFax", c.DirectFax},
+			} {
+				consider(f.name, 10*textScore(qDigits, digitsOnly(f.val)))
+			}
+		}
+		consider("notes", textScore(q, c.Notes))
+
+		if best == 0 {
+			continue
+		}
+		_, company := companyRef(c.Company)
+		out = append(out, ContactMatch{
+			ID:      c.ID,
+			Name:    contactName(c),
+			Company: company,
+			Email:   c.Email,
+			Phone:   FirstNonEmpty(c.DirectNumber, c.Mobile, c.HomePhone),
+			Matched: field,
+			Score:   best,
+			URL:     c.URL,
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// textScore rates how well the lower-cased query q matches val: 3 exact,
+// 2 prefix, 1 substring, 0 no match.
+func textScore(q, val string) int {
+	v := strings.ToLower(strings.TrimSpace(val))
+	switch {
+	case v == "" || q == "":
+		return 0
+	case v == q:
+		return 3
+	case strings.HasPrefix(v, q):
+		return 2
+	case strings.Contains(v, q):
+		return 1
+	}
+	return 0
+}
+
+// digitsOnly strips everything but ASCII digits from s.
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"slices"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// Changed is one snapshot entity whose Modified timestamp falls after a cutoff.
+type Changed struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Modified string `json:"modified"`
+	URL      string `json:"url,omitempty"`
+	at       time.Time
+}
+
+// ModifiedSince returns the entities of s modified after since, keyed by
+// snapshotCounts section and ordered oldest change first. Sections without
+// changes are left out; entities with a blank or unreadable Modified are
+// skipped.
+func (s *Snapshot) ModifiedSince(since time.Time) map[string][]Changed {
+	out := map[string][]Changed{}
+	changedIn(out, "companies", s.Companies, since, func(v *itportal.Company) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "sites", s.Sites, since, func(v *itportal.Site) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "devices", s.Devices, since, func(v *itportal.Device) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "kbs", s.KBs, since, func(v *itportal.KB) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "contacts", s.Contacts, since, func(v *itportal.Contact) Changed {
+		return Changed{ID: v.ID, Name: v.FullName(), Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "agreements", s.Agreements, since, func(v *itportal.Agreement) Changed {
+		return Changed{ID: v.ID, Name: v.Description, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "ip_networks", s.IPNetworks, since, func(v *itportal.IPNetwork) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "documents", s.Documents, since, func(v *itportal.Document) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "accounts", s.Accounts, since, func(v *itportal.Account) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "facilities", s.Facilities, since, func(v *itportal.Facility) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "cabinets", s.Cabinets, since, func(v *itportal.Cabinet) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	changedIn(out, "configurations", s.Configurations, since, func(v *itportal.Configuration) Changed {
+		return Changed{ID: v.ID, Name: v.Name, Modified: v.Modified, URL: v.URL}
+	})
+	return out
+}
+
+// changedIn adds the items of list modified after since to out[section].
+func changedIn[T any](out map[string][]Changed, section string, list []T, since time.Time, row func(*T) Changed) {
+	var changed []Changed
+	for i := range list {
+		c := row(&list[i])
+		at, ok := ParseTimestamp(c.Modified)
+		if !ok || !at.After(since) {
+			continue
+		}
+		c.at = at
+		changed = append(changed, c)
+	}
+	if len(changed) == 0 {
+		return
+	}
+	slices.SortStableFunc(changed, func(a, b Changed) int { return a.at.Compare(b.at) })
+	out[section] = changed
+}
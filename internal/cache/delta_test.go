@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestModifiedSinceKeepsTimeOfDay(t *testing.T) {
+	snap := &Snapshot{
+		Sites: []itportal.Site{
+			{ID: 1, Name: "morning", Modified: "2025-03-01 08:00:00"},
+			{ID: 2, Name: "evening", Modified: "2025-03-01T18:30:00+01:00"},
+			{ID: 3, Name: "next day", Modified: "2025-03-02"},
+			{ID: 4, Name: "garbled", Modified: "soon"},
+		},
+		Contacts: []itportal.Contact{{ID: 7, FirstName: "Ada", LastName: "Byte", Modified: "2025-02-28"}},
+	}
+	got := snap.ModifiedSince(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	sites := got["sites"]
+	if len(got) != 1 || len(sites) != 2 || sites[0].ID != 2 || sites[1].ID != 3 {
+		t.Errorf("changes = %+v, want sites 2 then 3 only", got)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RefreshHealth tracks failed snapshot builds since the last successful one.
+type RefreshHealth struct {
+	ConsecutiveFailures int
+	LastError           string
+	LastErrorAt         time.Time
+}
+
+// WithFailureThreshold marks the cache Degraded once n snapshot builds in a row
+// have failed. n <= 0 never marks it degraded; failures are still tracked.
+func WithFailureThreshold(n int) Option {
+	return func(c *Cache) { c.failureThreshold = n }
+}
+
+// RefreshHealth reports the failed builds since the last successful one.
+func (c *Cache) RefreshHealth() RefreshHealth {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	return c.health
+}
+
+// Degraded reports whether consecutive build failures have reached the
+// WithFailureThreshold limit. The last good snapshot is still served.
+func (c *Cache) Degraded() bool {
+	if c.failureThreshold <= 0 {
+		return false
+	}
+	return c.RefreshHealth().ConsecutiveFailures >= c.failureThreshold
+}
+
+// recordBuild updates the refresh health with the outcome of one build. A build
+// cancelled by shutdown says nothing about the portal and is not counted.
+func (c *Cache) recordBuild(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	if err == nil {
+		c.health = RefreshHealth{}
+		return
+	}
+	c.health.ConsecutiveFailures++
+	c.health.LastError = err.Error()
+	c.health.LastErrorAt = time.Now().UTC()
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestRepeatedRefreshFailuresDegradeCache verifies failed builds are counted,
+// mark the cache degraded at the threshold, and reset on the next success.
+func TestRepeatedRefreshFailuresDegradeCache(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	WithFailureThreshold(3)(c)
+	good := c.Get()
+
+	s.failing.Store(true)
+	for i := 1; i <= 3; i++ {
+		if _, err := c.Refresh(context.Background()); err == nil {
+			t.Fatalf("refresh %d succeeded against a failing server", i)
+		}
+		h := c.RefreshHealth()
+		if h.ConsecutiveFailures != i || !strings.Contains(h.LastError, "boom") || h.LastErrorAt.IsZero() {
+			t.Errorf("after %d failures health = %+v", i, h)
+		}
+		if want := i >= 3; c.Degraded() != want {
+			t.Errorf("after %d failures Degraded = %v, want %v", i, c.Degraded(), want)
+		}
+	}
+	if c.Get() != good {
+		t.Error("failed refreshes replaced the last good snapshot")
+	}
+
+	s.failing.Store(false)
+	if _, err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if h := c.RefreshHealth(); h.ConsecutiveFailures != 0 || h.LastError != "" || c.Degraded() {
+		t.Errorf("after a success health = %+v, degraded = %v", h, c.Degraded())
+	}
+}
+
+// TestCancelledBuildIsNotARefreshFailure verifies a build cut short by
+// shutdown leaves the refresh health alone.
+func TestCancelledBuildIsNotARefreshFailure(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	WithFailureThreshold(1)(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.lifetime = ctx
+	cancel()
+
+	if _, err := c.Refresh(context.Background()); err == nil {
+		t.Fatal("refresh succeeded after shutdown")
+	}
+	if h := c.RefreshHealth(); h.ConsecutiveFailures != 0 || c.Degraded() {
+		t.Errorf("health = %+v, degraded = %v; want a cancelled build ignored", h, c.Degraded())
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"strings"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// Lifecycle is a device's derived lifecycle state.
+type Lifecycle string
+
+const (
+	LifecycleActive          Lifecycle = "Active"
+	LifecycleRetired         Lifecycle = "Retired"
+	LifecycleLeaseEnded      Lifecycle = "Lease ended"
+	LifecycleWarrantyExpired Lifecycle = "Warranty expired"
+)
+
+// Lifecycles lists every state, most final first.
+var Lifecycles = []Lifecycle{LifecycleRetired, LifecycleLeaseEnded, LifecycleWarrantyExpired, LifecycleActive}
+
+// DeviceLifecycle derives d's lifecycle state as of now. The most final state
+// wins: a device marked out (inOut false) or past its retire date is Retired,
+// then one past its lease end is Lease ended, then one past its warranty is
+// Warranty expired. Anything else, including a device with no dates, is Active.
+// A date counts as passed from the day after it.
+func DeviceLifecycle(d itportal.Device, now time.Time) Lifecycle {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	passed := func(s string) bool {
+		t, ok := ParseDate(s)
+		return ok && t.Before(today)
+	}
+	switch {
+	case (d.InOut != nil && !*d.InOut) || passed(d.RetireDate):
+		return LifecycleRetired
+	case passed(d.LeaseEndDate):
+		return LifecycleLeaseEnded
+	case passed(d.WarrantyExpires):
+		return LifecycleWarrantyExpired
+	}
+	return LifecycleActive
+}
+
+// DeviceLifecycle returns the lifecycle state of the cached device with the
+// given ID as of the snapshot's build, or "" when no such device is cached.
+func (s *Snapshot) DeviceLifecycle(id int) Lifecycle {
+	if l, ok := s.lifecycles[id]; ok {
+		return l
+	}
+	for _, d := range s.Devices {
+		if d.ID == id {
+			return s.lifecycleOf(d)
+		}
+	}
+	return ""
+}
+
+// lifecycleOf returns d's precomputed state, deriving it when the snapshot was
+// not built with one.
+func (s *Snapshot) lifecycleOf(d itportal.Device) Lifecycle {
+	if l, ok := s.lifecycles[d.ID]; ok {
+		return l
+	}
+	return DeviceLifecycle(d, s.GeneratedAt)
+}
+
+// buildLifecycles derives every cached device's state as of the snapshot's
+// build, so the Markdown stays the same until the next rebuild.
+func buildLifecycles(s *Snapshot) map[int]Lifecycle {
+	out := make(map[int]Lifecycle, len(s.Devices))
+	for _, d := range s.Devices {
+		out[d.ID] = DeviceLifecycle(d, s.GeneratedAt)
+	}
+	return out
+}
+
+// dateLayouts are the date formats accepted from ITPortal date fields, which
+// are usually YYYY-MM-DD but may carry a time or come from manual imports.
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006/01/02",
+	"01/02/2006",
+	"02.01.2006",
+}
+
+// ParseDate parses s as a calendar date (UTC midnight) in any of dateLayouts.
+// It reports false for blank or unrecognised values.
+func ParseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timestampLayouts are the Modified forms ParseTimestamp reads with their time
+// of day; zone-less ones are taken as UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+// ParseTimestamp parses a Modified-style timestamp, keeping its time of day.
+// Date-only values fall back to ParseDate (UTC midnight).
+func ParseTimestamp(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return ParseDate(s)
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestDeviceLifecycle(t *testing.T) {
+	now := time.Date(2026, 6, 15, 14, 0, 0, 0, time.UTC)
+	out, in := false, true
+	cases := []struct {
+		name string
+		d    itportal.Device
+		want Lifecycle
+	}{
+		{"no dates", itportal.Device{}, LifecycleActive},
+		{"all dates ahead", itportal.Device{RetireDate: "2027-01-01", LeaseEndDate: "2026-12-31", WarrantyExpires: "2026-07-01"}, LifecycleActive},
+		{"warranty ends today", itportal.Device{WarrantyExpires: "2026-06-15"}, LifecycleActive},
+		{"checked in", itportal.Device{InOut: &in}, LifecycleActive},
+		{"unparseable date", itportal.Device{RetireDate: "soon"}, LifecycleActive},
+		{"warranty passed", itportal.Device{WarrantyExpires: "2026-06-14", LeaseEndDate: "2027-01-01"}, LifecycleWarrantyExpired},
+		{"lease passed", itportal.Device{LeaseEndDate: "2026-01-31T00:00:00Z", WarrantyExpires: "2025-01-01"}, LifecycleLeaseEnded},
+		{"retire passed", itportal.Device{RetireDate: "01/31/2026", LeaseEndDate: "2025-01-01", WarrantyExpires: "2025-01-01"}, LifecycleRetired},
+		{"marked out", itportal.Device{InOut: &out, RetireDate: "2030-01-01"}, LifecycleRetired},
+	}
+	for _, tc := range cases {
+		if got := DeviceLifecycle(tc.d, now); got != tc.want {
+			t.Errorf("%s: DeviceLifecycle = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBuildMarkdownShowsLifecycle(t *testing.T) {
+	snap := &Snapshot{
+		GeneratedAt: time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC),
+		Devices: []itportal.Device{
+			{ID: 1, Name: "old-nas", RetireDate: "2025-12-31"},
+			{ID: 2, Name: "new-fw"},
+		},
+	}
+	snap.lifecycles = buildLifecycles(snap)
+	md := buildMarkdown(snap)
+	for _, want := range []string{"- **Lifecycle**: Retired", "- **Lifecycle**: Active"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q", want)
+		}
+	}
+	if got := snap.DeviceLifecycle(1); got != LifecycleRetired {
+		t.Errorf("DeviceLifecycle(1) = %q", got)
+	}
+	if got := snap.DeviceLifecycle(99); got != "" {
+		t.Errorf("DeviceLifecycle(missing) = %q, want empty", got)
+	}
+}
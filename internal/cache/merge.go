@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// WithWriteMerge makes Upsert and Remove patch the current snapshot, so records
+// created, updated or deleted through the server show up in search and the
+// resources immediately instead of after the next refresh.
+func WithWriteMerge() Option {
+	return func(c *Cache) { c.mergeWrites = true }
+}
+
+// MergesWrites reports whether Upsert and Remove are enabled.
+func (c *Cache) MergesWrites() bool {
+	return c.mergeWrites
+}
+
+// Upsert inserts v (a pointer to a snapshot entity type such as
+// *itportal.Device) into the current snapshot, replacing any record with the
+// same ID, then re-renders the Markdown and rebuilds the store. It reports
+// false when write merging is off or v is not a snapshot type. The next full
+// refresh supersedes the merged record.
+func (c *Cache) Upsert(v any) bool {
+	if !c.mergeWrites {
+		return false
+	}
+	return c.mutate(func(s *Snapshot) bool {
+		base := c.portalBaseURL
+		switch e := v.(type) {
+		case *itportal.Company:
+			r := *e
+			setURL(&r.URL, base, "company", r.ID)
+			s.Companies = upsertByID(s.Companies, r, func(x *itportal.Company) int { return x.ID })
+		case *itportal.Site:
+			r := *e
+			setURL(&r.URL, base, "site", r.ID)
+			s.Sites = upsertByID(s.Sites, r, func(x *itportal.Site) int { return x.ID })
+		case *itportal.Device:
+			r := *e
+			setURL(&r.URL, base, "device", r.ID)
+			s.Devices = upsertByID(s.Devices, r, func(x *itportal.Device) int { return x.ID })
+		case *itportal.KB:
+			r := *e
+			setURL(&r.URL, base, "kb", r.ID)
+			s.KBs = upsertByID(s.KBs, r, func(x *itportal.KB) int { return x.ID })
+		case *itportal.Contact:
+			r := *e
+			setURL(&r.URL, base, "contact", r.ID)
+			s.Contacts = upsertByID(s.Contacts, r, func(x *itportal.Contact) int { return x.ID })
+		case *itportal.Agreement:
+			r := *e
+			setURL(&r.URL, base, "agreement", r.ID)
+			s.Agreements = upsertByID(s.Agreements, r, func(x *itportal.Agreement) int { return x.ID })
+		case *itportal.IPNetwork:
+			r := *e
+			setURL(&r.URL, base, "ipnetwork", r.ID)
+			s.IPNetworks = upsertByID(s.IPNetworks, r, func(x *itportal.IPNetwork) int { return x.ID })
+		case *itportal.Document:
+			r := *e
+			setURL(&r.URL, base, "document", r.ID)
+			s.Documents = upsertByID(s.Documents, r, func(x *itportal.Document) int { return x.ID })
+		case *itportal.Account:
+			r := *e
+			setURL(&r.URL, base, "account", r.ID)
+			s.Accounts = upsertByID(s.Accounts, r, func(x *itportal.Account) int { return x.ID })
+		case *itportal.Facility:
+			r := *e
+			setURL(&r.URL, base, "facility", r.ID)
+			s.Facilities = upsertByID(s.Facilities, r, func(x *itportal.Facility) int { return x.ID })
+		case *itportal.Cabinet:
+			r := *e
+			setURL(&r.URL, base, "cabinet", r.ID)
+			s.Cabinets = upsertByID(s.Cabinets, r, func(x *itportal.Cabinet) int { return x.ID })
+		case *itportal.Configuration:
+			r := *e
+			setURL(&r.URL, base, "configuration", r.ID)
+			s.Configurations = upsertByID(s.Configurations, r, func(x *itportal.Configuration) int { return x.ID })
+		default:
+			return false
+		}
+		return true
+	})
+}
+
+// Remove drops the record of entityType ("device", "ip_network", …) with the
+// given ID from the current snapshot. It reports whether a record was removed.
+func (c *Cache) Remove(entityType string, id int) bool {
+	if !c.mergeWrites {
+		return false
+	}
+	return c.mutate(func(s *Snapshot) bool {
+		var ok bool
+		switch strings.ToLower(strings.ReplaceAll(entityType, "_", "")) {
+		case "company":
+			s.Companies, ok = removeByID(s.Companies, id, func(x *itportal.Company) int { return x.ID })
+		case "site":
+			s.Sites, ok = removeByID(s.Sites, id, func(x *itportal.Site) int { return x.ID })
+		case "device":
+			s.Devices, ok = removeByID(s.Devices, id, func(x *itportal.Device) int { return x.ID })
+		case "kb", "knowledgebase":
+			s.KBs, ok = removeByID(s.KBs, id, func(x *itportal.KB) int { return x.ID })
+		case "contact":
+			s.Contacts, ok = removeByID(s.Contacts, id, func(x *itportal.Contact) int { return x.ID })
+		case "agreement":
+			s.Agreements, ok = removeByID(s.Agreements, id, func(x *itportal.Agreement) int { return x.ID })
+		case "ipnetwork":
+			s.IPNetworks, ok = removeByID(s.IPNetworks, id, func(x *itportal.IPNetwork) int { return x.ID })
+		case "document":
+			s.Documents, ok = removeByID(s.Documents, id, func(x *itportal.Document) int { return x.ID })
+		case "account":
+			s.Accounts, ok = removeByID(s.Accounts, id, func(x *itportal.Account) int { return x.ID })
+		case "facility":
+			s.Facilities, ok = removeByID(s.Facilities, id, func(x *itportal.Facility) int { return x.ID })
+		case "cabinet":
+			s.Cabinets, ok = removeByID(s.Cabinets, id, func(x *itportal.Cabinet) int { return x.ID })
+		case "configuration":
+			s.Configurations, ok = removeByID(s.Configurations, id, func(x *itportal.Configuration) int { return x.ID })
+		}
+		return ok
+	})
+}
+
+// mutate applies fn to a copy of the current snapshot and, when fn reports a
+// change, publishes the copy with fresh Markdown and store. Merges are
+// serialised with each other and with publish, so concurrent writes don't drop
+// each other's records and a merge never stores over a newer rebuild.
+func (c *Cache) mutate(fn func(*Snapshot) bool) bool {
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+	cur := c.current.Load()
+	if cur == nil {
+		return false
+	}
+	next := *cur
+	if !fn(&next) {
+		return false
+	}
+	next.lifecycles = buildLifecycles(&next)
+	next.Markdown = buildMarkdown(&next)
+	next.backlinks = buildBacklinks(&next)
+	c.current.Store(&next)
+	c.rebuildStore(&next)
+	return true
+}
+
+// upsertByID returns a copy of list with v replacing the element of the same ID,
+// or inserted before the first element with a higher ID when there is none, so
+// a list kept in ID order stays that way. list itself is left untouched because older
+// snapshots may still be read concurrently.
+func upsertByID[T any](list []T, v T, id func(*T) int) []T {
+	out := slices.Clone(list)
+	if i := slices.IndexFunc(out, func(x T) bool { return id(&x) == id(&v) }); i >= 0 {
+		out[i] = v
+		return out
+	}
+	at := slices.IndexFunc(out, func(x T) bool { return id(&x) > id(&v) })
+	if at < 0 {
+		at = len(out)
+	}
+	return slices.Insert(out, at, v)
+}
+
+// removeByID returns a copy of list without the element with the given ID.
+func removeByID[T any](list []T, target int, id func(*T) int) ([]T, bool) {
+	out := make([]T, 0, len(list))
+	for i := range list {
+		if id(&list[i]) != target {
+			out = append(out, list[i])
+		}
+	}
+	return out, len(out) != len(list)
+}
+
+func setURL(url *string, base, itemType string, id int) {
+	if *url == "" && base != "" {
+		*url = itportal.BuildPortalURL(base, itemType, id)
+	}
+}
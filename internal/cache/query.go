@@ -160,6 +160,42 @@ func (s *Store) byExactName(name, typ string, limit int) ([]SearchResult, error)
 	return s.scanResults(q, args...)
 }
 
+// SearchStemmed is Search followed, when it found fewer than limit hits, by a
+// keyword search that also matches the singular/plural form of each query word
+// ("switches" finds "switch", "battery" finds "batteries"). Search's own hits
+// stay first; stemmed hits are appended without duplicates.
+func (s *Store) SearchStemmed(query, typ string, limit int) ([]SearchResult, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	out, err := s.Search(query, typ, limit)
+	if err != nil || len(out) >= limit {
+		return out, err
+	}
+	match := buildStemmedMatch(query)
+	if match == "" {
+		return out, nil
+	}
+	extra, err := s.ftsMatch(match, typ, limit)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(out))
+	for _, r := range out {
+		seen[fmt.Sprintf("%s/%d", r.Type, r.ID)] = true
+	}
+	for _, r := range extra {
+		if len(out) >= limit {
+			break
+		}
+		if key := fmt.Sprintf("%s/%d", r.Type, r.ID); !seen[key] {
+			seen[key] = true
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
 // fts runs a full-text query. The raw query is sanitised into a safe FTS5 MATCH
 // expression (terms ANDed, each prefix-matched) unless the caller already passed
 // a quoted phrase.
@@ -168,6 +204,11 @@ func (s *Store) fts(query, typ string, limit int) ([]SearchResult, error) {
 	if match == "" {
 		return nil, nil
 	}
+	return s.ftsMatch(match, typ, limit)
+}
+
+// ftsMatch runs an already-built FTS5 MATCH expression.
+func (s *Store) ftsMatch(match, typ string, limit int) ([]SearchResult, error) {
 	args := []any{match}
 	q := `SELECT f.type, f.ref_id, f.name, f.summary, e.url,
 		snippet(entities_fts, 4, '[', ']', '…', 12) AS snip
@@ -241,6 +282,71 @@ func buildMatch(query string) string {
 	return strings.Join(terms, " AND ")
 }
 
+// buildStemmedMatch is buildMatch with each word that has a singular/plural
+// variant widened to also match that variant exactly, e.g. ("switches"* OR
+// "switch"). Variants are matched whole, not as prefixes, so "switches" does not
+// reach "switchboard". It returns "" when no word has a variant or the query is
+// an explicit phrase.
+func buildStemmedMatch(query string) string {
+	query = strings.TrimSpace(query)
+	if strings.HasPrefix(query, `"`) && strings.HasSuffix(query, `"`) && len(query) >= 2 {
+		return ""
+	}
+	fields := strings.FieldsFunc(query, func(r rune) bool {
+		return !(r == '.' || r == '-' || r == '_' || isAlphaNum(r))
+	})
+	terms := make([]string, 0, len(fields))
+	widened := false
+	for _, f := range fields {
+		f = strings.Trim(f, ".-_")
+		if f == "" {
+			continue
+		}
+		term := `"` + f + `"*`
+		if v := numberVariant(f); v != "" {
+			term = `(` + term + ` OR "` + v + `")`
+			widened = true
+		}
+		terms = append(terms, term)
+	}
+	if !widened {
+		return ""
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// numberVariant returns the singular of an English plural word, or the "-ies"
+// plural of a word ending in consonant+y (plain "-s"/"-es" plurals of a
+// singular are already reached by prefix matching). Words shorter than four
+// letters, containing digits or punctuation, or ending in -ss/-us/-is are left
+// alone so serials, hostnames and words like "status" don't drift. It returns
+// "" when w has no variant.
+func numberVariant(w string) string {
+	lw := strings.ToLower(w)
+	if len(lw) < 4 {
+		return ""
+	}
+	for _, r := range lw {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	switch {
+	case strings.HasSuffix(lw, "ss"), strings.HasSuffix(lw, "us"), strings.HasSuffix(lw, "is"):
+		return ""
+	case strings.HasSuffix(lw, "ies") && len(lw) > 4:
+		return lw[:len(lw)-3] + "y"
+	case strings.HasSuffix(lw, "sses"), strings.HasSuffix(lw, "shes"), strings.HasSuffix(lw, "ches"),
+		strings.HasSuffix(lw, "xes"), strings.HasSuffix(lw, "zes"):
+		return lw[:len(lw)-2]
+	case strings.HasSuffix(lw, "s"):
+		return lw[:len(lw)-1]
+	case strings.HasSuffix(lw, "y") && !strings.ContainsRune("aeiou", rune(lw[len(lw)-2])):
+		return lw[:len(lw)-1] + "ies"
+	}
+	return ""
+}
+
 func isAlphaNum(r rune) bool {
 	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
 }
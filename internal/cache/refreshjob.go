@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RefreshState is the lifecycle state of a RefreshJob.
+type RefreshState string
+
+const (
+	RefreshRunning   RefreshState = "running"
+	RefreshCompleted RefreshState = "completed"
+	RefreshFailed    RefreshState = "failed"
+)
+
+// RefreshJob describes one manual snapshot rebuild started by StartRefresh.
+type RefreshJob struct {
+	ID         string         `json:"job_id"`
+	State      RefreshState   `json:"state"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Counts     map[string]int `json:"counts,omitempty"`
+
+	done chan struct{}
+	snap *Snapshot
+	err  error
+}
+
+// keptRefreshJobs is how many finished jobs RefreshStatus can still report.
+const keptRefreshJobs = 20
+
+// StartRefresh starts a snapshot rebuild in the background and returns its job
+// at once. While a rebuild is running every caller joins it instead of starting
+// another; joined reports that. The rebuild keeps ctx's values but not its
+// cancellation, so it outlives the tool call that started it.
+func (c *Cache) StartRefresh(ctx context.Context) (job RefreshJob, joined bool) {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+	if c.runningJob != nil {
+		return c.runningJob.copy(), true
+	}
+	c.jobSeq++
+	j := &RefreshJob{
+		ID:        fmt.Sprintf("refresh-%d", c.jobSeq),
+		State:     RefreshRunning,
+		StartedAt: time.Now().UTC(),
+		done:      make(chan struct{}),
+	}
+	c.runningJob = j
+	c.jobs = append(c.jobs, j)
+	if len(c.jobs) > keptRefreshJobs {
+		c.jobs = c.jobs[len(c.jobs)-keptRefreshJobs:]
+	}
+	go c.runRefreshJob(context.WithoutCancel(ctx), j)
+	return j.copy(), false
+}
+
+func (c *Cache) runRefreshJob(ctx context.Context, j *RefreshJob) {
+	snap, err := c.Refresh(ctx)
+
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+	now := time.Now().UTC()
+	j.FinishedAt = &now
+	if err != nil {
+		j.State, j.Error, j.err = RefreshFailed, err.Error(), err
+		c.logger.Error("snapshot refresh job failed", "job_id", j.ID, "error", err)
+	} else {
+		j.State, j.snap, j.Counts = RefreshCompleted, snap, countsMap(snap)
+	}
+	c.runningJob = nil
+	close(j.done)
+}
+
+// RefreshStatus returns the job with the given ID, or ok false when it is
+// unknown (or old enough to have been forgotten).
+func (c *Cache) RefreshStatus(id string) (job RefreshJob, ok bool) {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+	for _, j := range c.jobs {
+		if j.ID == id {
+			return j.copy(), true
+		}
+	}
+	return RefreshJob{}, false
+}
+
+// LatestRefresh returns the most recently started job, if any.
+func (c *Cache) LatestRefresh() (job RefreshJob, ok bool) {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+	if len(c.jobs) == 0 {
+		return RefreshJob{}, false
+	}
+	return c.jobs[len(c.jobs)-1].copy(), true
+}
+
+// WaitRefresh blocks until the job with the given ID finishes or ctx ends, and
+// returns the snapshot it built.
+func (c *Cache) WaitRefresh(ctx context.Context, id string) (*Snapshot, error) {
+	c.jobsMu.Lock()
+	var j *RefreshJob
+	for _, candidate := range c.jobs {
+		if candidate.ID == id {
+			j = candidate
+		}
+	}
+	c.jobsMu.Unlock()
+	if j == nil {
+		return nil, fmt.Errorf("unknown refresh job %q", id)
+	}
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+	return j.snap, j.err
+}
+
+// copy returns j's reportable fields; callers must hold jobsMu.
+func (j *RefreshJob) copy() RefreshJob {
+	out := *j
+	out.done, out.snap, out.err = nil, nil, nil
+	return out
+}
+
+// countsMap turns snapshotCounts' key/value pairs into a map.
+func countsMap(snap *Snapshot) map[string]int {
+	kv := snapshotCounts(snap)
+	out := make(map[string]int, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		out[kv[i].(string)] = kv[i+1].(int)
+	}
+	return out
+}
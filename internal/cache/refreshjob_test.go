@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// jobServer answers every list with one company. Once gate is set, company
+// lists wait for it to be closed, and fail while failing is set.
+type jobServer struct {
+	builds  atomic.Int32
+	gate    atomic.Pointer[chan struct{}]
+	failing atomic.Bool
+}
+
+func (s *jobServer) cache(t *testing.T) *Cache {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/2.1/companies/" {
+			s.builds.Add(1)
+			if g := s.gate.Load(); g != nil {
+				<-*g
+			}
+			if s.failing.Load() {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"Acme"}]}}`))
+	}))
+	t.Cleanup(srv.Close)
+	c, err := New(context.Background(), itportal.NewClient(srv.URL, "k"), 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithStorePath(filepath.Join(t.TempDir(), "s.db")))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestStartRefreshCoalescesAndReportsStatus(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	gate := make(chan struct{})
+	s.gate.Store(&gate)
+	before := s.builds.Load()
+
+	first, joined := c.StartRefresh(context.Background())
+	if joined || first.State != RefreshRunning {
+		t.Fatalf("first StartRefresh = %+v joined=%v, want a new running job", first, joined)
+	}
+	second, joined := c.StartRefresh(context.Background())
+	if !joined || second.ID != first.ID {
+		t.Fatalf("second StartRefresh = %+v joined=%v, want to join %s", second, joined, first.ID)
+	}
+	if got, ok := c.RefreshStatus(first.ID); !ok || got.State != RefreshRunning || got.FinishedAt != nil {
+		t.Fatalf("status while running = %+v ok=%v", got, ok)
+	}
+
+	close(gate)
+	if _, err := c.WaitRefresh(context.Background(), first.ID); err != nil {
+		t.Fatalf("WaitRefresh: %v", err)
+	}
+	if n := s.builds.Load() - before; n != 1 {
+		t.Errorf("coalesced requests ran %d rebuilds, want 1", n)
+	}
+	got, _ := c.RefreshStatus(first.ID)
+	if got.State != RefreshCompleted || got.FinishedAt == nil || got.Counts["companies"] != 1 {
+		t.Errorf("status after completion = %+v", got)
+	}
+
+	// With the first job done, the next request starts a new one.
+	third, joined := c.StartRefresh(context.Background())
+	if joined || third.ID == first.ID {
+		t.Errorf("StartRefresh after completion = %+v joined=%v, want a new job", third, joined)
+	}
+	if _, err := c.WaitRefresh(context.Background(), third.ID); err != nil {
+		t.Fatalf("WaitRefresh: %v", err)
+	}
+	if latest, ok := c.LatestRefresh(); !ok || latest.ID != third.ID {
+		t.Errorf("LatestRefresh = %+v, want %s", latest, third.ID)
+	}
+}
+
+func TestStartRefreshReportsFailure(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	s.failing.Store(true)
+
+	job, _ := c.StartRefresh(context.Background())
+	if _, err := c.WaitRefresh(context.Background(), job.ID); err == nil {
+		t.Fatal("WaitRefresh succeeded against a failing API")
+	}
+	got, _ := c.RefreshStatus(job.ID)
+	if got.State != RefreshFailed || got.Error == "" || got.Counts != nil {
+		t.Errorf("status after failure = %+v", got)
+	}
+	if len(c.Get().Companies) != 1 {
+		t.Error("failed refresh replaced the previous snapshot")
+	}
+}
+
+func TestRefreshStatusUnknownJob(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	if _, ok := c.RefreshStatus("refresh-99"); ok {
+		t.Error("unknown job reported")
+	}
+	if _, ok := c.LatestRefresh(); ok {
+		t.Error("LatestRefresh reported a job before any was started")
+	}
+}
@@ -4,14 +4,19 @@
 package cache
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
 
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/alexfirilov/itportal-mcp/internal/itportal"
 )
@@ -32,28 +37,144 @@ type Snapshot struct {
 	Facilities     []itportal.Facility
 	Cabinets       []itportal.Cabinet
 	Configurations []itportal.Configuration
+	Truncated      []string // sections (as in snapshotCounts) whose fetch hit its cap; they may be incomplete
+
+	// PreviousGeneratedAt is the GeneratedAt of the snapshot this build
+	// replaced; zero for the first build.
+	PreviousGeneratedAt time.Time
+
+	timestampTrailer bool              // render GeneratedAt after the body instead of in the header
+	emptySections    bool              // render empty sections as a heading and "_No records._" instead of leaving them out
+	backlinks        backlinkIndex     // built with the snapshot; nil means build on demand
+	lifecycles       map[int]Lifecycle // device ID → state at GeneratedAt; nil means derive on demand
 }
 
 // Cache holds the current snapshot and refreshes it on a configurable schedule.
 // Each snapshot build also (re)builds an embedded SQLite Store derived from the
 // snapshot, which backs the compact index, per-section resources and search.
 type Cache struct {
-	client          *itportal.Client
-	limitPerEntity  int
-	deviceLimit     int
-	portalBaseURL   string
-	refreshInterval time.Duration
-	logger          *slog.Logger
-	storePath       string
-	current         atomic.Pointer[Snapshot]
-	store           atomic.Pointer[Store]
+	client           *itportal.Client
+	limitPerEntity   int
+	deviceLimit      int
+	typeLimits       map[string]int
+	portalBaseURL    string
+	refreshInterval  time.Duration
+	logger           *slog.Logger
+	lifetime         context.Context // New's ctx; shared builds run under it, not a caller's
+	storePath        string
+	current          atomic.Pointer[Snapshot]
+	store            atomic.Pointer[Store]
+	backgroundOn     atomic.Bool
+	ready            atomic.Bool
+	nonBlocking      bool
+	startupTimeout   time.Duration
+	maxStaleness     time.Duration
+	refreshOnStale   bool
+	staleRefreshing  atomic.Bool
+	mergeWrites      bool
+	stableBody       bool
+	emptySections    bool
+	healthMu         sync.Mutex
+	health           RefreshHealth
+	failureThreshold int
+	mergeMu          sync.Mutex
+	jobsMu           sync.Mutex
+	jobs             []*RefreshJob // recent manual refreshes, oldest first
+	runningJob       *RefreshJob
+	jobSeq           int
+	builds           singleflight.Group
+}
+
+// Option configures optional Cache behaviour.
+type Option func(*Cache)
+
+// WithStorePath overrides the SQLite store location (default StorePath()).
+// Each cache needs its own path when several run in one process.
+func WithStorePath(p string) Option {
+	return func(c *Cache) {
+		if p != "" {
+			c.storePath = p
+		}
+	}
 }
 
+// sectionTypes maps each snapshotCounts section to the entity type naming it in
+// WithTypeLimits.
+var sectionTypes = map[string]string{
+	"companies":      "company",
+	"sites":          "site",
+	"devices":        "device",
+	"kbs":            "kb",
+	"contacts":       "contact",
+	"agreements":     "agreement",
+	"ip_networks":    "ipnetwork",
+	"documents":      "document",
+	"accounts":       "account",
+	"facilities":     "facility",
+	"cabinets":       "cabinet",
+	"configurations": "configuration",
+}
+
+// WithTypeLimits overrides the fetch cap of individual entity types, keyed by
+// their sectionTypes name (e.g. {"device": 5000, "kb": 500}). Types without a
+// positive override keep limitPerEntity, or deviceLimit for devices.
+func WithTypeLimits(limits map[string]int) Option {
+	return func(c *Cache) { c.typeLimits = limits }
+}
+
+// WithNonBlockingStartup makes New return immediately with an empty snapshot and
+// build the first real one in the background, retrying until it succeeds. Ready
+// reports false until then.
+func WithNonBlockingStartup() Option {
+	return func(c *Cache) { c.nonBlocking = true }
+}
+
+// WithStartupTimeout bounds each initial snapshot build attempt. 0 keeps the
+// build's own limit.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *Cache) { c.startupTimeout = d }
+}
+
+// WithMaxStaleness sets how old the snapshot may get before EnsureFresh warns
+// about it; with refresh set it also rebuilds the snapshot synchronously before
+// serving. 0 disables the check.
+func WithMaxStaleness(d time.Duration, refresh bool) Option {
+	return func(c *Cache) {
+		c.maxStaleness = d
+		c.refreshOnStale = refresh
+	}
+}
+
+// WithStableBody keeps the generation timestamp out of the head of the snapshot
+// Markdown, rendering it as a trailer after the last section instead, so a
+// rebuild over unchanged data yields a byte-identical body that clients can
+// keep in their prompt cache. Read the timestamp from itportal://snapshot-meta.
+func WithStableBody() Option {
+	return func(c *Cache) { c.stableBody = true }
+}
+
+// WithEmptySections renders every section of the snapshot Markdown, giving an
+// empty one its heading and a "_No records._" note. By default empty sections
+// are left out.
+func WithEmptySections() Option {
+	return func(c *Cache) { c.emptySections = true }
+}
+
+// StableBody reports whether WithStableBody is set.
+func (c *Cache) StableBody() bool {
+	return c.stableBody
+}
+
+// startupRetryInterval is the pause between failed non-blocking warm-up builds.
+var startupRetryInterval = 30 * time.Second
+
 // New creates a Cache and performs an initial synchronous snapshot build.
 // Returns an error if the initial build fails (e.g. ITPortal is unreachable).
+// With WithNonBlockingStartup it instead returns at once and builds in the
+// background.
 // deviceLimit caps devices specifically (devices are usually the largest entity
 // set); pass <= 0 to fall back to limitPerEntity.
-func New(ctx context.Context, client *itportal.Client, limitPerEntity, deviceLimit int, refreshInterval time.Duration, logger *slog.Logger) (*Cache, error) {
+func New(ctx context.Context, client *itportal.Client, limitPerEntity, deviceLimit int, refreshInterval time.Duration, logger *slog.Logger, opts ...Option) (*Cache, error) {
 	if deviceLimit <= 0 {
 		deviceLimit = limitPerEntity
 	}
@@ -64,16 +185,113 @@ func New(ctx context.Context, client *itportal.Client, limitPerEntity, deviceLim
 		portalBaseURL:   client.BaseURL(),
 		refreshInterval: refreshInterval,
 		logger:          logger,
+		lifetime:        ctx,
 		storePath:       StorePath(),
 	}
+	for _, o := range opts {
+		o(c)
+	}
+
+	if c.nonBlocking {
+		empty := &Snapshot{timestampTrailer: c.stableBody, emptySections: c.emptySections}
+		empty.Markdown = buildMarkdown(empty)
+		c.current.Store(empty)
+		c.rebuildStore(empty)
+		go c.warmUp(ctx)
+		return c, nil
+	}
 
-	snap, err := c.build(ctx)
+	snap, err := c.buildInitial(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("initial snapshot build: %w", err)
 	}
+	logger.Info("initial snapshot built", snapshotCounts(snap)...)
+	return c, nil
+}
+
+// buildInitial runs one initial build attempt under the startup timeout and
+// publishes the result.
+func (c *Cache) buildInitial(ctx context.Context) (*Snapshot, error) {
+	return c.rebuild(ctx, c.startupTimeout)
+}
+
+// rebuild builds a snapshot and publishes it with a fresh store. Concurrent
+// callers (a manual refresh, the background loop, a stale-snapshot refresh)
+// share one in-flight build and all receive its result, so they never stack
+// full builds against the API. The build runs under the cache's lifetime
+// context, bounded by timeout when positive, so one caller giving up does not
+// fail it for the rest; each caller stops waiting when its own ctx ends.
+func (c *Cache) rebuild(ctx context.Context, timeout time.Duration) (*Snapshot, error) {
+	ch := c.builds.DoChan("snapshot", func() (any, error) {
+		buildCtx := c.lifetime
+		if buildCtx == nil {
+			buildCtx = context.Background()
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			buildCtx, cancel = context.WithTimeout(buildCtx, timeout)
+			defer cancel()
+		}
+		snap, err := c.build(buildCtx)
+		c.recordBuild(err)
+		if err != nil {
+			return nil, err
+		}
+		c.publish(snap)
+		return snap, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*Snapshot), nil
+	}
+}
+
+// publish makes snap the current snapshot. It holds mergeMu so a write merge
+// working from the previous snapshot cannot store its copy over snap.
+func (c *Cache) publish(snap *Snapshot) {
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+	if prev := c.current.Load(); prev != nil {
+		snap.PreviousGeneratedAt = prev.GeneratedAt
+	}
 	c.current.Store(snap)
 	c.rebuildStore(snap)
-	logger.Info("initial snapshot built",
+	c.ready.Store(true)
+}
+
+// warmUp builds the first snapshot in the background for a non-blocking
+// startup, retrying every startupRetryInterval until it succeeds or ctx ends.
+func (c *Cache) warmUp(ctx context.Context) {
+	for {
+		snap, err := c.buildInitial(ctx)
+		if err == nil {
+			c.logger.Info("initial snapshot built", snapshotCounts(snap)...)
+			return
+		}
+		c.logger.Error("initial snapshot build failed; retrying", "error", err, "retry_in", startupRetryInterval.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(startupRetryInterval):
+		}
+	}
+}
+
+// Ready reports whether a real snapshot has been built. It is always true after
+// a blocking New; with WithNonBlockingStartup it turns true once the background
+// warm-up (or any later refresh) succeeds.
+func (c *Cache) Ready() bool {
+	return c.ready.Load()
+}
+
+// snapshotCounts returns per-type record counts as slog key/value pairs.
+func snapshotCounts(snap *Snapshot) []any {
+	return []any{
 		"companies", len(snap.Companies),
 		"sites", len(snap.Sites),
 		"devices", len(snap.Devices),
@@ -86,8 +304,7 @@ func New(ctx context.Context, client *itportal.Client, limitPerEntity, deviceLim
 		"facilities", len(snap.Facilities),
 		"cabinets", len(snap.Cabinets),
 		"configurations", len(snap.Configurations),
-	)
-	return c, nil
+	}
 }
 
 // Get returns the current snapshot. Safe for concurrent use; never returns nil
@@ -96,6 +313,37 @@ func (c *Cache) Get() *Snapshot {
 	return c.current.Load()
 }
 
+// Age reports how long ago the current snapshot was built.
+func (c *Cache) Age() time.Duration {
+	snap := c.current.Load()
+	if snap == nil || snap.GeneratedAt.IsZero() {
+		return 0
+	}
+	return time.Since(snap.GeneratedAt)
+}
+
+// EnsureFresh is called before serving snapshot data. When the snapshot is older
+// than the WithMaxStaleness limit it logs a warning and, if configured, rebuilds
+// it first; a failed rebuild is logged and the stale snapshot is served. Only
+// one caller rebuilds at a time, the others serve the current snapshot. It
+// returns the age of the snapshot about to be served.
+func (c *Cache) EnsureFresh(ctx context.Context) time.Duration {
+	age := c.Age()
+	if c.maxStaleness <= 0 || age <= c.maxStaleness || !c.Ready() {
+		return age
+	}
+	c.logger.Warn("snapshot is stale; background refresh may be failing",
+		"age", age.Round(time.Second).String(), "max_staleness", c.maxStaleness.String())
+	if !c.refreshOnStale || !c.staleRefreshing.CompareAndSwap(false, true) {
+		return age
+	}
+	defer c.staleRefreshing.Store(false)
+	if _, err := c.Refresh(ctx); err != nil {
+		c.logger.Error("stale snapshot refresh failed; serving stale data", "error", err)
+	}
+	return c.Age()
+}
+
 // Store returns the current SQLite-backed store. Safe for concurrent use; never
 // returns nil after New succeeds (a failed store rebuild keeps the prior store).
 func (c *Cache) Store() *Store {
@@ -117,35 +365,23 @@ func (c *Cache) rebuildStore(snap *Snapshot) {
 	}
 }
 
-// Refresh forces an immediate snapshot rebuild, blocking until complete.
+// Refresh forces an immediate snapshot rebuild, blocking until complete. It
+// joins a build already in flight rather than starting a second one.
 func (c *Cache) Refresh(ctx context.Context) (*Snapshot, error) {
-	snap, err := c.build(ctx)
+	snap, err := c.rebuild(ctx, 0)
 	if err != nil {
 		return nil, err
 	}
-	c.current.Store(snap)
-	c.rebuildStore(snap)
-	c.logger.Info("snapshot refreshed manually",
-		"companies", len(snap.Companies),
-		"sites", len(snap.Sites),
-		"devices", len(snap.Devices),
-		"kbs", len(snap.KBs),
-		"contacts", len(snap.Contacts),
-		"agreements", len(snap.Agreements),
-		"ip_networks", len(snap.IPNetworks),
-		"documents", len(snap.Documents),
-		"accounts", len(snap.Accounts),
-		"facilities", len(snap.Facilities),
-		"cabinets", len(snap.Cabinets),
-		"configurations", len(snap.Configurations),
-	)
+	c.logger.Info("snapshot refreshed manually", snapshotCounts(snap)...)
 	return snap, nil
 }
 
 // StartBackgroundRefresh launches a goroutine that rebuilds the snapshot every
 // refreshInterval. It respects ctx cancellation for clean shutdown.
 func (c *Cache) StartBackgroundRefresh(ctx context.Context) {
+	c.backgroundOn.Store(true)
 	go func() {
+		defer c.backgroundOn.Store(false)
 		ticker := time.NewTicker(c.refreshInterval)
 		defer ticker.Stop()
 		for {
@@ -154,38 +390,35 @@ func (c *Cache) StartBackgroundRefresh(ctx context.Context) {
 				return
 			case <-ticker.C:
 				c.logger.Info("background snapshot refresh started")
-				snap, err := c.build(ctx)
+				snap, err := c.rebuild(ctx, 0)
 				if err != nil {
-					c.logger.Error("background snapshot refresh failed", "error", err)
+					c.logger.Error("background snapshot refresh failed", "error", err,
+						"consecutive_failures", c.RefreshHealth().ConsecutiveFailures)
 					continue
 				}
-				c.current.Store(snap)
-				c.rebuildStore(snap)
-				c.logger.Info("background snapshot refresh complete",
-					"companies", len(snap.Companies),
-					"sites", len(snap.Sites),
-					"devices", len(snap.Devices),
-					"kbs", len(snap.KBs),
-					"contacts", len(snap.Contacts),
-					"agreements", len(snap.Agreements),
-					"ip_networks", len(snap.IPNetworks),
-					"documents", len(snap.Documents),
-					"accounts", len(snap.Accounts),
-					"facilities", len(snap.Facilities),
-					"cabinets", len(snap.Cabinets),
-					"configurations", len(snap.Configurations),
-				)
+				c.logger.Info("background snapshot refresh complete", snapshotCounts(snap)...)
 			}
 		}
 	}()
 }
 
+// BackgroundRefreshRunning reports whether the StartBackgroundRefresh loop is
+// active (started and its context not yet cancelled).
+func (c *Cache) BackgroundRefreshRunning() bool {
+	return c.backgroundOn.Load()
+}
+
+// RefreshInterval returns the configured background refresh period.
+func (c *Cache) RefreshInterval() time.Duration {
+	return c.refreshInterval
+}
+
 // build fetches all entity types from ITPortal concurrently and assembles an immutable Snapshot.
 func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	buildCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	lim := c.limitPerEntity
+	lim := c.typeLimit
 	var (
 		companies      []itportal.Company
 		sites          []itportal.Site
@@ -205,7 +438,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 
 	eg.Go(func() error {
 		var err error
-		companies, err = c.client.ListAllCompanies(egCtx, nil, lim)
+		companies, err = c.client.ListAllCompanies(egCtx, nil, lim("company"))
 		if err != nil {
 			return fmt.Errorf("list companies: %w", err)
 		}
@@ -213,7 +446,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		sites, err = c.client.ListAllSites(egCtx, nil, lim)
+		sites, err = c.client.ListAllSites(egCtx, nil, lim("site"))
 		if err != nil {
 			return fmt.Errorf("list sites: %w", err)
 		}
@@ -221,7 +454,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		devices, err = c.client.ListAllDevices(egCtx, nil, c.deviceLimit)
+		devices, err = c.client.ListAllDevices(egCtx, nil, lim("device"))
 		if err != nil {
 			return fmt.Errorf("list devices: %w", err)
 		}
@@ -229,7 +462,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		kbs, err = c.client.ListAllKBs(egCtx, nil, lim)
+		kbs, err = c.client.ListAllKBs(egCtx, nil, lim("kb"))
 		if err != nil {
 			return fmt.Errorf("list KBs: %w", err)
 		}
@@ -237,7 +470,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		contacts, err = c.client.ListAllContacts(egCtx, nil, lim)
+		contacts, err = c.client.ListAllContacts(egCtx, nil, lim("contact"))
 		if err != nil {
 			return fmt.Errorf("list contacts: %w", err)
 		}
@@ -245,7 +478,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		agreements, err = c.client.ListAllAgreements(egCtx, nil, lim)
+		agreements, err = c.client.ListAllAgreements(egCtx, nil, lim("agreement"))
 		if err != nil {
 			return fmt.Errorf("list agreements: %w", err)
 		}
@@ -253,7 +486,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		ipNetworks, err = c.client.ListAllIPNetworks(egCtx, nil, lim)
+		ipNetworks, err = c.client.ListAllIPNetworks(egCtx, nil, lim("ipnetwork"))
 		if err != nil {
 			return fmt.Errorf("list IP networks: %w", err)
 		}
@@ -261,7 +494,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		documents, err = c.client.ListAllDocuments(egCtx, nil, lim)
+		documents, err = c.client.ListAllDocuments(egCtx, nil, lim("document"))
 		if err != nil {
 			return fmt.Errorf("list documents: %w", err)
 		}
@@ -269,7 +502,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		accounts, err = c.client.ListAllAccounts(egCtx, nil, lim)
+		accounts, err = c.client.ListAllAccounts(egCtx, nil, lim("account"))
 		if err != nil {
 			return fmt.Errorf("list accounts: %w", err)
 		}
@@ -277,7 +510,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		facilities, err = c.client.ListAllFacilities(egCtx, nil, lim)
+		facilities, err = c.client.ListAllFacilities(egCtx, nil, lim("facility"))
 		if err != nil {
 			return fmt.Errorf("list facilities: %w", err)
 		}
@@ -285,7 +518,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		cabinets, err = c.client.ListAllCabinets(egCtx, nil, lim)
+		cabinets, err = c.client.ListAllCabinets(egCtx, nil, lim("cabinet"))
 		if err != nil {
 			return fmt.Errorf("list cabinets: %w", err)
 		}
@@ -293,7 +526,7 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 	})
 	eg.Go(func() error {
 		var err error
-		configurations, err = c.client.ListAllConfigurations(egCtx, nil, lim)
+		configurations, err = c.client.ListAllConfigurations(egCtx, nil, lim("configuration"))
 		if err != nil {
 			return fmt.Errorf("list configurations: %w", err)
 		}
@@ -318,12 +551,76 @@ func (c *Cache) build(ctx context.Context) (*Snapshot, error) {
 		Facilities:     facilities,
 		Cabinets:       cabinets,
 		Configurations: configurations,
+
+		timestampTrailer: c.stableBody,
+		emptySections:    c.emptySections,
+	}
+	sortSnapshot(snap)
+	snap.Truncated = c.cappedSections(snap)
+	for _, section := range snap.Truncated {
+		c.logger.Warn("snapshot section hit its entity cap; data is truncated",
+			"section", section, "limit", c.sectionLimit(section))
 	}
 	backfillPortalURLs(snap, c.portalBaseURL)
+	snap.lifecycles = buildLifecycles(snap)
 	snap.Markdown = buildMarkdown(snap)
+	snap.backlinks = buildBacklinks(snap)
 	return snap, nil
 }
 
+// sortSnapshot orders every section by ID, so a rebuild over the same data
+// renders byte-identical Markdown whatever order ITPortal paged it in, keeping
+// the prompt cache warm.
+func sortSnapshot(s *Snapshot) {
+	sortByID(s.Companies, func(v *itportal.Company) int { return v.ID })
+	sortByID(s.Sites, func(v *itportal.Site) int { return v.ID })
+	sortByID(s.Devices, func(v *itportal.Device) int { return v.ID })
+	sortByID(s.KBs, func(v *itportal.KB) int { return v.ID })
+	sortByID(s.Contacts, func(v *itportal.Contact) int { return v.ID })
+	sortByID(s.Agreements, func(v *itportal.Agreement) int { return v.ID })
+	sortByID(s.IPNetworks, func(v *itportal.IPNetwork) int { return v.ID })
+	sortByID(s.Documents, func(v *itportal.Document) int { return v.ID })
+	sortByID(s.Accounts, func(v *itportal.Account) int { return v.ID })
+	sortByID(s.Facilities, func(v *itportal.Facility) int { return v.ID })
+	sortByID(s.Cabinets, func(v *itportal.Cabinet) int { return v.ID })
+	sortByID(s.Configurations, func(v *itportal.Configuration) int { return v.ID })
+}
+
+func sortByID[T any](list []T, id func(*T) int) {
+	slices.SortStableFunc(list, func(a, b T) int { return cmp.Compare(id(&a), id(&b)) })
+}
+
+// cappedSections returns the sections, in snapshotCounts order, that hold as
+// many records as their fetch cap allowed, so ITPortal may have more.
+func (c *Cache) cappedSections(snap *Snapshot) []string {
+	var out []string
+	kv := snapshotCounts(snap)
+	for i := 0; i+1 < len(kv); i += 2 {
+		section := kv[i].(string)
+		if lim := c.sectionLimit(section); lim > 0 && kv[i+1].(int) >= lim {
+			out = append(out, section)
+		}
+	}
+	return out
+}
+
+// sectionLimit is the fetch cap for a snapshotCounts section.
+func (c *Cache) sectionLimit(section string) int {
+	return c.typeLimit(sectionTypes[section])
+}
+
+// typeLimit is the fetch cap for an entity type: its WithTypeLimits override,
+// else deviceLimit for devices and limitPerEntity for the rest.
+func (c *Cache) typeLimit(typ string) int {
+	if n := c.typeLimits[typ]; n > 0 {
+		return n
+	}
+	if typ == "device" {
+		return c.deviceLimit
+	}
+	return c.limitPerEntity
+}
+
 // backfillPortalURLs sets a constructed portal deep-link on every entity whose
 // API-provided url is empty, so the snapshot and JSON resources always carry a
 // link. Entities that already have a url keep it untouched.
@@ -374,20 +671,67 @@ func backfillPortalURLs(s *Snapshot, base string) {
 	}
 }
 
+// PortalURL returns the portal link of the cached entity of itemType (a search
+// result type such as "device") with the given ID, or "" when the snapshot does
+// not hold it or it has no link.
+func (s *Snapshot) PortalURL(itemType string, id int) string {
+	switch itemType {
+	case "company":
+		return urlByID(s.Companies, id, func(v *itportal.Company) (int, string) { return v.ID, v.URL })
+	case "site":
+		return urlByID(s.Sites, id, func(v *itportal.Site) (int, string) { return v.ID, v.URL })
+	case "device":
+		return urlByID(s.Devices, id, func(v *itportal.Device) (int, string) { return v.ID, v.URL })
+	case "kb":
+		return urlByID(s.KBs, id, func(v *itportal.KB) (int, string) { return v.ID, v.URL })
+	case "contact":
+		return urlByID(s.Contacts, id, func(v *itportal.Contact) (int, string) { return v.ID, v.URL })
+	case "agreement":
+		return urlByID(s.Agreements, id, func(v *itportal.Agreement) (int, string) { return v.ID, v.URL })
+	case "ipnetwork":
+		return urlByID(s.IPNetworks, id, func(v *itportal.IPNetwork) (int, string) { return v.ID, v.URL })
+	case "document":
+		return urlByID(s.Documents, id, func(v *itportal.Document) (int, string) { return v.ID, v.URL })
+	case "account":
+		return urlByID(s.Accounts, id, func(v *itportal.Account) (int, string) { return v.ID, v.URL })
+	case "facility":
+		return urlByID(s.Facilities, id, func(v *itportal.Facility) (int, string) { return v.ID, v.URL })
+	case "cabinet":
+		return urlByID(s.Cabinets, id, func(v *itportal.Cabinet) (int, string) { return v.ID, v.URL })
+	case "configuration":
+		return urlByID(s.Configurations, id, func(v *itportal.Configuration) (int, string) { return v.ID, v.URL })
+	}
+	return ""
+}
+
+func urlByID[T any](list []T, target int, idURL func(*T) (int, string)) string {
+	for i := range list {
+		if id, url := idURL(&list[i]); id == target {
+			return url
+		}
+	}
+	return ""
+}
+
 // buildMarkdown renders the snapshot as structured Markdown optimised for LLM consumption.
 // Sensitive fields (passwords, 2FA codes, raw credentials) are intentionally omitted.
+// The generation timestamp heads the document, or closes it when
+// s.timestampTrailer is set.
 func buildMarkdown(s *Snapshot) string {
 	var b strings.Builder
 
 	fmt.Fprintf(&b, "# ITPortal Documentation Snapshot\n\n")
-	fmt.Fprintf(&b, "_Generated: %s UTC_\n\n", s.GeneratedAt.Format("2006-01-02 15:04:05"))
+	if !s.timestampTrailer {
+		fmt.Fprintf(&b, "_Generated: %s UTC_\n\n", s.GeneratedAt.Format("2006-01-02 15:04:05"))
+	}
 	fmt.Fprintf(&b, "**Summary:** %d companies · %d sites · %d devices · %d KB articles · %d contacts · %d agreements · %d IP networks · %d documents · %d accounts · %d facilities · %d cabinets · %d configurations\n\n",
 		len(s.Companies), len(s.Sites), len(s.Devices), len(s.KBs), len(s.Contacts), len(s.Agreements), len(s.IPNetworks),
 		len(s.Documents), len(s.Accounts), len(s.Facilities), len(s.Cabinets), len(s.Configurations))
+	writeTOC(&b, s)
 	b.WriteString("---\n\n")
 
 	// ---- Companies ----
-	fmt.Fprintf(&b, "## Companies (%d)\n\n", len(s.Companies))
+	sectionStart(&b, s, "Companies", len(s.Companies))
 	for _, co := range s.Companies {
 		fmt.Fprintf(&b, "### %s (ID: %d)\n", headingLink(co.Name, co.URL), co.ID)
 		if co.Abbreviation != "" {
@@ -421,7 +765,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Sites ----
-	fmt.Fprintf(&b, "## Sites (%d)\n\n", len(s.Sites))
+	sectionStart(&b, s, "Sites", len(s.Sites))
 	for _, si := range s.Sites {
 		companyCtx := ""
 		if si.Company != nil {
@@ -443,6 +787,7 @@ func buildMarkdown(s *Snapshot) string {
 		if si.NumberOfPCs > 0 {
 			fmt.Fprintf(&b, "- **Number of PCs**: %d\n", si.NumberOfPCs)
 		}
+		writeDiagram(&b, si.Diagram)
 		if si.URL != "" {
 			fmt.Fprintf(&b, "- **Portal Link**: %s\n", si.URL)
 		}
@@ -450,7 +795,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Devices ----
-	fmt.Fprintf(&b, "## Devices (%d)\n\n", len(s.Devices))
+	sectionStart(&b, s, "Devices", len(s.Devices))
 	for _, d := range s.Devices {
 		locationCtx := ""
 		if d.Company != nil {
@@ -501,6 +846,7 @@ func buildMarkdown(s *Snapshot) string {
 		if d.WarrantyExpires != "" {
 			fmt.Fprintf(&b, "- **Warranty Expires**: %s\n", d.WarrantyExpires)
 		}
+		fmt.Fprintf(&b, "- **Lifecycle**: %s\n", s.lifecycleOf(d))
 		if d.URL != "" {
 			fmt.Fprintf(&b, "- **Portal Link**: %s\n", d.URL)
 		}
@@ -508,7 +854,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Knowledge Base ----
-	fmt.Fprintf(&b, "## Knowledge Base Articles (%d)\n\n", len(s.KBs))
+	sectionStart(&b, s, "Knowledge Base Articles", len(s.KBs))
 	for _, kb := range s.KBs {
 		companyCtx := ""
 		if kb.Company != nil {
@@ -537,9 +883,9 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Contacts ----
-	fmt.Fprintf(&b, "## Contacts (%d)\n\n", len(s.Contacts))
+	sectionStart(&b, s, "Contacts", len(s.Contacts))
 	for _, co := range s.Contacts {
-		fullName := strings.TrimSpace(co.FirstName + " " + co.LastName)
+		fullName := co.FullName()
 		if fullName == "" {
 			fullName = fmt.Sprintf("Contact #%d", co.ID)
 		}
@@ -573,8 +919,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Agreements ----
-	if len(s.Agreements) > 0 {
-		fmt.Fprintf(&b, "## Agreements (%d)\n\n", len(s.Agreements))
+	if sectionStart(&b, s, "Agreements", len(s.Agreements)) {
 		for _, ag := range s.Agreements {
 			typeName := ""
 			if ag.Type != nil {
@@ -605,8 +950,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- IP Networks ----
-	if len(s.IPNetworks) > 0 {
-		fmt.Fprintf(&b, "## IP Networks (%d)\n\n", len(s.IPNetworks))
+	if sectionStart(&b, s, "IP Networks", len(s.IPNetworks)) {
 		for _, net := range s.IPNetworks {
 			companyCtx := ""
 			if net.Company != nil {
@@ -631,6 +975,9 @@ func buildMarkdown(s *Snapshot) string {
 			if net.DNSServer2 != nil && net.DNSServer2.IP != "" {
 				fmt.Fprintf(&b, "- **DNS Secondary**: %s\n", net.DNSServer2.IP)
 			}
+			if net.DHCPServer != nil && net.DHCPServer.IP != "" {
+				fmt.Fprintf(&b, "- **DHCP Server**: %s\n", net.DHCPServer.IP)
+			}
 			if net.VlanID > 0 {
 				fmt.Fprintf(&b, "- **VLAN**: %d\n", net.VlanID)
 			}
@@ -645,8 +992,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Documents ----
-	if len(s.Documents) > 0 {
-		fmt.Fprintf(&b, "## Documents (%d)\n\n", len(s.Documents))
+	if sectionStart(&b, s, "Documents", len(s.Documents)) {
 		for _, doc := range s.Documents {
 			companyCtx := ""
 			if doc.Company != nil {
@@ -678,8 +1024,7 @@ func buildMarkdown(s *Snapshot) string {
 
 	// ---- Accounts ----
 	// Passwords and 2FA codes are intentionally omitted.
-	if len(s.Accounts) > 0 {
-		fmt.Fprintf(&b, "## Accounts (%d)\n\n", len(s.Accounts))
+	if sectionStart(&b, s, "Accounts", len(s.Accounts)) {
 		for _, ac := range s.Accounts {
 			companyCtx := ""
 			if ac.Company != nil {
@@ -718,9 +1063,10 @@ func buildMarkdown(s *Snapshot) string {
 			if ac.AccountURL != "" {
 				fmt.Fprintf(&b, "- **Account URL**: %s\n", ac.AccountURL)
 			}
-			if ac.Expires != "" {
-				fmt.Fprintf(&b, "- **Expires**: %s\n", ac.Expires)
-			}
+			// Expires and 2FA presence are always shown for audits; the 2FA
+			// code itself never is.
+			fmt.Fprintf(&b, "- **Expires**: %s\n", orNotSet(ac.Expires))
+			fmt.Fprintf(&b, "- **2FA**: %s\n", TwoFAStatus(strings.TrimSpace(ac.TwoFACode) != ""))
 			if ac.Description != "" {
 				fmt.Fprintf(&b, "- **Description**: %s\n", truncate(ac.Description, 300))
 			}
@@ -735,8 +1081,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Facilities ----
-	if len(s.Facilities) > 0 {
-		fmt.Fprintf(&b, "## Facilities (%d)\n\n", len(s.Facilities))
+	if sectionStart(&b, s, "Facilities", len(s.Facilities)) {
 		for _, f := range s.Facilities {
 			companyCtx := ""
 			if f.Company != nil {
@@ -768,6 +1113,7 @@ func buildMarkdown(s *Snapshot) string {
 			if f.Notes != "" {
 				fmt.Fprintf(&b, "- **Notes**: %s\n", truncate(f.Notes, 300))
 			}
+			writeDiagram(&b, f.Diagram)
 			if f.URL != "" {
 				fmt.Fprintf(&b, "- **Portal Link**: %s\n", f.URL)
 			}
@@ -776,8 +1122,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Cabinets ----
-	if len(s.Cabinets) > 0 {
-		fmt.Fprintf(&b, "## Cabinets (%d)\n\n", len(s.Cabinets))
+	if sectionStart(&b, s, "Cabinets", len(s.Cabinets)) {
 		for _, cab := range s.Cabinets {
 			companyCtx := ""
 			if cab.Company != nil {
@@ -805,6 +1150,7 @@ func buildMarkdown(s *Snapshot) string {
 			if cab.Notes != "" {
 				fmt.Fprintf(&b, "- **Notes**: %s\n", truncate(cab.Notes, 300))
 			}
+			writeDiagram(&b, cab.Diagram)
 			if cab.URL != "" {
 				fmt.Fprintf(&b, "- **Portal Link**: %s\n", cab.URL)
 			}
@@ -813,8 +1159,7 @@ func buildMarkdown(s *Snapshot) string {
 	}
 
 	// ---- Configurations ----
-	if len(s.Configurations) > 0 {
-		fmt.Fprintf(&b, "## Configurations (%d)\n\n", len(s.Configurations))
+	if sectionStart(&b, s, "Configurations", len(s.Configurations)) {
 		for _, cfg := range s.Configurations {
 			companyCtx := ""
 			if cfg.Company != nil {
@@ -850,6 +1195,209 @@ func buildMarkdown(s *Snapshot) string {
 		}
 	}
 
+	if s.timestampTrailer {
+		fmt.Fprintf(&b, "---\n\n_Generated: %s UTC_\n", s.GeneratedAt.Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
+
+// TwoFAStatus describes whether a 2FA code is stored without revealing it.
+func TwoFAStatus(configured bool) string {
+	if configured {
+		return "configured"
+	}
+	return "not configured"
+}
+
+func orNotSet(s string) string {
+	if s == "" {
+		return "not set"
+	}
+	return s
+}
+
+// writeDiagram renders the Diagram line for a site, facility or cabinet that
+// references a diagram document.
+func writeDiagram(b *strings.Builder, d *itportal.DocumentReference) {
+	if d == nil || d.ID == 0 {
+		return
+	}
+	name := d.Name
+	if name == "" {
+		name = "Diagram"
+	}
+	fmt.Fprintf(b, "- **Diagram**: %s (Document ID: %d)\n", name, d.ID)
+}
+
+// EntityMarkdown renders one entity (a value or pointer of a snapshot type such
+// as itportal.Device) exactly as its entry in the snapshot Markdown. It reports
+// false for types the snapshot does not render.
+func EntityMarkdown(v any) (string, bool) {
+	s := Snapshot{GeneratedAt: time.Now().UTC()}
+	switch e := v.(type) {
+	case itportal.Company:
+		s.Companies = []itportal.Company{e}
+	case *itportal.Company:
+		s.Companies = []itportal.Company{*e}
+	case itportal.Site:
+		s.Sites = []itportal.Site{e}
+	case *itportal.Site:
+		s.Sites = []itportal.Site{*e}
+	case itportal.Device:
+		s.Devices = []itportal.Device{e}
+	case *itportal.Device:
+		s.Devices = []itportal.Device{*e}
+	case itportal.KB:
+		s.KBs = []itportal.KB{e}
+	case *itportal.KB:
+		s.KBs = []itportal.KB{*e}
+	case itportal.Contact:
+		s.Contacts = []itportal.Contact{e}
+	case *itportal.Contact:
+		s.Contacts = []itportal.Contact{*e}
+	case itportal.Agreement:
+		s.Agreements = []itportal.Agreement{e}
+	case *itportal.Agreement:
+		s.Agreements = []itportal.Agreement{*e}
+	case itportal.IPNetwork:
+		s.IPNetworks = []itportal.IPNetwork{e}
+	case *itportal.IPNetwork:
+		s.IPNetworks = []itportal.IPNetwork{*e}
+	case itportal.Document:
+		s.Documents = []itportal.Document{e}
+	case *itportal.Document:
+		s.Documents = []itportal.Document{*e}
+	case itportal.Account:
+		s.Accounts = []itportal.Account{e}
+	case *itportal.Account:
+		s.Accounts = []itportal.Account{*e}
+	case itportal.Facility:
+		s.Facilities = []itportal.Facility{e}
+	case *itportal.Facility:
+		s.Facilities = []itportal.Facility{*e}
+	case itportal.Cabinet:
+		s.Cabinets = []itportal.Cabinet{e}
+	case *itportal.Cabinet:
+		s.Cabinets = []itportal.Cabinet{*e}
+	case itportal.Configuration:
+		s.Configurations = []itportal.Configuration{e}
+	case *itportal.Configuration:
+		s.Configurations = []itportal.Configuration{*e}
+	default:
+		return "", false
+	}
+	var title string
+	for _, sec := range markdownSections(&s) {
+		if sec.count > 0 {
+			title = sec.title
+		}
+	}
+	section, ok := markdownSection(buildMarkdown(&s), title)
+	start := strings.Index(section, "### ")
+	if !ok || start < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(section[start:]) + "\n", true
+}
+
+// markdownSection returns the body of md's "## title (N)" section, up to the
+// next "## " heading. The heading must read exactly title followed by its
+// count, so "Sites" never picks up a "Sites Archive (…)" or "Facilities (…)"
+// section next to it.
+func markdownSection(md, title string) (string, bool) {
+	prefix := "## " + title + " ("
+	lines := strings.SplitAfter(md, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(strings.TrimRight(line, "\n"), ")") {
+			continue
+		}
+		var b strings.Builder
+		for _, next := range lines[i+1:] {
+			if strings.HasPrefix(next, "## ") {
+				break
+			}
+			b.WriteString(next)
+		}
+		return b.String(), true
+	}
+	return "", false
+}
+
+// mdSection is one "## " section of the snapshot Markdown.
+type mdSection struct {
+	title string
+	count int
+}
+
+// markdownSections lists the snapshot's Markdown sections in document order
+// with their record counts.
+func markdownSections(s *Snapshot) []mdSection {
+	return []mdSection{
+		{"Companies", len(s.Companies)},
+		{"Sites", len(s.Sites)},
+		{"Devices", len(s.Devices)},
+		{"Knowledge Base Articles", len(s.KBs)},
+		{"Contacts", len(s.Contacts)},
+		{"Agreements", len(s.Agreements)},
+		{"IP Networks", len(s.IPNetworks)},
+		{"Documents", len(s.Documents)},
+		{"Accounts", len(s.Accounts)},
+		{"Facilities", len(s.Facilities)},
+		{"Cabinets", len(s.Cabinets)},
+		{"Configurations", len(s.Configurations)},
+	}
+}
+
+// sectionStart opens a section of count records with its "## " heading and
+// reports whether it has records to list. Every entity type handles an empty
+// section the same way: it is left out, or with s.emptySections rendered as
+// its heading and a "_No records._" note.
+func sectionStart(b *strings.Builder, s *Snapshot, title string, count int) bool {
+	if count == 0 {
+		if s.emptySections {
+			fmt.Fprintf(b, "## %s\n\n_No records._\n\n", sectionHeading(title, 0))
+		}
+		return false
+	}
+	fmt.Fprintf(b, "## %s\n\n", sectionHeading(title, count))
+	return true
+}
+
+// sectionHeading is the text of a section's "## " heading.
+func sectionHeading(title string, count int) string {
+	return fmt.Sprintf("%s (%d)", title, count)
+}
+
+// writeTOC writes a contents list linking every non-empty section heading.
+func writeTOC(b *strings.Builder, s *Snapshot) {
+	var lines []string
+	for _, sec := range markdownSections(s) {
+		if sec.count == 0 {
+			continue
+		}
+		h := sectionHeading(sec.title, sec.count)
+		lines = append(lines, fmt.Sprintf("- [%s](#%s)", h, headingAnchor(h)))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	b.WriteString("**Contents:**\n\n")
+	b.WriteString(strings.Join(lines, "\n"))
+	b.WriteString("\n\n")
+}
+
+// headingAnchor is the fragment GitHub-style renderers give a heading: lower
+// case, punctuation dropped, spaces turned into hyphens.
+func headingAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
 	return b.String()
 }
 
@@ -1,8 +1,21 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/alexfirilov/itportal-mcp/internal/itportal"
 )
@@ -15,18 +28,104 @@ func TestBuildMarkdownIncludesEntities(t *testing.T) {
 			Company: &itportal.CompanyReference{ID: 1, Name: "Acme"},
 		}},
 		IPNetworks: []itportal.IPNetwork{{
-			ID: 3, Name: "LAN", NetworkAddress: "10.0.0.0", SubnetMask: "255.255.255.0",
+			ID: 3, Name: "LAN", NetworkAddress: "10.0.0.0", SubnetMask: "255.255.255.0", VlanID: 10,
+			DHCPServer: &itportal.IPRef{IP: "10.0.0.2"},
 		}},
 	}
 	md := buildMarkdown(snap)
 
-	for _, want := range []string{"## Companies (1)", "Acme", "## Devices (1)", "fw01", "Fortinet FG-60F", "## IP Networks (1)", "10.0.0.0 / 255.255.255.0"} {
+	for _, want := range []string{"## Companies (1)", "Acme", "## Devices (1)", "fw01", "Fortinet FG-60F", "## IP Networks (1)", "10.0.0.0 / 255.255.255.0",
+		"- **DHCP Server**: 10.0.0.2", "- **VLAN**: 10"} {
 		if !strings.Contains(md, want) {
 			t.Errorf("markdown missing %q", want)
 		}
 	}
 }
 
+func TestBuildMarkdownTableOfContents(t *testing.T) {
+	snap := &Snapshot{
+		Companies: []itportal.Company{{ID: 1, Name: "Acme"}, {ID: 2, Name: "Globex"}},
+		Devices:   []itportal.Device{{ID: 9, Name: "fw01"}},
+		KBs:       []itportal.KB{{ID: 4, Name: "VPN setup"}},
+		Cabinets:  []itportal.Cabinet{{ID: 5, Name: "Rack A"}, {ID: 6, Name: "Rack B"}, {ID: 7, Name: "Rack C"}},
+	}
+	md := buildMarkdown(snap)
+
+	start := strings.Index(md, "**Contents:**")
+	end := strings.Index(md, "---\n")
+	if start < 0 || end < start {
+		t.Fatalf("no table of contents before the first section:\n%s", md)
+	}
+	toc := md[start:end]
+	want := []string{
+		"- [Companies (2)](#companies-2)",
+		"- [Devices (1)](#devices-1)",
+		"- [Knowledge Base Articles (1)](#knowledge-base-articles-1)",
+		"- [Cabinets (3)](#cabinets-3)",
+	}
+	if got := strings.Count(toc, "\n- ["); got != len(want) {
+		t.Errorf("TOC has %d entries, want %d:\n%s", got, len(want), toc)
+	}
+	for _, line := range want {
+		if !strings.Contains(toc, line) {
+			t.Errorf("TOC missing %q:\n%s", line, toc)
+		}
+	}
+	for _, empty := range []string{"Sites", "Contacts"} {
+		if strings.Contains(toc, empty) {
+			t.Errorf("TOC lists empty section %s", empty)
+		}
+	}
+
+	// Every anchor must resolve to a generated heading.
+	for _, sec := range markdownSections(snap) {
+		if sec.count == 0 {
+			continue
+		}
+		h := sectionHeading(sec.title, sec.count)
+		if !strings.Contains(md, "\n## "+h+"\n") {
+			t.Errorf("no heading %q for TOC anchor #%s", h, headingAnchor(h))
+		}
+	}
+}
+
+// TestMarkdownSectionMatchesExactHeading extracts sections sitting next to
+// others whose titles contain or extend theirs.
+func TestMarkdownSectionMatchesExactHeading(t *testing.T) {
+	md := "# Snapshot\n\n" +
+		"## Sites Archive (1)\n\n### Old depot (ID: 9)\n\n" +
+		"## Facilities (1)\n\n### Sites hall (ID: 3)\n\n" +
+		"## Sites (2)\n\n### HQ (ID: 1)\n\n### Branch (ID: 2)\n\n" +
+		"## IP Networks (1)\n\n### LAN (ID: 4)\n"
+	for title, want := range map[string]string{
+		"Sites":         "\n### HQ (ID: 1)\n\n### Branch (ID: 2)\n\n",
+		"Sites Archive": "\n### Old depot (ID: 9)\n\n",
+		"Facilities":    "\n### Sites hall (ID: 3)\n\n",
+		"IP Networks":   "\n### LAN (ID: 4)\n",
+	} {
+		if got, ok := markdownSection(md, title); !ok || got != want {
+			t.Errorf("section %q = %q (%v), want %q", title, got, ok, want)
+		}
+	}
+	for _, title := range []string{"Site", "Networks", "Cabinets"} {
+		if got, ok := markdownSection(md, title); ok {
+			t.Errorf("section %q matched: %q", title, got)
+		}
+	}
+}
+
+func TestHeadingAnchor(t *testing.T) {
+	for in, want := range map[string]string{
+		"Companies (2)":                "companies-2",
+		"Knowledge Base Articles (12)": "knowledge-base-articles-12",
+		"IP Networks (0)":              "ip-networks-0",
+	} {
+		if got := headingAnchor(in); got != want {
+			t.Errorf("headingAnchor(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
 func TestTruncateStripsHTML(t *testing.T) {
 	got := truncate("<p>hello <b>world</b></p>", 100)
 	if got != "hello world" {
@@ -83,6 +182,49 @@ func TestBackfillPortalURLs(t *testing.T) {
 	}
 }
 
+// TestBuildMarkdownEmptySections checks every entity type treats an empty
+// section alike: left out by default, a heading and a note when configured.
+func TestBuildMarkdownEmptySections(t *testing.T) {
+	snap := &Snapshot{
+		Companies:  []itportal.Company{{ID: 1, Name: "Acme"}},
+		Agreements: []itportal.Agreement{{ID: 2, Description: "Support"}},
+	}
+	for _, show := range []bool{false, true} {
+		snap.emptySections = show
+		md := buildMarkdown(snap)
+		for _, sec := range markdownSections(snap) {
+			heading := "\n## " + sectionHeading(sec.title, sec.count) + "\n"
+			switch {
+			case sec.count > 0:
+				if !strings.Contains(md, heading+"\n### ") {
+					t.Errorf("show=%v: section %s not rendered with its records", show, sec.title)
+				}
+			case show:
+				if !strings.Contains(md, heading+"\n_No records._\n") {
+					t.Errorf("show=%v: empty section %s lacks its heading and note", show, sec.title)
+				}
+			case strings.Contains(md, "## "+sec.title+" ("):
+				t.Errorf("show=%v: empty section %s rendered", show, sec.title)
+			}
+		}
+		if got, want := strings.Count(md, "_No records._"), map[bool]int{false: 0, true: 10}[show]; got != want {
+			t.Errorf("show=%v: %d placeholder notes, want %d", show, got, want)
+		}
+	}
+}
+
+func TestBuildMarkdownRendersContactMiddleInitial(t *testing.T) {
+	md := buildMarkdown(&Snapshot{Contacts: []itportal.Contact{
+		{ID: 4, FirstName: "Ada", MiddleInitial: "M", LastName: "Byte"},
+		{ID: 5, FirstName: "Bob", LastName: "Stone"},
+	}})
+	for _, want := range []string{"### Ada M. Byte (ID: 4)", "### Bob Stone (ID: 5)"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q", want)
+		}
+	}
+}
+
 func TestBuildMarkdownRendersHeadingLinks(t *testing.T) {
 	snap := &Snapshot{
 		Devices:    []itportal.Device{{ID: 9, Name: "fw01", URL: "https://portal.example/v4/app/devices/9"}},
@@ -104,6 +246,26 @@ func TestBuildMarkdownRendersHeadingLinks(t *testing.T) {
 	}
 }
 
+func TestBuildMarkdownRendersDiagrams(t *testing.T) {
+	diagram := &itportal.DocumentReference{ID: 600, Name: "HQ Network Diagram"}
+	snap := &Snapshot{
+		Sites:      []itportal.Site{{ID: 1, Name: "HQ", Diagram: diagram}, {ID: 2, Name: "Branch"}},
+		Facilities: []itportal.Facility{{ID: 3, Name: "Server Room", Diagram: diagram}},
+		Cabinets:   []itportal.Cabinet{{ID: 4, Name: "Rack A", Diagram: &itportal.DocumentReference{ID: 601}}},
+	}
+	md := buildMarkdown(snap)
+
+	if n := strings.Count(md, "- **Diagram**: HQ Network Diagram (Document ID: 600)"); n != 2 {
+		t.Errorf("site/facility diagram lines = %d, want 2", n)
+	}
+	if !strings.Contains(md, "- **Diagram**: Diagram (Document ID: 601)") {
+		t.Error("unnamed cabinet diagram not rendered")
+	}
+	if strings.Count(md, "**Diagram**") != 3 {
+		t.Errorf("diagram line rendered for an entity without one:\n%s", md)
+	}
+}
+
 func TestBuildMarkdownHeadingWithoutURLStaysPlain(t *testing.T) {
 	snap := &Snapshot{Devices: []itportal.Device{{ID: 9, Name: "fw01"}}}
 	md := buildMarkdown(snap)
@@ -140,3 +302,425 @@ func TestSnapshotMarkdownNoSecrets(t *testing.T) {
 		t.Error("expected non-secret username to be present")
 	}
 }
+
+// TestAccountMarkdownShowsTwoFAPresence verifies the account block reports
+// whether 2FA is configured and always shows Expires, without the 2FA code.
+func TestAccountMarkdownShowsTwoFAPresence(t *testing.T) {
+	snap := &Snapshot{Accounts: []itportal.Account{
+		{ID: 1, Username: "admin", TwoFACode: "483920", Password: "pw-1", Expires: "2027-01-31"},
+		{ID: 2, Username: "ops"},
+	}}
+	md := buildMarkdown(snap)
+
+	for _, want := range []string{
+		"- **Expires**: 2027-01-31\n- **2FA**: configured",
+		"- **Expires**: not set\n- **2FA**: not configured",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "483920") || strings.Contains(md, "pw-1") {
+		t.Error("account block leaked a secret value")
+	}
+}
+
+// TestSearchContactsByEmailAndPhone verifies contacts are found when the only
+// match is their email address or a phone number in a different format.
+func TestSearchContactsByEmailAndPhone(t *testing.T) {
+	snap := sampleSnapshot()
+	snap.Contacts = append(snap.Contacts,
+		itportal.Contact{ID: 301, FirstName: "Bob", LastName: "Stone", Email: "bob@globex.example", DirectNumber: "(555) 867-5309"},
+	)
+
+	byEmail := snap.SearchContacts("ada@acme.example", 10)
+	if len(byEmail) == 0 || byEmail[0].ID != 300 || byEmail[0].Matched != "email" {
+		t.Fatalf("email query: got %+v, want contact 300 matched on email", byEmail)
+	}
+
+	byPhone := snap.SearchContacts("555-867-5309", 10)
+	if len(byPhone) != 1 || byPhone[0].ID != 301 || byPhone[0].Matched != "directNumber" {
+		t.Fatalf("phone query: got %+v, want only contact 301 matched on directNumber", byPhone)
+	}
+
+	if got := snap.SearchContacts("nobody-here", 10); len(got) != 0 {
+		t.Errorf("unexpected matches for unknown query: %+v", got)
+	}
+}
+
+// TestNonBlockingStartupReturnsEmptyCache verifies New returns at once with a
+// usable empty snapshot while ITPortal is still answering, and turns ready once
+// the background build lands.
+func TestNonBlockingStartupReturnsEmptyCache(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"Acme"}]}}`))
+	}))
+	defer srv.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	c, err := New(ctx, itportal.NewClient(srv.URL, "k"), 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithStorePath(filepath.Join(t.TempDir(), "s.db")), WithNonBlockingStartup())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("non-blocking New took %s", elapsed)
+	}
+	if c.Ready() {
+		t.Error("cache ready before the first build")
+	}
+	if snap := c.Get(); snap == nil || len(snap.Companies) != 0 {
+		t.Fatalf("want empty snapshot, got %+v", snap)
+	}
+	if c.Store() == nil {
+		t.Fatal("store not usable before the first build")
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("cache never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(c.Get().Companies); got != 1 {
+		t.Errorf("companies after warm-up = %d, want 1", got)
+	}
+}
+
+// TestEnsureFreshWarnsAndRefreshesStaleSnapshot verifies a snapshot older than
+// the max staleness is logged, and rebuilt only when refresh-on-stale is set.
+func TestEnsureFreshWarnsAndRefreshesStaleSnapshot(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"Acme"}]}}`))
+	}))
+	defer srv.Close()
+
+	for _, refresh := range []bool{false, true} {
+		var logs bytes.Buffer
+		c, err := New(context.Background(), itportal.NewClient(srv.URL, "k"), 10, 10, time.Hour,
+			slog.New(slog.NewTextHandler(&logs, nil)),
+			WithStorePath(filepath.Join(t.TempDir(), "s.db")), WithMaxStaleness(time.Hour, refresh))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+
+		if age := c.EnsureFresh(context.Background()); age > time.Minute || strings.Contains(logs.String(), "stale") {
+			t.Fatalf("fresh snapshot treated as stale (age %s): %s", age, logs.String())
+		}
+
+		old := *c.Get()
+		old.GeneratedAt = time.Now().Add(-3 * time.Hour)
+		c.current.Store(&old)
+		before := hits.Load()
+
+		age := c.EnsureFresh(context.Background())
+		if !strings.Contains(logs.String(), "snapshot is stale") {
+			t.Errorf("refresh=%v: no staleness warning: %s", refresh, logs.String())
+		}
+		if refreshed := hits.Load() > before; refreshed != refresh {
+			t.Errorf("refresh=%v: snapshot rebuilt = %v", refresh, refreshed)
+		}
+		if refresh && age > time.Minute {
+			t.Errorf("age after refresh = %s", age)
+		}
+		if !refresh && age < 3*time.Hour {
+			t.Errorf("age without refresh = %s, want >= 3h", age)
+		}
+	}
+}
+
+// TestBuildFlagsSectionsAtTheirCap verifies a section returning exactly its cap
+// is logged as truncated and recorded on the snapshot, and others are not.
+func TestBuildFlagsSectionsAtTheirCap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/2.1/companies/", "/api/2.1/devices/":
+			_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"a"}]}}`))
+		}
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c, err := New(context.Background(), itportal.NewClient(srv.URL, "k"), 2, 3, time.Hour,
+		slog.New(slog.NewTextHandler(&logs, nil)), WithStorePath(filepath.Join(t.TempDir(), "s.db")))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := c.Get().Truncated; len(got) != 1 || got[0] != "companies" {
+		t.Errorf("Truncated = %v, want [companies] (devices are under their own cap)", got)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "section=companies limit=2") {
+		t.Errorf("no cap warning for companies:\n%s", out)
+	}
+	if strings.Contains(out, "section=devices") || strings.Contains(out, "section=sites") {
+		t.Errorf("cap warning for a section under its cap:\n%s", out)
+	}
+}
+
+// TestBuildUsesTypeLimits serves ten records of every type and checks each
+// section is fetched up to its own override, the rest to the global caps.
+func TestBuildUsesTypeLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		items := make([]string, 10)
+		for i := range items {
+			items[i] = fmt.Sprintf(`{"id":%d,"name":"n%d"}`, i+1, i+1)
+		}
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[` + strings.Join(items, ",") + `]}}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(context.Background(), itportal.NewClient(srv.URL, "k"), 4, 6, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithStorePath(filepath.Join(t.TempDir(), "s.db")),
+		WithTypeLimits(map[string]int{"device": 8, "kb": 2, "ipnetwork": 3}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	snap := c.Get()
+	for section, want := range map[string]int{
+		"devices": 8, "kbs": 2, "ip_networks": 3, "companies": 4, "sites": 4, "configurations": 4,
+	} {
+		if got := sectionCount(snap, section); got != want {
+			t.Errorf("%s: fetched %d, want %d", section, got, want)
+		}
+		if lim := c.sectionLimit(section); lim != want {
+			t.Errorf("%s: limit %d, want %d", section, lim, want)
+		}
+	}
+	if !slices.Contains(snap.Truncated, "kbs") || !slices.Contains(snap.Truncated, "devices") {
+		t.Errorf("Truncated = %v, want the capped kbs and devices listed", snap.Truncated)
+	}
+}
+
+// sectionCount is the record count snapshotCounts reports for section.
+func sectionCount(snap *Snapshot, section string) int {
+	kv := snapshotCounts(snap)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i] == section {
+			return kv[i+1].(int)
+		}
+	}
+	return -1
+}
+
+// TestBuildRendersSameMarkdownWhateverTheOrder verifies two builds over the
+// same records, paged in different orders, render identical Markdown.
+func TestBuildRendersSameMarkdownWhateverTheOrder(t *testing.T) {
+	var reversed atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		rows := []string{`{"id":3,"name":"sw03"}`, `{"id":1,"name":"fw01"}`, `{"id":2,"name":"ap02"}`}
+		if reversed.Load() {
+			slices.Reverse(rows)
+		}
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[` + strings.Join(rows, ",") + `]}}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(context.Background(), itportal.NewClient(srv.URL, "k"), 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithStorePath(filepath.Join(t.TempDir(), "s.db")))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	first := c.Get()
+	reversed.Store(true)
+	second, err := c.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if ids := []int{first.Devices[0].ID, first.Devices[1].ID, first.Devices[2].ID}; !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Errorf("device order = %v, want [1 2 3]", ids)
+	}
+	// The generated-at header differs between builds; compare the rest.
+	render := func(s *Snapshot) string {
+		cp := *s
+		cp.GeneratedAt = time.Time{}
+		return buildMarkdown(&cp)
+	}
+	if render(first) != render(second) {
+		t.Errorf("markdown differs between builds:\n%s\n---\n%s", render(first), render(second))
+	}
+}
+
+// TestStableBodyMovesTimestampToTrailer verifies WithStableBody renders builds
+// of the same data at different times with an identical body, differing only
+// in the trailing timestamp.
+func TestStableBodyMovesTimestampToTrailer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"fw01"}]}}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(context.Background(), itportal.NewClient(srv.URL, "k"), 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithStorePath(filepath.Join(t.TempDir(), "s.db")), WithStableBody())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	first := *c.Get()
+	second := first
+	second.GeneratedAt = first.GeneratedAt.Add(time.Hour)
+	a, b := buildMarkdown(&first), buildMarkdown(&second)
+
+	const marker = "---\n\n_Generated: "
+	ia, ib := strings.LastIndex(a, marker), strings.LastIndex(b, marker)
+	if ia < 0 || ib < 0 || !strings.HasSuffix(a, " UTC_\n") {
+		t.Fatalf("no timestamp trailer:\n%s", a)
+	}
+	if a[:ia] != b[:ib] {
+		t.Errorf("bodies differ between builds:\n%s\n---\n%s", a[:ia], b[:ib])
+	}
+	if a == b {
+		t.Error("trailers are identical; want each build's own timestamp")
+	}
+	if strings.Contains(a[:ia], "_Generated") {
+		t.Errorf("timestamp still in the body:\n%s", a[:ia])
+	}
+	if md := c.Get().Markdown; md != a {
+		t.Errorf("cached Markdown not rendered with the trailer:\n%s", md)
+	}
+}
+
+// TestConcurrentRefreshesShareOneBuild verifies refreshes arriving while a
+// build is in flight join it instead of starting their own.
+func TestConcurrentRefreshesShareOneBuild(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	gate := make(chan struct{})
+	s.gate.Store(&gate)
+	before := s.builds.Load()
+
+	const callers = 5
+	snaps := make([]*Snapshot, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snaps[i], errs[i] = c.Refresh(context.Background())
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.builds.Load() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("no build started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // let the other callers reach the in-flight build
+	close(gate)
+	wg.Wait()
+
+	if got := s.builds.Load() - before; got != 1 {
+		t.Errorf("%d builds ran for %d concurrent refreshes, want 1", got, callers)
+	}
+	for i := range callers {
+		if errs[i] != nil || snaps[i] != snaps[0] {
+			t.Errorf("caller %d got %p, %v; want the shared snapshot %p", i, snaps[i], errs[i], snaps[0])
+		}
+	}
+	if c.Get() != snaps[0] {
+		t.Error("shared snapshot not published")
+	}
+}
+
+// TestMergeDoesNotOverwriteRefresh verifies a write merge that started from
+// the previous snapshot cannot publish its copy over a refresh that finished
+// in the meantime.
+func TestMergeDoesNotOverwriteRefresh(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	old := c.Get()
+
+	entered := make(chan struct{})
+	merged := make(chan bool)
+	go func() {
+		merged <- c.mutate(func(snap *Snapshot) bool {
+			close(entered)
+			// Give the refresh every chance to publish while this merge
+			// still holds its copy of the old snapshot.
+			deadline := time.Now().Add(500 * time.Millisecond)
+			for c.Get() == old && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			snap.Devices = append(snap.Devices, itportal.Device{ID: 7, Name: "merged"})
+			return true
+		})
+	}()
+	<-entered
+	snap, err := c.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if !<-merged {
+		t.Fatal("merge reported no change")
+	}
+	if got := c.Get(); got.GeneratedAt.Before(snap.GeneratedAt) {
+		t.Errorf("current snapshot from %v, older than the refresh at %v", got.GeneratedAt, snap.GeneratedAt)
+	}
+}
+
+// TestCancelledCallerDoesNotFailSharedBuild verifies a caller giving up on a
+// shared build returns at once while the build carries on for the others.
+func TestCancelledCallerDoesNotFailSharedBuild(t *testing.T) {
+	var s jobServer
+	c := s.cache(t)
+	gate := make(chan struct{})
+	s.gate.Store(&gate)
+	before := s.builds.Load()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := c.Refresh(ctx)
+		cancelled <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.builds.Load() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("no build started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := c.Refresh(context.Background())
+		waiter <- err
+	}()
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(gate)
+	if err := <-waiter; err != nil {
+		t.Errorf("other caller got %v, want the shared snapshot", err)
+	}
+	if h := c.RefreshHealth(); h.ConsecutiveFailures != 0 {
+		t.Errorf("refresh health = %+v, want no failures", h)
+	}
+}
@@ -59,6 +59,21 @@ func StorePath() string {
 	return filepath.Join(dir, "snapshot.db")
 }
 
+// InstanceStorePath returns the store location for a named, non-default ITPortal
+// instance: StorePath() with "-<name>" inserted before the extension. Characters
+// that are unsafe in a file name are replaced with '_'.
+func InstanceStorePath(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+	p := StorePath()
+	ext := filepath.Ext(p)
+	return strings.TrimSuffix(p, ext) + "-" + safe + ext
+}
+
 // BuildStore creates (or rebuilds) the SQLite database at path from snap. Passing
 // an empty path builds a private in-memory database (used by tests). Any existing
 // file at path is replaced so a refresh always reflects the latest snapshot.
@@ -314,7 +329,7 @@ func (s *Store) load(snap *Snapshot) error {
 		coID, coName := companyRef(c.Company)
 		name := contactName(&c)
 		role := typeContactName(c.Type)
-		phone := firstNonEmpty(c.DirectNumber, c.Mobile, c.HomePhone)
+		phone := FirstNonEmpty(c.DirectNumber, c.Mobile, c.HomePhone)
 		summary := contactSummary(&c)
 		if _, err := tx.Exec(`INSERT INTO contacts(id,name,summary,role,company_id,company_name,email,phone,url) VALUES (?,?,?,?,?,?,?,?,?)`,
 			c.ID, name, summary, role, coID, coName, c.Email, phone, c.URL); err != nil {
@@ -372,7 +387,14 @@ func (s *Store) load(snap *Snapshot) error {
 		if net.DNSServer2 != nil {
 			dns += " " + net.DNSServer2.IP
 		}
-		body := strings.Join([]string{coName, siteName, net.NetworkAddress, net.SubnetMask, gw, dns, truncate(net.Description, 500)}, " ")
+		if net.DHCPServer != nil {
+			dns += " " + net.DHCPServer.IP
+		}
+		vlan := ""
+		if net.VlanID > 0 {
+			vlan = fmt.Sprintf("VLAN: %d", net.VlanID)
+		}
+		body := strings.Join([]string{coName, siteName, net.NetworkAddress, net.SubnetMask, gw, dns, vlan, truncate(net.Description, 500)}, " ")
 		if err := index("ipnetwork", net.ID, net.Name, summary, net.URL, body); err != nil {
 			return err
 		}
@@ -544,7 +566,8 @@ func typeContactName(t *itportal.ContactType) string {
 	return t.Name
 }
 
-func firstNonEmpty(vals ...string) string {
+// FirstNonEmpty returns the first of vals that is not blank, or "" when all are.
+func FirstNonEmpty(vals ...string) string {
 	for _, v := range vals {
 		if strings.TrimSpace(v) != "" {
 			return v
@@ -554,7 +577,7 @@ func firstNonEmpty(vals ...string) string {
 }
 
 func contactName(c *itportal.Contact) string {
-	name := strings.TrimSpace(c.FirstName + " " + c.LastName)
+	name := c.FullName()
 	if name == "" {
 		return "Contact #" + strconv.Itoa(c.ID)
 	}
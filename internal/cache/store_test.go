@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -41,6 +42,7 @@ func sampleSnapshot() *Snapshot {
 		IPNetworks: []itportal.IPNetwork{
 			{ID: 500, Name: "HQ LAN", NetworkAddress: "10.0.0.0", SubnetMask: "255.255.255.0", VlanID: 10,
 				DefaultGateway: &itportal.IPRef{IP: "10.0.0.1"},
+				DHCPServer:     &itportal.IPRef{IP: "10.0.0.2"},
 				Company:        &itportal.CompanyReference{ID: 1, Name: "Acme Corp"}},
 		},
 		Documents: []itportal.Document{
@@ -391,3 +393,112 @@ func keys(m map[string]any) []string {
 	}
 	return out
 }
+
+// stemStore indexes devices whose descriptions use singular, plural and
+// merely prefix-sharing words.
+func stemStore(t *testing.T) *Store {
+	t.Helper()
+	st, err := BuildStore(&Snapshot{Devices: []itportal.Device{
+		{ID: 1, Name: "sw-core", Description: "Core switch"},
+		{ID: 2, Name: "sw-access", Description: "Access switches for floor 2"},
+		{ID: 3, Name: "pbx", Description: "Switchboard console"},
+		{ID: 4, Name: "ups01", Description: "UPS batteries replaced"},
+		{ID: 5, Name: "mon01", Description: "Status page"},
+	}}, "")
+	if err != nil {
+		t.Fatalf("BuildStore: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func deviceIDs(rs []SearchResult) []int {
+	ids := make([]int, len(rs))
+	for i, r := range rs {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func TestSearchStemmedMatchesSingularAndPlural(t *testing.T) {
+	st := stemStore(t)
+	cases := []struct {
+		query string
+		plain []int
+		stem  []int
+	}{
+		// Search's own hits stay first; the stem adds the other form only.
+		{"switches", []int{2}, []int{2, 1}},
+		{"battery", nil, []int{4}},
+		{"batteries", []int{4}, []int{4}},
+	}
+	for _, c := range cases {
+		plain, err := st.Search(c.query, "", 50)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", c.query, err)
+		}
+		if got := deviceIDs(plain); fmt.Sprint(got) != fmt.Sprint(c.plain) {
+			t.Errorf("Search(%q) = %v, want %v", c.query, got, c.plain)
+		}
+		stemmed, err := st.SearchStemmed(c.query, "", 50)
+		if err != nil {
+			t.Fatalf("SearchStemmed(%q): %v", c.query, err)
+		}
+		if got := deviceIDs(stemmed); fmt.Sprint(got) != fmt.Sprint(c.stem) {
+			t.Errorf("SearchStemmed(%q) = %v, want %v", c.query, got, c.stem)
+		}
+	}
+}
+
+func TestSearchStemmedDoesNotOverMatch(t *testing.T) {
+	st := stemStore(t)
+	for query, banned := range map[string]int{
+		"switches": 3, // switchboard only shares a prefix with the stem
+		"status":   0, // -us is not a plural; "statu" must not be searched
+		"ups":      0, // too short to stem
+	} {
+		rs, err := st.SearchStemmed(query, "", 50)
+		if err != nil {
+			t.Fatalf("SearchStemmed(%q): %v", query, err)
+		}
+		for _, r := range rs {
+			if r.ID == banned {
+				t.Errorf("SearchStemmed(%q) matched device %d: %v", query, banned, deviceIDs(rs))
+			}
+		}
+	}
+}
+
+func TestNumberVariant(t *testing.T) {
+	cases := map[string]string{
+		"switches": "switch", "servers": "server", "batteries": "battery", "boxes": "box",
+		"battery": "batteries", "switch": "", "status": "", "access": "", "analysis": "",
+		"days": "day", "key": "", "fw01s": "", "ups": "",
+	}
+	for in, want := range cases {
+		if got := numberVariant(in); got != want {
+			t.Errorf("numberVariant(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestSearchIPNetworkByVLANAndDHCP finds a network by its "VLAN: N" text and
+// by its DHCP server's address.
+func TestSearchIPNetworkByVLANAndDHCP(t *testing.T) {
+	st := newTestStore(t)
+	for _, q := range []string{"VLAN 10", "10.0.0.2"} {
+		rs, err := st.Search(q, "", 50)
+		if err != nil {
+			t.Fatalf("Search %q: %v", q, err)
+		}
+		found := false
+		for _, r := range rs {
+			if r.Type == "ipnetwork" && r.ID == 500 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Search %q did not return the HQ LAN ipnetwork; got %+v", q, rs)
+		}
+	}
+}
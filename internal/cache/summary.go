@@ -78,7 +78,7 @@ func contactSummary(c *itportal.Contact) string {
 	if c.Type != nil {
 		parts = append(parts, c.Type.Name)
 	}
-	parts = append(parts, c.Email, firstNonEmpty(c.DirectNumber, c.Mobile))
+	parts = append(parts, c.Email, FirstNonEmpty(c.DirectNumber, c.Mobile))
 	return joinSummary(parts...)
 }
 
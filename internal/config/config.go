@@ -2,51 +2,111 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexfirilov/itportal-mcp/internal/itportal"
 )
 
+// Instance is one ITPortal tenant the server talks to.
+type Instance struct {
+	Name          string
+	BaseURL       string
+	APIKey        string
+	APIVersion    string
+	EncryptionKey string
+	// MCPAPIKey, when set, is an MCP API key pinned to this instance alone.
+	MCPAPIKey string
+}
+
 // Config holds all runtime configuration sourced from environment variables.
+// The ITPortal* fields describe the first (default) instance; Instances lists
+// every configured instance, starting with it.
 type Config struct {
-	ITPortalBaseURL         string
-	ITPortalAPIKey          string
-	ITPortalAPIVersion      string
-	ITPortalEncryptionKey   string
-	MCPAPIKey               string
-	ListenAddr              string
-	SnapshotRefreshInterval time.Duration
-	SnapshotLimitPerEntity  int
-	SnapshotDeviceLimit     int
+	ITPortalBaseURL           string
+	ITPortalAPIKey            string
+	ITPortalAPIVersion        string
+	ITPortalEncryptionKey     string
+	MCPAPIKey                 string
+	ListenAddr                string
+	SnapshotRefreshInterval   time.Duration
+	SnapshotLimitPerEntity    int
+	SnapshotTypeLimits        map[string]int // entity type → cap, from SNAPSHOT_LIMIT_<type>
+	SnapshotDeviceLimit       int
+	MCPReadOnly               bool
+	MCPWriteAllowedEntities   []string
+	UploadAllowedExtensions   map[string][]string
+	NormalizePhones           bool
+	PhoneCountryCode          string
+	DefaultCompanyID          int
+	ToolMaxResultBytes        int
+	SubResourceLimits         itportal.SubResourceLimits
+	EnableRawRequest          bool
+	MCPDenySecrets            bool
+	SnapshotStartupNonBlock   bool
+	SnapshotStartupTimeout    time.Duration
+	SnapshotMaxStaleness      time.Duration
+	SnapshotRefreshOnStale    bool
+	SnapshotMergeWrites       bool
+	SnapshotStableBody        bool
+	SnapshotEmptySections     bool
+	SnapshotFailureThreshold  int
+	ITPortalTotalHeader       string
+	ITPortalPagination        itportal.Pagination
+	ITPortalUserAgent         string
+	ITPortalCAFile            string
+	ITPortalInsecureSkipTLS   bool
+	ITPortalReferenceTTL      time.Duration
+	ITPortalProxyURL          *url.URL
+	ITPortalIdempotencyHeader string
+	MCPShutdownTimeout        time.Duration
+	MCPMaxConcurrentTools     int
+	MCPToolQueueTimeout       time.Duration
+	MCPToolTimeout            time.Duration
+	SearchStemming            bool
+	ValidateDeviceType        bool
+	LogLevel                  slog.Level
+	Instances                 []Instance
 }
 
 // Load reads and validates configuration from environment variables.
 // Call after loading a .env file if desired.
 func Load() (*Config, error) {
-	baseURL := os.Getenv("ITPORTAL_BASE_URL")
-	if baseURL == "" {
-		return nil, fmt.Errorf("ITPORTAL_BASE_URL is required")
+	apiVersion := os.Getenv("ITPORTAL_API_VERSION")
+	if apiVersion == "" {
+		apiVersion = itportal.DefaultAPIVersion
 	}
 
-	apiKey := os.Getenv("ITPORTAL_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("ITPORTAL_API_KEY is required")
+	instances, err := loadInstances(apiVersion)
+	if err != nil {
+		return nil, err
 	}
 
 	mcpKey := os.Getenv("MCP_API_KEY")
 	if mcpKey == "" {
 		return nil, fmt.Errorf("MCP_API_KEY is required")
 	}
-
-	apiVersion := os.Getenv("ITPORTAL_API_VERSION")
-	if apiVersion == "" {
-		apiVersion = itportal.DefaultAPIVersion
+	pinnedKeys := map[string]string{mcpKey: ""}
+	for _, inst := range instances {
+		if inst.MCPAPIKey == "" {
+			continue
+		}
+		if other, dup := pinnedKeys[inst.MCPAPIKey]; dup {
+			if other == "" {
+				other = "MCP_API_KEY"
+			} else {
+				other = "ITPORTAL_" + envName(other) + "_MCP_API_KEY"
+			}
+			return nil, fmt.Errorf("invalid ITPORTAL_%s_MCP_API_KEY: same key as %s", envName(inst.Name), other)
+		}
+		pinnedKeys[inst.MCPAPIKey] = inst.Name
 	}
 
-	encryptionKey := os.Getenv("ITPORTAL_ENCRYPTION_KEY")
-
 	listenAddr := os.Getenv("MCP_LISTEN_ADDR")
 	if listenAddr == "" {
 		listenAddr = ":8080"
@@ -81,15 +141,474 @@ func Load() (*Config, error) {
 		deviceLimit = n
 	}
 
+	typeLimits, err := parseTypeLimits(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	readOnly := false
+	if v := os.Getenv("MCP_READONLY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MCP_READONLY %q: %w", v, err)
+		}
+		readOnly = b
+	}
+
+	// Comma-separated entity types the write tools may touch. Empty = all.
+	var writeAllowed []string
+	for _, t := range strings.Split(os.Getenv("MCP_WRITE_ALLOWED_ENTITIES"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			writeAllowed = append(writeAllowed, t)
+		}
+	}
+
+	// Per upload kind extension overrides: "contact_photo=.png,.jpg;kb=.pdf".
+	// Kinds are validated by mcp.NewUploadExtensions.
+	var uploadExts map[string][]string
+	for _, entry := range strings.Split(os.Getenv("UPLOAD_ALLOWED_EXTENSIONS"), ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		kind, list, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(kind) == "" {
+			return nil, fmt.Errorf("invalid UPLOAD_ALLOWED_EXTENSIONS entry %q: want type=.ext,.ext", entry)
+		}
+		if uploadExts == nil {
+			uploadExts = make(map[string][]string)
+		}
+		uploadExts[strings.TrimSpace(kind)] = strings.Split(list, ",")
+	}
+
+	normalizePhones := false
+	if v := os.Getenv("NORMALIZE_PHONES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NORMALIZE_PHONES %q: %w", v, err)
+		}
+		normalizePhones = b
+	}
+
+	phoneCountryCode := strings.TrimPrefix(os.Getenv("PHONE_DEFAULT_COUNTRY_CODE"), "+")
+	if phoneCountryCode == "" {
+		phoneCountryCode = "1"
+	}
+	if _, err := strconv.Atoi(phoneCountryCode); err != nil {
+		return nil, fmt.Errorf("invalid PHONE_DEFAULT_COUNTRY_CODE %q: %w", phoneCountryCode, err)
+	}
+
+	// 0 = no default company.
+	defaultCompanyID := 0
+	if v := os.Getenv("ITPORTAL_DEFAULT_COMPANY_ID"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid ITPORTAL_DEFAULT_COMPANY_ID %q: must be a positive integer", v)
+		}
+		defaultCompanyID = n
+	}
+
+	// 0 = no cap on tool result size.
+	maxResultBytes := 0
+	if v := os.Getenv("TOOL_MAX_RESULT_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOOL_MAX_RESULT_BYTES %q: %w", v, err)
+		}
+		maxResultBytes = n
+	}
+
+	// Caps on device sub-resources fetched per device detail call.
+	subLimits := itportal.DefaultSubResourceLimits
+	for _, f := range []struct {
+		env string
+		dst *int
+	}{
+		{"DEVICE_IP_LIMIT", &subLimits.IPs},
+		{"DEVICE_NOTE_LIMIT", &subLimits.Notes},
+		{"DEVICE_MANAGEMENT_URL_LIMIT", &subLimits.ManagementURLs},
+	} {
+		if v := os.Getenv(f.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a positive integer", f.env, v)
+			}
+			*f.dst = n
+		}
+	}
+
+	enableRawRequest := false
+	if v := os.Getenv("ENABLE_RAW_REQUEST"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENABLE_RAW_REQUEST %q: %w", v, err)
+		}
+		enableRawRequest = b
+	}
+
+	denySecrets := false
+	if v := os.Getenv("MCP_DENY_SECRETS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MCP_DENY_SECRETS %q: %w", v, err)
+		}
+		denySecrets = b
+	}
+
+	startupNonBlocking := false
+	if v := os.Getenv("SNAPSHOT_STARTUP_NONBLOCKING"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_STARTUP_NONBLOCKING %q: %w", v, err)
+		}
+		startupNonBlocking = b
+	}
+
+	// 0 = the snapshot build's own limit.
+	var startupTimeout time.Duration
+	if v := os.Getenv("SNAPSHOT_STARTUP_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_STARTUP_TIMEOUT %q: %w", v, err)
+		}
+		startupTimeout = d
+	}
+
+	// 0 = no staleness check.
+	var maxStaleness time.Duration
+	if v := os.Getenv("SNAPSHOT_MAX_STALENESS"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_MAX_STALENESS %q: %w", v, err)
+		}
+		maxStaleness = d
+	}
+
+	refreshOnStale := false
+	if v := os.Getenv("SNAPSHOT_REFRESH_ON_STALE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_REFRESH_ON_STALE %q: %w", v, err)
+		}
+		refreshOnStale = b
+	}
+
+	mergeWrites := false
+	if v := os.Getenv("SNAPSHOT_MERGE_WRITES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_MERGE_WRITES %q: %w", v, err)
+		}
+		mergeWrites = b
+	}
+
+	stableBody := false
+	if v := os.Getenv("SNAPSHOT_STABLE_BODY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_STABLE_BODY %q: %w", v, err)
+		}
+		stableBody = b
+	}
+
+	emptySections := false
+	if v := os.Getenv("SNAPSHOT_EMPTY_SECTIONS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_EMPTY_SECTIONS %q: %w", v, err)
+		}
+		emptySections = b
+	}
+
+	// Consecutive failed snapshot builds before /readyz reports degraded; 0 never.
+	failureThreshold := 0
+	if v := os.Getenv("SNAPSHOT_FAILURE_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_FAILURE_THRESHOLD %q: %w", v, err)
+		}
+		failureThreshold = n
+	}
+
+	// Some endpoints report a list's total in a header rather than the JSON
+	// envelope; empty keeps the client default (X-Total-Count).
+	totalHeader := strings.TrimSpace(os.Getenv("ITPORTAL_TOTAL_HEADER"))
+
+	// offset (limit/offset, the default) or page (page/pageSize).
+	var pagination itportal.Pagination
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("ITPORTAL_PAGINATION"))); v != "" {
+		pagination = itportal.Pagination(v)
+		if pagination != itportal.PaginationOffset && pagination != itportal.PaginationPage {
+			return nil, fmt.Errorf("invalid ITPORTAL_PAGINATION %q: must be offset or page", v)
+		}
+	}
+
+	// Empty keeps the versioned default built in cmd/server.
+	userAgent := strings.TrimSpace(os.Getenv("ITPORTAL_USER_AGENT"))
+
+	shutdownTimeout := 10 * time.Second
+	if v := os.Getenv("MCP_SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MCP_SHUTDOWN_TIMEOUT %q: %w", v, err)
+		}
+		shutdownTimeout = d
+	}
+
+	// 0 = no cap on concurrent tool calls.
+	maxConcurrentTools := 0
+	if v := os.Getenv("MCP_MAX_CONCURRENT_TOOLS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MCP_MAX_CONCURRENT_TOOLS %q: %w", v, err)
+		}
+		maxConcurrentTools = n
+	}
+
+	// How long a call over MCP_MAX_CONCURRENT_TOOLS queues; 0 rejects at once.
+	toolQueueTimeout := 30 * time.Second
+	if v := os.Getenv("MCP_TOOL_QUEUE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MCP_TOOL_QUEUE_TIMEOUT %q: %w", v, err)
+		}
+		toolQueueTimeout = d
+	}
+
+	// Deadline of each tool call; 0 = none.
+	var toolTimeout time.Duration
+	if v := os.Getenv("MCP_TOOL_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MCP_TOOL_TIMEOUT %q: %w", v, err)
+		}
+		toolTimeout = d
+	}
+
+	searchStemming := false
+	if v := os.Getenv("SEARCH_STEMMING"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SEARCH_STEMMING %q: %w", v, err)
+		}
+		searchStemming = b
+	}
+
+	validateDeviceType := false
+	if v := os.Getenv("VALIDATE_DEVICE_TYPE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VALIDATE_DEVICE_TYPE %q: %w", v, err)
+		}
+		validateDeviceType = b
+	}
+
+	// debug adds a record of every tool call with its scrubbed input.
+	logLevel := slog.LevelInfo
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := logLevel.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: %w", v, err)
+		}
+	}
+
+	// PEM bundle trusted in addition to the system roots, for an internal CA.
+	caFile := strings.TrimSpace(os.Getenv("ITPORTAL_CA_FILE"))
+
+	insecureSkipTLS := false
+	if v := os.Getenv("ITPORTAL_INSECURE_SKIP_VERIFY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ITPORTAL_INSECURE_SKIP_VERIFY %q: %w", v, err)
+		}
+		insecureSkipTLS = b
+	}
+
+	// How long type, KB category and country lists are reused; 0 disables.
+	referenceTTL := itportal.DefaultReferenceTTL
+	if v := os.Getenv("ITPORTAL_REFERENCE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ITPORTAL_REFERENCE_TTL %q: %w", v, err)
+		}
+		referenceTTL = d
+	}
+
+	// nil = the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment.
+	var proxyURL *url.URL
+	if v := strings.TrimSpace(os.Getenv("ITPORTAL_PROXY_URL")); v != "" {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ITPORTAL_PROXY_URL %q: %w", v, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			return nil, fmt.Errorf("invalid ITPORTAL_PROXY_URL %q: want http://, https:// or socks5://host:port", v)
+		}
+		proxyURL = u
+	}
+
+	// Empty = no idempotency key on creates.
+	idempotencyHeader := strings.TrimSpace(os.Getenv("ITPORTAL_IDEMPOTENCY_HEADER"))
+
 	return &Config{
-		ITPortalBaseURL:         baseURL,
-		ITPortalAPIKey:          apiKey,
-		ITPortalAPIVersion:      apiVersion,
-		ITPortalEncryptionKey:   encryptionKey,
-		MCPAPIKey:               mcpKey,
-		ListenAddr:              listenAddr,
-		SnapshotRefreshInterval: refreshInterval,
-		SnapshotLimitPerEntity:  limitPerEntity,
-		SnapshotDeviceLimit:     deviceLimit,
+		ITPortalBaseURL:           instances[0].BaseURL,
+		ITPortalAPIKey:            instances[0].APIKey,
+		ITPortalAPIVersion:        instances[0].APIVersion,
+		ITPortalEncryptionKey:     instances[0].EncryptionKey,
+		MCPAPIKey:                 mcpKey,
+		ListenAddr:                listenAddr,
+		SnapshotRefreshInterval:   refreshInterval,
+		SnapshotLimitPerEntity:    limitPerEntity,
+		SnapshotTypeLimits:        typeLimits,
+		SnapshotDeviceLimit:       deviceLimit,
+		MCPReadOnly:               readOnly,
+		MCPWriteAllowedEntities:   writeAllowed,
+		UploadAllowedExtensions:   uploadExts,
+		NormalizePhones:           normalizePhones,
+		PhoneCountryCode:          phoneCountryCode,
+		DefaultCompanyID:          defaultCompanyID,
+		ToolMaxResultBytes:        maxResultBytes,
+		SubResourceLimits:         subLimits,
+		EnableRawRequest:          enableRawRequest,
+		MCPDenySecrets:            denySecrets,
+		SnapshotStartupNonBlock:   startupNonBlocking,
+		SnapshotStartupTimeout:    startupTimeout,
+		SnapshotMaxStaleness:      maxStaleness,
+		SnapshotRefreshOnStale:    refreshOnStale,
+		SnapshotMergeWrites:       mergeWrites,
+		SnapshotStableBody:        stableBody,
+		SnapshotEmptySections:     emptySections,
+		SnapshotFailureThreshold:  failureThreshold,
+		ITPortalTotalHeader:       totalHeader,
+		ITPortalPagination:        pagination,
+		ITPortalUserAgent:         userAgent,
+		ITPortalCAFile:            caFile,
+		ITPortalInsecureSkipTLS:   insecureSkipTLS,
+		ITPortalReferenceTTL:      referenceTTL,
+		ITPortalProxyURL:          proxyURL,
+		ITPortalIdempotencyHeader: idempotencyHeader,
+		MCPShutdownTimeout:        shutdownTimeout,
+		MCPMaxConcurrentTools:     maxConcurrentTools,
+		MCPToolQueueTimeout:       toolQueueTimeout,
+		MCPToolTimeout:            toolTimeout,
+		SearchStemming:            searchStemming,
+		ValidateDeviceType:        validateDeviceType,
+		LogLevel:                  logLevel,
+		Instances:                 instances,
 	}, nil
 }
+
+// typeLimitPrefix starts the per-type snapshot cap variables, e.g.
+// SNAPSHOT_LIMIT_device=5000.
+const typeLimitPrefix = "SNAPSHOT_LIMIT_"
+
+// typeLimitTypes are the snapshot entity types a SNAPSHOT_LIMIT_<type>
+// override may name, sorted.
+var typeLimitTypes = []string{
+	"account", "agreement", "cabinet", "company", "configuration", "contact",
+	"device", "document", "facility", "ipnetwork", "kb", "site",
+}
+
+// parseTypeLimits reads the SNAPSHOT_LIMIT_<type> overrides out of environ
+// (KEY=value entries) into an entity type → cap map. The type is matched
+// case-insensitively, ignoring underscores (SNAPSHOT_LIMIT_IP_NETWORK works);
+// SNAPSHOT_LIMIT_PER_ENTITY is the global default, not an override.
+func parseTypeLimits(environ []string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, kv := range environ {
+		key, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, typeLimitPrefix) || key == "SNAPSHOT_LIMIT_PER_ENTITY" || v == "" {
+			continue
+		}
+		typ := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(key, typeLimitPrefix), "_", ""))
+		if !slices.Contains(typeLimitTypes, typ) {
+			return nil, fmt.Errorf("invalid %s: unknown entity type %q (one of %s)", key, typ, strings.Join(typeLimitTypes, ", "))
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", key, v, err)
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be a positive integer", key, v)
+		}
+		limits[typ] = n
+	}
+	return limits, nil
+}
+
+// loadInstances reads the ITPortal instances to serve. Without
+// ITPORTAL_INSTANCES a single "default" instance comes from ITPORTAL_BASE_URL /
+// ITPORTAL_API_KEY / ITPORTAL_ENCRYPTION_KEY. With ITPORTAL_INSTANCES=emea,apac
+// each name reads ITPORTAL_<NAME>_BASE_URL and ITPORTAL_<NAME>_API_KEY (both
+// required) plus optional ITPORTAL_<NAME>_API_VERSION,
+// ITPORTAL_<NAME>_ENCRYPTION_KEY and ITPORTAL_<NAME>_MCP_API_KEY; the first
+// name is the default instance.
+func loadInstances(defaultAPIVersion string) ([]Instance, error) {
+	names := os.Getenv("ITPORTAL_INSTANCES")
+	if strings.TrimSpace(names) == "" {
+		baseURL := os.Getenv("ITPORTAL_BASE_URL")
+		if baseURL == "" {
+			return nil, fmt.Errorf("ITPORTAL_BASE_URL is required")
+		}
+		apiKey := os.Getenv("ITPORTAL_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("ITPORTAL_API_KEY is required")
+		}
+		return []Instance{{
+			Name:          "default",
+			BaseURL:       baseURL,
+			APIKey:        apiKey,
+			APIVersion:    defaultAPIVersion,
+			EncryptionKey: os.Getenv("ITPORTAL_ENCRYPTION_KEY"),
+		}}, nil
+	}
+
+	var out []Instance
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid ITPORTAL_INSTANCES %q: duplicate instance %q", names, name)
+		}
+		seen[name] = true
+
+		prefix := "ITPORTAL_" + envName(name) + "_"
+		inst := Instance{
+			Name:          name,
+			BaseURL:       os.Getenv(prefix + "BASE_URL"),
+			APIKey:        os.Getenv(prefix + "API_KEY"),
+			APIVersion:    os.Getenv(prefix + "API_VERSION"),
+			EncryptionKey: os.Getenv(prefix + "ENCRYPTION_KEY"),
+			MCPAPIKey:     os.Getenv(prefix + "MCP_API_KEY"),
+		}
+		if inst.BaseURL == "" {
+			return nil, fmt.Errorf("%sBASE_URL is required", prefix)
+		}
+		if inst.APIKey == "" {
+			return nil, fmt.Errorf("%sAPI_KEY is required", prefix)
+		}
+		if inst.APIVersion == "" {
+			inst.APIVersion = defaultAPIVersion
+		}
+		out = append(out, inst)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("invalid ITPORTAL_INSTANCES %q: no instance names", names)
+	}
+	return out, nil
+}
+
+// envName upper-cases an instance name and replaces anything that is not a
+// letter or digit with '_' so it can be embedded in an environment variable name.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseTypeLimits(t *testing.T) {
+	got, err := parseTypeLimits([]string{
+		"SNAPSHOT_LIMIT_device=5000",
+		"SNAPSHOT_LIMIT_KB=500",
+		"SNAPSHOT_LIMIT_IP_NETWORK=50",
+		"SNAPSHOT_LIMIT_PER_ENTITY=1000",
+		"SNAPSHOT_LIMIT_site=",
+		"SNAPSHOT_DEVICE_LIMIT=7",
+		"PATH=/bin",
+	})
+	if err != nil {
+		t.Fatalf("parseTypeLimits: %v", err)
+	}
+	if want := map[string]int{"device": 5000, "kb": 500, "ipnetwork": 50}; !maps.Equal(got, want) {
+		t.Errorf("limits = %v, want %v", got, want)
+	}
+
+	for env, want := range map[string]string{
+		"SNAPSHOT_LIMIT_toaster=5": `unknown entity type "toaster"`,
+		"SNAPSHOT_LIMIT_kb=many":   `invalid SNAPSHOT_LIMIT_kb "many"`,
+		"SNAPSHOT_LIMIT_kb=0":      "must be a positive integer",
+	} {
+		if _, err := parseTypeLimits([]string{env}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", env, err, want)
+		}
+	}
+}
+
+func TestLoadReadsTypeLimits(t *testing.T) {
+	t.Setenv("ITPORTAL_BASE_URL", "https://itportal.example")
+	t.Setenv("ITPORTAL_API_KEY", "k")
+	t.Setenv("MCP_API_KEY", "m")
+	t.Setenv("SNAPSHOT_LIMIT_PER_ENTITY", "800")
+	t.Setenv("SNAPSHOT_LIMIT_device", "5000")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.SnapshotLimitPerEntity != 800 || cfg.SnapshotTypeLimits["device"] != 5000 || len(cfg.SnapshotTypeLimits) != 1 {
+		t.Errorf("limits = %d, %v; want 800 and device 5000", cfg.SnapshotLimitPerEntity, cfg.SnapshotTypeLimits)
+	}
+}
+
+func TestLoadDefaultCompanyID(t *testing.T) {
+	t.Setenv("ITPORTAL_BASE_URL", "https://itportal.example")
+	t.Setenv("ITPORTAL_API_KEY", "k")
+	t.Setenv("MCP_API_KEY", "m")
+
+	t.Setenv("ITPORTAL_DEFAULT_COMPANY_ID", "42")
+	if cfg, err := Load(); err != nil || cfg.DefaultCompanyID != 42 {
+		t.Errorf("Load = %v, %v; want DefaultCompanyID 42", cfg, err)
+	}
+	t.Setenv("ITPORTAL_DEFAULT_COMPANY_ID", "acme")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "ITPORTAL_DEFAULT_COMPANY_ID") {
+		t.Errorf("non-numeric: err = %v, want an ITPORTAL_DEFAULT_COMPANY_ID error", err)
+	}
+}
@@ -3,10 +3,12 @@ package itportal
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -33,8 +35,27 @@ type Client struct {
 	authHeader    string
 	encryptionKey string
 	httpClient    *http.Client
+	subLimits     SubResourceLimits
+	logger        *slog.Logger
+	totalHeader   string
+	pagination    Pagination
+	userAgent     string
+	refs          referenceCache
+
+	idempotencyHeader string
+}
+
+// SubResourceLimits caps how many records the device sub-resource getters
+// (GetDeviceIPs, GetDeviceNotes, GetDeviceManagementURLs) page through.
+type SubResourceLimits struct {
+	IPs            int
+	Notes          int
+	ManagementURLs int
 }
 
+// DefaultSubResourceLimits are the caps used when none are configured.
+var DefaultSubResourceLimits = SubResourceLimits{IPs: 500, Notes: 500, ManagementURLs: 100}
+
 // Option configures a Client.
 type Option func(*Client)
 
@@ -53,16 +74,140 @@ func WithEncryptionKey(k string) Option {
 	return func(c *Client) { c.encryptionKey = k }
 }
 
+// WithSubResourceLimits overrides the device sub-resource caps. Zero or negative
+// fields keep their DefaultSubResourceLimits value.
+func WithSubResourceLimits(l SubResourceLimits) Option {
+	return func(c *Client) {
+		if l.IPs > 0 {
+			c.subLimits.IPs = l.IPs
+		}
+		if l.Notes > 0 {
+			c.subLimits.Notes = l.Notes
+		}
+		if l.ManagementURLs > 0 {
+			c.subLimits.ManagementURLs = l.ManagementURLs
+		}
+	}
+}
+
+// WithLogger sets the logger used for client-side warnings such as list
+// results truncated at their cap (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		if l != nil {
+			c.logger = l
+		}
+	}
+}
+
+// DefaultTotalHeader is the response header read for a list's total record
+// count when the JSON envelope does not report one.
+const DefaultTotalHeader = "X-Total-Count"
+
+// WithTotalHeader overrides the header consulted for a list's total count
+// (default DefaultTotalHeader).
+func WithTotalHeader(name string) Option {
+	return func(c *Client) {
+		if name != "" {
+			c.totalHeader = name
+		}
+	}
+}
+
+// Pagination selects the query parameters list requests page with.
+type Pagination string
+
+const (
+	// PaginationOffset pages with limit/offset, following the v2.1 nextCursor
+	// when one is returned. This is the default.
+	PaginationOffset Pagination = "offset"
+	// PaginationPage pages with page/pageSize, pages numbered from 1, for
+	// ITPortal builds whose endpoints ignore offset.
+	PaginationPage Pagination = "page"
+)
+
+// WithPagination sets the pagination style of list requests (default
+// PaginationOffset). An empty style keeps the default.
+func WithPagination(p Pagination) Option {
+	return func(c *Client) {
+		if p != "" {
+			c.pagination = p
+		}
+	}
+}
+
+// Pagination reports the pagination style of list requests.
+func (c *Client) Pagination() Pagination {
+	return c.pagination
+}
+
+// DefaultUserAgent identifies this integration in ITPortal's access logs when
+// no versioned User-Agent is configured.
+const DefaultUserAgent = "itportal-mcp"
+
+// WithUserAgent overrides the User-Agent header sent on every request (default
+// DefaultUserAgent).
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		if ua != "" {
+			c.userAgent = ua
+		}
+	}
+}
+
+// WithTLSConfig sends requests over a transport using cfg (see LoadTLSConfig),
+// keeping HTTP/2. A nil cfg keeps the default transport.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		if cfg == nil {
+			return
+		}
+		t := c.transport()
+		t.TLSClientConfig = cfg
+		t.ForceAttemptHTTP2 = true
+	}
+}
+
+// WithProxyURL sends every request through the given proxy, overriding the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment the default transport honours.
+// A nil u keeps the environment's proxy settings.
+func WithProxyURL(u *url.URL) Option {
+	return func(c *Client) {
+		if u == nil {
+			return
+		}
+		c.transport().Proxy = http.ProxyURL(u)
+	}
+}
+
+// transport returns the client's own transport, first replacing the shared
+// http.DefaultTransport with a clone (which keeps ProxyFromEnvironment) so
+// options can adjust it.
+func (c *Client) transport() *http.Transport {
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	c.httpClient = &http.Client{Timeout: c.httpClient.Timeout, Transport: t}
+	return t
+}
+
 // NewClient creates a new ITPortal API client.
 // baseURL is the root of the ITPortal instance (no trailing slash).
 // apiKey is the ITPortal API token; it is sent as HTTP Basic auth (key as password)
 // unless it already carries an explicit scheme ("Basic "/"Bearer ").
 func NewClient(baseURL, apiKey string, opts ...Option) *Client {
 	c := &Client{
-		baseURL:    strings.TrimRight(baseURL, "/"),
-		apiVersion: DefaultAPIVersion,
-		authHeader: buildAuthHeader(apiKey),
-		httpClient: &http.Client{Timeout: 60 * time.Second},
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		apiVersion:  DefaultAPIVersion,
+		authHeader:  buildAuthHeader(apiKey),
+		httpClient:  &http.Client{Timeout: 60 * time.Second},
+		subLimits:   DefaultSubResourceLimits,
+		logger:      slog.Default(),
+		totalHeader: DefaultTotalHeader,
+		pagination:  PaginationOffset,
+		userAgent:   DefaultUserAgent,
+		refs:        referenceCache{ttl: DefaultReferenceTTL},
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -104,6 +249,7 @@ type ListOptions struct {
 	InOut          *bool // nil = all, true = active, false = inactive
 	Deleted        *bool
 	ForeignID      string
+	ForeignType    string
 	Limit          int
 	Offset         int    // deprecated in v2.1; prefer Cursor
 	Cursor         string // v2.1 cursor pagination token
@@ -111,7 +257,9 @@ type ListOptions struct {
 	Extra          map[string]string
 }
 
-func (o *ListOptions) toQuery() url.Values {
+// toQuery renders o as query parameters. With PaginationPage, Limit becomes
+// pageSize and Offset the page holding it.
+func (o *ListOptions) toQuery(p Pagination) url.Values {
 	q := url.Values{}
 	if o == nil {
 		return q
@@ -164,15 +312,25 @@ func (o *ListOptions) toQuery() url.Values {
 	if o.ForeignID != "" {
 		q.Set("foreignId", o.ForeignID)
 	}
-	if o.Limit > 0 {
-		q.Set("limit", strconv.Itoa(o.Limit))
+	if o.ForeignType != "" {
+		q.Set("foreignType", o.ForeignType)
+	}
+	if p == PaginationPage {
+		if o.Limit > 0 {
+			q.Set("pageSize", strconv.Itoa(o.Limit))
+			q.Set("page", strconv.Itoa(o.Offset/o.Limit+1))
+		}
+	} else {
+		if o.Limit > 0 {
+			q.Set("limit", strconv.Itoa(o.Limit))
+		}
+		if o.Offset > 0 {
+			q.Set("offset", strconv.Itoa(o.Offset))
+		}
 	}
 	if o.Cursor != "" {
 		q.Set("cursor", o.Cursor)
 	}
-	if o.Offset > 0 {
-		q.Set("offset", strconv.Itoa(o.Offset))
-	}
 	if o.OrderBy != "" {
 		q.Set("orderBy", o.OrderBy)
 	}
@@ -199,7 +357,7 @@ type apiResponse struct {
 
 // doMeta executes an authenticated request and returns the full response. It does
 // not enforce a 2xx status; callers decide how to interpret the result.
-func (c *Client) doMeta(ctx context.Context, method, path string, body interface{}, query url.Values) (*apiResponse, error) {
+func (c *Client) doMeta(ctx context.Context, method, path string, body interface{}, query url.Values, header http.Header) (*apiResponse, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
@@ -216,6 +374,7 @@ func (c *Client) doMeta(ctx context.Context, method, path string, body interface
 	}
 
 	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("User-Agent", c.userAgent)
 	req.Header.Set("Accept", "application/json")
 	if body != nil {
 		// RFC 7396 merge-patch content type is required for PATCH in v2.1.
@@ -228,6 +387,9 @@ func (c *Client) doMeta(ctx context.Context, method, path string, body interface
 	if c.encryptionKey != "" {
 		req.Header.Set("X-Encryption-Key", c.encryptionKey)
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	if len(query) > 0 {
 		req.URL.RawQuery = query.Encode()
 	}
@@ -245,28 +407,70 @@ func (c *Client) doMeta(ctx context.Context, method, path string, body interface
 	return &apiResponse{Status: resp.StatusCode, Header: resp.Header, Body: respBody}, nil
 }
 
-// do executes a request and returns the body, enforcing a 2xx status code.
+// do executes a request and returns the body, enforcing a 2xx status code and a
+// successful envelope code. Failures are returned as *APIError.
 func (c *Client) do(ctx context.Context, method, path string, body interface{}, query url.Values) ([]byte, error) {
-	resp, err := c.doMeta(ctx, method, path, body, query)
+	resp, err := c.doChecked(ctx, method, path, body, query)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// doChecked is do for callers that also need the response headers.
+func (c *Client) doChecked(ctx context.Context, method, path string, body interface{}, query url.Values) (*apiResponse, error) {
+	resp, err := c.doMeta(ctx, method, path, body, query, nil)
 	if err != nil {
 		return nil, err
 	}
 	if resp.Status < 200 || resp.Status >= 300 {
-		return nil, fmt.Errorf("ITPortal API %s %s → %d: %s", method, path, resp.Status, string(resp.Body))
+		return nil, &APIError{Method: method, Path: path, Status: resp.Status, Message: string(resp.Body)}
 	}
-	return resp.Body, nil
+	if err := softError(method, path, resp.Status, resp.Body); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RawRequest performs an arbitrary authenticated request against path (written
+// with the /api/2.0/ prefix like every other call-site) and returns the HTTP
+// status and raw body without enforcing a 2xx status. It backs the raw_request
+// escape hatch for endpoints the typed methods don't cover.
+func (c *Client) RawRequest(ctx context.Context, method, path string, body interface{}, query url.Values) (int, []byte, error) {
+	resp, err := c.doMeta(ctx, method, path, body, query, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.Status, resp.Body, nil
 }
 
 // createID POSTs a new entity and returns the id parsed from the Location header.
 // v2.1 responds 201 with a Location header and no body.
 func (c *Client) createID(ctx context.Context, path string, body interface{}) (int, error) {
-	resp, err := c.doMeta(ctx, http.MethodPost, path, body, nil)
+	var header http.Header
+	done := func(bool) {}
+	if c.idempotencyHeader != "" {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("marshal request body: %w", err)
+		}
+		body = json.RawMessage(data)
+		var key string
+		key, done = idempotencyKey(ctx, path, data)
+		header = http.Header{}
+		header.Set(c.idempotencyHeader, key)
+	}
+	resp, err := c.doMeta(ctx, http.MethodPost, path, body, nil, header)
 	if err != nil {
 		return 0, err
 	}
 	if resp.Status < 200 || resp.Status >= 300 {
-		return 0, fmt.Errorf("ITPortal API POST %s → %d: %s", path, resp.Status, string(resp.Body))
+		return 0, &APIError{Method: http.MethodPost, Path: path, Status: resp.Status, Message: string(resp.Body)}
 	}
+	if err := softError(http.MethodPost, path, resp.Status, resp.Body); err != nil {
+		return 0, err
+	}
+	done(true)
 	if id := parseLocationID(resp.Header.Get("Location")); id != 0 {
 		return id, nil
 	}
@@ -307,14 +511,16 @@ type pageMeta struct {
 	NextCursor string
 }
 
-// listPage fetches a single page of entities and its pagination metadata.
+// listPage fetches a single page of entities and its pagination metadata. When
+// the envelope reports no total, the client's total header (X-Total-Count by
+// default) is used instead.
 func listPage[T any](ctx context.Context, c *Client, path string, opts *ListOptions) ([]T, pageMeta, error) {
-	data, err := c.do(ctx, http.MethodGet, path, nil, opts.toQuery())
+	resp, err := c.doChecked(ctx, http.MethodGet, path, nil, opts.toQuery(c.pagination))
 	if err != nil {
 		return nil, pageMeta{}, err
 	}
+	data := resp.Body
 	var wrapper struct {
-		Code int `json:"code"`
 		Data struct {
 			Results    []T    `json:"results"`
 			Total      int    `json:"total"`
@@ -328,6 +534,11 @@ func listPage[T any](ctx context.Context, c *Client, path string, opts *ListOpti
 		return nil, pageMeta{}, fmt.Errorf("unmarshal list response from %s: %w", path, err)
 	}
 	meta := pageMeta{Total: wrapper.Data.Total, Count: wrapper.Data.Count, NextCursor: wrapper.Data.NextCursor}
+	if meta.Total == 0 && c.totalHeader != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get(c.totalHeader))); err == nil && n > 0 {
+			meta.Total = n
+		}
+	}
 	return wrapper.Data.Results, meta, nil
 }
 
@@ -346,6 +557,17 @@ func listOne[T any](ctx context.Context, c *Client, path string, opts *ListOptio
 }
 
 // listAll fetches all pages up to maxItems, following the v2.1 nextCursor token.
+// Endpoints that report a total (in the envelope or the total header) but no
+// cursor are paged by offset instead, and paging stops once the total is reached.
+// With PaginationPage every page is requested by number instead, and paging
+// stops at the first short or empty page or once the total is reached.
+// When more records exist beyond maxItems (shown by the reported total, from the
+// envelope or the total header, by a fresh cursor or, for numbered pages, by a
+// full last page) the result is cut at the cap and a warning is logged, so
+// silently truncated data is visible to operators.
+// ctx is checked before every page request, so a cancelled or expired context
+// stops pagination promptly; the pages fetched so far are returned with the
+// context error.
 func listAll[T any](ctx context.Context, c *Client, path string, opts *ListOptions, maxItems int) ([]T, error) {
 	if opts == nil {
 		opts = &ListOptions{}
@@ -353,23 +575,60 @@ func listAll[T any](ctx context.Context, c *Client, path string, opts *ListOptio
 	const pageSize = 100
 	var all []T
 	cursor := ""
+	byPage := c.pagination == PaginationPage
+	byOffset := byPage
 	for {
+		if err := ctx.Err(); err != nil {
+			return all, err
+		}
 		pagOpts := *opts
 		pagOpts.Limit = pageSize
 		pagOpts.Cursor = cursor
+		if byOffset {
+			pagOpts.Offset = opts.Offset + len(all)
+		}
 
 		items, meta, err := listPage[T](ctx, c, path, &pagOpts)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return all, ctxErr
+			}
 			return nil, err
 		}
 		all = append(all, items...)
 		if len(all) >= maxItems {
+			// A cap that lands on a page boundary leaves nothing over, so the
+			// reported total or a fresh cursor is what shows records remain.
+			// Numbered pages carry neither; a full last page is taken to mean
+			// more follow.
+			more := len(all) > maxItems ||
+				(meta.Total > 0 && opts.Offset+maxItems < meta.Total) ||
+				(meta.NextCursor != "" && meta.NextCursor != cursor && len(items) > 0) ||
+				(byPage && meta.Total == 0 && len(items) == pageSize)
+			if more {
+				c.logger.Warn("list truncated at cap; raise the limit to see every record",
+					"path", path, "cap", maxItems)
+			}
 			all = all[:maxItems]
 			break
 		}
-		if meta.NextCursor == "" || len(items) == 0 {
+		if len(items) == 0 || (meta.Total > 0 && len(all) >= meta.Total) {
 			break
 		}
+		if byPage {
+			// A page shorter than requested is the last one.
+			if len(items) < pageSize {
+				break
+			}
+			continue
+		}
+		if meta.NextCursor == "" {
+			if cursor != "" || meta.Total == 0 {
+				break
+			}
+			byOffset = true
+			continue
+		}
 		// Guard against endpoints (e.g. some device sub-resource collections) that
 		// echo back the same nextCursor regardless of the cursor we send. Without
 		// this check the loop would re-fetch the same page and append duplicate
@@ -382,14 +641,45 @@ func listAll[T any](ctx context.Context, c *Client, path string, opts *ListOptio
 	return all, nil
 }
 
-// getOne fetches a single entity. v2.1 returns the record inside data.results[0].
+// getOne fetches a single entity. Detail endpoints return the record either as
+// the data object itself or, like v2.1, inside data.results[0]; both are read.
+// A missing record, whether an empty result or a 404, is a *NotFoundError.
 func getOne[T any](ctx context.Context, c *Client, path string) (*T, error) {
-	items, _, err := listPage[T](ctx, c, path, nil)
+	data, err := c.do(ctx, http.MethodGet, path, nil, nil)
+	if IsNotFound(err) {
+		return nil, notFoundAt(path)
+	}
 	if err != nil {
 		return nil, err
 	}
+	var wrapper struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal response from %s: %w", path, err)
+	}
+	var fields map[string]json.RawMessage
+	if len(wrapper.Data) > 0 {
+		if err := json.Unmarshal(wrapper.Data, &fields); err != nil {
+			return nil, fmt.Errorf("unmarshal response from %s: %w", path, err)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, notFoundAt(path)
+	}
+	if _, listed := fields["results"]; !listed {
+		var v T
+		if err := json.Unmarshal(wrapper.Data, &v); err != nil {
+			return nil, fmt.Errorf("unmarshal response from %s: %w", path, err)
+		}
+		return &v, nil
+	}
+	var items []T
+	if err := json.Unmarshal(fields["results"], &items); err != nil {
+		return nil, fmt.Errorf("unmarshal list response from %s: %w", path, err)
+	}
 	if len(items) == 0 {
-		return nil, fmt.Errorf("no entity found at %s", path)
+		return nil, notFoundAt(path)
 	}
 	return &items[0], nil
 }
@@ -493,7 +783,7 @@ func (c *Client) DeleteDevice(ctx context.Context, id string) error {
 }
 
 func (c *Client) GetDeviceIPs(ctx context.Context, deviceID string) ([]DeviceIP, error) {
-	return listAll[DeviceIP](ctx, c, "/api/2.0/devices/"+deviceID+"/ips/", nil, 500)
+	return listAll[DeviceIP](ctx, c, "/api/2.0/devices/"+deviceID+"/ips/", nil, c.subLimits.IPs)
 }
 
 func (c *Client) AddDeviceIP(ctx context.Context, deviceID string, ip *DeviceIP) (*DeviceIP, error) {
@@ -506,7 +796,7 @@ func (c *Client) AddDeviceIP(ctx context.Context, deviceID string, ip *DeviceIP)
 }
 
 func (c *Client) GetDeviceNotes(ctx context.Context, deviceID string) ([]DeviceNote, error) {
-	return listAll[DeviceNote](ctx, c, "/api/2.0/devices/"+deviceID+"/notes/", nil, 500)
+	return listAll[DeviceNote](ctx, c, "/api/2.0/devices/"+deviceID+"/notes/", nil, c.subLimits.Notes)
 }
 
 func (c *Client) AddDeviceNote(ctx context.Context, deviceID string, note *DeviceNote) (*DeviceNote, error) {
@@ -519,7 +809,7 @@ func (c *Client) AddDeviceNote(ctx context.Context, deviceID string, note *Devic
 }
 
 func (c *Client) GetDeviceManagementURLs(ctx context.Context, deviceID string) ([]DeviceMUrl, error) {
-	return listAll[DeviceMUrl](ctx, c, "/api/2.0/devices/"+deviceID+"/managementUrls/", nil, 100)
+	return listAll[DeviceMUrl](ctx, c, "/api/2.0/devices/"+deviceID+"/managementUrls/", nil, c.subLimits.ManagementURLs)
 }
 
 func (c *Client) AddDeviceManagementURL(ctx context.Context, deviceID string, murl *DeviceMUrl) (*DeviceMUrl, error) {
@@ -540,6 +830,23 @@ func (c *Client) GetDeviceCredentials(ctx context.Context, deviceID string) ([]C
 	return listAll[Credential](ctx, c, "/api/2.0/devices/"+deviceID+"/credentials/", nil, 100)
 }
 
+// AddDeviceCredential stores a credential on a device. Only the new ID is read
+// back; the returned Credential is cred with ID set.
+func (c *Client) AddDeviceCredential(ctx context.Context, deviceID string, cred *Credential) (*Credential, error) {
+	id, err := c.createID(ctx, "/api/2.0/devices/"+deviceID+"/credentials/", cred)
+	if err != nil {
+		return nil, err
+	}
+	cred.ID = id
+	return cred, nil
+}
+
+// GetDeviceConfigFiles lists the configuration files stored on a device, up
+// to 500. Upload new ones with UploadFile.
+func (c *Client) GetDeviceConfigFiles(ctx context.Context, deviceID string) ([]DeviceConfigFile, error) {
+	return listAll[DeviceConfigFile](ctx, c, "/api/2.0/devices/"+deviceID+"/configurationFiles/", nil, 500)
+}
+
 // ---- Knowledge Base ----
 
 func (c *Client) ListKBs(ctx context.Context, opts *ListOptions) ([]KB, int, error) {
@@ -569,7 +876,7 @@ func (c *Client) DeleteKB(ctx context.Context, id string) error {
 }
 
 func (c *Client) ListKBCategories(ctx context.Context) ([]KBCategory, error) {
-	return listAll[KBCategory](ctx, c, "/api/2.0/categories/kb/", nil, 500)
+	return cachedList[KBCategory](ctx, c, "/api/2.0/categories/kb/", 500)
 }
 
 // ---- Contacts ----
@@ -848,41 +1155,41 @@ func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
 }
 
 func (c *Client) ListSecurityGroups(ctx context.Context) ([]SecurityGroup, error) {
-	return listAll[SecurityGroup](ctx, c, "/api/2.0/system/groups/securityGroups/", nil, 500)
+	return cachedList[SecurityGroup](ctx, c, "/api/2.0/system/groups/securityGroups/", 500)
 }
 
 func (c *Client) ListCountries(ctx context.Context) ([]Country, error) {
-	return listAll[Country](ctx, c, "/api/2.0/system/countries/", nil, 300)
+	return cachedList[Country](ctx, c, "/api/2.0/system/countries/", 300)
 }
 
 // ---- Reference types ----
 
 func (c *Client) ListDeviceTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/device/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/device/", 500)
 }
 
 func (c *Client) ListCompanyTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/company/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/company/", 500)
 }
 
 func (c *Client) ListAccountTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/account/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/account/", 500)
 }
 
 func (c *Client) ListContactTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/contact/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/contact/", 500)
 }
 
 func (c *Client) ListDocumentTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/document/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/document/", 500)
 }
 
 func (c *Client) ListAgreementTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/agreement/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/agreement/", 500)
 }
 
 func (c *Client) ListFacilityTypes(ctx context.Context) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/facility/", nil, 500)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/facility/", 500)
 }
 
 // ---- File Upload ----
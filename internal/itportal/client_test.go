@@ -1,11 +1,18 @@
 package itportal
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -136,6 +143,293 @@ func TestCursorPagination(t *testing.T) {
 	}
 }
 
+// TestListAllVariantsPage runs every ListAll* snapshot lister against a
+// two-page cursor listing of its own collection, uncapped and capped.
+func TestListAllVariantsPage(t *testing.T) {
+	type lister func(c *Client, max int) (int, error)
+	cases := []struct {
+		path string
+		list lister
+	}{
+		{"/api/2.1/companies/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllCompanies(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/sites/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllSites(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/devices/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllDevices(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/kbs/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllKBs(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/contacts/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllContacts(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/accounts/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllAccounts(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/agreements/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllAgreements(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/documents/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllDocuments(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/ipnetworks/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllIPNetworks(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/facilities/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllFacilities(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/cabinets/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllCabinets(context.Background(), nil, max)
+			return len(v), err
+		}},
+		{"/api/2.1/configurations/", func(c *Client, max int) (int, error) {
+			v, err := c.ListAllConfigurations(context.Background(), nil, max)
+			return len(v), err
+		}},
+	}
+	for _, tc := range cases {
+		var pages []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != tc.path {
+				t.Errorf("path = %q, want %q", r.URL.Path, tc.path)
+			}
+			cursor := r.URL.Query().Get("cursor")
+			pages = append(pages, cursor)
+			if cursor == "" {
+				writeList(w, []map[string]int{{"id": 1}, {"id": 2}}, "CUR2")
+				return
+			}
+			writeList(w, []map[string]int{{"id": 3}}, "")
+		}))
+		c := newTestClient(srv.URL)
+
+		if n, err := tc.list(c, 100); err != nil || n != 3 {
+			t.Errorf("%s: got %d records (err %v), want 3", tc.path, n, err)
+		}
+		if strings.Join(pages, ",") != ",CUR2" {
+			t.Errorf("%s: cursors requested = %q, want both pages", tc.path, pages)
+		}
+		if n, err := tc.list(c, 2); err != nil || n != 2 {
+			t.Errorf("%s: capped at 2, got %d records (err %v)", tc.path, n, err)
+		}
+		srv.Close()
+	}
+}
+
+// totalHeaderServer serves n companies by limit/offset, reporting the total only
+// in the given response header; the envelope has no total and no cursor.
+func totalHeaderServer(t *testing.T, header string, n int, calls *int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		page := []Company{}
+		for id := offset + 1; id <= offset+limit && id <= n; id++ {
+			page = append(page, Company{ID: id})
+		}
+		w.Header().Set(header, strconv.Itoa(n))
+		writeList(w, page, "")
+	}))
+}
+
+func TestListAllPagesByTotalHeader(t *testing.T) {
+	var calls int
+	srv := totalHeaderServer(t, "X-Total-Count", 250, &calls)
+	defer srv.Close()
+
+	c := newTestClient(srv.URL)
+	all, err := c.ListAllCompanies(context.Background(), nil, 1000)
+	if err != nil {
+		t.Fatalf("ListAllCompanies: %v", err)
+	}
+	if len(all) != 250 || all[0].ID != 1 || all[249].ID != 250 {
+		t.Fatalf("got %d companies (first %d), want IDs 1..250", len(all), all[0].ID)
+	}
+	if calls != 3 {
+		t.Errorf("made %d requests, want 3 pages of 100", calls)
+	}
+
+	// The reported total also shows through List*.
+	if _, total, err := c.ListCompanies(context.Background(), &ListOptions{Limit: 10}); err != nil || total != 250 {
+		t.Errorf("ListCompanies total = %d, err %v; want 250", total, err)
+	}
+}
+
+// TestListAllWarnsOnHeaderTotalPastCap verifies the total header alone is
+// enough to flag a cap that offset paging fills exactly.
+func TestListAllWarnsOnHeaderTotalPastCap(t *testing.T) {
+	var calls int
+	srv := totalHeaderServer(t, "X-Total-Count", 250, &calls)
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c := newTestClient(srv.URL, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	all, err := c.ListAllCompanies(context.Background(), nil, 200)
+	if err != nil || len(all) != 200 {
+		t.Fatalf("got %d companies, err %v; want 200", len(all), err)
+	}
+	if !strings.Contains(logs.String(), "list truncated at cap") || !strings.Contains(logs.String(), "cap=200") {
+		t.Errorf("missing truncation warning: %q", logs.String())
+	}
+
+	logs.Reset()
+	if all, err = c.ListAllCompanies(context.Background(), nil, 250); err != nil || len(all) != 250 {
+		t.Fatalf("at exact total: got %d companies, err %v", len(all), err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("warned although nothing was truncated: %q", logs.String())
+	}
+}
+
+func TestListAllCustomTotalHeader(t *testing.T) {
+	var calls int
+	srv := totalHeaderServer(t, "X-Result-Count", 120, &calls)
+	defer srv.Close()
+
+	// The default header is absent, so only the first page is fetched.
+	all, err := newTestClient(srv.URL).ListAllCompanies(context.Background(), nil, 1000)
+	if err != nil || len(all) != 100 {
+		t.Fatalf("default header: got %d companies, err %v; want 100", len(all), err)
+	}
+
+	c := newTestClient(srv.URL, WithTotalHeader("X-Result-Count"))
+	if all, err = c.ListAllCompanies(context.Background(), nil, 1000); err != nil || len(all) != 120 {
+		t.Fatalf("custom header: got %d companies, err %v; want 120", len(all), err)
+	}
+}
+
+func TestListAllStopsAtReportedTotal(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// A fresh cursor every time, but the header says there are only 2.
+		w.Header().Set("X-Total-Count", "2")
+		writeList(w, []Company{{ID: calls}}, "c"+strconv.Itoa(calls))
+	}))
+	defer srv.Close()
+
+	all, err := newTestClient(srv.URL).ListAllCompanies(context.Background(), nil, 100)
+	if err != nil {
+		t.Fatalf("ListAllCompanies: %v", err)
+	}
+	if len(all) != 2 || calls != 2 {
+		t.Errorf("got %d companies in %d requests, want 2 in 2", len(all), calls)
+	}
+}
+
+// pagedServer serves n companies by whichever pagination the request uses:
+// limit/offset or page/pageSize. Offset requests get the total in
+// X-Total-Count; page requests get none, so paging must stop on its own. Every
+// query served is recorded.
+func pagedServer(t *testing.T, n int, queries *[]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		*queries = append(*queries, r.URL.RawQuery)
+		size, _ := strconv.Atoi(q.Get("limit"))
+		start, _ := strconv.Atoi(q.Get("offset"))
+		if ps := q.Get("pageSize"); ps != "" {
+			size, _ = strconv.Atoi(ps)
+			page, _ := strconv.Atoi(q.Get("page"))
+			start = (page - 1) * size
+		} else {
+			w.Header().Set("X-Total-Count", strconv.Itoa(n))
+		}
+		page := []Company{}
+		for id := start + 1; id <= n && id <= start+size; id++ {
+			page = append(page, Company{ID: id})
+		}
+		writeList(w, page, "")
+	}))
+}
+
+func TestListAllPaginationStyles(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		opts  []Option
+		n     int
+		want  []string
+		maxIt int
+	}{
+		{"offset", nil, 250, []string{"limit=100", "limit=100&offset=100", "limit=100&offset=200"}, 1000},
+		{"page", []Option{WithPagination(PaginationPage)}, 250,
+			[]string{"page=1&pageSize=100", "page=2&pageSize=100", "page=3&pageSize=100"}, 1000},
+		// A full last page needs one more, empty, request to end on.
+		{"page exact", []Option{WithPagination(PaginationPage)}, 200,
+			[]string{"page=1&pageSize=100", "page=2&pageSize=100", "page=3&pageSize=100"}, 1000},
+		{"page capped", []Option{WithPagination(PaginationPage)}, 250,
+			[]string{"page=1&pageSize=100", "page=2&pageSize=100"}, 150},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var queries []string
+			srv := pagedServer(t, c.n, &queries)
+			defer srv.Close()
+
+			all, err := newTestClient(srv.URL, c.opts...).ListAllCompanies(context.Background(), nil, c.maxIt)
+			if err != nil {
+				t.Fatalf("ListAllCompanies: %v", err)
+			}
+			wantLen := min(c.n, c.maxIt)
+			if len(all) != wantLen || all[0].ID != 1 || all[len(all)-1].ID != wantLen {
+				t.Errorf("got %d companies, want IDs 1..%d", len(all), wantLen)
+			}
+			if strings.Join(queries, " ") != strings.Join(c.want, " ") {
+				t.Errorf("queries = %q, want %q", queries, c.want)
+			}
+		})
+	}
+}
+
+// TestListAllPageModeWarnsAtAlignedCap verifies page/pageSize paging, which
+// reports neither a total nor a cursor, still flags a cap on a page boundary.
+func TestListAllPageModeWarnsAtAlignedCap(t *testing.T) {
+	var queries []string
+	srv := pagedServer(t, 250, &queries)
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c := newTestClient(srv.URL, WithPagination(PaginationPage), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	all, err := c.ListAllCompanies(context.Background(), nil, 200)
+	if err != nil || len(all) != 200 {
+		t.Fatalf("got %d companies, err %v; want 200", len(all), err)
+	}
+	if !strings.Contains(logs.String(), "list truncated at cap") || !strings.Contains(logs.String(), "cap=200") {
+		t.Errorf("missing truncation warning: %q", logs.String())
+	}
+
+	logs.Reset()
+	if all, err = c.ListAllCompanies(context.Background(), nil, 300); err != nil || len(all) != 250 {
+		t.Fatalf("under the cap: got %d companies, err %v", len(all), err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("warned although nothing was truncated: %q", logs.String())
+	}
+}
+
+func TestListOptionsPageQuery(t *testing.T) {
+	o := &ListOptions{Limit: 25, Offset: 50, Name: "x"}
+	if got := o.toQuery(PaginationPage).Encode(); got != "name=x&page=3&pageSize=25" {
+		t.Errorf("page query = %q", got)
+	}
+	if got := o.toQuery(PaginationOffset).Encode(); got != "limit=25&name=x&offset=50" {
+		t.Errorf("offset query = %q", got)
+	}
+}
+
 func TestListAllRespectsMaxItems(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Always advertise another page; maxItems must stop the loop.
@@ -153,6 +447,34 @@ func TestListAllRespectsMaxItems(t *testing.T) {
 	}
 }
 
+func TestListAllStopsOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			cancel() // cancelled mid-pagination, after this page is served
+		}
+		writeList(w, []Company{{ID: calls}}, fmt.Sprintf("CUR%d", calls))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL)
+	all, err := c.ListAllCompanies(ctx, nil, 100)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if calls != 2 {
+		t.Errorf("made %d requests; pagination should stop once ctx is cancelled", calls)
+	}
+	// Page 2 may or may not land before the in-flight request sees the
+	// cancellation, but page 1 must be kept.
+	if len(all) == 0 || all[0].ID != 1 {
+		t.Errorf("accumulated pages dropped: %+v", all)
+	}
+}
+
 func TestGetOneReadsResults(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/api/2.1/devices/9/" {
@@ -172,6 +494,24 @@ func TestGetOneReadsResults(t *testing.T) {
 	}
 }
 
+// TestGetOneReadsSingleObject verifies a detail endpoint returning the record
+// as the data object itself, not a results array, is read too.
+func TestGetOneReadsSingleObject(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"id":9,"name":"fw01","url":"https://p/v4/app/devices/9"}}`))
+	}))
+	defer srv.Close()
+
+	d, err := newTestClient(srv.URL).GetDevice(context.Background(), "9")
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if d.ID != 9 || d.Name != "fw01" || d.URL != "https://p/v4/app/devices/9" {
+		t.Errorf("got %+v", d)
+	}
+}
+
 func TestCreateParsesLocationHeader(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Location", "/api/2.1/types/device/77/")
@@ -231,6 +571,34 @@ func TestErrorStatusSurfacesBody(t *testing.T) {
 	}
 }
 
+func TestSoftErrorCodeOn200(t *testing.T) {
+	for name, body := range map[string]string{
+		"numeric code": `{"code":403,"message":"permission denied for companies"}`,
+		"string code":  `{"code":"500","errors":[{"message":"permission denied for companies"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(body)) // HTTP 200
+			}))
+			defer srv.Close()
+
+			c := newTestClient(srv.URL)
+			_, _, err := c.ListCompanies(context.Background(), nil)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			if apiErr.Status != http.StatusOK || apiErr.Message != "permission denied for companies" {
+				t.Errorf("APIError = %+v", apiErr)
+			}
+			if !strings.Contains(err.Error(), "permission denied") {
+				t.Errorf("error %q should carry the message", err)
+			}
+		})
+	}
+}
+
 func TestGetKBReturnsArticle(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/api/2.1/kbs/39/" {
@@ -258,6 +626,41 @@ func TestGetKBReturnsArticle(t *testing.T) {
 	}
 }
 
+func TestUserAgentOnEveryRequest(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Method+" "+r.Header.Get("User-Agent"))
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []KB{{ID: 39}}, "")
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		opts []Option
+		want string
+	}{
+		{nil, DefaultUserAgent},
+		{[]Option{WithUserAgent("itportal-mcp/1.4.0")}, "itportal-mcp/1.4.0"},
+	} {
+		got = nil
+		c := newTestClient(srv.URL, tc.opts...)
+		if _, err := c.GetKB(ctx, "39"); err != nil {
+			t.Fatalf("GetKB: %v", err)
+		}
+		if err := c.UploadFile(ctx, "/api/2.0/kbs/39/file/", "a.txt", "text/plain", []byte("x")); err != nil {
+			t.Fatalf("UploadFile: %v", err)
+		}
+		want := []string{"GET " + tc.want, "POST " + tc.want}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("User-Agent headers = %q, want %q", got, want)
+		}
+	}
+}
+
 // writeList writes a v2.1-style list envelope.
 func writeList[T any](w http.ResponseWriter, results []T, nextCursor string) {
 	type data struct {
@@ -272,3 +675,125 @@ func writeList[T any](w http.ResponseWriter, results []T, nextCursor string) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(body)
 }
+
+func TestGetOneMissingIsNotFound(t *testing.T) {
+	for name, respond := range map[string]func(http.ResponseWriter){
+		"empty results": func(w http.ResponseWriter) { writeList(w, []Device{}, "") },
+		"null data":     func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"code":200,"data":null}`)) },
+		"http 404":      func(w http.ResponseWriter) { http.Error(w, `{"code":404,"message":"Not found"}`, http.StatusNotFound) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { respond(w) }))
+			defer srv.Close()
+
+			_, err := newTestClient(srv.URL).GetIPNetwork(context.Background(), "999")
+			var nf *NotFoundError
+			if !errors.As(err, &nf) || !IsNotFound(err) {
+				t.Fatalf("err = %v, want *NotFoundError", err)
+			}
+			if err.Error() != "ip network 999 not found" {
+				t.Errorf("message = %q", err.Error())
+			}
+			if strings.Contains(err.Error(), "/api/") {
+				t.Errorf("message leaks the API path: %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestNotFoundAtNames(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/2.0/devices/7/":                  "device 7 not found",
+		"/api/2.0/companies/3/":                "company 3 not found",
+		"/api/2.0/additionalCredentials/4/":    "additional credential 4 not found",
+		"/api/2.0/devices/5/relationships/12/": "relationship 12 not found",
+		"/api/2.0/facilities/8/folders/2/":     "folder 2 not found",
+	} {
+		if got := notFoundAt(path).Error(); got != want {
+			t.Errorf("notFoundAt(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestProxyURLRoutesRequests(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		writeList(w, []Country{{ID: 1, Name: "Austria"}}, "")
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	c := newTestClient("http://itportal.invalid", WithProxyURL(proxyURL), WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	countries, err := c.ListCountries(context.Background())
+	if err != nil {
+		t.Fatalf("ListCountries: %v", err)
+	}
+	if len(countries) != 1 || countries[0].Name != "Austria" {
+		t.Errorf("countries = %+v", countries)
+	}
+	if len(proxied) != 1 || !strings.HasPrefix(proxied[0], "http://itportal.invalid/api/2.1/system/countries/") {
+		t.Errorf("proxy saw %q, want the absolute ITPortal URL", proxied)
+	}
+}
+
+// TestIdempotencyKeyStableAcrossRetry verifies a create keeps its key only for
+// retries within one idempotency scope.
+func TestIdempotencyKeyStableAcrossRetry(t *testing.T) {
+	var keys []string
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if fail {
+			fail = false
+			http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+			return
+		}
+		w.Header().Set("Location", r.URL.Path+"77/")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	ctx := WithIdempotencyScope(context.Background())
+	c := newTestClient(srv.URL, WithIdempotencyHeader("Idempotency-Key"))
+
+	note := &DeviceNote{Notes: "swapped PSU"}
+	if _, err := c.createID(ctx, "/api/2.0/devices/9/notes/", note); err == nil {
+		t.Fatal("first attempt: want the 504 error")
+	}
+	id, err := c.createID(ctx, "/api/2.0/devices/9/notes/", note)
+	if err != nil || id != 77 {
+		t.Fatalf("retry: id=%d err=%v", id, err)
+	}
+	if _, err := c.createID(ctx, "/api/2.0/devices/9/notes/", &DeviceNote{Notes: "other"}); err != nil {
+		t.Fatalf("different create: %v", err)
+	}
+	// An identical note after the first succeeded is a second note, not a retry.
+	if _, err := c.createID(ctx, "/api/2.0/devices/9/notes/", note); err != nil {
+		t.Fatalf("identical create: %v", err)
+	}
+	if len(keys) != 4 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("keys = %q, want the retry to reuse the first key", keys)
+	}
+	if keys[2] == keys[0] || keys[3] == keys[0] {
+		t.Errorf("keys = %q, want a new key for every create after the retried one", keys)
+	}
+
+	// Separate calls with the same body get separate keys.
+	keys = nil
+	for range 2 {
+		if _, err := c.createID(WithIdempotencyScope(context.Background()), "/api/2.0/devices/9/notes/", note); err != nil {
+			t.Fatalf("create in a new call: %v", err)
+		}
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] == keys[1] {
+		t.Errorf("keys = %q, want two different keys for two calls", keys)
+	}
+
+	keys = nil
+	if _, err := newTestClient(srv.URL).createID(ctx, "/api/2.0/devices/9/notes/", note); err != nil {
+		t.Fatalf("create without header: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "" {
+		t.Errorf("idempotency header sent while disabled: %q", keys)
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // This file groups the endpoints introduced or reshaped in ITPortal API v2.1:
@@ -48,6 +50,15 @@ func (c *Client) DeleteRelationship(ctx context.Context, objectPath, objectID, l
 	return err
 }
 
+// ---- Entity history ----
+//
+// objectPath is as for relationships. Not every ITPortal release exposes
+// per-object history; those answer 404 or 405.
+
+func (c *Client) ListEntityHistory(ctx context.Context, objectPath, objectID string) ([]HistoryEntry, error) {
+	return listAll[HistoryEntry](ctx, c, fmt.Sprintf("/api/2.0/%s/%s/history/", objectPath, objectID), nil, 1000)
+}
+
 // ---- Folders (per-object document tree) ----
 
 func (c *Client) ListFolders(ctx context.Context, objectPath, objectID string) ([]Folder, error) {
@@ -143,22 +154,25 @@ func (c *Client) DeleteSwitchPortRange(ctx context.Context, deviceID, rangeID st
 // ---- Type management (generic over kind) ----
 //
 // kind is one of: account, agreement, company, contact, device, document,
-// facility, configuration.
+// facility, configuration. Writes drop the kind's cached list (see cachedList).
 
 func (c *Client) ListTypes(ctx context.Context, kind string) ([]TypeItem, error) {
-	return listAll[TypeItem](ctx, c, "/api/2.0/types/"+kind+"/", nil, 1000)
+	return cachedList[TypeItem](ctx, c, "/api/2.0/types/"+kind+"/", 1000)
 }
 
 func (c *Client) CreateType(ctx context.Context, kind, name string) (int, error) {
+	defer c.invalidateReference("/api/2.0/types/" + kind + "/")
 	return c.createID(ctx, "/api/2.0/types/"+kind+"/", map[string]string{"name": name})
 }
 
 func (c *Client) UpdateType(ctx context.Context, kind, id string, fields map[string]interface{}) error {
+	defer c.invalidateReference("/api/2.0/types/" + kind + "/")
 	_, err := c.do(ctx, http.MethodPatch, "/api/2.0/types/"+kind+"/"+id+"/", fields, nil)
 	return err
 }
 
 func (c *Client) DeleteType(ctx context.Context, kind, id string) error {
+	defer c.invalidateReference("/api/2.0/types/" + kind + "/")
 	_, err := c.do(ctx, http.MethodDelete, "/api/2.0/types/"+kind+"/"+id+"/", nil, nil)
 	return err
 }
@@ -166,29 +180,35 @@ func (c *Client) DeleteType(ctx context.Context, kind, id string) error {
 // ---- KB category & subcategory management ----
 
 func (c *Client) CreateKBCategory(ctx context.Context, name string) (int, error) {
+	defer c.invalidateReference("/api/2.0/categories/kb/")
 	return c.createID(ctx, "/api/2.0/categories/kb/", map[string]string{"name": name})
 }
 
 func (c *Client) UpdateKBCategory(ctx context.Context, id string, fields map[string]interface{}) error {
+	defer c.invalidateReference("/api/2.0/categories/kb/")
 	_, err := c.do(ctx, http.MethodPatch, "/api/2.0/categories/kb/"+id+"/", fields, nil)
 	return err
 }
 
 func (c *Client) DeleteKBCategory(ctx context.Context, id string) error {
+	defer c.invalidateReference("/api/2.0/categories/kb/")
 	_, err := c.do(ctx, http.MethodDelete, "/api/2.0/categories/kb/"+id+"/", nil, nil)
 	return err
 }
 
 func (c *Client) CreateKBSubCategory(ctx context.Context, categoryID, name string) (int, error) {
+	defer c.invalidateReference("/api/2.0/categories/kb/")
 	return c.createID(ctx, "/api/2.0/categories/kb/"+categoryID+"/subcategories/", map[string]string{"name": name})
 }
 
 func (c *Client) UpdateKBSubCategory(ctx context.Context, categoryID, subID string, fields map[string]interface{}) error {
+	defer c.invalidateReference("/api/2.0/categories/kb/")
 	_, err := c.do(ctx, http.MethodPatch, "/api/2.0/categories/kb/"+categoryID+"/subcategories/"+subID+"/", fields, nil)
 	return err
 }
 
 func (c *Client) DeleteKBSubCategory(ctx context.Context, categoryID, subID string) error {
+	defer c.invalidateReference("/api/2.0/categories/kb/")
 	_, err := c.do(ctx, http.MethodDelete, "/api/2.0/categories/kb/"+categoryID+"/subcategories/"+subID+"/", nil, nil)
 	return err
 }
@@ -327,6 +347,35 @@ func (c *Client) DeleteConfiguration(ctx context.Context, id string) error {
 	return err
 }
 
+// ---- Contact photo ----
+
+// FileDownload is a stored file's bytes and the content type ITPortal served.
+type FileDownload struct {
+	Data        []byte
+	ContentType string
+}
+
+// ErrFileTooLarge is returned when a download exceeds the caller's size cap.
+var ErrFileTooLarge = errors.New("file exceeds size limit")
+
+// GetContactPhoto fetches the photo uploaded to a contact (the counterpart of
+// uploading to /contacts/{id}/file/). It returns nil, nil when the contact has
+// no photo, and ErrFileTooLarge when the photo is over maxBytes (0 = no cap).
+func (c *Client) GetContactPhoto(ctx context.Context, contactID string, maxBytes int64) (*FileDownload, error) {
+	path := "/api/2.0/contacts/" + contactID + "/file/"
+	dl, err := c.downloadFile(ctx, path, maxBytes)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(dl.Data) == 0 {
+		return nil, nil
+	}
+	return dl, nil
+}
+
 // ---- Multipart helper ----
 
 // uploadMultipart POSTs a file plus optional extra form fields as multipart/form-data.
@@ -354,6 +403,7 @@ func (c *Client) uploadMultipart(ctx context.Context, path, fileName, contentTyp
 		return nil, fmt.Errorf("create upload request: %w", err)
 	}
 	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("User-Agent", c.userAgent)
 	req.Header.Set("Content-Type", w.FormDataContentType())
 	if c.encryptionKey != "" {
 		req.Header.Set("X-Encryption-Key", c.encryptionKey)
@@ -373,3 +423,51 @@ func (c *Client) uploadMultipart(ctx context.Context, path, fileName, contentTyp
 	}
 	return &apiResponse{Status: resp.StatusCode, Header: resp.Header, Body: body}, nil
 }
+
+// downloadFile GETs a raw file, reading at most maxBytes (0 = no cap) so an
+// oversized file is refused without buffering all of it. A JSON body is checked
+// for an error envelope, since some endpoints answer 200 with a failure code.
+func (c *Client) downloadFile(ctx context.Context, path string, maxBytes int64) (*FileDownload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+c.resolvePath(path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create download request: %w", err)
+	}
+	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.encryptionKey != "" {
+		req.Header.Set("X-Encryption-Key", c.encryptionKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute download from %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("download from %s (%d bytes, limit %d): %w", path, resp.ContentLength, maxBytes, ErrFileTooLarge)
+	}
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read download from %s: %w", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &APIError{Method: http.MethodGet, Path: path, Status: resp.StatusCode, Message: string(data)}
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("download from %s (over %d bytes): %w", path, maxBytes, ErrFileTooLarge)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		if err := softError(http.MethodGet, path, resp.StatusCode, data); err != nil {
+			return nil, err
+		}
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return &FileDownload{Data: data, ContentType: contentType}, nil
+}
@@ -0,0 +1,120 @@
+package itportal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIError is returned when ITPortal rejects a request, either with a non-2xx
+// HTTP status or with a 2xx status whose response envelope carries a failure
+// code (a "soft" error).
+type APIError struct {
+	Method string
+	Path   string
+	// Status is the HTTP status code of the response.
+	Status int
+	// Code is the envelope's "code" field; 0 when the body had none.
+	Code int
+	// Message is the envelope's "message" field, or the raw body when the
+	// response wasn't a JSON envelope.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Status >= 200 && e.Status < 300 {
+		return fmt.Sprintf("ITPortal API %s %s → code %d: %s", e.Method, e.Path, e.Code, e.Message)
+	}
+	return fmt.Sprintf("ITPortal API %s %s → %d: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// NotFoundError is returned when a single entity lookup finds no record. Its
+// message names the entity, never the API path, so it is safe to show as is.
+type NotFoundError struct {
+	// Type is the entity type in singular, readable form ("device",
+	// "ip network", …).
+	Type string
+	ID   string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found", e.Type, e.ID)
+}
+
+// IsNotFound reports whether err is a *NotFoundError, or an *APIError with a
+// 404 HTTP status or envelope code.
+func IsNotFound(err error) bool {
+	var nf *NotFoundError
+	if errors.As(err, &nf) {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Code == http.StatusNotFound)
+}
+
+// collectionNames maps REST collection segments to readable singular names;
+// others drop their trailing "s".
+var collectionNames = map[string]string{
+	"companies":             "company",
+	"facilities":            "facility",
+	"addresses":             "address",
+	"kbs":                   "kb",
+	"ipnetworks":            "ip network",
+	"forminstances":         "form instance",
+	"additionalcredentials": "additional credential",
+}
+
+// notFoundAt builds the NotFoundError for an entity path such as
+// /api/2.0/devices/999/ or /api/2.0/devices/5/folders/7/.
+func notFoundAt(path string) *NotFoundError {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return &NotFoundError{Type: "entity", ID: strings.Trim(path, "/")}
+	}
+	id, collection := parts[len(parts)-1], strings.ToLower(parts[len(parts)-2])
+	typ, ok := collectionNames[collection]
+	if !ok {
+		typ = strings.TrimSuffix(collection, "s")
+	}
+	return &NotFoundError{Type: typ, ID: id}
+}
+
+// envelope is the outer wrapper of every v2.x JSON response. Code arrives as a
+// number on success but has been seen as a string ("400") on failures, and the
+// message may come either as "message" or as an "errors" list.
+type envelope struct {
+	Code    json.RawMessage `json:"code"`
+	Message string          `json:"message"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// softError inspects a 2xx response body and returns an *APIError when its
+// envelope reports failure. Bodies that aren't a JSON envelope, or that omit
+// the code, are treated as success.
+func softError(method, path string, status int, body []byte) error {
+	var env envelope
+	if json.Unmarshal(body, &env) != nil {
+		return nil
+	}
+	code, err := strconv.Atoi(strings.Trim(string(env.Code), `"`))
+	if err != nil || code == 0 || (code >= 200 && code < 300) {
+		return nil
+	}
+	msg := env.Message
+	if msg == "" && len(env.Errors) > 0 {
+		msgs := make([]string, 0, len(env.Errors))
+		for _, e := range env.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		msg = strings.Join(msgs, "; ")
+	}
+	if msg == "" {
+		msg = string(body)
+	}
+	return &APIError{Method: method, Path: path, Status: status, Code: code, Message: msg}
+}
@@ -0,0 +1,80 @@
+package itportal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// WithIdempotencyHeader sends a per-create key in the named header (e.g.
+// "Idempotency-Key") on every create POST. An empty name sends none (default).
+func WithIdempotencyHeader(name string) Option {
+	return func(c *Client) {
+		if name != "" {
+			c.idempotencyHeader = name
+		}
+	}
+}
+
+// idempotencyScopeKey is the context key of an idempotencyScope.
+type idempotencyScopeKey struct{}
+
+// idempotencyScope holds the keys of the creates attempted under it that have
+// not succeeded yet, by a hash of their path and JSON body.
+type idempotencyScope struct {
+	mu   sync.Mutex
+	keys map[[sha256.Size]byte]string
+}
+
+// WithIdempotencyScope returns ctx carrying a fresh idempotency scope, usually
+// one per tool call. A create retried under the scope after failing reuses its
+// key, so a server honouring the header can drop the duplicate; once a create
+// succeeds its key is retired, so an identical create after it gets a new one.
+// Creates made outside any scope get a new key every time.
+func WithIdempotencyScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotencyScopeKey{}, &idempotencyScope{})
+}
+
+// idempotencyKey returns the key for POSTing body to path under ctx's scope,
+// and a func reporting whether the create succeeded.
+func idempotencyKey(ctx context.Context, path string, body []byte) (string, func(created bool)) {
+	scope, _ := ctx.Value(idempotencyScopeKey{}).(*idempotencyScope)
+	if scope == nil {
+		return newIdempotencyKey(), func(bool) {}
+	}
+	h := sha256.New()
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	var fp [sha256.Size]byte
+	copy(fp[:], h.Sum(nil))
+
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	key, ok := scope.keys[fp]
+	if !ok {
+		if scope.keys == nil {
+			scope.keys = map[[sha256.Size]byte]string{}
+		}
+		key = newIdempotencyKey()
+		scope.keys[fp] = key
+	}
+	return key, func(created bool) {
+		if !created {
+			return
+		}
+		scope.mu.Lock()
+		defer scope.mu.Unlock()
+		if scope.keys[fp] == key {
+			delete(scope.keys, fp)
+		}
+	}
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
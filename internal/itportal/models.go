@@ -1,5 +1,7 @@
 package itportal
 
+import "strings"
+
 // ---- Reference / embedded types ----
 
 type CompanyReference struct {
@@ -20,6 +22,8 @@ type ContactReference struct {
 type DocumentReference struct {
 	ID   int    `json:"id,omitempty"`
 	Name string `json:"name,omitempty"`
+	// URL is not sent by the API; tools fill it with the document's portal link.
+	URL string `json:"url,omitempty"`
 }
 
 type DeviceReference struct {
@@ -201,6 +205,16 @@ type DeviceMUrl struct {
 	Notes     string `json:"notes,omitempty"`
 }
 
+// DeviceConfigFile is a configuration file stored on a device's Configuration
+// Files tab. Only its metadata is listed; the content is not.
+type DeviceConfigFile struct {
+	ID          int    `json:"id,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	Description string `json:"description,omitempty"`
+	DateTime    string `json:"datetime,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+}
+
 // Credential represents a username/password pair associated with an account or device.
 type Credential struct {
 	ID          int    `json:"id,omitempty"`
@@ -282,6 +296,23 @@ type Contact struct {
 	URL           string            `json:"url,omitempty"`
 }
 
+// FullName is the contact's display name, "First M. Last", leaving out the
+// parts that are blank. The middle initial gets its period whether or not it
+// was stored with one.
+func (c *Contact) FullName() string {
+	var parts []string
+	if s := strings.TrimSpace(c.FirstName); s != "" {
+		parts = append(parts, s)
+	}
+	if s := strings.TrimSuffix(strings.TrimSpace(c.MiddleInitial), "."); s != "" {
+		parts = append(parts, s+".")
+	}
+	if s := strings.TrimSpace(c.LastName); s != "" {
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
 // ---- Account ----
 
 type AccountType struct {
@@ -525,6 +556,21 @@ type Relationship struct {
 	Notes  string              `json:"notes,omitempty"`
 }
 
+// ---- Entity history ----
+
+// HistoryEntry is one change in an entity's audit history. OldValue and
+// NewValue keep whatever JSON type the API reports.
+type HistoryEntry struct {
+	ID       int                    `json:"id,omitempty"`
+	Date     string                 `json:"date,omitempty"`
+	User     *ContactEmailReference `json:"user,omitempty"`
+	Action   string                 `json:"action,omitempty"` // created, updated, deleted, …
+	Field    string                 `json:"field,omitempty"`
+	OldValue any                    `json:"oldValue,omitempty"`
+	NewValue any                    `json:"newValue,omitempty"`
+	Notes    string                 `json:"notes,omitempty"`
+}
+
 // ---- Switch ports (per-device port ranges) ----
 //
 // A switch device's "Switch Ports" tab is modelled as one or more SwitchPortRanges
@@ -0,0 +1,76 @@
+package itportal
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReferenceTTL is how long reference lists (types, KB categories,
+// countries, security groups) are served from memory before being re-fetched.
+const DefaultReferenceTTL = 5 * time.Minute
+
+// WithReferenceTTL overrides how long reference lists are cached (default
+// DefaultReferenceTTL). Zero or negative disables the cache.
+func WithReferenceTTL(d time.Duration) Option {
+	return func(c *Client) { c.refs.ttl = d }
+}
+
+// referenceCache holds recently fetched reference lists, keyed by path and cap.
+type referenceCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]referenceEntry
+}
+
+type referenceEntry struct {
+	value   any
+	fetched time.Time
+}
+
+// cachedList is listAll for reference endpoints: a list fetched less than the
+// reference TTL ago is returned again without calling ITPortal. Errors are not
+// cached. Callers get their own copy of the slice.
+func cachedList[T any](ctx context.Context, c *Client, path string, maxItems int) ([]T, error) {
+	r := &c.refs
+	if r.ttl <= 0 {
+		return listAll[T](ctx, c, path, nil, maxItems)
+	}
+	key := path + "#" + strconv.Itoa(maxItems)
+	r.mu.Lock()
+	e, ok := r.entries[key]
+	r.mu.Unlock()
+	if ok && time.Since(e.fetched) < r.ttl {
+		if v, ok := e.value.([]T); ok {
+			return slices.Clone(v), nil
+		}
+	}
+
+	items, err := listAll[T](ctx, c, path, nil, maxItems)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	if r.entries == nil {
+		r.entries = map[string]referenceEntry{}
+	}
+	r.entries[key] = referenceEntry{value: slices.Clone(items), fetched: time.Now()}
+	r.mu.Unlock()
+	return items, nil
+}
+
+// invalidateReference drops every cached list under path, so the next read
+// after a write through this client sees the change.
+func (c *Client) invalidateReference(path string) {
+	r := &c.refs
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.entries {
+		if strings.HasPrefix(key, path) {
+			delete(r.entries, key)
+		}
+	}
+}
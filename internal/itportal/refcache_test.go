@@ -0,0 +1,98 @@
+package itportal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingTypesServer serves a one-item type list and counts GETs per path.
+func countingTypesServer(t *testing.T) (*httptest.Server, map[string]int) {
+	t.Helper()
+	gets := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		gets[r.URL.Path]++
+		writeList(w, []TypeItem{{ID: 1, Name: "Server"}}, "")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, gets
+}
+
+func TestReferenceListsCachedWithinTTL(t *testing.T) {
+	srv, gets := countingTypesServer(t)
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		types, err := c.ListDeviceTypes(ctx)
+		if err != nil {
+			t.Fatalf("ListDeviceTypes: %v", err)
+		}
+		if len(types) != 1 || types[0].Name != "Server" {
+			t.Fatalf("types = %+v", types)
+		}
+		types[0].Name = "mutated by caller"
+	}
+	if n := gets["/api/2.1/types/device/"]; n != 1 {
+		t.Errorf("device types fetched %d times within the TTL, want 1", n)
+	}
+
+	// Expire the entry: the next call goes back to ITPortal.
+	c.refs.mu.Lock()
+	for k, e := range c.refs.entries {
+		e.fetched = time.Now().Add(-DefaultReferenceTTL - time.Second)
+		c.refs.entries[k] = e
+	}
+	c.refs.mu.Unlock()
+	if _, err := c.ListDeviceTypes(ctx); err != nil {
+		t.Fatalf("ListDeviceTypes: %v", err)
+	}
+	if n := gets["/api/2.1/types/device/"]; n != 2 {
+		t.Errorf("device types fetched %d times after expiry, want 2", n)
+	}
+}
+
+func TestReferenceWriteInvalidatesKind(t *testing.T) {
+	srv, gets := countingTypesServer(t)
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	for _, kind := range []string{"device", "company"} {
+		if _, err := c.ListTypes(ctx, kind); err != nil {
+			t.Fatalf("ListTypes(%s): %v", kind, err)
+		}
+	}
+	if err := c.DeleteType(ctx, "device", "1"); err != nil {
+		t.Fatalf("DeleteType: %v", err)
+	}
+	for _, kind := range []string{"device", "company"} {
+		if _, err := c.ListTypes(ctx, kind); err != nil {
+			t.Fatalf("ListTypes(%s): %v", kind, err)
+		}
+	}
+	if n := gets["/api/2.1/types/device/"]; n != 2 {
+		t.Errorf("device types fetched %d times, want 2 (refetched after the delete)", n)
+	}
+	if n := gets["/api/2.1/types/company/"]; n != 1 {
+		t.Errorf("company types fetched %d times, want 1 (untouched by a device write)", n)
+	}
+}
+
+func TestReferenceTTLZeroDisablesCache(t *testing.T) {
+	srv, gets := countingTypesServer(t)
+	c := newTestClient(srv.URL, WithReferenceTTL(0))
+	for i := 0; i < 2; i++ {
+		if _, err := c.ListCountries(context.Background()); err != nil {
+			t.Fatalf("ListCountries: %v", err)
+		}
+	}
+	if n := gets["/api/2.1/system/countries/"]; n != 2 {
+		t.Errorf("countries fetched %d times with the cache off, want 2", n)
+	}
+}
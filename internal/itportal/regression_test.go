@@ -1,10 +1,15 @@
 package itportal
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -89,3 +94,156 @@ func TestAccountNameRoundTrips(t *testing.T) {
 		t.Errorf("name not decoded back: got %q", created.Name)
 	}
 }
+
+// TestDeviceIPsTruncateAtConfiguredCap verifies GetDeviceIPs pages through up to
+// the configured cap and logs a warning only when records were left behind.
+func TestDeviceIPsTruncateAtConfiguredCap(t *testing.T) {
+	// Three IPs per page, eight in total.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		var ips []DeviceIP
+		for id := page*3 + 1; id <= page*3+3 && id <= 8; id++ {
+			ips = append(ips, DeviceIP{ID: id})
+		}
+		next := ""
+		if (page+1)*3 < 8 {
+			next = strconv.Itoa(page + 1)
+		}
+		writeList(w, ips, next)
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	c := newTestClient(srv.URL, WithSubResourceLimits(SubResourceLimits{IPs: 5}), WithLogger(logger))
+	ips, err := c.GetDeviceIPs(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("GetDeviceIPs: %v", err)
+	}
+	if len(ips) != 5 || ips[0].ID != 1 || ips[4].ID != 5 {
+		t.Fatalf("got %+v, want IDs 1..5", ips)
+	}
+	if !strings.Contains(logs.String(), "list truncated at cap") || !strings.Contains(logs.String(), "cap=5") {
+		t.Errorf("missing truncation warning: %q", logs.String())
+	}
+
+	logs.Reset()
+	c = newTestClient(srv.URL, WithSubResourceLimits(SubResourceLimits{IPs: 8}), WithLogger(logger))
+	if ips, err = c.GetDeviceIPs(context.Background(), "1"); err != nil || len(ips) != 8 {
+		t.Fatalf("GetDeviceIPs at exact cap: %d IPs, err %v", len(ips), err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("warned although nothing was truncated: %q", logs.String())
+	}
+}
+
+// TestGetContactPhoto covers a stored image, the no-photo 404 and the size cap.
+func TestGetContactPhoto(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n-fake-image-data")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.1/contacts/7/file/":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(png)
+		default:
+			http.Error(w, `{"code":404,"message":"Not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+
+	photo, err := c.GetContactPhoto(context.Background(), "7", 1024)
+	if err != nil {
+		t.Fatalf("GetContactPhoto: %v", err)
+	}
+	if photo == nil || !bytes.Equal(photo.Data, png) || photo.ContentType != "image/png" {
+		t.Fatalf("got %+v, want the PNG", photo)
+	}
+
+	photo, err = c.GetContactPhoto(context.Background(), "8", 1024)
+	if err != nil || photo != nil {
+		t.Errorf("no-photo contact: got %+v, %v; want nil, nil", photo, err)
+	}
+
+	if _, err = c.GetContactPhoto(context.Background(), "7", 4); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("oversized photo: err = %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestContactFullName(t *testing.T) {
+	for _, tc := range []struct {
+		c    Contact
+		want string
+	}{
+		{Contact{FirstName: "Ada", MiddleInitial: "M", LastName: "Byte"}, "Ada M. Byte"},
+		{Contact{FirstName: "Ada", MiddleInitial: " m. ", LastName: "Byte"}, "Ada m. Byte"},
+		{Contact{FirstName: "Ada", LastName: "Byte"}, "Ada Byte"},
+		{Contact{FirstName: "Ada"}, "Ada"},
+		{Contact{MiddleInitial: "M", LastName: "Byte"}, "M. Byte"},
+		{Contact{}, ""},
+	} {
+		if got := tc.c.FullName(); got != tc.want {
+			t.Errorf("FullName(%q, %q, %q) = %q, want %q", tc.c.FirstName, tc.c.MiddleInitial, tc.c.LastName, got, tc.want)
+		}
+	}
+}
+
+func TestGetDeviceConfigFiles(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[
+			{"id":7,"fileName":"fw01-running.cfg","description":"after VLAN change","datetime":"2026-03-02T10:15:00","modified":"2026-03-02T10:15:04"}
+		],"count":1}}`))
+	}))
+	defer srv.Close()
+
+	files, err := newTestClient(srv.URL).GetDeviceConfigFiles(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("GetDeviceConfigFiles: %v", err)
+	}
+	if path != "/api/2.1/devices/42/configurationFiles/" {
+		t.Errorf("path = %q", path)
+	}
+	want := DeviceConfigFile{ID: 7, FileName: "fw01-running.cfg", Description: "after VLAN change", DateTime: "2026-03-02T10:15:00", Modified: "2026-03-02T10:15:04"}
+	if len(files) != 1 || files[0] != want {
+		t.Errorf("files = %+v, want [%+v]", files, want)
+	}
+}
+
+// TestDeviceIPsWarnAtPageAlignedCap verifies a cap that is a multiple of the
+// page size still warns when the reported total shows more records: offset
+// paging then fills the cap exactly, with nothing over to notice.
+func TestDeviceIPsWarnAtPageAlignedCap(t *testing.T) {
+	const total = 700
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		ips := []DeviceIP{}
+		for id := offset + 1; id <= total && id <= offset+limit; id++ {
+			ips = append(ips, DeviceIP{ID: id})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"code": 200,
+			"data": map[string]any{"results": ips, "count": len(ips), "total": total},
+		})
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c := newTestClient(srv.URL, WithSubResourceLimits(SubResourceLimits{IPs: 500}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	ips, err := c.GetDeviceIPs(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("GetDeviceIPs: %v", err)
+	}
+	if len(ips) != 500 || ips[499].ID != 500 {
+		t.Fatalf("got %d IPs, want IDs 1..500", len(ips))
+	}
+	if !strings.Contains(logs.String(), "list truncated at cap") || !strings.Contains(logs.String(), "cap=500") {
+		t.Errorf("missing truncation warning: %q", logs.String())
+	}
+}
@@ -0,0 +1,35 @@
+package itportal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// LoadTLSConfig builds the TLS settings for a self-hosted ITPortal: caFile, when
+// set, is a PEM bundle trusted in addition to the system roots, and
+// insecureSkipVerify turns certificate verification off entirely (discouraged).
+// It returns nil, keeping Go's defaults, when neither is set.
+func LoadTLSConfig(caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecureSkipVerify} //nolint:gosec // opt-in via ITPORTAL_INSECURE_SKIP_VERIFY
+	if caFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA file %s holds no PEM certificates", caFile)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
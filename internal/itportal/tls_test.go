@@ -0,0 +1,78 @@
+package itportal
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tlsServer starts an HTTP/2 TLS ITPortal stand-in with its own self-signed
+// CA, written as PEM to the returned file, and records the protocol used.
+func tlsServer(t *testing.T, proto *int) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*proto = r.ProtoMajor
+		writeList(w, []Device{{ID: 9, Name: "fw01"}}, "")
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, block, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return srv, caFile
+}
+
+func TestCustomCATrustsSelfHostedServer(t *testing.T) {
+	var proto int
+	srv, caFile := tlsServer(t, &proto)
+
+	if _, err := newTestClient(srv.URL).GetDevice(context.Background(), "9"); err == nil {
+		t.Fatal("default client accepted an unknown CA")
+	}
+
+	cfg, err := LoadTLSConfig(caFile, false)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig: %v", err)
+	}
+	d, err := newTestClient(srv.URL, WithTLSConfig(cfg)).GetDevice(context.Background(), "9")
+	if err != nil {
+		t.Fatalf("GetDevice with custom CA: %v", err)
+	}
+	if d.Name != "fw01" || proto != 2 {
+		t.Errorf("device %+v over HTTP/%d, want fw01 over HTTP/2", d, proto)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	var proto int
+	srv, _ := tlsServer(t, &proto)
+	cfg, err := LoadTLSConfig("", true)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig: %v", err)
+	}
+	if _, err := newTestClient(srv.URL, WithTLSConfig(cfg)).GetDevice(context.Background(), "9"); err != nil {
+		t.Errorf("GetDevice skipping verification: %v", err)
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	if cfg, err := LoadTLSConfig("", false); cfg != nil || err != nil {
+		t.Errorf("no settings = %v, %v; want nil, nil", cfg, err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	_ = os.WriteFile(bad, []byte("not a certificate"), 0o600)
+	if _, err := LoadTLSConfig(bad, false); err == nil {
+		t.Error("CA file without certificates accepted")
+	}
+	if _, err := LoadTLSConfig(filepath.Join(t.TempDir(), "missing.pem"), false); err == nil {
+		t.Error("missing CA file accepted")
+	}
+}
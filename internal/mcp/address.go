@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ---- update_address ----
+
+type UpdateAddressInput struct {
+	EntityType string `json:"entity_type" jsonschema:"Type of the entity whose address changes. One of: company, site, facility, cabinet"`
+	ID         string `json:"id" jsonschema:"Numeric ID of the entity"`
+	Address1   string `json:"address1,omitempty" jsonschema:"Street address, first line"`
+	Address2   string `json:"address2,omitempty" jsonschema:"Street address, second line"`
+	City       string `json:"city,omitempty"`
+	State      string `json:"state,omitempty" jsonschema:"State, province or region"`
+	Zip        string `json:"zip,omitempty" jsonschema:"Postal code"`
+	Country    string `json:"country,omitempty"`
+}
+
+// addressEntityTypes are the entity types whose model embeds an Address.
+var addressEntityTypes = []string{"company", "site", "facility", "cabinet"}
+
+// UpdateAddress patches the nested address object of a company, site, facility
+// or cabinet, sending only the address fields that were given.
+func (h *Handler) UpdateAddress(ctx context.Context, _ *sdkmcp.CallToolRequest, input UpdateAddressInput) (*sdkmcp.CallToolResult, any, error) {
+	address := map[string]interface{}{}
+	for key, v := range map[string]string{
+		"address1": input.Address1, "address2": input.Address2, "city": input.City,
+		"state": input.State, "zip": input.Zip, "country": input.Country,
+	} {
+		if v = strings.TrimSpace(v); v != "" {
+			address[key] = v
+		}
+	}
+	var noFields *fieldError
+	if len(address) == 0 {
+		noFields = &fieldError{Field: "address1", Reason: "at least one of address1, address2, city, state, zip or country is required"}
+	}
+	var noAddress *fieldError
+	if typ := input.EntityType; strings.TrimSpace(typ) != "" && validateOneOf("entity_type", typ, addressEntityTypes...) != nil {
+		noAddress = &fieldError{Field: "entity_type", Reason: fmt.Sprintf("%q has no address; one of: %s", typ, strings.Join(addressEntityTypes, ", "))}
+	}
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		noAddress,
+		validateRequired("id", input.ID),
+		validateNumericID("id", input.ID),
+		noFields,
+	); res != nil {
+		return res, nil, nil
+	}
+	typ := normType(input.EntityType)
+	if res := h.checkWrite(typ); res != nil {
+		return res, nil, nil
+	}
+
+	id := strings.TrimSpace(input.ID)
+	fields := map[string]interface{}{"address": address}
+	var err error
+	switch typ {
+	case "company":
+		err = h.client.UpdateCompany(ctx, id, fields)
+	case "site":
+		err = h.client.UpdateSite(ctx, id, fields)
+	case "facility":
+		err = h.client.UpdateFacility(ctx, id, fields)
+	case "cabinet":
+		err = h.client.UpdateCabinet(ctx, id, fields)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("update %s %s address: %w", typ, id, err)
+	}
+	h.mergeUpdated(ctx, typ, id)
+	return toolText(fmt.Sprintf("Address of %s ID %s updated successfully.", typ, id)), nil, nil
+}
@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateAddressSendsNestedPatch(t *testing.T) {
+	var method, path string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("body not JSON: %s", data)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	res, _, err := newHandler(srv.URL).UpdateAddress(context.Background(), nil, UpdateAddressInput{
+		EntityType: "Site", ID: "10", Address1: "1 Main St", City: " Springfield ", Zip: "12345",
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("UpdateAddress = %v, %v", resultText(t, res), err)
+	}
+	if method != http.MethodPatch || path != "/sites/10/" {
+		t.Errorf("request = %s %s, want PATCH /sites/10/", method, path)
+	}
+	want := map[string]any{"address": map[string]any{"address1": "1 Main St", "city": "Springfield", "zip": "12345"}}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("patch body = %v, want %v", body, want)
+	}
+}
+
+func TestUpdateAddressRejectsInvalidInput(t *testing.T) {
+	h := newHandler("http://unused.invalid")
+	for name, in := range map[string]UpdateAddressInput{
+		"no address":  {EntityType: "device", ID: "9", City: "Springfield"},
+		"no fields":   {EntityType: "company", ID: "1", City: "  "},
+		"bad id":      {EntityType: "cabinet", ID: "rack", City: "Springfield"},
+		"no type set": {ID: "1", City: "Springfield"},
+	} {
+		res, _, err := h.UpdateAddress(context.Background(), nil, in)
+		if err != nil || !res.IsError {
+			t.Errorf("%s: want a tool error, got %v, %v", name, res, err)
+		}
+	}
+}
+
+func TestAddressEntityTypesHaveAddress(t *testing.T) {
+	for _, typ := range addressEntityTypes {
+		if _, ok := describedModels[typ].FieldByName("Address"); !ok {
+			t.Errorf("%s model has no Address field", typ)
+		}
+	}
+}
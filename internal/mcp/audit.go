@@ -0,0 +1,96 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// WithLogger logs every tool call, with its scrubbed input, to l at debug
+// level.
+func WithLogger(l *slog.Logger) Option {
+	return func(h *Handler) { h.logger = l }
+}
+
+// secretInputKeys are input keys (lowercased, without "_" and "-") whose values
+// are never logged.
+var secretInputKeys = map[string]bool{
+	"password": true, "2fa": true, "2facode": true, "twofacode": true, "secret": true,
+	"token": true, "apikey": true, "encryptionkey": true,
+}
+
+// blobInputKeys are input keys carrying base64 file content, logged only as
+// their decoded size. Any other key ending in "base64" is treated the same.
+var blobInputKeys = map[string]bool{"base64data": true, "csvbase64": true}
+
+// logToolCall records a tool call and its scrubbed input at debug level.
+func (h *Handler) logToolCall(ctx context.Context, tool string, input any) {
+	if h.logger == nil || !h.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	h.logger.LogAttrs(ctx, slog.LevelDebug, "tool call",
+		slog.String("tool", tool),
+		slog.String("instance", h.instance),
+		slog.Any("input", scrubInput(input)),
+	)
+}
+
+// scrubInput returns input as a JSON value with secrets masked and base64
+// payloads replaced by "<N bytes>". Input that cannot be marshalled is logged
+// as a note instead, never raw.
+func scrubInput(input any) json.RawMessage {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return json.RawMessage(`"<unloggable input>"`)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return json.RawMessage(`"<unloggable input>"`)
+	}
+	out, err := json.Marshal(scrubValue("", v))
+	if err != nil {
+		return json.RawMessage(`"<unloggable input>"`)
+	}
+	return out
+}
+
+// scrubValue masks v when key names a secret or blob, recursing into objects
+// and arrays (so create_entity's fields map is scrubbed too).
+func scrubValue(key string, v any) any {
+	k := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	switch {
+	case secretInputKeys[k]:
+		if s, ok := v.(string); ok && s == "" {
+			return ""
+		}
+		return "[redacted]"
+	case blobInputKeys[k] || strings.HasSuffix(k, "base64"):
+		if s, ok := v.(string); ok {
+			return blobSize(s)
+		}
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		for mk, mv := range t {
+			t[mk] = scrubValue(mk, mv)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = scrubValue(key, e)
+		}
+	}
+	return v
+}
+
+// blobSize renders a base64 payload as its (approximate, for unpadded or
+// malformed input) decoded size, without decoding it.
+func blobSize(s string) string {
+	s = strings.TrimSpace(s)
+	if _, after, ok := strings.Cut(s, ";base64,"); ok {
+		s = after
+	}
+	trimmed := strings.TrimRight(s, "=")
+	return fmt.Sprintf("<%d bytes>", len(trimmed)*3/4)
+}
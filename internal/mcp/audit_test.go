@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// debugHandler returns a Handler logging tool calls as JSON into buf.
+func debugHandler(buf *bytes.Buffer, level slog.Level) *Handler {
+	h := &Handler{instance: "default"}
+	WithLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: level})))(h)
+	return h
+}
+
+func TestLogToolCallScrubsSecretsAndBlobs(t *testing.T) {
+	var buf bytes.Buffer
+	h := debugHandler(&buf, slog.LevelDebug)
+	payload := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("x"), 3000))
+
+	h.logToolCall(context.Background(), "add_device_credential", AddDeviceCredentialInput{
+		DeviceID: "7", Username: "admin", Password: "hunter2", TwoFACode: "JBSWY3DP",
+	})
+	h.logToolCall(context.Background(), "upload_file", UploadFileInput{
+		EntityType: "kb", EntityID: "3", FileName: "diagram.png", Base64Data: payload,
+	})
+	h.logToolCall(context.Background(), "create_entity", CreateEntityInput{
+		EntityType: "account", Fields: map[string]interface{}{"username": "svc", "password": "s3cret", "two_fa_code": "123456"},
+	})
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "JBSWY3DP", "s3cret", "123456", payload[:64]} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log leaks %q:\n%s", secret, out)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want 3 log records, got %d:\n%s", len(lines), out)
+	}
+	var rec struct {
+		Level string         `json:"level"`
+		Tool  string         `json:"tool"`
+		Input map[string]any `json:"input"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("record not JSON: %v", err)
+	}
+	if rec.Level != "DEBUG" || rec.Tool != "add_device_credential" {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec.Input["password"] != "[redacted]" || rec.Input["2fa"] != "[redacted]" || rec.Input["username"] != "admin" {
+		t.Errorf("credential input = %v", rec.Input)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("record not JSON: %v", err)
+	}
+	if rec.Input["base64_data"] != "<3000 bytes>" || rec.Input["file_name"] != "diagram.png" {
+		t.Errorf("upload input = %v", rec.Input)
+	}
+}
+
+func TestLogToolCallElidesImportCSVPayload(t *testing.T) {
+	var buf bytes.Buffer
+	h := debugHandler(&buf, slog.LevelDebug)
+	csv := base64.StdEncoding.EncodeToString([]byte("name,username,password\nfw01,admin,hunter2\n"))
+
+	h.logToolCall(context.Background(), "import_csv", ImportCSVInput{
+		EntityType: "account", CSVBase64: csv, Mapping: map[string]string{"name": "name"},
+	})
+
+	out := buf.String()
+	if strings.Contains(out, csv) {
+		t.Fatalf("log contains the CSV payload:\n%s", out)
+	}
+	var rec struct {
+		Input map[string]any `json:"input"`
+	}
+	if err := json.Unmarshal([]byte(out), &rec); err != nil {
+		t.Fatalf("record not JSON: %v", err)
+	}
+	if got := rec.Input["csv_base64"]; got != "<42 bytes>" {
+		t.Errorf("csv_base64 logged as %v, want its size", got)
+	}
+}
+
+func TestLogToolCallSilentAboveDebug(t *testing.T) {
+	var buf bytes.Buffer
+	h := debugHandler(&buf, slog.LevelInfo)
+	h.logToolCall(context.Background(), "search_docs", SearchDocsInput{Query: "fw01"})
+	if buf.Len() != 0 {
+		t.Errorf("tool call logged at info level: %s", buf.String())
+	}
+	(&Handler{}).logToolCall(context.Background(), "search_docs", SearchDocsInput{Query: "fw01"})
+}
@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+)
+
+// ---- get_backlinks ----
+
+type GetBacklinksInput struct {
+	EntityType string `json:"entity_type" jsonschema:"Type of the referenced entity. One of: company, site, facility, cabinet, device"`
+	ID         string `json:"id" jsonschema:"Numeric ID of the referenced entity"`
+}
+
+// backlinkTargets are the entity types other entities reference.
+var backlinkTargets = []string{"company", "site", "facility", "cabinet", "device"}
+
+// GetBacklinks lists the cached entities that reference the given company,
+// site, facility, cabinet or device, e.g. every device and contact at a site.
+func (h *Handler) GetBacklinks(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetBacklinksInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateOneOf("entity_type", input.EntityType, backlinkTargets...),
+		validateRequired("id", input.ID),
+		validateNumericID("id", input.ID),
+	); res != nil {
+		return res, nil, nil
+	}
+	id, _ := strconv.Atoi(strings.TrimSpace(input.ID))
+	typ := normType(input.EntityType)
+
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	age := h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+	links := snap.Backlinks(typ, id)
+	if len(links) == 0 {
+		return toolText(fmt.Sprintf("No cached entity references %s %d. Snapshot age: %s", typ, id, formatAge(age))), nil, nil
+	}
+	return marshalResult(struct {
+		EntityType  string           `json:"entity_type"`
+		ID          int              `json:"id"`
+		Count       int              `json:"count"`
+		Backlinks   []cache.Backlink `json:"backlinks"`
+		Hint        string           `json:"hint"`
+		SnapshotAge string           `json:"snapshot_age"`
+	}{
+		EntityType:  typ,
+		ID:          id,
+		Count:       len(links),
+		Backlinks:   links,
+		Hint:        "via is the referencing field. Use get_entity_details(entity_type=<type>, id=<id>) for any entry.",
+		SnapshotAge: formatAge(age),
+	})
+}
@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- bulk_update ----
+
+// bulkUpdateMaxItems is the largest max_items bulk_update accepts, matching
+// list_entities' page cap.
+const bulkUpdateMaxItems = 500
+
+// bulkUpdateTypes are the entity types bulk_update can both list and patch.
+var bulkUpdateTypes = []string{
+	"company", "site", "device", "kb", "contact", "account", "agreement",
+	"document", "facility", "cabinet", "configuration", "ipnetwork",
+}
+
+// BulkFilter selects the records bulk_update changes. Fields mean what they do
+// in list_entities.
+type BulkFilter struct {
+	Name           string            `json:"name,omitempty" jsonschema:"Filter by exact name"`
+	NameStartsWith string            `json:"name_starts_with,omitempty" jsonschema:"Filter by name prefix"`
+	CompanyID      string            `json:"company_id,omitempty" jsonschema:"Filter by company ID"`
+	SiteID         string            `json:"site_id,omitempty" jsonschema:"Filter by site ID (devices, contacts)"`
+	TypeName       string            `json:"type_name,omitempty" jsonschema:"Filter by entity type name (e.g. 'Server')"`
+	IPAddress      string            `json:"ip_address,omitempty" jsonschema:"Filter devices by IP address"`
+	MacAddress     string            `json:"mac_address,omitempty" jsonschema:"Filter devices by MAC address, any common notation"`
+	SerialNumber   string            `json:"serial_number,omitempty" jsonschema:"Filter devices by serial number"`
+	Manufacturer   string            `json:"manufacturer,omitempty" jsonschema:"Filter devices by manufacturer"`
+	ModifiedSince  string            `json:"modified_since,omitempty" jsonschema:"Only items modified since this date (YYYY-MM-DD)"`
+	ExtraFilters   map[string]string `json:"extra_filters,omitempty" jsonschema:"Further ITPortal query parameters, sent verbatim as in list_entities"`
+}
+
+type BulkUpdateInput struct {
+	EntityType string                 `json:"entity_type" jsonschema:"Required. One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
+	Filter     BulkFilter             `json:"filter" jsonschema:"Which records to update, with the same filters as list_entities"`
+	Fields     map[string]interface{} `json:"fields" jsonschema:"Required. Fields to set on every matched record, as in update_entity. Reference fields use {\"id\": N} format."`
+	MaxItems   int                    `json:"max_items" jsonschema:"Required. Refuse to change anything when more records than this match (1-500)"`
+}
+
+// bulkItemResult is the outcome of patching one matched record.
+type bulkItemResult struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkUpdate lists the records matching a filter and PATCHes the same fields
+// onto each, reporting every record's outcome. Nothing is changed when more
+// than max_items records match.
+func (h *Handler) BulkUpdate(ctx context.Context, _ *sdkmcp.CallToolRequest, input BulkUpdateInput) (*sdkmcp.CallToolResult, any, error) {
+	var capCheck *fieldError
+	if input.MaxItems < 1 || input.MaxItems > bulkUpdateMaxItems {
+		capCheck = &fieldError{Field: "max_items", Reason: fmt.Sprintf("required, between 1 and %d", bulkUpdateMaxItems)}
+	}
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateOneOf("entity_type", input.EntityType, bulkUpdateTypes...),
+		validateRequired("fields", input.Fields),
+		capCheck,
+		validateExtraFilters("filter.extra_filters", input.Filter.ExtraFilters),
+	); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+	f := input.Filter
+	mac := ""
+	if f.MacAddress != "" {
+		var ok bool
+		if mac, ok = normalizeMAC(f.MacAddress); !ok {
+			return toolError(fmt.Sprintf("filter.mac_address %q is not a valid MAC address", f.MacAddress)), nil, nil
+		}
+	}
+
+	// One more than the cap, so an over-cap match is seen even when the
+	// endpoint reports no total.
+	items, total, _, err := h.listByType(ctx, input.EntityType, &itportal.ListOptions{
+		Name:           f.Name,
+		NameStartsWith: f.NameStartsWith,
+		CompanyID:      f.CompanyID,
+		SiteID:         f.SiteID,
+		TypeName:       f.TypeName,
+		IPAddress:      f.IPAddress,
+		MacAddress:     mac,
+		SerialNumber:   f.SerialNumber,
+		Manufacturer:   f.Manufacturer,
+		ModifiedSince:  f.ModifiedSince,
+		Limit:          input.MaxItems + 1,
+		Extra:          f.ExtraFilters,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := bulkTargets(items)
+	if n := max(total, len(matched)); n > input.MaxItems {
+		return toolError(fmt.Sprintf("%d %s records match, more than max_items %d. Nothing was updated; narrow the filter or raise max_items.",
+			n, input.EntityType, input.MaxItems)), nil, nil
+	}
+	if len(matched) == 0 {
+		return toolText(fmt.Sprintf("No %s records match the filter. Nothing was updated.", input.EntityType)), nil, nil
+	}
+
+	updated, failed := 0, 0
+	var warnings []string
+	for i := range matched {
+		r := &matched[i]
+		id := strconv.Itoa(r.ID)
+		// patchByType may normalise fields in place; give each record its own copy.
+		if _, err := h.patchByType(ctx, input.EntityType, id, maps.Clone(input.Fields)); err != nil {
+			r.Status, r.Error = "failed", err.Error()
+			failed++
+			warnings = append(warnings, fmt.Sprintf("Could not update %s %s%s: %v", input.EntityType, id, bulkLabel(r.Name), err))
+			continue
+		}
+		r.Status = "updated"
+		updated++
+		h.mergeUpdated(ctx, input.EntityType, id)
+	}
+
+	summary := struct {
+		EntityType string           `json:"entity_type"`
+		Matched    int              `json:"matched"`
+		Updated    int              `json:"updated"`
+		Failed     int              `json:"failed"`
+		Results    []bulkItemResult `json:"results"`
+	}{input.EntityType, len(matched), updated, failed, matched}
+	out, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal bulk update: %w", err)
+	}
+	return outcomeResult(string(out), summary, warnings)
+}
+
+// bulkLabel renders a record's name for a warning: " (name)", or nothing.
+func bulkLabel(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " (" + name + ")"
+}
+
+// bulkTargets reads the ID and display name of each listed record.
+func bulkTargets(items any) []bulkItemResult {
+	rv := reflect.ValueOf(items)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	out := make([]bulkItemResult, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		v := reflect.Indirect(rv.Index(i))
+		r := bulkItemResult{ID: int(v.FieldByName("ID").Int())}
+		for _, name := range []string{"Name", "Description"} {
+			if f := v.FieldByName(name); f.IsValid() && f.String() != "" {
+				r.Name = f.String()
+				break
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// bulkServer lists sites and records every PATCH path and body; PATCHes to a
+// path in fail get a 500.
+func bulkServer(t *testing.T, sites []itportal.Site, fail map[string]bool) (*httptest.Server, *sync.Map, *listQuery) {
+	t.Helper()
+	patched := &sync.Map{}
+	q := &listQuery{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			q.set(r.URL.Query().Get("companyId"), r.URL.Query().Get("limit"))
+			writeList(w, sites, "")
+		case http.MethodPatch:
+			if fail[r.URL.Path] {
+				http.Error(w, `{"code":500,"message":"boom"}`, http.StatusInternalServerError)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			patched.Store(r.URL.Path, string(body))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, patched, q
+}
+
+// listQuery remembers the filter the last list request carried.
+type listQuery struct {
+	mu               sync.Mutex
+	companyID, limit string
+}
+
+func (q *listQuery) set(companyID, limit string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.companyID, q.limit = companyID, limit
+}
+
+func TestBulkUpdatePatchesEveryMatch(t *testing.T) {
+	sites := []itportal.Site{{ID: 10, Name: "HQ"}, {ID: 11, Name: "Branch"}, {ID: 12, Name: "Depot"}}
+	srv, patched, q := bulkServer(t, sites, map[string]bool{"/api/2.1/sites/12/": true})
+	h := newHandler(srv.URL)
+
+	res, structured, err := h.BulkUpdate(context.Background(), nil, BulkUpdateInput{
+		EntityType: "site",
+		Filter:     BulkFilter{CompanyID: "5"},
+		Fields:     map[string]interface{}{"status": "Closed"},
+		MaxItems:   5,
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("BulkUpdate: err=%v res=%v", err, res)
+	}
+	if q.companyID != "5" || q.limit != "6" {
+		t.Errorf("list filter companyId=%q limit=%q, want 5 and 6", q.companyID, q.limit)
+	}
+	for _, path := range []string{"/api/2.1/sites/10/", "/api/2.1/sites/11/"} {
+		body, ok := patched.Load(path)
+		if !ok || !strings.Contains(body.(string), `"status":"Closed"`) {
+			t.Errorf("%s patched with %v", path, body)
+		}
+	}
+
+	var out struct {
+		Matched, Updated, Failed int
+		Results                  []bulkItemResult
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Matched != 3 || out.Updated != 2 || out.Failed != 1 {
+		t.Errorf("counts = %+v", out)
+	}
+	if r := out.Results[2]; r.ID != 12 || r.Name != "Depot" || r.Status != "failed" || r.Error == "" {
+		t.Errorf("failed item = %+v", r)
+	}
+	if w := structured.(toolOutcome).Warnings; len(w) != 1 || !strings.HasPrefix(w[0], "Could not update site 12 (Depot):") {
+		t.Errorf("warnings = %q, want the Depot failure", w)
+	}
+}
+
+func TestBulkUpdateEnforcesCap(t *testing.T) {
+	sites := []itportal.Site{{ID: 10}, {ID: 11}, {ID: 12}}
+	srv, patched, _ := bulkServer(t, sites, nil)
+	h := newHandler(srv.URL)
+
+	res, _, err := h.BulkUpdate(context.Background(), nil, BulkUpdateInput{
+		EntityType: "site",
+		Fields:     map[string]interface{}{"status": "Closed"},
+		MaxItems:   2,
+	})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "more than max_items 2") {
+		t.Fatalf("over-cap result: err=%v text=%q", err, resultText(t, res))
+	}
+	patched.Range(func(k, _ any) bool {
+		t.Errorf("%v patched despite exceeding the cap", k)
+		return true
+	})
+
+	for name, in := range map[string]BulkUpdateInput{
+		"no cap":       {EntityType: "site", Fields: map[string]interface{}{"a": 1}},
+		"cap too big":  {EntityType: "site", Fields: map[string]interface{}{"a": 1}, MaxItems: 501},
+		"no fields":    {EntityType: "site", MaxItems: 2},
+		"unknown type": {EntityType: "user", Fields: map[string]interface{}{"a": 1}, MaxItems: 2},
+	} {
+		if res, _, _ := h.BulkUpdate(context.Background(), nil, in); !res.IsError {
+			t.Errorf("%s: not rejected", name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// capabilityTypes are the entity types the capability matrix reports on: every
+// type one of the generic entity tools accepts.
+var capabilityTypes = []string{
+	"company", "site", "device", "kb", "contact", "account", "agreement", "document",
+	"facility", "cabinet", "configuration", "ipnetwork", "address", "form",
+	"additional_credential", "interaction", "kb_category", "device_type", "template",
+	"user", "country", "security_group", "main_contact",
+}
+
+// createTools are the dedicated create tools, by the entity type they create.
+var createTools = map[string]string{
+	"device":    "create_device",
+	"kb":        "create_kb_article",
+	"ipnetwork": "create_ip_network",
+}
+
+// entityCapability is one row of the capability matrix: the tools performing
+// each operation on an entity type. Operations it lacks are left out.
+type entityCapability struct {
+	EntityType string              `json:"entity_type"`
+	Operations map[string][]string `json:"operations"`
+	// WritesDenied is the write policy's refusal for this type, if any.
+	WritesDenied string `json:"writes_denied,omitempty"`
+}
+
+// The normalised entity types (see normType) each generic entity tool
+// accepts, mirroring the type switches in listByType, GetEntityDetails,
+// CreateEntity, patchByType and deleter; TestCapabilityTablesMatchHandlers
+// probes the handlers to keep the two in step. The capability matrix is built
+// from these tables, never by calling the handlers. They are read-only.
+var (
+	listableTypes = typeSet("company", "site", "device", "kb", "contact", "account", "agreement",
+		"document", "facility", "cabinet", "configuration", "ipnetwork", "kbcategory", "devicetype",
+		"template", "address", "form", "additionalcredential", "user", "country", "securitygroup",
+		"maincontact")
+	gettableTypes = typeSet("company", "site", "device", "kb", "contact", "account", "agreement",
+		"document", "facility", "cabinet", "configuration", "ipnetwork")
+	creatableTypes = typeSet("company", "site", "contact", "account", "agreement", "document",
+		"ipnetwork", "facility", "cabinet", "configuration", "address")
+	updatableTypes = typeSet("company", "site", "device", "kb", "contact", "account", "agreement",
+		"document", "facility", "cabinet", "configuration", "ipnetwork", "additionalcredential")
+	deletableTypes = typeSet("company", "site", "device", "kb", "contact", "account", "agreement",
+		"document", "facility", "cabinet", "configuration", "ipnetwork", "address",
+		"additionalcredential", "interaction")
+)
+
+func typeSet(types ...string) map[string]bool {
+	m := make(map[string]bool, len(types))
+	for _, t := range types {
+		m[t] = true
+	}
+	return m
+}
+
+// capabilities builds the capability matrix from the static type tables.
+func (h *Handler) capabilities() []entityCapability {
+	uploads := map[string][]string{}
+	for _, t := range uploadTargets {
+		kind := "upload_file(entity_type=" + t.kind + ")"
+		if !slices.Contains(uploads[t.owner], kind) {
+			uploads[t.owner] = append(uploads[t.owner], kind)
+		}
+	}
+
+	out := make([]entityCapability, 0, len(capabilityTypes))
+	for _, typ := range capabilityTypes {
+		norm := normType(typ)
+		ops := map[string][]string{}
+		add := func(op, tool string, wired bool) {
+			if wired {
+				ops[op] = append(ops[op], tool)
+			}
+		}
+		add("list", "list_entities", listableTypes[norm])
+		add("get", "get_entity_details", gettableTypes[norm])
+		add("create", "create_entity", creatableTypes[norm])
+		if tool, ok := createTools[typ]; ok {
+			add("create", tool, true)
+		}
+		add("update", "update_entity", updatableTypes[norm])
+		add("delete", "delete_entity", deletableTypes[norm])
+		if kinds := uploads[norm]; len(kinds) > 0 {
+			sort.Strings(kinds)
+			ops["upload"] = kinds
+		}
+		out = append(out, entityCapability{EntityType: typ, Operations: ops, WritesDenied: h.policy.denied(typ)})
+	}
+	return out
+}
+
+// CapabilitiesResource serves the capability matrix: every entity type and the
+// tools that list, get, create, update, delete and upload it.
+func (h *Handler) CapabilitiesResource(_ context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+	out, err := json.MarshalIndent(struct {
+		EntityTypes []entityCapability `json:"entity_types"`
+	}{h.capabilities()}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal capabilities: %w", err)
+	}
+	return h.resourceResult(req.Params.URI, "application/json", string(out), len(capabilityTypes)), nil
+}
+
+// capabilitiesURI is the capabilities resource URI of this Handler's instance.
+func (h *Handler) capabilitiesURI() string {
+	return "itportal://" + h.uriPrefix + "capabilities"
+}
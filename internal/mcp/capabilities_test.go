@@ -0,0 +1,111 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// TestCapabilitiesMatchRegisteredTools verifies every tool the capability
+// matrix names is registered, that the matrix reflects what the handlers
+// accept, and that building it never reaches ITPortal.
+func TestCapabilitiesMatchRegisteredTools(t *testing.T) {
+	client, c, hits := fakeInstance(t, "Alpha")
+	cs := connect(t, NewServer(client, c, WithWritePolicy(WritePolicy{ReadOnly: true})))
+	ctx := context.Background()
+
+	tools, err := cs.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	registered := map[string]bool{}
+	for _, tool := range tools.Tools {
+		registered[tool.Name] = true
+	}
+
+	before := hits.Load()
+	rr, err := cs.ReadResource(ctx, &sdkmcp.ReadResourceParams{URI: "itportal://capabilities"})
+	if err != nil {
+		t.Fatalf("read capabilities: %v", err)
+	}
+	if n := hits.Load() - before; n != 0 {
+		t.Errorf("building the matrix made %d API requests", n)
+	}
+	var got struct {
+		EntityTypes []entityCapability `json:"entity_types"`
+	}
+	if err := json.Unmarshal([]byte(rr.Contents[0].Text), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	matrix := map[string]map[string][]string{}
+	for _, ec := range got.EntityTypes {
+		matrix[ec.EntityType] = ec.Operations
+		for op, names := range ec.Operations {
+			for _, name := range names {
+				if tool, _, _ := strings.Cut(name, "("); !registered[tool] {
+					t.Errorf("%s %s names unregistered tool %q", ec.EntityType, op, name)
+				}
+			}
+		}
+		if ec.WritesDenied == "" {
+			t.Errorf("%s: read-only policy not reported", ec.EntityType)
+		}
+	}
+
+	for _, tc := range []struct {
+		typ, op string
+		want    []string
+	}{
+		{"device", "create", []string{"create_device"}},
+		{"ipnetwork", "create", []string{"create_entity", "create_ip_network"}},
+		{"company", "update", []string{"update_entity"}},
+		{"kb", "upload", []string{"upload_file(entity_type=kb)"}},
+		{"company", "upload", nil},
+		{"interaction", "delete", []string{"delete_entity"}},
+		{"interaction", "get", nil},
+		{"address", "update", nil},
+		{"user", "list", []string{"list_entities"}},
+	} {
+		if got := matrix[tc.typ][tc.op]; !slices.Equal(got, tc.want) {
+			t.Errorf("%s %s = %v, want %v", tc.typ, tc.op, got, tc.want)
+		}
+	}
+}
+
+// TestCapabilityTablesMatchHandlers verifies the static type tables agree with
+// the type switches in the generic entity handlers. The handlers are probed
+// against a fake portal with a cancelled context: a wired type fails on the
+// request, an unwired one is turned away with a tool error.
+func TestCapabilityTablesMatchHandlers(t *testing.T) {
+	client, _, _ := fakeInstance(t, "Alpha")
+	h := &Handler{client: client, baseURL: client.BaseURL()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	wired := func(res *sdkmcp.CallToolResult, _ any, err error) bool {
+		return err != nil && (res == nil || !res.IsError)
+	}
+	fields := func() map[string]any { return map[string]any{"name": "probe"} }
+	for _, typ := range capabilityTypes {
+		norm := normType(typ)
+		for _, tc := range []struct {
+			op    string
+			table map[string]bool
+			got   bool
+		}{
+			{"list", listableTypes, wired(h.ListEntities(ctx, nil, ListEntitiesInput{EntityType: typ}))},
+			{"get", gettableTypes, wired(h.GetEntityDetails(ctx, nil, GetEntityInput{EntityType: typ, ID: "1"}))},
+			{"create", creatableTypes, wired(h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: typ, Fields: fields()}))},
+			{"update", updatableTypes, wired(h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: typ, ID: "1", Fields: fields()}))},
+			{"delete", deletableTypes, wired(h.DeleteEntity(ctx, nil, DeleteEntityInput{EntityType: typ, ID: "1"}))},
+		} {
+			if tc.table[norm] != tc.got {
+				t.Errorf("%s %s: table says %v, handler says %v", typ, tc.op, tc.table[norm], tc.got)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- validate_changeset ----
+
+// changesetMaxOperations is the most operations validate_changeset checks in
+// one call; each may cost a few lookups.
+const changesetMaxOperations = 100
+
+type ChangeOperation struct {
+	Op         string                 `json:"op" jsonschema:"One of: create, update, delete"`
+	EntityType string                 `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork (delete also takes address, additional_credential, interaction)"`
+	ID         string                 `json:"id,omitempty" jsonschema:"Numeric ID of the entity; required for update and delete"`
+	Fields     map[string]interface{} `json:"fields,omitempty" jsonschema:"The fields create_entity or update_entity would send. Reference fields use {\"id\": N} format."`
+}
+
+type ValidateChangesetInput struct {
+	Operations []ChangeOperation `json:"operations" jsonschema:"Required. The proposed operations, in the order they would be applied (at most 100)"`
+}
+
+// changeCheck is the verdict on one proposed operation.
+type changeCheck struct {
+	Index      int          `json:"index"`
+	Op         string       `json:"op"`
+	EntityType string       `json:"entity_type"`
+	ID         string       `json:"id,omitempty"`
+	Valid      bool         `json:"valid"`
+	Errors     []fieldError `json:"errors,omitempty"`
+}
+
+// changesetDateFields are the model fields holding YYYY-MM-DD dates.
+var changesetDateFields = map[string]bool{
+	"startDate": true, "dueDate": true, "expires": true, "installDate": true,
+	"purchaseDate": true, "warrantyExpires": true, "retireDate": true,
+	"leaseEndDate": true, "dateIssued": true, "dateExpires": true,
+}
+
+// referenceTypes maps each reference model to the entity type it points at,
+// for the existence check of reference fields.
+var referenceTypes = map[reflect.Type]string{
+	reflect.TypeFor[itportal.CompanyReference]():   "company",
+	reflect.TypeFor[itportal.SiteReference]():      "site",
+	reflect.TypeFor[itportal.ContactReference]():   "contact",
+	reflect.TypeFor[itportal.DocumentReference]():  "document",
+	reflect.TypeFor[itportal.DeviceReference]():    "device",
+	reflect.TypeFor[itportal.FacilityReference]():  "facility",
+	reflect.TypeFor[itportal.CabinetReference]():   "cabinet",
+	reflect.TypeFor[itportal.IPNetworkReference](): "ipnetwork",
+}
+
+// ValidateChangeset checks every proposed create/update/delete without
+// applying any: the operation and entity type, the write policy, required
+// fields, field names and types, date formats, and that the target record and
+// every referenced record exist. It reads from ITPortal but never writes.
+func (h *Handler) ValidateChangeset(ctx context.Context, _ *sdkmcp.CallToolRequest, input ValidateChangesetInput) (*sdkmcp.CallToolResult, any, error) {
+	var sizeCheck *fieldError
+	if len(input.Operations) > changesetMaxOperations {
+		sizeCheck = &fieldError{Field: "operations", Reason: fmt.Sprintf("at most %d operations per call", changesetMaxOperations)}
+	}
+	if res := validationResult(validateRequired("operations", input.Operations), sizeCheck); res != nil {
+		return res, nil, nil
+	}
+
+	v := &changesetValidator{h: h, seen: map[string]error{}}
+	results := make([]changeCheck, len(input.Operations))
+	invalid := 0
+	for i, op := range input.Operations {
+		errs, err := v.check(ctx, op)
+		if err != nil {
+			return nil, nil, fmt.Errorf("validate operation %d: %w", i, err)
+		}
+		results[i] = changeCheck{
+			Index:      i,
+			Op:         strings.ToLower(strings.TrimSpace(op.Op)),
+			EntityType: op.EntityType,
+			ID:         strings.TrimSpace(op.ID),
+			Valid:      len(errs) == 0,
+			Errors:     errs,
+		}
+		if len(errs) > 0 {
+			invalid++
+		}
+	}
+	return marshalResult(struct {
+		Valid      bool          `json:"valid"`
+		Operations int           `json:"operations"`
+		Invalid    int           `json:"invalid"`
+		Results    []changeCheck `json:"results"`
+		Note       string        `json:"note"`
+	}{
+		Valid:      invalid == 0,
+		Operations: len(results),
+		Invalid:    invalid,
+		Results:    results,
+		Note:       "Nothing was applied. References to records created earlier in the same changeset cannot be checked.",
+	})
+}
+
+// changesetValidator checks the operations of one changeset, looking each
+// record up at most once.
+type changesetValidator struct {
+	h *Handler
+	// seen holds the lookup outcome per "type/id": nil when the record exists.
+	seen map[string]error
+}
+
+// check returns the problems of one operation. err is a lookup failure other
+// than not found.
+func (v *changesetValidator) check(ctx context.Context, op ChangeOperation) (errs []fieldError, err error) {
+	add := func(checks ...*fieldError) {
+		for _, c := range checks {
+			if c != nil {
+				errs = append(errs, *c)
+			}
+		}
+	}
+	action := strings.ToLower(strings.TrimSpace(op.Op))
+	add(validateRequired("op", action), validateOneOf("op", action, "create", "update", "delete"),
+		validateRequired("entity_type", op.EntityType))
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	typ := normType(op.EntityType)
+	if typ == "knowledgebase" {
+		typ = "kb"
+	}
+	model, modelled := describedModels[typ]
+	if action == "delete" {
+		_, modelled = v.h.deleter(typ)
+	}
+	if !modelled || (action != "delete" && typ == "address") {
+		add(&fieldError{Field: "entity_type", Reason: fmt.Sprintf("%q cannot be %sd with this changeset", op.EntityType, action)})
+		return errs, nil
+	}
+	if msg := v.h.policy.denied(op.EntityType); msg != "" {
+		add(&fieldError{Field: "entity_type", Reason: msg})
+	}
+
+	id := strings.TrimSpace(op.ID)
+	if action != "create" {
+		add(validateRequiredFor("id", id, action), validateNumericID("id", id))
+		if validateNumericID("id", id) == nil && id != "" {
+			problem, err := v.exists(ctx, "id", typ, id)
+			if err != nil {
+				return nil, err
+			}
+			add(problem)
+		}
+	}
+	if action == "delete" {
+		return errs, nil
+	}
+
+	if action == "create" {
+		v.h.defaultCompanyField(typ, op.Fields)
+	}
+	add(validateRequiredFor("fields", op.Fields, action))
+	if len(op.Fields) == 0 {
+		return errs, nil
+	}
+	if action == "create" {
+		for _, name := range []string{"name", "company"} {
+			if _, ok := jsonField(model, name); ok {
+				add(validateRequiredFor("fields."+name, op.Fields[name], "create"))
+			}
+		}
+	}
+	problems, err := v.checkFields(ctx, model, op.Fields)
+	add(problems...)
+	return errs, err
+}
+
+// checkFields checks fields against model: known names, decodable values,
+// YYYY-MM-DD dates and existing references. Keys are checked in sorted order
+// so the reported problems are stable.
+func (v *changesetValidator) checkFields(ctx context.Context, model reflect.Type, fields map[string]any) ([]*fieldError, error) {
+	coerceScalarFields(fields, model)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var problems []*fieldError
+	for _, k := range keys {
+		field := "fields." + k
+		sf, ok := jsonField(model, k)
+		if !ok {
+			problems = append(problems, &fieldError{Field: field, Reason: fmt.Sprintf("is not a %s field; see describe_entity", strings.ToLower(model.Name()))})
+			continue
+		}
+		raw, _ := json.Marshal(fields[k])
+		decoded := reflect.New(sf.Type)
+		if err := json.Unmarshal(raw, decoded.Interface()); err != nil {
+			problems = append(problems, &fieldError{Field: field, Reason: fmt.Sprintf("want %s", jsonTypeName(sf.Type))})
+			continue
+		}
+		if s, ok := fields[k].(string); ok && changesetDateFields[k] {
+			problems = append(problems, validateDate(field, s))
+		}
+		typ, isRef := referenceTypes[structType(sf.Type)]
+		if !isRef || sf.Type.Kind() == reflect.Slice {
+			continue
+		}
+		if ref := reflect.Indirect(decoded.Elem()); ref.IsValid() && ref.FieldByName("ID").Int() > 0 {
+			problem, err := v.exists(ctx, field, typ, strconv.FormatInt(ref.FieldByName("ID").Int(), 10))
+			if err != nil {
+				return nil, err
+			}
+			problems = append(problems, problem)
+		}
+	}
+	return problems, nil
+}
+
+// exists reports field as invalid when the typ record id is not found.
+func (v *changesetValidator) exists(ctx context.Context, field, typ, id string) (*fieldError, error) {
+	key := typ + "/" + id
+	err, done := v.seen[key]
+	if !done {
+		_, ok, gerr := v.h.getByType(ctx, typ, id)
+		if !ok {
+			// No single-record endpoint to ask; leave it to the API.
+			gerr = nil
+		}
+		err = gerr
+		v.seen[key] = err
+	}
+	switch {
+	case err == nil:
+		return nil, nil
+	case itportal.IsNotFound(err):
+		return &fieldError{Field: field, Reason: fmt.Sprintf("%s %s not found", typ, id)}, nil
+	}
+	return nil, fmt.Errorf("look up %s %s: %w", typ, id, err)
+}
@@ -0,0 +1,98 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateChangesetMixedValidity(t *testing.T) {
+	// Companies 1 and sites 10 exist; everything else is missing. Writes fail
+	// the test: validation must not apply anything.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/api/2.1") {
+		case "/companies/1/":
+			writeList(w, []map[string]any{{"id": 1, "name": "Acme"}}, "")
+		case "/sites/10/":
+			writeList(w, []map[string]any{{"id": 10, "name": "HQ"}}, "")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	res, _, err := h.ValidateChangeset(context.Background(), nil, ValidateChangesetInput{Operations: []ChangeOperation{
+		{Op: "create", EntityType: "device", Fields: map[string]any{"name": "fw02", "company": map[string]any{"id": 1}, "site": map[string]any{"id": 10}, "purchaseDate": "2026-01-05"}},
+		{Op: "create", EntityType: "device", Fields: map[string]any{"name": "fw01", "company": map[string]any{"id": "99"}, "warrantyExpires": "05/01/2027"}},
+		{Op: "update", EntityType: "site", ID: "10", Fields: map[string]any{"name": "HQ West"}},
+		{Op: "update", EntityType: "site", ID: "11", Fields: map[string]any{"colour": "blue"}},
+		{Op: "delete", EntityType: "company", ID: "abc"},
+		{Op: "rename", EntityType: "site", ID: "10"},
+	}})
+	if err != nil || res.IsError {
+		t.Fatalf("ValidateChangeset = %v, %v", res, err)
+	}
+	var out struct {
+		Valid   bool
+		Invalid int
+		Results []changeCheck
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Valid || out.Invalid != 4 || len(out.Results) != 6 {
+		t.Fatalf("valid=%v invalid=%d results=%d, want false, 4, 6", out.Valid, out.Invalid, len(out.Results))
+	}
+
+	want := [][]string{
+		nil,
+		{"fields.company", "fields.warrantyExpires"},
+		nil,
+		{"id", "fields.colour"},
+		{"id"},
+		{"op"},
+	}
+	for i, r := range out.Results {
+		var fields []string
+		for _, e := range r.Errors {
+			fields = append(fields, e.Field)
+		}
+		if r.Valid != (want[i] == nil) || strings.Join(fields, ",") != strings.Join(want[i], ",") {
+			t.Errorf("operation %d: valid=%v errors=%v, want fields %v", i, r.Valid, r.Errors, want[i])
+		}
+	}
+	if got := out.Results[1].Errors[0].Reason; got != "company 99 not found" {
+		t.Errorf("reference reason = %q", got)
+	}
+}
+
+func TestValidateChangesetRequiredFieldsAndPolicy(t *testing.T) {
+	h := newHandler("http://127.0.0.1:0")
+	h.policy = NewWritePolicy(false, []string{"kb"})
+
+	res, _, err := h.ValidateChangeset(context.Background(), nil, ValidateChangesetInput{Operations: []ChangeOperation{
+		{Op: "create", EntityType: "kb", Fields: map[string]any{"description": "no name"}},
+		{Op: "create", EntityType: "device", Fields: map[string]any{"name": "fw01"}},
+	}})
+	if err != nil || res.IsError {
+		t.Fatalf("ValidateChangeset = %v, %v", res, err)
+	}
+	text := resultText(t, res)
+	for _, want := range []string{`"field": "fields.name"`, `"field": "fields.company"`, "writes to \\\"device\\\" are not permitted"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result missing %s:\n%s", want, text)
+		}
+	}
+
+	res, _, _ = h.ValidateChangeset(context.Background(), nil, ValidateChangesetInput{})
+	if !res.IsError || !strings.Contains(resultText(t, res), "operations") {
+		t.Errorf("empty changeset: want an operations field error, got %v", resultText(t, res))
+	}
+}
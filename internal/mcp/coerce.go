@@ -0,0 +1,82 @@
+package mcp
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// entityModel returns the model struct of entityType (any alias normType
+// accepts), or nil when describedModels has none.
+func entityModel(entityType string) reflect.Type {
+	typ := normType(entityType)
+	if typ == "knowledgebase" {
+		typ = "kb"
+	}
+	return describedModels[typ]
+}
+
+// coerceScalarFields rewrites string values of fields that model declares as
+// numbers or booleans into numbers and booleans, descending into nested
+// objects and arrays, so models sending {"company": {"id": "5"}} or
+// {"public": "true"} get the same request as {"company": {"id": 5}} or
+// {"public": true}. Strings that do not parse are left for the API to reject,
+// and keys model does not know are left untouched. A nil model changes nothing.
+func coerceScalarFields(fields map[string]any, model reflect.Type) {
+	if model == nil {
+		return
+	}
+	for model.Kind() == reflect.Pointer {
+		model = model.Elem()
+	}
+	if model.Kind() != reflect.Struct {
+		return
+	}
+	for k, v := range fields {
+		sf, ok := jsonField(model, k)
+		if !ok {
+			continue
+		}
+		if n, ok := coerceScalar(v, sf.Type); ok {
+			fields[k] = n
+		}
+	}
+}
+
+// coerceScalar converts v for a field of type t: a numeric string for a number
+// field, a "true"/"false" string (any case) for a boolean field, or the values
+// nested in an object or array. ok is false when v is left as it is.
+func coerceScalar(v any, t reflect.Type) (any, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch val := v.(type) {
+	case string:
+		s := strings.TrimSpace(val)
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n, err := strconv.Atoi(s); err == nil {
+				return n, true
+			}
+		case reflect.Float32, reflect.Float64:
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f, true
+			}
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+				return b, true
+			}
+		}
+	case map[string]any:
+		coerceScalarFields(val, t)
+	case []any:
+		if t.Kind() == reflect.Slice {
+			for i, el := range val {
+				if n, ok := coerceScalar(el, t.Elem()); ok {
+					val[i] = n
+				}
+			}
+		}
+	}
+	return nil, false
+}
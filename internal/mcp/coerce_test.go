@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestStringIDsCoercedToNumbers verifies create_entity and update_entity send
+// {"company": {"id": "5"}} exactly like {"company": {"id": 5}}.
+func TestStringIDsCoercedToNumbers(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPatch:
+			body = nil
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.Header().Set("Location", "/api/2.1/sites/77/")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeList(w, []map[string]any{{"id": 77}}, "")
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	companyID := func(what string) {
+		t.Helper()
+		company, _ := body["company"].(map[string]any)
+		if company["id"] != float64(5) {
+			t.Errorf("%s: company = %#v, want {id: 5}", what, body["company"])
+		}
+	}
+	for _, id := range []any{"5", " 5 ", 5, float64(5)} {
+		res, _, err := h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: "site", Fields: map[string]any{
+			"name": "HQ", "company": map[string]any{"id": id}, "numberOfPCs": "12",
+		}})
+		if err != nil || res.IsError {
+			t.Fatalf("CreateEntity(id %#v): %v, %v", id, res, err)
+		}
+		companyID("create")
+		if body["numberOfPCs"] != float64(12) {
+			t.Errorf("create: numberOfPCs = %#v, want 12", body["numberOfPCs"])
+		}
+	}
+
+	res, _, err := h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: "site", ID: "77", Fields: map[string]any{
+		"company": map[string]any{"id": "5"}, "name": "123",
+	}})
+	if err != nil || res.IsError {
+		t.Fatalf("UpdateEntity: %v, %v", res, err)
+	}
+	companyID("update")
+	if body["name"] != "123" {
+		t.Errorf("update: string field name = %#v, want \"123\" left as a string", body["name"])
+	}
+
+	res, _, _ = h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: "site", Fields: map[string]any{
+		"name": "HQ", "company": map[string]any{"id": "five"},
+	}})
+	if !res.IsError {
+		t.Errorf("non-numeric id accepted: %s", resultText(t, res))
+	}
+}
+
+// TestStringBooleansCoerced verifies create_entity and update_entity send
+// {"public": "true"} exactly like {"public": true}, for plain and pointer
+// booleans.
+func TestStringBooleansCoerced(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPatch:
+			body = nil
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.Header().Set("Location", "/api/2.1/documents/77/")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeList(w, []map[string]any{{"id": 77}}, "")
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	for in, want := range map[any]bool{"true": true, " TRUE ": true, "False": false, true: true} {
+		res, _, err := h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: "document", Fields: map[string]any{
+			"name": "Backups", "company": map[string]any{"id": 5}, "public": in, "inOut": in,
+		}})
+		if err != nil || res.IsError {
+			t.Fatalf("CreateEntity(public %#v): %v, %v", in, res, err)
+		}
+		// public is omitempty, so false is left out of the create body.
+		if got, _ := body["public"].(bool); got != want || body["inOut"] != want {
+			t.Errorf("create: %#v sent as public %#v, inOut %#v, want %v", in, body["public"], body["inOut"], want)
+		}
+	}
+
+	res, _, err := h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: "document", ID: "77", Fields: map[string]any{
+		"public": "false", "inOut": "true", "name": "true",
+	}})
+	if err != nil || res.IsError {
+		t.Fatalf("UpdateEntity: %v, %v", res, err)
+	}
+	if body["public"] != false || body["inOut"] != true {
+		t.Errorf("update: public = %#v, inOut = %#v, want false and true", body["public"], body["inOut"])
+	}
+	if body["name"] != "true" {
+		t.Errorf("update: string field name = %#v, want \"true\" left as a string", body["name"])
+	}
+
+	res, _, _ = h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: "document", Fields: map[string]any{
+		"name": "Backups", "company": map[string]any{"id": 5}, "public": "sometimes",
+	}})
+	if !res.IsError {
+		t.Errorf("non-boolean public accepted: %s", resultText(t, res))
+	}
+}
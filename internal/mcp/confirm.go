@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deleteConfirmTTL is how long a delete_entity confirmation token stays valid.
+var deleteConfirmTTL = 5 * time.Minute
+
+// pendingDelete is an issued, not yet redeemed, confirmation token.
+type pendingDelete struct {
+	token   string
+	expires time.Time
+}
+
+// pendingDeletes holds the one-time tokens delete_entity hands out, keyed by
+// entity type and ID. A new preview of the same entity replaces its token.
+type pendingDeletes struct {
+	mu     sync.Mutex
+	tokens map[string]pendingDelete
+}
+
+func newPendingDeletes() *pendingDeletes {
+	return &pendingDeletes{tokens: map[string]pendingDelete{}}
+}
+
+func deleteKey(entityType, id string) string {
+	return normType(entityType) + "/" + strings.TrimSpace(id)
+}
+
+// issue returns a fresh token for deleting the entity, valid for deleteConfirmTTL.
+func (p *pendingDeletes) issue(entityType, id string) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for k, pd := range p.tokens {
+		if now.After(pd.expires) {
+			delete(p.tokens, k)
+		}
+	}
+	p.tokens[deleteKey(entityType, id)] = pendingDelete{token: token, expires: now.Add(deleteConfirmTTL)}
+	return token
+}
+
+// redeem reports whether token is the live token for the entity, consuming it
+// when it is.
+func (p *pendingDeletes) redeem(entityType, id, token string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := deleteKey(entityType, id)
+	pd, ok := p.tokens[key]
+	if !ok || time.Now().After(pd.expires) || pd.token != strings.TrimSpace(token) {
+		return false
+	}
+	delete(p.tokens, key)
+	return true
+}
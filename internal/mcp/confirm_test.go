@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// confirmHandler serves device 77 and counts DELETEs of it.
+func confirmHandler(t *testing.T, deletes *int) *Handler {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case r.Method == http.MethodDelete && path == "/devices/77/":
+			*deletes++
+			w.WriteHeader(http.StatusNoContent)
+		case path == "/devices/77/":
+			writeList(w, []itportal.Device{{ID: 77, Name: "nas-backup01"}}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	h := newHandler(srv.URL)
+	h.deletes = newPendingDeletes()
+	return h
+}
+
+// previewToken runs the preview step and returns the issued token.
+func previewToken(t *testing.T, h *Handler) string {
+	t.Helper()
+	res, _, err := h.DeleteEntity(context.Background(), nil, DeleteEntityInput{EntityType: "device", ID: "77"})
+	if err != nil || res.IsError {
+		t.Fatalf("preview = %v, %v", res, err)
+	}
+	var out struct {
+		Confirm string `json:"confirm"`
+		Preview string `json:"preview"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &out); err != nil {
+		t.Fatalf("preview not JSON: %v", err)
+	}
+	if out.Confirm == "" || !strings.Contains(out.Preview, "nas-backup01") {
+		t.Fatalf("preview = %+v, want a token and the device name", out)
+	}
+	return out.Confirm
+}
+
+func TestDeleteEntityNeedsValidToken(t *testing.T) {
+	var deletes int
+	h := confirmHandler(t, &deletes)
+	ctx := context.Background()
+
+	token := previewToken(t, h)
+	if deletes != 0 {
+		t.Fatal("preview deleted the entity")
+	}
+	for name, in := range map[string]DeleteEntityInput{
+		"wrong token":  {EntityType: "device", ID: "77", Confirm: "deadbeef"},
+		"other entity": {EntityType: "device", ID: "78", Confirm: token},
+	} {
+		if res, _, err := h.DeleteEntity(ctx, nil, in); err != nil || !res.IsError {
+			t.Errorf("%s: want a refusal, got %v, %v", name, res, err)
+		}
+	}
+
+	res, _, err := h.DeleteEntity(ctx, nil, DeleteEntityInput{EntityType: "device", ID: "77", Confirm: token})
+	if err != nil || res.IsError || deletes != 1 {
+		t.Fatalf("confirmed delete = %v, %v (deletes %d)", res, err, deletes)
+	}
+	if res, _, _ := h.DeleteEntity(ctx, nil, DeleteEntityInput{EntityType: "device", ID: "77", Confirm: token}); !res.IsError || deletes != 1 {
+		t.Error("token was accepted twice")
+	}
+}
+
+func TestDeleteEntityTokenExpires(t *testing.T) {
+	var deletes int
+	h := confirmHandler(t, &deletes)
+	defer func(ttl time.Duration) { deleteConfirmTTL = ttl }(deleteConfirmTTL)
+	deleteConfirmTTL = time.Millisecond
+
+	token := previewToken(t, h)
+	time.Sleep(5 * time.Millisecond)
+	res, _, err := h.DeleteEntity(context.Background(), nil, DeleteEntityInput{EntityType: "device", ID: "77", Confirm: token})
+	if err != nil || !res.IsError || deletes != 0 {
+		t.Errorf("expired token: got %v, %v (deletes %d)", res, err, deletes)
+	}
+}
@@ -0,0 +1,42 @@
+package mcp
+
+import "strconv"
+
+// companyOr returns id, or the default company when id is 0 and one is set.
+func (h *Handler) companyOr(id int) int {
+	if id == 0 {
+		return h.defaultCompanyID
+	}
+	return id
+}
+
+// companyFilterOr is companyOr for the string company_id filters.
+func (h *Handler) companyFilterOr(id string) string {
+	if id == "" && h.defaultCompanyID != 0 {
+		return strconv.Itoa(h.defaultCompanyID)
+	}
+	return id
+}
+
+// hasCompany reports whether entityType's model carries a company reference,
+// so the default company applies to it. Types without a model (users,
+// countries, templates, …) and companies themselves have none.
+func hasCompany(entityType string) bool {
+	model := entityModel(entityType)
+	if model == nil {
+		return false
+	}
+	_, ok := jsonField(model, "company")
+	return ok
+}
+
+// defaultCompanyField fills in create_entity's company reference from the
+// default company when fields has none and the type has a company.
+func (h *Handler) defaultCompanyField(entityType string, fields map[string]any) {
+	if h.defaultCompanyID == 0 || fields == nil || !hasCompany(entityType) {
+		return
+	}
+	if _, ok := fields["company"]; !ok {
+		fields["company"] = map[string]any{"id": h.defaultCompanyID}
+	}
+}
@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bodyCompany returns the company reference ID of a recorded request body.
+func bodyCompany(body map[string]any) any {
+	company, _ := body["company"].(map[string]any)
+	return company["id"]
+}
+
+func TestDefaultCompanyFillsOmittedCompanyID(t *testing.T) {
+	h, bodies := reviewServer(t)
+	h.defaultCompanyID = 5
+	ctx := context.Background()
+
+	if res, _, err := h.CreateDevice(ctx, nil, CreateDeviceInput{Name: "fw01"}); err != nil || res.IsError {
+		t.Fatalf("CreateDevice = %v, %v", res, err)
+	}
+	if got := bodyCompany(bodies["POST /devices/"]); got != float64(5) {
+		t.Errorf("create_device company = %v, want the default 5", got)
+	}
+	if res, _, err := h.CreateKBArticle(ctx, nil, CreateKBArticleInput{CompanyID: 9, Name: "Backups"}); err != nil || res.IsError {
+		t.Fatalf("CreateKBArticle = %v, %v", res, err)
+	}
+	if got := bodyCompany(bodies["POST /kbs/"]); got != float64(9) {
+		t.Errorf("create_kb_article company = %v, want the explicit 9", got)
+	}
+	if res, _, err := h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: "contact", Fields: map[string]any{"firstName": "Ada"}}); err != nil || res.IsError {
+		t.Fatalf("CreateEntity = %v, %v", res, err)
+	}
+	if got := bodyCompany(bodies["POST /contacts/"]); got != float64(5) {
+		t.Errorf("create_entity contact company = %v, want the default 5", got)
+	}
+}
+
+func TestDefaultCompanyRequiredWithoutDefault(t *testing.T) {
+	h, bodies := reviewServer(t)
+	res, _, err := h.CreateDevice(context.Background(), nil, CreateDeviceInput{Name: "fw01"})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "company_id") {
+		t.Errorf("no company: want a company_id field error, got %v, %v", res, err)
+	}
+	if len(bodies) != 0 {
+		t.Errorf("invalid input reached the API: %v", bodies)
+	}
+}
+
+func TestDefaultCompanyFiltersLists(t *testing.T) {
+	queries := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries[strings.TrimPrefix(r.URL.Path, "/api/2.1")] = r.URL.Query().Get("companyId")
+		writeList(w, []map[string]any{{"id": 1}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	h.defaultCompanyID = 5
+	ctx := context.Background()
+
+	for _, in := range []ListEntitiesInput{
+		{EntityType: "site"},
+		{EntityType: "device", CompanyID: "9"},
+		{EntityType: "company"},
+		{EntityType: "template"},
+	} {
+		if res, _, err := h.ListEntities(ctx, nil, in); err != nil || res.IsError {
+			t.Fatalf("ListEntities(%s) = %v, %v", in.EntityType, res, err)
+		}
+	}
+	for path, want := range map[string]string{"/sites/": "5", "/devices/": "9", "/companies/": "", "/templates/": ""} {
+		if got, ok := queries[path]; !ok || got != want {
+			t.Errorf("%s companyId = %q, want %q", path, got, want)
+		}
+	}
+}
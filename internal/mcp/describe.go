@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- describe_entity ----
+
+type DescribeEntityInput struct {
+	EntityType string `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address"`
+}
+
+// describedModels maps each describable entity type (keyed by normType) to the
+// model struct create_entity and update_entity marshal its fields into.
+var describedModels = map[string]reflect.Type{
+	"company":       reflect.TypeFor[itportal.Company](),
+	"site":          reflect.TypeFor[itportal.Site](),
+	"device":        reflect.TypeFor[itportal.Device](),
+	"kb":            reflect.TypeFor[itportal.KB](),
+	"contact":       reflect.TypeFor[itportal.Contact](),
+	"account":       reflect.TypeFor[itportal.Account](),
+	"agreement":     reflect.TypeFor[itportal.Agreement](),
+	"document":      reflect.TypeFor[itportal.Document](),
+	"facility":      reflect.TypeFor[itportal.Facility](),
+	"cabinet":       reflect.TypeFor[itportal.Cabinet](),
+	"configuration": reflect.TypeFor[itportal.Configuration](),
+	"ipnetwork":     reflect.TypeFor[itportal.IPNetwork](),
+	"address":       reflect.TypeFor[itportal.Address](),
+}
+
+// readOnlyFields are set by ITPortal and ignored on create/update.
+var readOnlyFields = map[string]bool{"id": true, "modified": true, "url": true}
+
+// entityField describes one settable JSON field of an entity.
+type entityField struct {
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Reference bool          `json:"reference,omitempty"`
+	ReadOnly  bool          `json:"read_only,omitempty"`
+	Fields    []entityField `json:"fields,omitempty"`
+}
+
+// DescribeEntity lists the JSON fields of an entity type as the API accepts
+// them, with their types and which ones are references to other objects, so
+// create_entity/update_entity calls don't rely on guessed field names.
+func (h *Handler) DescribeEntity(_ context.Context, _ *sdkmcp.CallToolRequest, input DescribeEntityInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(validateRequired("entity_type", input.EntityType)); res != nil {
+		return res, nil, nil
+	}
+	typ := normType(input.EntityType)
+	if typ == "knowledgebase" {
+		typ = "kb"
+	}
+	model, ok := describedModels[typ]
+	if !ok {
+		names := make([]string, 0, len(describedModels))
+		for k := range describedModels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return toolError(fmt.Sprintf("unknown entity_type %q. Valid values: %s", input.EntityType, strings.Join(names, ", "))), nil, nil
+	}
+	return marshalResult(struct {
+		EntityType string        `json:"entity_type"`
+		Fields     []entityField `json:"fields"`
+		Hint       string        `json:"hint"`
+	}{
+		EntityType: typ,
+		Fields:     describeFields(model, 0),
+		Hint:       `Set reference fields with {"id": N}; read-only fields are ignored on create/update. Dates are YYYY-MM-DD strings.`,
+	})
+}
+
+// describeFields lists t's JSON fields in declaration order. Nested objects are
+// expanded one level, which covers every reference and inline object the
+// models use.
+func describeFields(t reflect.Type, depth int) []entityField {
+	var out []entityField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := entityField{Name: name, Type: jsonTypeName(sf.Type), ReadOnly: depth == 0 && readOnlyFields[name]}
+		if st := structType(sf.Type); st != nil && sf.Type.Kind() != reflect.Slice {
+			f.Reference = hasIDField(st)
+			if depth == 0 {
+				f.Fields = describeFields(st, depth+1)
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// jsonTypeName names t the way it appears in JSON.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array of " + jsonTypeName(t.Elem())
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "any"
+}
+
+// structType returns the struct t (or the element of a pointer/slice t) is, or nil.
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		return t
+	}
+	return nil
+}
+
+// hasIDField reports whether struct t carries an "id" JSON field, i.e. whether
+// it can point at an existing object with {"id": N}.
+func hasIDField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "id" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDescribeEntityDevice(t *testing.T) {
+	h := &Handler{}
+	res, _, err := h.DescribeEntity(context.Background(), nil, DescribeEntityInput{EntityType: "Device"})
+	if err != nil {
+		t.Fatalf("DescribeEntity: %v", err)
+	}
+	var got struct {
+		EntityType string        `json:"entity_type"`
+		Fields     []entityField `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &got); err != nil {
+		t.Fatalf("decode: %v\n%s", err, resultText(t, res))
+	}
+	fields := map[string]entityField{}
+	for _, f := range got.Fields {
+		fields[f.Name] = f
+	}
+
+	company := fields["company"]
+	if !company.Reference || company.Type != "object" || len(company.Fields) == 0 || company.Fields[0].Name != "id" {
+		t.Errorf("company = %+v, want an object reference with an id field", company)
+	}
+	if serial := fields["serial"]; serial.Type != "string" || serial.Reference {
+		t.Errorf("serial = %+v, want a plain string", serial)
+	}
+	if f := fields["numberCpu"]; f.Type != "integer" {
+		t.Errorf("numberCpu type = %q, want integer", f.Type)
+	}
+	if f := fields["inOut"]; f.Type != "boolean" {
+		t.Errorf("inOut type = %q, want boolean", f.Type)
+	}
+	if !fields["url"].ReadOnly || !fields["id"].ReadOnly || fields["name"].ReadOnly {
+		t.Errorf("read-only flags wrong: url=%v id=%v name=%v", fields["url"].ReadOnly, fields["id"].ReadOnly, fields["name"].ReadOnly)
+	}
+}
+
+func TestDescribeEntityUnknownType(t *testing.T) {
+	h := &Handler{}
+	res, _, err := h.DescribeEntity(context.Background(), nil, DescribeEntityInput{EntityType: "spaceship"})
+	if err != nil {
+		t.Fatalf("DescribeEntity: %v", err)
+	}
+	if !res.IsError {
+		t.Errorf("unknown type should be a tool error: %s", resultText(t, res))
+	}
+}
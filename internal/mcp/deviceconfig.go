@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- list_device_configs ----
+
+type ListDeviceConfigsInput struct {
+	DeviceID string `json:"device_id" jsonschema:"Numeric ID of the device"`
+}
+
+// deviceConfigsResult is list_device_configs' structured output: the files
+// keyed under the device they belong to.
+type deviceConfigsResult struct {
+	DeviceID string                      `json:"device_id"`
+	Files    []itportal.DeviceConfigFile `json:"files"`
+}
+
+// ListDeviceConfigs lists the configuration files stored on a device — file
+// name, ID, date and description — so an agent can see what is there before
+// uploading another with upload_file(entity_type=device_config).
+func (h *Handler) ListDeviceConfigs(ctx context.Context, _ *sdkmcp.CallToolRequest, input ListDeviceConfigsInput) (*sdkmcp.CallToolResult, any, error) {
+	id := strings.TrimSpace(input.DeviceID)
+	if res := validationResult(
+		validateRequired("device_id", id),
+		validateNumericID("device_id", id),
+	); res != nil {
+		return res, nil, nil
+	}
+	files, err := h.client.GetDeviceConfigFiles(ctx, id)
+	if itportal.IsNotFound(err) {
+		return toolError(fmt.Sprintf("device %s not found", id)), nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("list device %s configuration files: %w", id, err)
+	}
+	if len(files) == 0 {
+		return toolText(fmt.Sprintf("Device %s has no configuration files. Add one with upload_file(entity_type=device_config).", id)), nil, nil
+	}
+	return toolText(fmt.Sprintf("Configuration files on device %s (%d):\n%s", id, len(files), formatConfigFiles(files))), deviceConfigsResult{DeviceID: id, Files: files}, nil
+}
+
+// formatConfigFiles renders one line per file: name, ID, date and description.
+func formatConfigFiles(files []itportal.DeviceConfigFile) string {
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "- %s (ID: %d)", cache.FirstNonEmpty(strings.TrimSpace(f.FileName), "(unnamed)"), f.ID)
+		if date := cache.FirstNonEmpty(strings.TrimSpace(f.DateTime), strings.TrimSpace(f.Modified)); date != "" {
+			b.WriteString(" · " + date)
+		}
+		if d := strings.TrimSpace(f.Description); d != "" {
+			b.WriteString(" — " + d)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestListDeviceConfigs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.1/devices/5/configurationFiles/":
+			writeList(w, []itportal.DeviceConfigFile{
+				{ID: 7, FileName: "fw01-running.cfg", Description: "after VLAN change", DateTime: "2026-03-02T10:15:00"},
+				{ID: 8, FileName: "fw01-startup.cfg", Modified: "2026-03-01T08:00:00"},
+			}, "")
+		case "/api/2.1/devices/6/configurationFiles/":
+			writeList(w, []itportal.DeviceConfigFile{}, "")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	res, out, err := h.ListDeviceConfigs(ctx, nil, ListDeviceConfigsInput{DeviceID: "5"})
+	if err != nil || res.IsError {
+		t.Fatalf("ListDeviceConfigs = %v, %v", res, err)
+	}
+	text := resultText(t, res)
+	for _, want := range []string{
+		"Configuration files on device 5 (2):",
+		"- fw01-running.cfg (ID: 7) · 2026-03-02T10:15:00 — after VLAN change",
+		"- fw01-startup.cfg (ID: 8) · 2026-03-01T08:00:00",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result missing %q:\n%s", want, text)
+		}
+	}
+	if r, ok := out.(deviceConfigsResult); !ok || r.DeviceID != "5" || len(r.Files) != 2 {
+		t.Errorf("structured output = %#v, want the two files", out)
+	}
+
+	res, _, err = h.ListDeviceConfigs(ctx, nil, ListDeviceConfigsInput{DeviceID: "6"})
+	if err != nil || res.IsError || !strings.Contains(resultText(t, res), "no configuration files") {
+		t.Errorf("empty device: got %v, %v", res, err)
+	}
+	res, _, err = h.ListDeviceConfigs(ctx, nil, ListDeviceConfigsInput{DeviceID: "9"})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "device 9 not found") {
+		t.Errorf("missing device: got %v, %v", res, err)
+	}
+	res, _, _ = h.ListDeviceConfigs(ctx, nil, ListDeviceConfigsInput{DeviceID: "fw01"})
+	if !res.IsError || !strings.Contains(resultText(t, res), "device_id") {
+		t.Errorf("non-numeric device_id: got %v", resultText(t, res))
+	}
+}
@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// WithDeviceTypeValidation checks create_device's type_name against the device
+// types defined in ITPortal: a close variant is mapped to the defined name, and
+// an unknown one is refused with the list of valid types.
+func WithDeviceTypeValidation(enabled bool) Option {
+	return func(h *Handler) { h.validateDeviceTypes = enabled }
+}
+
+// deviceTypeNames returns the sorted device type names of client's instance.
+// The list comes from the client's reference cache, so repeated creates do not
+// refetch it.
+func deviceTypeNames(ctx context.Context, client *itportal.Client) ([]string, error) {
+	types, err := client.ListDeviceTypes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list device types: %w", err)
+	}
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// closestName finds want among names: an exact match ignoring case and
+// surrounding space, else the single name whose folded form (no spaces,
+// hyphens or underscores; trailing plural "s"/"es" dropped) equals want's, or
+// that is within edit distance 2 of it. A tie between equally close names is
+// no match, so an ambiguous name is never guessed.
+func closestName(want string, names []string) (match string, exact bool) {
+	for _, n := range names {
+		if strings.EqualFold(strings.TrimSpace(want), n) {
+			return n, true
+		}
+	}
+	fw := foldTypeName(want)
+	best, bestDist, tie := "", 3, false
+	for _, n := range names {
+		d := editDistance(fw, foldTypeName(n))
+		switch {
+		case d < bestDist:
+			best, bestDist, tie = n, d, false
+		case d == bestDist:
+			tie = true
+		}
+	}
+	// Folding can make short names collide, so a distance-2 match needs
+	// enough letters to be meaningful.
+	if tie || best == "" || (bestDist == 2 && len(fw) < 6) {
+		return "", false
+	}
+	return best, false
+}
+
+// foldTypeName lowercases s and drops separators and a plural ending, so
+// "Access Points", "access-point" and "AccessPoint" compare equal.
+func foldTypeName(s string) string {
+	s = strings.ToLower(s)
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, s)
+	switch {
+	case strings.HasSuffix(s, "ches"), strings.HasSuffix(s, "shes"), strings.HasSuffix(s, "xes"):
+		return s[:len(s)-2]
+	case strings.HasSuffix(s, "s") && !strings.HasSuffix(s, "ss") && len(s) > 3:
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
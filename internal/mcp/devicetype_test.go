@@ -0,0 +1,106 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// deviceTypeServer defines the Server, Switch and Access Point device types
+// and records the type name of each device posted.
+func deviceTypeServer(t *testing.T) (h *Handler, posted *[]string, typeFetches *int) {
+	t.Helper()
+	posted, typeFetches = new([]string), new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case path == "/types/device/":
+			*typeFetches++
+			writeList(w, []itportal.TypeItem{{ID: 1, Name: "Server"}, {ID: 2, Name: "Switch"}, {ID: 3, Name: "Access Point"}}, "")
+		case r.Method == http.MethodPost && path == "/devices/":
+			var d itportal.Device
+			_ = json.NewDecoder(r.Body).Decode(&d)
+			name := ""
+			if d.Type != nil {
+				name = d.Type.Name
+			}
+			*posted = append(*posted, name)
+			w.Header().Set("Location", "/api/2.1/devices/77/")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeList(w, []itportal.Device{{ID: 77}}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	h = newHandler(srv.URL)
+	WithDeviceTypeValidation(true)(h)
+	return h, posted, typeFetches
+}
+
+func TestCreateDeviceTypeValidation(t *testing.T) {
+	cases := []struct {
+		typeName string
+		want     string // type posted; "" when the call must be refused
+		note     bool   // a mapping note is expected
+	}{
+		{"Server", "Server", false},
+		{"switch", "Switch", false},
+		{"switches", "Switch", true},
+		{"Acess Point", "Access Point", true},
+		{"access-points", "Access Point", true},
+		{"Toaster", "", false},
+		{"Router", "", false},
+		{"Swith", "Switch", true},
+	}
+	for _, c := range cases {
+		h, posted, _ := deviceTypeServer(t)
+		res, _, err := h.CreateDevice(context.Background(), nil, CreateDeviceInput{CompanyID: 3, Name: "dev01", TypeName: c.typeName})
+		if err != nil {
+			t.Fatalf("CreateDevice(%q): %v", c.typeName, err)
+		}
+		text := resultText(t, res)
+		if c.want == "" {
+			if !res.IsError || len(*posted) != 0 {
+				t.Errorf("type %q: want refusal without a POST, got %q", c.typeName, text)
+			}
+			if !strings.Contains(text, "Access Point, Server, Switch") {
+				t.Errorf("type %q: error does not list the valid types: %q", c.typeName, text)
+			}
+			continue
+		}
+		if res.IsError || len(*posted) != 1 || (*posted)[0] != c.want {
+			t.Errorf("type %q: posted %q, want %q (%s)", c.typeName, *posted, c.want, text)
+		}
+		if got := strings.Contains(text, "mapped to"); got != c.note {
+			t.Errorf("type %q: mapping note = %v, want %v: %s", c.typeName, got, c.note, text)
+		}
+	}
+}
+
+func TestCreateDeviceTypeListIsCached(t *testing.T) {
+	h, _, fetches := deviceTypeServer(t)
+	for range 3 {
+		if _, _, err := h.CreateDevice(context.Background(), nil, CreateDeviceInput{CompanyID: 3, Name: "dev01", TypeName: "Server"}); err != nil {
+			t.Fatalf("CreateDevice: %v", err)
+		}
+	}
+	if *fetches != 1 {
+		t.Errorf("device types fetched %d times, want 1", *fetches)
+	}
+}
+
+func TestCreateDeviceTypeUncheckedByDefault(t *testing.T) {
+	h, posted, fetches := deviceTypeServer(t)
+	WithDeviceTypeValidation(false)(h)
+	if _, _, err := h.CreateDevice(context.Background(), nil, CreateDeviceInput{CompanyID: 3, Name: "dev01", TypeName: "Toaster"}); err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+	if *fetches != 0 || len(*posted) != 1 || (*posted)[0] != "Toaster" {
+		t.Errorf("without validation: fetches=%d posted=%q", *fetches, *posted)
+	}
+}
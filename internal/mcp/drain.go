@@ -0,0 +1,100 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Drainer tracks in-flight tool calls so shutdown can wait for them instead of
+// cutting an ITPortal write off halfway. Every tool is tracked, not just the
+// write tools, because several manage_* tools read or write depending on their
+// action argument.
+type Drainer struct {
+	grace    time.Duration
+	wg       sync.WaitGroup
+	inFlight atomic.Int64
+	// mu orders Track's wg.Add against Wait setting draining, so no call is
+	// added once Wait has started.
+	mu       sync.Mutex
+	draining bool
+}
+
+// errShuttingDown is returned by Track once Wait has started.
+var errShuttingDown = errors.New("server shutting down; retry the call once it is back")
+
+// NewDrainer returns a Drainer whose tracked calls keep running for up to grace
+// after their request context is cancelled (a client that disconnects during
+// shutdown). grace 0 leaves the request context untouched.
+func NewDrainer(grace time.Duration) *Drainer {
+	return &Drainer{grace: grace}
+}
+
+// WithDrainer tracks every tool call in d.
+func WithDrainer(d *Drainer) Option {
+	return func(h *Handler) { h.drainer = d }
+}
+
+// Track registers a tool call starting now. It returns the context the call
+// should use and a func to call when it ends, or an error once shutdown has
+// begun draining, so new calls are refused rather than started.
+func (d *Drainer) Track(ctx context.Context) (context.Context, func(), error) {
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		return nil, nil, errShuttingDown
+	}
+	d.wg.Add(1)
+	d.inFlight.Add(1)
+	d.mu.Unlock()
+	ctx, cancel := d.detach(ctx)
+	return ctx, func() {
+		cancel()
+		d.inFlight.Add(-1)
+		d.wg.Done()
+	}, nil
+}
+
+// InFlight reports how many tracked calls are running.
+func (d *Drainer) InFlight() int {
+	return int(d.inFlight.Load())
+}
+
+// Wait starts draining: Track refuses new calls from then on. It blocks until
+// no tracked call is running or ctx ends, and reports how many calls were in
+// flight when it started.
+func (d *Drainer) Wait(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+	awaited := d.InFlight()
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return awaited, nil
+	case <-ctx.Done():
+		return awaited, ctx.Err()
+	}
+}
+
+// detach returns a context carrying parent's values that is only cancelled
+// grace after parent is.
+func (d *Drainer) detach(parent context.Context) (context.Context, context.CancelFunc) {
+	if d.grace <= 0 {
+		return parent, func() {}
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	stop := context.AfterFunc(parent, func() {
+		time.AfterFunc(d.grace, cancel)
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestDrainerContextOutlivesCancelledRequest(t *testing.T) {
+	d := NewDrainer(100 * time.Millisecond)
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, done, err := d.Track(parent)
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	defer done()
+	if d.InFlight() != 1 {
+		t.Fatalf("InFlight = %d, want 1", d.InFlight())
+	}
+
+	cancel()
+	select {
+	case <-ctx.Done():
+		t.Fatal("tool context cancelled together with the request")
+	case <-time.After(30 * time.Millisecond):
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("tool context not cancelled after the grace period")
+	}
+}
+
+func TestDrainerWaitReportsAwaitedCalls(t *testing.T) {
+	d := NewDrainer(0)
+	_, done, err := d.Track(context.Background())
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	time.AfterFunc(20*time.Millisecond, done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := d.Wait(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("Wait = %d, %v; want 1, nil", n, err)
+	}
+	if d.InFlight() != 0 {
+		t.Errorf("InFlight = %d after the call ended", d.InFlight())
+	}
+}
+
+func TestDrainerRefusesCallsOnceDraining(t *testing.T) {
+	d := NewDrainer(0)
+	if _, err := d.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if _, _, err := d.Track(context.Background()); err == nil || !strings.Contains(err.Error(), "shutting down") {
+		t.Fatalf("Track after Wait = %v, want a shutting-down error", err)
+	}
+	if d.InFlight() != 0 {
+		t.Errorf("InFlight = %d after a refused call", d.InFlight())
+	}
+}
+
+// TestDrainingServerRefusesToolCalls verifies a tool call arriving during
+// shutdown gets a tool error instead of starting.
+func TestDrainingServerRefusesToolCalls(t *testing.T) {
+	d := NewDrainer(0)
+	if _, err := d.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	client, c, _ := fakeInstance(t, "default")
+	cs := connect(t, NewServer(client, c, WithDrainer(d)))
+	res, err := cs.CallTool(context.Background(), &sdkmcp.CallToolParams{
+		Name: "search_docs", Arguments: map[string]any{"query": "fw01"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !res.IsError || !strings.Contains(resultText(t, res), "shutting down") {
+		t.Errorf("result = %q, want a shutting-down tool error", resultText(t, res))
+	}
+}
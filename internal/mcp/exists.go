@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- entity_exists ----
+
+type EntityExistsInput struct {
+	EntityType string `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
+	ID         string `json:"id" jsonschema:"Numeric ID of the entity to check"`
+}
+
+// entityExistsResult is entity_exists' answer: Name and URL are set only when
+// the entity exists.
+type entityExistsResult struct {
+	EntityType string `json:"entity_type"`
+	ID         string `json:"id"`
+	Exists     bool   `json:"exists"`
+	Name       string `json:"name,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+// EntityExists checks an entity is there with one plain GET, without the
+// sub-resources get_entity_details loads. A 404 answers exists=false.
+func (h *Handler) EntityExists(ctx context.Context, _ *sdkmcp.CallToolRequest, input EntityExistsInput) (*sdkmcp.CallToolResult, any, error) {
+	id := strings.TrimSpace(input.ID)
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateRequired("id", id),
+		validateNumericID("id", id),
+	); res != nil {
+		return res, nil, nil
+	}
+	out := entityExistsResult{EntityType: input.EntityType, ID: id}
+	v, ok, err := h.getByType(ctx, input.EntityType, id)
+	if !ok {
+		return toolError(fmt.Sprintf("unknown entity_type %q", input.EntityType)), nil, nil
+	}
+	if itportal.IsNotFound(err) {
+		return marshalResult(out)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get %s %s: %w", input.EntityType, id, err)
+	}
+	out.Exists = true
+	out.Name = entityLabel(v)
+	if e := reflect.Indirect(reflect.ValueOf(v)); e.Kind() == reflect.Struct {
+		if u := e.FieldByName("URL"); u.IsValid() && u.Kind() == reflect.String {
+			out.URL = u.String()
+		}
+		if out.URL == "" {
+			if n, err := strconv.Atoi(id); err == nil {
+				out.URL = itportal.BuildPortalURL(h.baseURL, normType(input.EntityType), n)
+			}
+		}
+	}
+	return marshalResult(out)
+}
+
+// entityLabel names an entity the way the snapshot index does: its name, else
+// a contact's full name, an account's username or the description.
+func entityLabel(v any) string {
+	switch c := v.(type) {
+	case *itportal.Contact:
+		return c.FullName()
+	case itportal.Contact:
+		return c.FullName()
+	}
+	e := reflect.Indirect(reflect.ValueOf(v))
+	if e.Kind() != reflect.Struct {
+		return ""
+	}
+	field := func(name string) string {
+		if f := e.FieldByName(name); f.IsValid() && f.Kind() == reflect.String {
+			return strings.TrimSpace(f.String())
+		}
+		return ""
+	}
+	return cache.FirstNonEmpty(
+		field("Name"),
+		field("Username"),
+		field("Description"),
+	)
+}
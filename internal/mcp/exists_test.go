@@ -0,0 +1,58 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestEntityExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.1/contacts/7/":
+			writeList(w, []itportal.Contact{{ID: 7, FirstName: "Ada", LastName: "Byte"}}, "")
+		case "/api/2.1/devices/8/":
+			writeList(w, []itportal.Device{{ID: 8, Name: "fw01"}}, "")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	cases := []struct {
+		typ, id string
+		exists  bool
+		name    string
+	}{
+		{"contact", "7", true, "Ada Byte"},
+		{"device", "8", true, "fw01"},
+		{"device", "9", false, ""},
+	}
+	for _, c := range cases {
+		res, _, err := h.EntityExists(ctx, nil, EntityExistsInput{EntityType: c.typ, ID: c.id})
+		if err != nil || res.IsError {
+			t.Fatalf("EntityExists(%s %s) = %v, %v", c.typ, c.id, res, err)
+		}
+		var got entityExistsResult
+		if err := json.Unmarshal([]byte(resultText(t, res)), &got); err != nil {
+			t.Fatalf("result not JSON: %v", err)
+		}
+		if got.Exists != c.exists || got.Name != c.name {
+			t.Errorf("%s %s: exists=%v name=%q, want %v %q", c.typ, c.id, got.Exists, got.Name, c.exists, c.name)
+		}
+		if c.exists && got.URL == "" {
+			t.Errorf("%s %s: no portal url", c.typ, c.id)
+		}
+	}
+
+	res, _, _ := h.EntityExists(ctx, nil, EntityExistsInput{EntityType: "widget", ID: "1"})
+	if !res.IsError {
+		t.Errorf("unknown entity_type accepted: %s", resultText(t, res))
+	}
+}
@@ -0,0 +1,156 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- devices_expiring ----
+
+type DevicesExpiringInput struct {
+	WithinDays     int  `json:"within_days,omitempty" jsonschema:"Report dates from today up to this many days ahead (default 90)"`
+	CompanyID      int  `json:"company_id,omitempty" jsonschema:"Optional: only devices of this company"`
+	IncludeExpired bool `json:"include_expired,omitempty" jsonschema:"Also list dates that have already passed"`
+}
+
+// defaultExpiryWindowDays is the devices_expiring window when within_days is unset.
+const defaultExpiryWindowDays = 90
+
+// expiringDevice is one device date falling inside the report window.
+type expiringDevice struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	DateType string `json:"date_type"`
+	Date     string `json:"date"`
+	DaysLeft int    `json:"days_left"`
+	URL      string `json:"url,omitempty"`
+	due      time.Time
+}
+
+// expiringCompany groups a company's expiring devices, soonest first.
+type expiringCompany struct {
+	CompanyID int              `json:"company_id,omitempty"`
+	Company   string           `json:"company"`
+	Devices   []expiringDevice `json:"devices"`
+}
+
+// DevicesExpiring scans the cached devices for warranty, lease-end and retire
+// dates inside the window and lists them grouped by company, soonest first.
+func (h *Handler) DevicesExpiring(ctx context.Context, _ *sdkmcp.CallToolRequest, input DevicesExpiringInput) (*sdkmcp.CallToolResult, any, error) {
+	if input.WithinDays < 0 {
+		return validationResult(&fieldError{Field: "within_days", Reason: "must not be negative"}), nil, nil
+	}
+	if input.WithinDays == 0 {
+		input.WithinDays = defaultExpiryWindowDays
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+
+	input.CompanyID = h.companyOr(input.CompanyID)
+	devices := snap.Devices
+	if input.CompanyID != 0 {
+		devices = nil
+		for _, d := range snap.Devices {
+			if d.Company != nil && d.Company.ID == input.CompanyID {
+				devices = append(devices, d)
+			}
+		}
+	}
+	now := time.Now()
+	groups := expiringDevices(devices, now, input.WithinDays, input.IncludeExpired)
+	count := 0
+	for _, g := range groups {
+		count += len(g.Devices)
+	}
+	if count == 0 {
+		return toolText(fmt.Sprintf("No device warranty, lease-end or retire dates in the next %d days.", input.WithinDays)), nil, nil
+	}
+
+	out, err := json.MarshalIndent(struct {
+		AsOf       string            `json:"as_of"`
+		WithinDays int               `json:"within_days"`
+		Count      int               `json:"count"`
+		Companies  []expiringCompany `json:"companies"`
+	}{
+		AsOf:       now.Format("2006-01-02"),
+		WithinDays: input.WithinDays,
+		Count:      count,
+		Companies:  groups,
+	}, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal expiring devices: %w", err)
+	}
+	return toolText(string(out)), nil, nil
+}
+
+// expiringDevices collects every warranty, lease-end and retire date of devices
+// that falls within withinDays of now (or before now, with includeExpired),
+// grouped by company. Groups are ordered by their soonest date and devices by
+// date. Blank and unparseable dates are skipped.
+func expiringDevices(devices []itportal.Device, now time.Time, withinDays int, includeExpired bool) []expiringCompany {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	limit := today.AddDate(0, 0, withinDays)
+
+	byCompany := map[int]*expiringCompany{}
+	for _, d := range devices {
+		for _, field := range []struct{ name, value string }{
+			{"warranty_expires", d.WarrantyExpires},
+			{"lease_end", d.LeaseEndDate},
+			{"retire", d.RetireDate},
+		} {
+			due, ok := cache.ParseDate(field.value)
+			if !ok || due.After(limit) || (due.Before(today) && !includeExpired) {
+				continue
+			}
+			key, name := 0, "(no company)"
+			if d.Company != nil && d.Company.ID != 0 {
+				key, name = d.Company.ID, cache.FirstNonEmpty(d.Company.Name, fmt.Sprintf("Company %d", d.Company.ID))
+			}
+			g := byCompany[key]
+			if g == nil {
+				g = &expiringCompany{CompanyID: key, Company: name}
+				byCompany[key] = g
+			}
+			g.Devices = append(g.Devices, expiringDevice{
+				ID:       d.ID,
+				Name:     d.Name,
+				DateType: field.name,
+				Date:     due.Format("2006-01-02"),
+				DaysLeft: int(due.Sub(today).Hours() / 24),
+				URL:      d.URL,
+				due:      due,
+			})
+		}
+	}
+
+	groups := make([]expiringCompany, 0, len(byCompany))
+	for _, g := range byCompany {
+		sort.SliceStable(g.Devices, func(i, j int) bool {
+			if !g.Devices[i].due.Equal(g.Devices[j].due) {
+				return g.Devices[i].due.Before(g.Devices[j].due)
+			}
+			return g.Devices[i].ID < g.Devices[j].ID
+		})
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].Devices[0].due, groups[j].Devices[0].due
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return strings.ToLower(groups[i].Company) < strings.ToLower(groups[j].Company)
+	})
+	return groups
+}
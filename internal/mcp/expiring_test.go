@@ -0,0 +1,43 @@
+package mcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestExpiringDevicesWindow verifies each date type is reported when inside the
+// window, skipped outside it or when blank/unparseable, and ordered soonest
+// first within and across companies.
+func TestExpiringDevicesWindow(t *testing.T) {
+	now := time.Date(2026, 6, 1, 15, 0, 0, 0, time.UTC)
+	acme := &itportal.CompanyReference{ID: 1, Name: "Acme"}
+	beta := &itportal.CompanyReference{ID: 2, Name: "Beta"}
+	devices := []itportal.Device{
+		{ID: 1, Name: "warranty-in", Company: acme, WarrantyExpires: "2026-07-15"},
+		{ID: 2, Name: "warranty-out", Company: acme, WarrantyExpires: "2026-12-01"},
+		{ID: 3, Name: "lease-in", Company: beta, LeaseEndDate: "2026-06-10T00:00:00Z"},
+		{ID: 4, Name: "lease-out", Company: beta, LeaseEndDate: "2027-01-01"},
+		{ID: 5, Name: "retire-in", Company: acme, RetireDate: "06/20/2026"},
+		{ID: 6, Name: "retire-past", Company: acme, RetireDate: "2026-05-01"},
+		{ID: 7, Name: "blank", Company: acme, WarrantyExpires: " ", LeaseEndDate: "n/a"},
+	}
+
+	groups := expiringDevices(devices, now, 60, false)
+	if len(groups) != 2 || groups[0].Company != "Beta" || groups[1].Company != "Acme" {
+		t.Fatalf("groups = %+v, want Beta (soonest) then Acme", groups)
+	}
+	if got := groups[0].Devices; len(got) != 1 || got[0].ID != 3 || got[0].DateType != "lease_end" || got[0].DaysLeft != 9 {
+		t.Errorf("Beta devices = %+v", got)
+	}
+	acmeDevs := groups[1].Devices
+	if len(acmeDevs) != 2 || acmeDevs[0].ID != 5 || acmeDevs[0].DateType != "retire" || acmeDevs[1].ID != 1 || acmeDevs[1].DateType != "warranty_expires" {
+		t.Errorf("Acme devices = %+v, want retire-in then warranty-in", acmeDevs)
+	}
+
+	withPast := expiringDevices(devices, now, 60, true)
+	if d := withPast[0].Devices[0]; d.ID != 6 || d.DaysLeft != -31 {
+		t.Errorf("include_expired: first = %+v, want retire-past at -31 days", d)
+	}
+}
@@ -0,0 +1,332 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- export_company ----
+
+type ExportCompanyInput struct {
+	CompanyID      string `json:"company_id" jsonschema:"Numeric ID of the company to export"`
+	Format         string `json:"format,omitempty" jsonschema:"markdown (default) or json"`
+	IncludeSecrets bool   `json:"include_secrets,omitempty" jsonschema:"Include account passwords/2FA codes and device credentials. Default false. Refused when the server denies secret access."`
+}
+
+// deviceExport is one device with its live sub-resources.
+type deviceExport struct {
+	Device         itportal.Device       `json:"device"`
+	IPAddresses    []itportal.DeviceIP   `json:"ip_addresses"`
+	Notes          []itportal.DeviceNote `json:"notes"`
+	ManagementURLs []itportal.DeviceMUrl `json:"management_urls"`
+	Credentials    []itportal.Credential `json:"credentials,omitempty"`
+}
+
+// accountExport is an account plus whether it has a 2FA code, which survives
+// the secret stripping.
+type accountExport struct {
+	itportal.Account
+	TwoFactorConfigured bool `json:"two_factor_configured"`
+}
+
+// companyExport is the bundle export_company renders.
+type companyExport struct {
+	GeneratedAt    string                   `json:"generated_at"`
+	SecretsOmitted bool                     `json:"secrets_omitted"`
+	Company        itportal.Company         `json:"company"`
+	Sites          []itportal.Site          `json:"sites"`
+	Devices        []deviceExport           `json:"devices"`
+	Contacts       []itportal.Contact       `json:"contacts"`
+	Accounts       []accountExport          `json:"accounts"`
+	Agreements     []itportal.Agreement     `json:"agreements"`
+	Documents      []itportal.Document      `json:"documents"`
+	IPNetworks     []itportal.IPNetwork     `json:"ip_networks"`
+	Facilities     []itportal.Facility      `json:"facilities"`
+	Cabinets       []itportal.Cabinet       `json:"cabinets"`
+	Configurations []itportal.Configuration `json:"configurations"`
+	KBs            []itportal.KB            `json:"kb_articles"`
+}
+
+// exportConcurrency bounds the live device sub-resource fetches.
+const exportConcurrency = 4
+
+// ExportCompany assembles one company's documentation — its records from the
+// snapshot plus each device's live IPs, notes and management URLs — into a
+// single Markdown or JSON document returned base64-encoded. Secrets are
+// stripped unless include_secrets is set and the credential policy allows it.
+func (h *Handler) ExportCompany(ctx context.Context, _ *sdkmcp.CallToolRequest, input ExportCompanyInput) (*sdkmcp.CallToolResult, any, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(input.CompanyID))
+	if err != nil || id <= 0 {
+		return toolError("company_id must be a numeric ID"), nil, nil
+	}
+	if res := validationResult(validateOneOf("format", input.Format, "markdown", "md", "json")); res != nil {
+		return res, nil, nil
+	}
+	format := strings.ToLower(strings.TrimSpace(input.Format))
+	if format == "" {
+		format = "markdown"
+	}
+	if input.IncludeSecrets {
+		if denied := h.checkSecrets(); denied != nil {
+			return denied, nil, nil
+		}
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	snap := h.cache.Get()
+
+	bundle := &companyExport{
+		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		SecretsOmitted: !input.IncludeSecrets,
+	}
+	found := false
+	for _, c := range snap.Companies {
+		if c.ID == id {
+			bundle.Company, found = c, true
+			break
+		}
+	}
+	if !found {
+		return toolError(fmt.Sprintf("company %d not found in the documentation snapshot", id)), nil, nil
+	}
+	bundle.Sites = filterCompany(snap.Sites, id, func(v itportal.Site) *itportal.CompanyReference { return v.Company })
+	bundle.Contacts = filterCompany(snap.Contacts, id, func(v itportal.Contact) *itportal.CompanyReference { return v.Company })
+	bundle.Agreements = filterCompany(snap.Agreements, id, func(v itportal.Agreement) *itportal.CompanyReference { return v.Company })
+	bundle.Documents = filterCompany(snap.Documents, id, func(v itportal.Document) *itportal.CompanyReference { return v.Company })
+	bundle.IPNetworks = filterCompany(snap.IPNetworks, id, func(v itportal.IPNetwork) *itportal.CompanyReference { return v.Company })
+	bundle.Facilities = filterCompany(snap.Facilities, id, func(v itportal.Facility) *itportal.CompanyReference { return v.Company })
+	bundle.Cabinets = filterCompany(snap.Cabinets, id, func(v itportal.Cabinet) *itportal.CompanyReference { return v.Company })
+	bundle.Configurations = filterCompany(snap.Configurations, id, func(v itportal.Configuration) *itportal.CompanyReference { return v.Company })
+	bundle.KBs = filterCompany(snap.KBs, id, func(v itportal.KB) *itportal.CompanyReference { return v.Company })
+	for _, a := range filterCompany(snap.Accounts, id, func(v itportal.Account) *itportal.CompanyReference { return v.Company }) {
+		ae := accountExport{Account: a, TwoFactorConfigured: strings.TrimSpace(a.TwoFACode) != ""}
+		if !input.IncludeSecrets {
+			ae.Password, ae.TwoFACode = "", ""
+		}
+		bundle.Accounts = append(bundle.Accounts, ae)
+	}
+
+	devices := filterCompany(snap.Devices, id, func(v itportal.Device) *itportal.CompanyReference { return v.Company })
+	bundle.Devices = make([]deviceExport, len(devices))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(exportConcurrency)
+	for i, d := range devices {
+		eg.Go(func() error {
+			de := deviceExport{Device: d}
+			devID := strconv.Itoa(d.ID)
+			var err error
+			if de.IPAddresses, err = h.client.GetDeviceIPs(egCtx, devID); err != nil {
+				return fmt.Errorf("get device %d IPs: %w", d.ID, err)
+			}
+			de.IPAddresses = dedupeDeviceIPs(de.IPAddresses)
+			if de.Notes, err = h.client.GetDeviceNotes(egCtx, devID); err != nil {
+				return fmt.Errorf("get device %d notes: %w", d.ID, err)
+			}
+			if de.ManagementURLs, err = h.client.GetDeviceManagementURLs(egCtx, devID); err != nil {
+				return fmt.Errorf("get device %d management URLs: %w", d.ID, err)
+			}
+			de.ManagementURLs = dedupeManagementURLs(de.ManagementURLs)
+			if input.IncludeSecrets {
+				if de.Credentials, err = h.client.GetDeviceCredentials(egCtx, devID); err != nil {
+					return fmt.Errorf("get device %d credentials: %w", d.ID, err)
+				}
+			}
+			bundle.Devices[i] = de
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, nil, fmt.Errorf("export company %d: %w", id, err)
+	}
+
+	var (
+		data []byte
+		ext  string
+	)
+	if format == "json" {
+		if data, err = json.MarshalIndent(bundle, "", "  "); err != nil {
+			return nil, nil, fmt.Errorf("marshal export: %w", err)
+		}
+		ext = "json"
+	} else {
+		data, ext = []byte(renderCompanyExport(bundle)), "md"
+	}
+	fileName := fmt.Sprintf("company-%d-export.%s", id, ext)
+	return toolText(fmt.Sprintf("Export of %s (%d devices, %d bytes, secrets %s). Save the base64 below as %s:\n%s",
+		bundle.Company.Name, len(bundle.Devices), len(data), secretsWord(input.IncludeSecrets), fileName,
+		base64.StdEncoding.EncodeToString(data))), nil, nil
+}
+
+// filterCompany returns the items whose company reference points at id.
+func filterCompany[T any](items []T, id int, company func(T) *itportal.CompanyReference) []T {
+	var out []T
+	for _, v := range items {
+		if ref := company(v); ref != nil && ref.ID == id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func secretsWord(included bool) string {
+	if included {
+		return "included"
+	}
+	return "omitted"
+}
+
+// renderCompanyExport renders the bundle as a Markdown document, one section
+// per entity type.
+func renderCompanyExport(e *companyExport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s — documentation export\n\n", e.Company.Name)
+	fmt.Fprintf(&b, "- **Company ID**: %d\n- **Generated**: %s\n", e.Company.ID, e.GeneratedAt)
+	if e.Company.URL != "" {
+		fmt.Fprintf(&b, "- **Portal Link**: %s\n", e.Company.URL)
+	}
+	if e.SecretsOmitted {
+		b.WriteString("- **Secrets**: omitted\n")
+	}
+	b.WriteString("\n")
+
+	section := func(title string, n int) {
+		fmt.Fprintf(&b, "## %s (%d)\n\n", title, n)
+	}
+	line := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "- **%s**: %s\n", label, value)
+		}
+	}
+
+	section("Sites", len(e.Sites))
+	for _, s := range e.Sites {
+		fmt.Fprintf(&b, "### %s (ID: %d)\n", s.Name, s.ID)
+		line("Description", s.Description)
+		if s.Address != nil {
+			line("Address", strings.Join(nonEmpty(s.Address.Address1, s.Address.City, s.Address.Zip, s.Address.Country), ", "))
+		}
+		line("Portal Link", s.URL)
+		b.WriteString("\n")
+	}
+
+	section("Devices", len(e.Devices))
+	for _, d := range e.Devices {
+		fmt.Fprintf(&b, "### %s (ID: %d)\n", d.Device.Name, d.Device.ID)
+		if d.Device.Type != nil {
+			line("Type", d.Device.Type.Name)
+		}
+		if d.Device.Site != nil {
+			line("Site", d.Device.Site.Name)
+		}
+		line("Hostname", d.Device.HostName)
+		line("Manufacturer / Model", strings.Join(nonEmpty(d.Device.Manufacturer, d.Device.Model), " "))
+		line("Serial", d.Device.Serial)
+		line("Description", d.Device.Description)
+		for _, ip := range d.IPAddresses {
+			line("IP", strings.Join(nonEmpty(ip.IP, ip.Description), " — "))
+		}
+		for _, u := range d.ManagementURLs {
+			line("Management URL", strings.Join(nonEmpty(u.Title, u.URL), " — "))
+		}
+		for _, n := range d.Notes {
+			line("Note", strings.Join(nonEmpty(n.DateTime, n.Notes), " — "))
+		}
+		for _, c := range d.Credentials {
+			line("Credential", fmt.Sprintf("%s / %s (2FA: %s)", c.Username, c.Password, cache.TwoFAStatus(strings.TrimSpace(c.TwoFACode) != "")))
+		}
+		line("Portal Link", d.Device.URL)
+		b.WriteString("\n")
+	}
+
+	section("Contacts", len(e.Contacts))
+	for _, c := range e.Contacts {
+		fmt.Fprintf(&b, "### %s (ID: %d)\n", c.FullName(), c.ID)
+		if c.Type != nil {
+			line("Type", c.Type.Name)
+		}
+		line("Email", c.Email)
+		line("Phone", cache.FirstNonEmpty(c.DirectNumber, c.Mobile, c.HomePhone))
+		line("Portal Link", c.URL)
+		b.WriteString("\n")
+	}
+
+	section("Accounts", len(e.Accounts))
+	for _, a := range e.Accounts {
+		fmt.Fprintf(&b, "### %s (ID: %d)\n", a.Name, a.ID)
+		line("Username", a.Username)
+		line("Expires", a.Expires)
+		line("2FA", cache.TwoFAStatus(a.TwoFactorConfigured))
+		line("Password", a.Password)
+		line("2FA Code", a.TwoFACode)
+		line("URL", a.AccountURL)
+		line("Portal Link", a.URL)
+		b.WriteString("\n")
+	}
+
+	simple := func(title string, n int, item func(i int) (name string, id int, desc, url string)) {
+		section(title, n)
+		for i := 0; i < n; i++ {
+			name, id, desc, url := item(i)
+			fmt.Fprintf(&b, "### %s (ID: %d)\n", name, id)
+			line("Description", desc)
+			line("Portal Link", url)
+			b.WriteString("\n")
+		}
+	}
+	simple("Agreements", len(e.Agreements), func(i int) (string, int, string, string) {
+		v := e.Agreements[i]
+		name := "Agreement"
+		if v.Type != nil {
+			name = v.Type.Name
+		}
+		return name, v.ID, v.Description, v.URL
+	})
+	simple("Documents", len(e.Documents), func(i int) (string, int, string, string) {
+		v := e.Documents[i]
+		return v.Name, v.ID, v.Description, v.URL
+	})
+	simple("IP Networks", len(e.IPNetworks), func(i int) (string, int, string, string) {
+		v := e.IPNetworks[i]
+		return v.Name, v.ID, v.Description, v.URL
+	})
+	simple("Facilities", len(e.Facilities), func(i int) (string, int, string, string) {
+		v := e.Facilities[i]
+		return v.Name, v.ID, v.Description, v.URL
+	})
+	simple("Cabinets", len(e.Cabinets), func(i int) (string, int, string, string) {
+		v := e.Cabinets[i]
+		return v.Name, v.ID, v.Description, v.URL
+	})
+	simple("Configurations", len(e.Configurations), func(i int) (string, int, string, string) {
+		v := e.Configurations[i]
+		return v.Name, v.ID, v.Notes, v.URL
+	})
+	simple("KB Articles", len(e.KBs), func(i int) (string, int, string, string) {
+		v := e.KBs[i]
+		return v.Name, v.ID, v.Description, v.URL
+	})
+	return b.String()
+}
+
+// nonEmpty returns the non-blank values, in order.
+func nonEmpty(vals ...string) []string {
+	var out []string
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
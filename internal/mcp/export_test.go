@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// exportHandler serves a two-company tenant: Acme (1) owns site 2, device 5 and
+// an account with a password; Other (9) owns device 6.
+func exportHandler(t *testing.T) *Handler {
+	t.Helper()
+	acme := &itportal.CompanyReference{ID: 1, Name: "Acme"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/api/2.1") {
+		case "/companies/":
+			writeList(w, []itportal.Company{{ID: 1, Name: "Acme"}, {ID: 9, Name: "Other"}}, "")
+		case "/sites/":
+			writeList(w, []itportal.Site{{ID: 2, Name: "HQ", Company: acme}}, "")
+		case "/devices/":
+			writeList(w, []itportal.Device{
+				{ID: 5, Name: "fw01", Company: acme},
+				{ID: 6, Name: "other-sw", Company: &itportal.CompanyReference{ID: 9}},
+			}, "")
+		case "/accounts/":
+			writeList(w, []itportal.Account{{ID: 3, Name: "O365 admin", Username: "admin", Password: "S3CRET-PW", TwoFACode: "918273", Company: acme}}, "")
+		case "/devices/5/ips/":
+			writeList(w, []itportal.DeviceIP{{ID: 1, IP: "10.0.0.1"}}, "")
+		case "/devices/5/credentials/":
+			writeList(w, []itportal.Credential{{ID: 1, Username: "root", Password: "DEVICE-PW"}}, "")
+		case "/devices/6/ips/":
+			t.Error("export fetched another company's device")
+			writeList(w, []any{}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := itportal.NewClient(srv.URL, "secret")
+	c, err := cache.New(context.Background(), client, 100, 100, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cache.WithStorePath(filepath.Join(t.TempDir(), "export.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	return &Handler{client: client, cache: c, baseURL: srv.URL}
+}
+
+// decodeExport extracts and decodes the base64 bundle from an export result.
+func decodeExport(t *testing.T, text string) string {
+	t.Helper()
+	_, b64, ok := strings.Cut(text, ":\n")
+	if !ok {
+		t.Fatalf("no base64 payload in %q", text)
+	}
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	return string(data)
+}
+
+func TestExportCompanyMarkdownOmitsSecrets(t *testing.T) {
+	h := exportHandler(t)
+	res, _, err := h.ExportCompany(context.Background(), nil, ExportCompanyInput{CompanyID: "1"})
+	if err != nil || res.IsError {
+		t.Fatalf("ExportCompany: err=%v res=%v", err, res)
+	}
+	md := decodeExport(t, resultText(t, res))
+	for _, want := range []string{
+		"# Acme — documentation export",
+		"## Sites (1)", "### HQ (ID: 2)",
+		"## Devices (1)", "### fw01 (ID: 5)", "- **IP**: 10.0.0.1",
+		"## Accounts (1)", "- **Username**: admin", "- **2FA**: configured",
+		"- **Secrets**: omitted",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("bundle missing %q", want)
+		}
+	}
+	if strings.Contains(md, "other-sw") {
+		t.Error("bundle leaked another company's device")
+	}
+	if strings.Contains(md, "S3CRET-PW") || strings.Contains(md, "DEVICE-PW") || strings.Contains(md, "918273") {
+		t.Error("bundle contains secrets although include_secrets was false")
+	}
+}
+
+func TestExportCompanyJSONWithSecrets(t *testing.T) {
+	h := exportHandler(t)
+	res, _, err := h.ExportCompany(context.Background(), nil, ExportCompanyInput{CompanyID: "1", Format: "json", IncludeSecrets: true})
+	if err != nil || res.IsError {
+		t.Fatalf("ExportCompany: err=%v res=%v", err, res)
+	}
+	var bundle companyExport
+	if err := json.Unmarshal([]byte(decodeExport(t, resultText(t, res))), &bundle); err != nil {
+		t.Fatalf("bundle is not JSON: %v", err)
+	}
+	if len(bundle.Accounts) != 1 || bundle.Accounts[0].Password != "S3CRET-PW" {
+		t.Errorf("account password not exported: %+v", bundle.Accounts)
+	}
+	if len(bundle.Devices) != 1 || len(bundle.Devices[0].Credentials) != 1 {
+		t.Errorf("device credentials not exported: %+v", bundle.Devices)
+	}
+
+	h.denySecrets = true
+	res, _, _ = h.ExportCompany(context.Background(), nil, ExportCompanyInput{CompanyID: "1", IncludeSecrets: true})
+	if !res.IsError || !strings.Contains(resultText(t, res), "credential policy") {
+		t.Errorf("include_secrets not refused under MCP_DENY_SECRETS: %s", resultText(t, res))
+	}
+}
@@ -0,0 +1,303 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// outputFormats are the values accepted by the read tools' format argument.
+var outputFormats = []string{"json", "markdown", "md", "yaml", "yml"}
+
+// formatResult renders v as JSON (the default), YAML or Markdown. YAML is
+// derived from the JSON encoding so field names and order match; Markdown uses
+// the snapshot's rendering of each entity.
+func formatResult(format string, v any) (*sdkmcp.CallToolResult, any, error) {
+	switch normType(format) {
+	case "", "json":
+		return marshalResult(v)
+	case "yaml", "yml":
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal result: %w", err)
+		}
+		out, err := jsonToYAML(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encode yaml: %w", err)
+		}
+		return toolText(out), nil, nil
+	case "markdown", "md":
+		return toolText(markdownFor(v)), nil, nil
+	default:
+		return validationResult(validateFormat(format)), nil, nil
+	}
+}
+
+// validateFormat checks a read tool's format argument.
+func validateFormat(format string) *fieldError {
+	return validateOneOf("format", format, outputFormats...)
+}
+
+// listResult is the list_entities payload.
+type listResult struct {
+	Total    int         `json:"total"`
+	Offset   int         `json:"offset"`
+	Limit    int         `json:"limit"`
+	Items    interface{} `json:"items"`
+	Excluded int         `json:"excluded,omitempty"` // items dropped by exclude_ids
+	Note     string      `json:"note,omitempty"`
+}
+
+// deviceDetail is the get_entity_details payload for a device.
+type deviceDetail struct {
+	Device         *itportal.Device      `json:"device"`
+	IPAddresses    []itportal.DeviceIP   `json:"ip_addresses"`
+	Notes          []itportal.DeviceNote `json:"notes"`
+	NotesOmitted   int                   `json:"notes_omitted,omitempty"`
+	ManagementURLs []itportal.DeviceMUrl `json:"management_urls"`
+}
+
+// markdownFor renders a read-tool payload as Markdown. Entities the snapshot
+// renders reuse that form; anything else falls back to a YAML code block.
+func markdownFor(v any) string {
+	switch p := v.(type) {
+	case listResult:
+		var b strings.Builder
+		rv := reflect.ValueOf(p.Items)
+		n := 0
+		if rv.Kind() == reflect.Slice {
+			n = rv.Len()
+		}
+		fmt.Fprintf(&b, "_%d of %d (offset %d)", n, p.Total, p.Offset)
+		if p.Excluded > 0 {
+			fmt.Fprintf(&b, "; %d excluded", p.Excluded)
+		}
+		b.WriteString("_\n")
+		if p.Note != "" {
+			b.WriteString("\n" + p.Note + "\n")
+		}
+		for i := 0; i < n; i++ {
+			b.WriteString("\n")
+			b.WriteString(markdownFor(rv.Index(i).Interface()))
+		}
+		return b.String()
+	case deviceDetail:
+		var b strings.Builder
+		b.WriteString(markdownFor(p.Device))
+		if len(p.IPAddresses) > 0 {
+			b.WriteString("\n#### IP addresses\n")
+			for _, ip := range p.IPAddresses {
+				line := ip.IP
+				if ip.MAC != "" {
+					line += " (MAC " + ip.MAC + ")"
+				}
+				if ip.Description != "" {
+					line += " — " + ip.Description
+				}
+				fmt.Fprintf(&b, "- %s\n", line)
+			}
+		}
+		if len(p.ManagementURLs) > 0 {
+			b.WriteString("\n#### Management URLs\n")
+			for _, u := range p.ManagementURLs {
+				fmt.Fprintf(&b, "- %s: %s\n", cache.FirstNonEmpty(u.Title, "URL"), u.URL)
+			}
+		}
+		if len(p.Notes) > 0 {
+			b.WriteString("\n#### Notes\n")
+			for _, n := range p.Notes {
+				text := strings.Join(strings.Fields(n.Notes), " ")
+				if n.DateTime != "" {
+					text = n.DateTime + ": " + text
+				}
+				fmt.Fprintf(&b, "- %s\n", text)
+			}
+		}
+		if p.NotesOmitted > 0 {
+			fmt.Fprintf(&b, "\n_%d older or out-of-range notes omitted._\n", p.NotesOmitted)
+		}
+		return b.String()
+	}
+	if md, ok := cache.EntityMarkdown(v); ok {
+		return md
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		if y, err := jsonToYAML(data); err == nil {
+			return "```yaml\n" + y + "```\n"
+		}
+	}
+	return fmt.Sprintf("%+v\n", v)
+}
+
+// ---- Minimal YAML encoder ----
+//
+// The server has no YAML dependency; read-tool output is plain JSON data, so a
+// block-style encoder over the decoded JSON is enough. Object key order is kept.
+
+// yamlMap is a JSON object with its key order preserved.
+type yamlMap struct {
+	keys []string
+	vals []any
+}
+
+// jsonToYAML re-encodes a JSON document as block-style YAML.
+func jsonToYAML(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	switch v.(type) {
+	case *yamlMap, []any:
+		if isEmptyCollection(v) {
+			b.WriteString(yamlScalar(v) + "\n")
+		} else {
+			writeYAML(&b, v, 0)
+		}
+	default:
+		b.WriteString(yamlScalar(v) + "\n")
+	}
+	return b.String(), nil
+}
+
+// decodeOrdered decodes the next JSON value, keeping object key order.
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := &yamlMap{}
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				m.keys = append(m.keys, kt.(string))
+				m.vals = append(m.vals, v)
+			}
+			_, err := dec.Token()
+			return m, err
+		case '[':
+			list := []any{}
+			for dec.More() {
+				v, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			_, err := dec.Token()
+			return list, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+	default:
+		return t, nil
+	}
+}
+
+func isEmptyCollection(v any) bool {
+	switch c := v.(type) {
+	case *yamlMap:
+		return len(c.keys) == 0
+	case []any:
+		return len(c) == 0
+	}
+	return false
+}
+
+// writeYAML writes a non-empty map or list at the given indent.
+func writeYAML(b *strings.Builder, v any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch c := v.(type) {
+	case *yamlMap:
+		for i, k := range c.keys {
+			b.WriteString(pad + yamlString(k) + ":")
+			writeYAMLValue(b, c.vals[i], indent+2)
+		}
+	case []any:
+		for _, item := range c {
+			switch item.(type) {
+			case *yamlMap, []any:
+				if !isEmptyCollection(item) {
+					// Render the nested block one level in, then hang its first
+					// line off the "- " marker.
+					var nested strings.Builder
+					writeYAML(&nested, item, indent+2)
+					b.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+					continue
+				}
+			}
+			b.WriteString(pad + "- " + yamlScalar(item) + "\n")
+		}
+	}
+}
+
+// writeYAMLValue writes the value part of a "key:" line.
+func writeYAMLValue(b *strings.Builder, v any, indent int) {
+	switch v.(type) {
+	case *yamlMap, []any:
+		if !isEmptyCollection(v) {
+			b.WriteString("\n")
+			writeYAML(b, v, indent)
+			return
+		}
+	}
+	b.WriteString(" " + yamlScalar(v) + "\n")
+}
+
+// yamlScalar renders a scalar (or empty collection) as a YAML flow value.
+func yamlScalar(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case string:
+		return yamlString(t)
+	case *yamlMap:
+		return "{}"
+	case []any:
+		return "[]"
+	}
+	return yamlString(fmt.Sprint(v))
+}
+
+// yamlPlainSafe matches strings that YAML reads back unchanged without quotes.
+var yamlPlainSafe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_ ./()-]*$`)
+
+// yamlReserved are plain scalars YAML would read as booleans or null.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true,
+}
+
+// yamlString writes s plain when that is unambiguous, else double-quoted. Go's
+// quoting escapes (\n, \t, \xNN, \uNNNN, …) are all valid YAML escapes.
+func yamlString(s string) string {
+	if yamlPlainSafe.MatchString(s) && !strings.HasSuffix(s, " ") && !yamlReserved[strings.ToLower(s)] {
+		return s
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,100 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestGetEntityDetailsFormats verifies the same company renders as valid JSON,
+// as the snapshot's Markdown entry, and as block YAML with quoting where a
+// plain scalar would be misread.
+func TestGetEntityDetailsFormats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []itportal.Company{{
+			ID: 7, Name: "Acme: HQ", Abbreviation: "ACME", Status: "yes",
+			Address: &itportal.Address{City: "Berlin"},
+			URL:     "https://portal.example/v4/app/companies/7",
+		}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	get := func(format string) string {
+		t.Helper()
+		res, _, err := h.GetEntityDetails(context.Background(), nil, GetEntityInput{EntityType: "company", ID: "7", Format: format})
+		if err != nil || res.IsError {
+			t.Fatalf("format %q: err=%v res=%v", format, err, res)
+		}
+		return resultText(t, res)
+	}
+
+	var c itportal.Company
+	if err := json.Unmarshal([]byte(get("")), &c); err != nil || c.Name != "Acme: HQ" {
+		t.Errorf("json: %v %+v", err, c)
+	}
+
+	md := get("markdown")
+	if !strings.HasPrefix(md, "### [Acme: HQ](https://portal.example/v4/app/companies/7) (ID: 7)\n") || !strings.Contains(md, "- **Code**: ACME\n") {
+		t.Errorf("markdown:\n%s", md)
+	}
+
+	want := `id: 7
+name: "Acme: HQ"
+address:
+  city: Berlin
+abbreviation: ACME
+status: "yes"
+url: "https://portal.example/v4/app/companies/7"
+`
+	if got := get("yaml"); got != want {
+		t.Errorf("yaml:\n%s\nwant:\n%s", got, want)
+	}
+
+	res, _, _ := h.GetEntityDetails(context.Background(), nil, GetEntityInput{EntityType: "company", ID: "7", Format: "xml"})
+	if !res.IsError || !strings.Contains(resultText(t, res), "field format") {
+		t.Errorf("unknown format not rejected: %v", res)
+	}
+}
+
+func TestJSONToYAMLNesting(t *testing.T) {
+	got, err := jsonToYAML([]byte(`{"total":2,"items":[{"id":1,"tags":["a","b"]},{"id":2,"tags":[]}],"next":null,"empty":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `total: 2
+items:
+  - id: 1
+    tags:
+      - a
+      - b
+  - id: 2
+    tags: []
+next: null
+empty: {}
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestListEntitiesMarkdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []itportal.Device{{ID: 1, Name: "fw01", Serial: "S1"}, {ID: 2, Name: "sw01"}}, "")
+	}))
+	defer srv.Close()
+	res, _, err := newHandler(srv.URL).ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", Format: "markdown"})
+	if err != nil || res.IsError {
+		t.Fatalf("ListEntities: err=%v res=%v", err, res)
+	}
+	text := resultText(t, res)
+	for _, want := range []string{"### fw01 (ID: 1)", "- **Serial**: S1", "### sw01 (ID: 2)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+}
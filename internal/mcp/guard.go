@@ -0,0 +1,271 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Limits guardedMarshal holds a tool result to. Today's models are flat; the
+// guard keeps a nested tree or a reference cycle from producing runaway output.
+const (
+	marshalMaxDepth  = 32
+	marshalMaxValues = 50000
+)
+
+// Markers replacing what guardedMarshal leaves out.
+const (
+	marshalDepthMarker = "… (nested too deep)"
+	marshalCycleMarker = "… (cycle)"
+	marshalMoreMarker  = "… (%d more)"
+)
+
+var jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+
+// guardedMarshal marshals v as indented JSON like json.MarshalIndent. When v
+// nests deeper than marshalMaxDepth, holds more than marshalMaxValues values
+// or refers back to itself, it instead marshals a pruned copy wrapped as
+// {"truncated": <why>, "result": <pruned>}.
+func guardedMarshal(v any) ([]byte, error) {
+	check := newMarshalGuard(false)
+	check.walk(reflect.ValueOf(v), 0)
+	if !check.tripped() {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	prune := newMarshalGuard(true)
+	pruned := prune.walk(reflect.ValueOf(v), 0)
+	return json.MarshalIndent(struct {
+		Truncated string `json:"truncated"`
+		Result    any    `json:"result"`
+	}{check.reason(), pruned}, "", "  ")
+}
+
+// marshalGuard walks a value the way encoding/json would, counting values and
+// depth and, when build is set, returning a JSON-ready copy within the limits.
+type marshalGuard struct {
+	build    bool
+	values   int
+	tooDeep  bool
+	tooLarge bool
+	cycle    bool
+	onPath   map[uintptr]bool // pointers being walked, to spot cycles
+}
+
+func newMarshalGuard(build bool) *marshalGuard {
+	return &marshalGuard{build: build, onPath: map[uintptr]bool{}}
+}
+
+func (g *marshalGuard) tripped() bool {
+	return g.tooDeep || g.tooLarge || g.cycle
+}
+
+// full reports, and records, that the value budget is spent.
+func (g *marshalGuard) full() bool {
+	if g.values >= marshalMaxValues {
+		g.tooLarge = true
+	}
+	return g.tooLarge
+}
+
+// reason says what the guard cut, for the "truncated" note.
+func (g *marshalGuard) reason() string {
+	var why []string
+	if g.tooLarge {
+		why = append(why, fmt.Sprintf("the result holds more than %d values; only the first are shown", marshalMaxValues))
+	}
+	if g.tooDeep {
+		why = append(why, fmt.Sprintf("it nests deeper than %d levels; deeper values are replaced with %q", marshalMaxDepth, marshalDepthMarker))
+	}
+	if g.cycle {
+		why = append(why, fmt.Sprintf("it refers back to itself; repeats are replaced with %q", marshalCycleMarker))
+	}
+	return strings.Join(why, "; ") + ". Narrow the request (filters, limit, a single ID) for complete output."
+}
+
+// walk visits v at depth. It returns v's pruned copy when building, else nil.
+func (g *marshalGuard) walk(v reflect.Value, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Pointer {
+			p := v.Pointer()
+			if g.onPath[p] {
+				g.cycle = true
+				return marshalCycleMarker
+			}
+			g.onPath[p] = true
+			defer delete(g.onPath, p)
+		}
+		if v.Type().Implements(jsonMarshalerType) {
+			return g.leaf(v)
+		}
+		return g.walk(v.Elem(), depth)
+	}
+	if g.full() {
+		return nil
+	}
+	g.values++
+	if depth > marshalMaxDepth {
+		g.tooDeep = true
+		return marshalDepthMarker
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		return g.leaf(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		var obj orderedObject
+		g.walkFields(v, depth, &obj)
+		return g.result(obj)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = fmt.Sprint(k.Interface())
+		}
+		idx := make([]int, len(keys))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.Slice(idx, func(a, b int) bool { return names[idx[a]] < names[idx[b]] })
+		var obj orderedObject
+		for _, i := range idx {
+			if g.full() {
+				break
+			}
+			obj = append(obj, orderedField{names[i], g.walk(v.MapIndex(keys[i]), depth+1)})
+		}
+		return g.result(obj)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return g.leaf(v)
+		}
+		list := []any{}
+		for i := 0; i < v.Len(); i++ {
+			if g.full() {
+				list = append(list, fmt.Sprintf(marshalMoreMarker, v.Len()-i))
+				break
+			}
+			list = append(list, g.walk(v.Index(i), depth+1))
+		}
+		return g.result(list)
+	}
+	return g.leaf(v)
+}
+
+// walkFields adds struct v's JSON fields to obj, following encoding/json's
+// tag names, "-", omitempty and embedded-struct flattening.
+func (g *marshalGuard) walkFields(v reflect.Value, depth int, obj *orderedObject) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				ft, fv = ft.Elem(), fv.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.walkFields(fv, depth, obj)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && emptyJSONValue(fv) {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if g.full() {
+			return
+		}
+		*obj = append(*obj, orderedField{name, g.walk(fv, depth+1)})
+	}
+}
+
+// leaf returns v for encoding/json to marshal itself.
+func (g *marshalGuard) leaf(v reflect.Value) any {
+	if !g.build || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// result returns x when building, else nil.
+func (g *marshalGuard) result(x any) any {
+	if !g.build {
+		return nil
+	}
+	return x
+}
+
+// emptyJSONValue reports whether omitempty drops v.
+func emptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// orderedObject is a JSON object that keeps its fields in order.
+type orderedObject []orderedField
+
+type orderedField struct {
+	name  string
+	value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type guardNode struct {
+	Name  string     `json:"name"`
+	Child *guardNode `json:"child,omitempty"`
+	Skip  string     `json:"-"`
+}
+
+type guardPage struct {
+	Items []guardNode `json:"items"`
+}
+
+func TestGuardedMarshalPassesOrdinaryValues(t *testing.T) {
+	v := guardPage{Items: []guardNode{{Name: "a", Child: &guardNode{Name: "b"}}}}
+	got, err := guardedMarshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.MarshalIndent(v, "", "  ")
+	if string(got) != string(want) {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestGuardedMarshalTruncatesDeepNesting(t *testing.T) {
+	root := &guardNode{Name: "n0"}
+	n := root
+	for i := 1; i < 100; i++ {
+		n.Child = &guardNode{Name: "n", Skip: "hidden"}
+		n = n.Child
+	}
+	got, err := guardedMarshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Truncated string          `json:"truncated"`
+		Result    json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(got, &out); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, got)
+	}
+	if !strings.Contains(out.Truncated, "nests deeper than 32 levels") {
+		t.Errorf("truncated = %q", out.Truncated)
+	}
+	if !strings.Contains(string(out.Result), marshalDepthMarker) {
+		t.Errorf("result lacks the depth marker:\n%s", out.Result)
+	}
+	if strings.Contains(string(out.Result), "hidden") {
+		t.Error(`json:"-" field was marshaled`)
+	}
+	if r := string(out.Result); strings.Index(r, `"name"`) > strings.Index(r, `"child"`) {
+		t.Errorf("field order lost: %.60s", r)
+	}
+}
+
+func TestGuardedMarshalBreaksCycles(t *testing.T) {
+	a := &guardNode{Name: "a"}
+	a.Child = &guardNode{Name: "b", Child: a}
+	got, err := guardedMarshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(got)
+	if !strings.Contains(s, "refers back to itself") || !strings.Contains(s, marshalCycleMarker) {
+		t.Errorf("cycle not reported:\n%s", s)
+	}
+}
+
+func TestGuardedMarshalCapsLargeResults(t *testing.T) {
+	v := guardPage{Items: make([]guardNode, marshalMaxValues)}
+	got, err := guardedMarshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Truncated string `json:"truncated"`
+		Result    struct {
+			Items []any `json:"items"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(got, &out); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if !strings.Contains(out.Truncated, "more than 50000 values") {
+		t.Errorf("truncated = %q", out.Truncated)
+	}
+	items := out.Result.Items
+	if len(items) == 0 || len(items) >= marshalMaxValues {
+		t.Fatalf("kept %d items", len(items))
+	}
+	if last, _ := items[len(items)-1].(string); !strings.HasSuffix(last, "more)") {
+		t.Errorf("last item = %v, want a \"… (N more)\" marker", items[len(items)-1])
+	}
+}
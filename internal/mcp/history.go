@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- get_entity_history ----
+
+type GetEntityHistoryInput struct {
+	EntityType string `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
+	ID         string `json:"id" jsonschema:"Numeric ID of the entity"`
+}
+
+// GetEntityHistory renders an entity's change log as a timeline, oldest change
+// first. ITPortal releases without a history endpoint get a clear unsupported
+// message rather than an API error.
+func (h *Handler) GetEntityHistory(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetEntityHistoryInput) (*sdkmcp.CallToolResult, any, error) {
+	id := strings.TrimSpace(input.ID)
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateRequired("id", id),
+		validateNumericID("id", id),
+	); res != nil {
+		return res, nil, nil
+	}
+	objPath, ok := objectPathFor(input.EntityType)
+	if !ok {
+		return toolError(fmt.Sprintf("unknown entity_type %q", input.EntityType)), nil, nil
+	}
+
+	entries, err := h.client.ListEntityHistory(ctx, objPath, id)
+	if historyUnsupported(err) {
+		// A 404 may also mean the entity itself is missing; say which.
+		if _, known, gerr := h.getByType(ctx, input.EntityType, id); known && itportal.IsNotFound(gerr) {
+			return toolError(fmt.Sprintf("%s %s not found", input.EntityType, id)), nil, nil
+		}
+		return toolError(fmt.Sprintf("entity history is not supported by this ITPortal: it has no history endpoint for %s. "+
+			"get_logs covers access and password audit logs, and get_entity_details shows the last modified time.", objPath)), nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get %s %s history: %w", input.EntityType, id, err)
+	}
+	return toolText(renderHistory(input.EntityType, id, entries)), nil, nil
+}
+
+// historyUnsupported reports whether err is the answer of an ITPortal with no
+// history endpoint: 404, 405 or 501.
+func historyUnsupported(err error) bool {
+	if itportal.IsNotFound(err) {
+		return true
+	}
+	var apiErr *itportal.APIError
+	return errors.As(err, &apiErr) && (apiErr.Status == http.StatusMethodNotAllowed || apiErr.Status == http.StatusNotImplemented)
+}
+
+// renderHistory renders entries as a Markdown timeline, oldest first. Entries
+// whose date does not parse keep their order after the dated ones.
+func renderHistory(entityType, id string, entries []itportal.HistoryEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## History of %s %s\n\n", entityType, id)
+	if len(entries) == 0 {
+		b.WriteString("No recorded changes.\n")
+		return b.String()
+	}
+	when := make([]time.Time, len(entries))
+	for i, e := range entries {
+		when[i], _ = cache.ParseTimestamp(e.Date)
+	}
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ta, tb := when[idx[a]], when[idx[b]]
+		if ta.IsZero() || tb.IsZero() {
+			return !ta.IsZero() && tb.IsZero()
+		}
+		return ta.Before(tb)
+	})
+
+	noun := "changes"
+	if len(entries) == 1 {
+		noun = "change"
+	}
+	fmt.Fprintf(&b, "%d %s, oldest first.\n\n", len(entries), noun)
+	for _, i := range idx {
+		e := entries[i]
+		parts := []string{cache.FirstNonEmpty(strings.TrimSpace(e.Date), "(undated)")}
+		if who := historyUser(e.User); who != "" {
+			parts = append(parts, who)
+		}
+		parts = append(parts, historyChange(e))
+		b.WriteString("- " + strings.Join(parts, " · ") + "\n")
+	}
+	return b.String()
+}
+
+// historyChange describes what one entry changed: the action, the field and
+// its old → new value, and any notes.
+func historyChange(e itportal.HistoryEntry) string {
+	s := cache.FirstNonEmpty(strings.TrimSpace(e.Action), "changed")
+	if e.Field != "" {
+		s += " " + e.Field
+		if e.OldValue != nil || e.NewValue != nil {
+			s += fmt.Sprintf(": %s → %s", historyValue(e.OldValue), historyValue(e.NewValue))
+		}
+	}
+	if n := strings.TrimSpace(e.Notes); n != "" {
+		s += " — " + n
+	}
+	return s
+}
+
+// historyValue renders a changed value, quoting strings and marking an absent
+// one as (empty).
+func historyValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "(empty)"
+	case string:
+		return fmt.Sprintf("%q", x)
+	}
+	return fmt.Sprint(v)
+}
+
+// historyUser names who made a change: name, else email, else user ID.
+func historyUser(u *itportal.ContactEmailReference) string {
+	if u == nil {
+		return ""
+	}
+	if s := cache.FirstNonEmpty(strings.TrimSpace(u.Name), strings.TrimSpace(u.Email)); s != "" {
+		return s
+	}
+	if u.ID != 0 {
+		return fmt.Sprintf("user %d", u.ID)
+	}
+	return ""
+}
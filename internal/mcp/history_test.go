@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestGetEntityHistoryRendersChronologically(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/2.1/devices/5/history/" {
+			http.NotFound(w, r)
+			return
+		}
+		// Newest first, as an API might return it, with one undated entry.
+		writeList(w, []itportal.HistoryEntry{
+			{ID: 3, Date: "2024-03-01T08:00:00Z", User: &itportal.ContactEmailReference{Email: "ops@example.com"}, Action: "updated", Field: "location", OldValue: "Rack 1", NewValue: "Rack 2"},
+			{ID: 9, Action: "updated", Notes: "bulk import"},
+			{ID: 1, Date: "2024-01-15 09:30:00", User: &itportal.ContactEmailReference{Name: "Jane Doe"}, Action: "created"},
+			{ID: 2, Date: "2024-02-01", User: &itportal.ContactEmailReference{ID: 4}, Action: "updated", Field: "serial", NewValue: "SN-9"},
+		}, "")
+	}))
+	defer srv.Close()
+
+	res, _, err := newHandler(srv.URL).GetEntityHistory(context.Background(), nil, GetEntityHistoryInput{EntityType: "device", ID: "5"})
+	if err != nil || res.IsError {
+		t.Fatalf("GetEntityHistory = %v, %v", res, err)
+	}
+	want := "## History of device 5\n\n4 changes, oldest first.\n\n" +
+		"- 2024-01-15 09:30:00 · Jane Doe · created\n" +
+		"- 2024-02-01 · user 4 · updated serial: (empty) → \"SN-9\"\n" +
+		"- 2024-03-01T08:00:00Z · ops@example.com · updated location: \"Rack 1\" → \"Rack 2\"\n" +
+		"- (undated) · updated — bulk import\n"
+	if got := resultText(t, res); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGetEntityHistoryUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.1/devices/5/":
+			writeList(w, []itportal.Device{{ID: 5, Name: "fw01"}}, "")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	res, _, err := h.GetEntityHistory(context.Background(), nil, GetEntityHistoryInput{EntityType: "device", ID: "5"})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "not supported by this ITPortal") {
+		t.Errorf("existing device = %v, %v; want an unsupported message", res, err)
+	}
+	res, _, err = h.GetEntityHistory(context.Background(), nil, GetEntityHistoryInput{EntityType: "device", ID: "6"})
+	if err != nil || !res.IsError || resultText(t, res) != "device 6 not found" {
+		t.Errorf("missing device = %v, %v; want not found", res, err)
+	}
+}
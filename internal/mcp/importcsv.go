@@ -0,0 +1,329 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ---- import_csv ----
+
+// Row caps for import_csv: the default when max_rows is omitted, and the most
+// one call may create.
+const (
+	importCSVDefaultRows = 100
+	importCSVMaxRows     = 500
+)
+
+// importCSVTypes are the entity types import_csv creates: those create_entity
+// handles.
+var importCSVTypes = []string{
+	"company", "site", "contact", "account", "agreement", "document",
+	"facility", "cabinet", "configuration", "ipnetwork", "address",
+}
+
+type ImportCSVInput struct {
+	EntityType string            `json:"entity_type" jsonschema:"Required. One of: company, site, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address"`
+	CSVBase64  string            `json:"csv_base64" jsonschema:"Required. Base64-encoded CSV file; the first row is the header. Quoted cells may hold commas, quotes and line breaks."`
+	Mapping    map[string]string `json:"mapping" jsonschema:"Required. CSV header -> entity field. Dotted paths set nested fields, e.g. {\"Name\": \"name\", \"Customer ID\": \"company.id\"}. Unmapped columns are ignored."`
+	MaxRows    int               `json:"max_rows,omitempty" jsonschema:"Refuse the file when it has more data rows than this (default 100, max 500)"`
+}
+
+// importRowResult is the outcome of creating one CSV row. Line is the CSV line
+// the row starts on, as a spreadsheet numbers it.
+type importRowResult struct {
+	Line   int    `json:"line"`
+	ID     int    `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importColumn is one mapped CSV column: where it sits, the field path it sets
+// and that field's Go kind, which decides how the cell is parsed.
+type importColumn struct {
+	header string
+	index  int
+	path   []string
+	kind   reflect.Kind
+}
+
+// ImportCSV creates one entity per CSV row through create_entity, mapping
+// columns to fields. A row that fails is reported and the rest carry on.
+func (h *Handler) ImportCSV(ctx context.Context, _ *sdkmcp.CallToolRequest, input ImportCSVInput) (*sdkmcp.CallToolResult, any, error) {
+	var rowsCheck *fieldError
+	if input.MaxRows < 0 || input.MaxRows > importCSVMaxRows {
+		rowsCheck = &fieldError{Field: "max_rows", Reason: fmt.Sprintf("between 1 and %d", importCSVMaxRows)}
+	}
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateOneOf("entity_type", input.EntityType, importCSVTypes...),
+		validateRequired("csv_base64", input.CSVBase64),
+		validateRequired("mapping", input.Mapping),
+		rowsCheck,
+	); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+	maxRows := input.MaxRows
+	if maxRows == 0 {
+		maxRows = importCSVDefaultRows
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(input.CSVBase64))
+	if err != nil {
+		return toolError(fmt.Sprintf("csv_base64 is not valid base64: %v", err)), nil, nil
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return toolError(fmt.Sprintf("csv_base64: cannot read the header row: %v", err)), nil, nil
+	}
+	columns, msg := importColumns(describedModels[normType(input.EntityType)], header, input.Mapping)
+	if msg != "" {
+		return toolError(msg), nil, nil
+	}
+
+	type csvRow struct {
+		line  int
+		cells []string
+		err   error
+	}
+	var rows []csvRow
+	for {
+		cells, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return toolError(fmt.Sprintf("csv_base64: %v. Nothing was imported.", err)), nil, nil
+		}
+		line, _ := r.FieldPos(0)
+		if err != nil {
+			err = fmt.Errorf("has %d columns, the header has %d", len(cells), len(header))
+		}
+		rows = append(rows, csvRow{line: line, cells: cells, err: err})
+	}
+	if len(rows) > maxRows {
+		return toolError(fmt.Sprintf("the CSV has %d data rows, more than max_rows %d. Nothing was imported; split the file or raise max_rows (up to %d).",
+			len(rows), maxRows, importCSVMaxRows)), nil, nil
+	}
+	if len(rows) == 0 {
+		return toolText("The CSV has a header but no data rows. Nothing was imported."), nil, nil
+	}
+
+	results := make([]importRowResult, 0, len(rows))
+	created, failed := 0, 0
+	var warnings []string
+	for _, row := range rows {
+		out := importRowResult{Line: row.line}
+		fields, err := importFields(columns, row.cells)
+		if row.err != nil {
+			err = row.err
+		}
+		if name, ok := fields["name"].(string); ok {
+			out.Name = name
+		}
+		if err == nil {
+			out.ID, err = h.importRow(ctx, input.EntityType, fields)
+		}
+		if err != nil {
+			out.Status, out.Error = "failed", err.Error()
+			failed++
+			warnings = append(warnings, fmt.Sprintf("Could not import line %d%s: %v", row.line, bulkLabel(out.Name), err))
+		} else {
+			out.Status = "created"
+			created++
+		}
+		results = append(results, out)
+	}
+
+	summary := struct {
+		EntityType string            `json:"entity_type"`
+		Rows       int               `json:"rows"`
+		Created    int               `json:"created"`
+		Failed     int               `json:"failed"`
+		Results    []importRowResult `json:"results"`
+	}{input.EntityType, len(rows), created, failed, results}
+	out, err := guardedMarshal(summary)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal result: %w", err)
+	}
+	return outcomeResult(string(out), summary, warnings)
+}
+
+// importRow creates one entity from fields via create_entity and returns its ID.
+func (h *Handler) importRow(ctx context.Context, entityType string, fields map[string]any) (int, error) {
+	res, record, err := h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: entityType, Fields: fields})
+	if err != nil {
+		return 0, err
+	}
+	if res.IsError {
+		msg := "create refused"
+		if len(res.Content) > 0 {
+			if tc, ok := res.Content[0].(*sdkmcp.TextContent); ok {
+				msg = tc.Text
+			}
+		}
+		return 0, errors.New(msg)
+	}
+	if v := reflect.Indirect(reflect.ValueOf(record)); v.Kind() == reflect.Struct {
+		if id := v.FieldByName("ID"); id.IsValid() && id.CanInt() {
+			return int(id.Int()), nil
+		}
+	}
+	return 0, nil
+}
+
+// importColumns resolves mapping against the CSV header and model. It returns
+// the mapped columns in header order, or a message naming every problem.
+func importColumns(model reflect.Type, header []string, mapping map[string]string) ([]importColumn, string) {
+	index := make(map[string]int, len(header))
+	for i, hd := range header {
+		index[strings.TrimSpace(hd)] = i
+	}
+	var columns []importColumn
+	var problems []string
+	for hd, field := range mapping {
+		i, ok := index[strings.TrimSpace(hd)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("mapping: column %q is not in the CSV header", hd))
+			continue
+		}
+		path := strings.Split(strings.TrimSpace(field), ".")
+		kind, reason := fieldKind(model, path)
+		if reason != "" {
+			problems = append(problems, fmt.Sprintf("mapping: %q -> %q: %s", hd, field, reason))
+			continue
+		}
+		columns = append(columns, importColumn{header: hd, index: i, path: path, kind: kind})
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, strings.Join(problems, "\n") + "\nUse describe_entity for the field names. Nothing was imported."
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].index < columns[j].index })
+	return columns, ""
+}
+
+// fieldKind follows a dotted JSON field path through model and returns the
+// kind of the scalar it ends on, or why the path cannot be set from a cell.
+func fieldKind(model reflect.Type, path []string) (reflect.Kind, string) {
+	t := model
+	for i, name := range path {
+		st := t
+		for st.Kind() == reflect.Pointer {
+			st = st.Elem()
+		}
+		if st.Kind() != reflect.Struct {
+			return 0, fmt.Sprintf("%s is not an object", strings.Join(path[:i], "."))
+		}
+		sf, ok := jsonField(st, name)
+		if !ok {
+			return 0, fmt.Sprintf("no field %q", strings.Join(path[:i+1], "."))
+		}
+		t = sf.Type
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64:
+		return t.Kind(), ""
+	}
+	if t.Kind() == reflect.Struct && hasIDField(t) {
+		return 0, fmt.Sprintf("is a reference; map the column to %s.id", strings.Join(path, "."))
+	}
+	return 0, fmt.Sprintf("is %s and cannot be set from a CSV cell", jsonTypeName(t))
+}
+
+// jsonField finds the field of struct t whose JSON name is name.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if sf.IsExported() && tag == name {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// importFields builds one row's create_entity fields. Empty cells are left
+// unset; the rest are parsed to their field's type.
+func importFields(columns []importColumn, cells []string) (map[string]any, error) {
+	fields := map[string]any{}
+	for _, c := range columns {
+		if c.index >= len(cells) {
+			continue
+		}
+		cell := strings.TrimSpace(cells[c.index])
+		if cell == "" {
+			continue
+		}
+		var v any = cell
+		switch c.kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.Atoi(cell)
+			if err != nil {
+				return fields, fmt.Errorf("column %q: %q is not a whole number", c.header, cell)
+			}
+			v = n
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return fields, fmt.Errorf("column %q: %q is not a number", c.header, cell)
+			}
+			v = f
+		case reflect.Bool:
+			b, ok := parseCSVBool(cell)
+			if !ok {
+				return fields, fmt.Errorf("column %q: %q is not true/false or yes/no", c.header, cell)
+			}
+			v = b
+		}
+		setPath(fields, c.path, v)
+	}
+	return fields, nil
+}
+
+// parseCSVBool reads the yes/no spellings spreadsheets use as well as
+// strconv.ParseBool's.
+func parseCSVBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "yes", "y":
+		return true, true
+	case "no", "n":
+		return false, true
+	}
+	b, err := strconv.ParseBool(s)
+	return b, err == nil
+}
+
+// setPath sets m[path[0]][path[1]]... = v, creating the nested maps.
+func setPath(m map[string]any, path []string, v any) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[k] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = v
+}
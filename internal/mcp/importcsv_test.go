@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestImportCSVMapsRowsAndReportsFailures imports four sites: two succeed, one
+// has a non-numeric company ID and one is refused by the API. The failures are
+// reported by line and do not stop the other rows.
+func TestImportCSVMapsRowsAndReportsFailures(t *testing.T) {
+	var posted []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/2.1/sites/"), "/")
+			n, _ := strconv.Atoi(id)
+			writeList(w, []itportal.Site{{ID: n}}, "")
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["name"] == "Rejected" {
+			http.Error(w, `{"code":400,"message":"name already taken"}`, http.StatusBadRequest)
+			return
+		}
+		posted = append(posted, body)
+		w.Header().Set("Location", fmt.Sprintf("/api/2.1/sites/%d/", 100+len(posted)))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	csv := "\ufeffSite,Customer ID,City,Notes\n" +
+		"\"Main Office, HQ\",5,Berlin,\"Core \"\"A\"\" rack\"\n" +
+		"Branch,five,Hamburg,\n" +
+		"Rejected,5,Munich,\n" +
+		"Warehouse,6,,\"two\nlines\"\n"
+	res, _, err := h.ImportCSV(context.Background(), nil, ImportCSVInput{
+		EntityType: "site",
+		CSVBase64:  base64.StdEncoding.EncodeToString([]byte(csv)),
+		Mapping:    map[string]string{"Site": "name", "Customer ID": "company.id", "City": "address.city", "Notes": "description"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("ImportCSV: %s, %v", resultText(t, res), err)
+	}
+	var out struct {
+		Rows, Created, Failed int
+		Results               []importRowResult
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Rows != 4 || out.Created != 2 || out.Failed != 2 {
+		t.Errorf("rows/created/failed = %d/%d/%d, want 4/2/2", out.Rows, out.Created, out.Failed)
+	}
+	want := []importRowResult{
+		{Line: 2, ID: 101, Name: "Main Office, HQ", Status: "created"},
+		{Line: 3, Name: "Branch", Status: "failed"},
+		{Line: 4, Name: "Rejected", Status: "failed"},
+		{Line: 5, ID: 102, Name: "Warehouse", Status: "created"},
+	}
+	for i, w := range want {
+		if i >= len(out.Results) {
+			t.Fatalf("only %d results", len(out.Results))
+		}
+		got := out.Results[i]
+		got.Error = ""
+		if got != w {
+			t.Errorf("row %d = %+v, want %+v", i, out.Results[i], w)
+		}
+	}
+	if e := out.Results[1].Error; !strings.Contains(e, `"Customer ID"`) {
+		t.Errorf("bad company ID error = %q", e)
+	}
+	if e := out.Results[2].Error; !strings.Contains(e, "name already taken") {
+		t.Errorf("API refusal error = %q", e)
+	}
+
+	if len(posted) != 2 {
+		t.Fatalf("posted %d sites, want 2", len(posted))
+	}
+	first, _ := json.Marshal(posted[0])
+	for _, s := range []string{`"name":"Main Office, HQ"`, `"company":{"id":5}`, `"city":"Berlin"`, `"description":"Core \"A\" rack"`} {
+		if !strings.Contains(string(first), s) {
+			t.Errorf("first site %s lacks %s", first, s)
+		}
+	}
+	if posted[1]["description"] != "two\nlines" || posted[1]["address"] != nil {
+		t.Errorf("second site = %v, want the multi-line note and no address", posted[1])
+	}
+}
+
+func TestImportCSVRejectsBadInputBeforeCreating(t *testing.T) {
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	enc := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	threeRows := enc("Name\na\nb\nc\n")
+
+	for name, c := range map[string]struct {
+		in   ImportCSVInput
+		want string
+	}{
+		"unknown column":  {ImportCSVInput{EntityType: "company", CSVBase64: threeRows, Mapping: map[string]string{"Title": "name"}}, `column "Title"`},
+		"unknown field":   {ImportCSVInput{EntityType: "company", CSVBase64: threeRows, Mapping: map[string]string{"Name": "nom"}}, `no field "nom"`},
+		"bare reference":  {ImportCSVInput{EntityType: "site", CSVBase64: threeRows, Mapping: map[string]string{"Name": "company"}}, "company.id"},
+		"over max_rows":   {ImportCSVInput{EntityType: "company", CSVBase64: threeRows, Mapping: map[string]string{"Name": "name"}, MaxRows: 2}, "3 data rows"},
+		"device type":     {ImportCSVInput{EntityType: "device", CSVBase64: threeRows, Mapping: map[string]string{"Name": "name"}}, "field entity_type"},
+		"malformed quote": {ImportCSVInput{EntityType: "company", CSVBase64: enc("Name\n\"a\"b\n"), Mapping: map[string]string{"Name": "name"}}, "Nothing was imported"},
+	} {
+		res, _, err := h.ImportCSV(context.Background(), nil, c.in)
+		if err != nil || !res.IsError {
+			t.Errorf("%s: want a tool error, got %v, %v", name, res, err)
+			continue
+		}
+		if got := resultText(t, res); !strings.Contains(got, c.want) {
+			t.Errorf("%s: error %q lacks %q", name, got, c.want)
+		}
+	}
+	if posts != 0 {
+		t.Errorf("%d requests sent for rejected imports", posts)
+	}
+}
@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// instanceSpec is an additional ITPortal instance registered via WithInstance.
+type instanceSpec struct {
+	name   string
+	client *itportal.Client
+	cache  *cache.Cache
+}
+
+// WithInstanceName names the primary ITPortal instance passed to NewServer. It
+// only matters when further instances are added with WithInstance.
+func WithInstanceName(name string) Option {
+	return func(h *Handler) { h.instance = name }
+}
+
+// WithInstance adds another ITPortal tenant behind the same MCP server. Tools
+// gain an optional "instance" argument that routes the call to it, and its
+// snapshot resources are served under itportal://<name>/snapshot.
+func WithInstance(name string, client *itportal.Client, c *cache.Cache) Option {
+	return func(h *Handler) {
+		h.extraInstances = append(h.extraInstances, instanceSpec{name: name, client: client, cache: c})
+	}
+}
+
+// instanceRouter resolves the optional "instance" tool argument to the Handler
+// bound to that ITPortal instance. names[0] is the default instance.
+type instanceRouter struct {
+	names    []string
+	handlers map[string]*Handler
+	// principals maps MCP API keys to the instance they are pinned to.
+	principals map[string]string
+}
+
+// newInstanceRouter derives one Handler per configured instance from the
+// primary h. Every instance shares h's policy and options; only the client,
+// cache and resource URIs differ.
+func newInstanceRouter(h *Handler) *instanceRouter {
+	if h.instance == "" {
+		h.instance = "default"
+	}
+	r := &instanceRouter{
+		names:      []string{h.instance},
+		handlers:   map[string]*Handler{h.instance: h},
+		principals: h.principalKeys,
+	}
+	for _, spec := range h.extraInstances {
+		ih := *h
+		ih.client = spec.client
+		ih.cache = spec.cache
+		ih.baseURL = spec.client.BaseURL()
+		ih.instance = spec.name
+		ih.uriPrefix = spec.name + "/"
+		ih.extraInstances = nil
+		// Company IDs are per tenant; the default company is the default
+		// instance's.
+		ih.defaultCompanyID = 0
+		if h.deletes != nil {
+			ih.deletes = newPendingDeletes()
+		}
+		r.names = append(r.names, spec.name)
+		r.handlers[spec.name] = &ih
+	}
+	return r
+}
+
+// multi reports whether more than one instance is configured.
+func (r *instanceRouter) multi() bool {
+	return len(r.names) > 1
+}
+
+// resolve returns the Handler for name, or the default instance when name is
+// empty.
+func (r *instanceRouter) resolve(name string) (*Handler, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return r.handlers[r.names[0]], nil
+	}
+	if h, ok := r.handlers[name]; ok {
+		return h, nil
+	}
+	return nil, fmt.Errorf("unknown instance %q (configured: %s)", name, strings.Join(r.names, ", "))
+}
+
+// instanceArg extracts the optional "instance" argument from a raw tool call.
+func instanceArg(req *sdkmcp.CallToolRequest) string {
+	if req == nil || req.Params == nil || len(req.Params.Arguments) == 0 {
+		return ""
+	}
+	var args struct {
+		Instance string `json:"instance"`
+	}
+	_ = json.Unmarshal(req.Params.Arguments, &args)
+	return args.Instance
+}
+
+// untimedTools run without the WithToolTimeout deadline. Each makes many writes
+// and reports per-row results; cutting one off mid-way would drop the record of
+// what it already wrote, and a retry would repeat those writes.
+var untimedTools = map[string]bool{
+	"bulk_update": true,
+	"import_csv":  true,
+}
+
+// addTool registers an instance-routed tool. fn is a Handler method expression
+// such as (*Handler).SearchDocs; each call runs on the Handler of the instance
+// named by the "instance" argument, or pinned to the caller's MCP API key
+// (WithPrincipalKeys). The inferred input schema carries the
+// tool's toolExamples and, when several instances are configured, gains that
+// optional argument.
+func addTool[In any](server *sdkmcp.Server, t *sdkmcp.Tool, r *instanceRouter,
+	fn func(*Handler, context.Context, *sdkmcp.CallToolRequest, In) (*sdkmcp.CallToolResult, any, error)) {
+	schema := inputSchema[In](t.Name)
+	if r.multi() {
+		if schema.Properties == nil {
+			schema.Properties = map[string]*jsonschema.Schema{}
+		}
+		enum := make([]any, len(r.names))
+		for i, n := range r.names {
+			enum[i] = n
+		}
+		schema.Properties["instance"] = &jsonschema.Schema{
+			Type:        "string",
+			Description: fmt.Sprintf("Optional: ITPortal instance to query. Defaults to %q.", r.names[0]),
+			Enum:        enum,
+		}
+	}
+	t.InputSchema = schema
+	sdkmcp.AddTool(server, t, func(ctx context.Context, req *sdkmcp.CallToolRequest, in In) (*sdkmcp.CallToolResult, any, error) {
+		h, err := r.route(req)
+		if err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+		h.logToolCall(ctx, t.Name, in)
+		if h.limiter != nil {
+			release, err := h.limiter.Acquire(ctx)
+			if err != nil {
+				return toolError(err.Error()), nil, nil
+			}
+			defer release()
+		}
+		if h.drainer != nil {
+			tracked, done, err := h.drainer.Track(ctx)
+			if err != nil {
+				return toolError(err.Error()), nil, nil
+			}
+			defer done()
+			ctx = tracked
+		}
+		timeout := h.toolTimeout
+		if untimedTools[t.Name] {
+			timeout = 0
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		// Each call is one logical operation: its creates get idempotency keys
+		// of their own, shared only with their retries inside the call.
+		ctx = itportal.WithIdempotencyScope(ctx)
+		res, out, err := fn(h, ctx, req, in)
+		if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return toolError(fmt.Sprintf("%s timed out after %s waiting on ITPortal. A read can be retried or narrowed; a write may already have been applied, so check the record before repeating it.", t.Name, timeout)), nil, nil
+		}
+		var nf *itportal.NotFoundError
+		if errors.As(err, &nf) {
+			return toolError(nf.Error()), nil, nil
+		}
+		if u, ok := any(in).(uncappedInput); !ok || !u.uncapped() {
+			h.capResult(res)
+		}
+		return res, out, err
+	})
+}
@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// fakeInstance starts an ITPortal stand-in whose every list endpoint returns one
+// record named name, and builds a cache against it. hits counts API requests.
+func fakeInstance(t *testing.T, name string) (*itportal.Client, *cache.Cache, *atomic.Int32) {
+	t.Helper()
+	hits := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		writeList(w, []map[string]any{{"id": 1, "name": name}}, "")
+	}))
+	t.Cleanup(srv.Close)
+
+	client := itportal.NewClient(srv.URL, "secret")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour, logger,
+		cache.WithStorePath(filepath.Join(t.TempDir(), name+".db")))
+	if err != nil {
+		t.Fatalf("cache.New(%s): %v", name, err)
+	}
+	return client, c, hits
+}
+
+// connect serves server over in-memory transports and returns a client session.
+func connect(t *testing.T, server *sdkmcp.Server) *sdkmcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	ct, st := sdkmcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	t.Cleanup(func() { _ = ss.Close() })
+	cs, err := sdkmcp.NewClient(&sdkmcp.Implementation{Name: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.Close() })
+	return cs
+}
+
+// TestMultiInstanceRoutingAndIsolation verifies the instance argument routes
+// live calls and index searches to the named tenant only, with the first
+// instance as the default.
+func TestMultiInstanceRoutingAndIsolation(t *testing.T) {
+	clientA, cacheA, hitsA := fakeInstance(t, "Alpha")
+	clientB, cacheB, hitsB := fakeInstance(t, "Bravo")
+	server := NewServer(clientA, cacheA, WithInstanceName("emea"), WithInstance("apac", clientB, cacheB))
+	cs := connect(t, server)
+	ctx := context.Background()
+
+	call := func(tool string, args map[string]any) *sdkmcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &sdkmcp.CallToolParams{Name: tool, Arguments: args})
+		if err != nil {
+			t.Fatalf("%s %v: %v", tool, args, err)
+		}
+		return res
+	}
+
+	// Index search is isolated per instance.
+	if got := resultText(t, call("search_docs", map[string]any{"query": "Bravo", "instance": "apac"})); !strings.Contains(got, `"Bravo"`) {
+		t.Errorf("apac search missed its own record: %s", got)
+	}
+	if got := resultText(t, call("search_docs", map[string]any{"query": "Bravo"})); !strings.HasPrefix(got, "No results") {
+		t.Errorf("default (emea) search leaked apac data: %s", got)
+	}
+
+	// Live calls reach only the selected instance's API.
+	a0, b0 := hitsA.Load(), hitsB.Load()
+	call("list_entities", map[string]any{"entity_type": "company", "instance": "apac"})
+	if hitsA.Load() != a0 || hitsB.Load() != b0+1 {
+		t.Errorf("apac call routed wrongly: emea +%d, apac +%d", hitsA.Load()-a0, hitsB.Load()-b0)
+	}
+	call("list_entities", map[string]any{"entity_type": "company"})
+	if hitsA.Load() != a0+1 {
+		t.Errorf("default call did not reach emea")
+	}
+
+	// The schema enumerates instance names, so an unknown one is rejected outright.
+	if _, err := cs.CallTool(ctx, &sdkmcp.CallToolParams{Name: "list_entities",
+		Arguments: map[string]any{"entity_type": "company", "instance": "nope"}}); err == nil {
+		t.Error("unknown instance not rejected")
+	}
+
+	// Per-instance snapshot resources.
+	rr, err := cs.ReadResource(ctx, &sdkmcp.ReadResourceParams{URI: "itportal://apac/snapshot"})
+	if err != nil {
+		t.Fatalf("read apac snapshot: %v", err)
+	}
+	if text := rr.Contents[0].Text; !strings.Contains(text, "Bravo") || strings.Contains(text, "Alpha") {
+		t.Errorf("apac snapshot not isolated: %.200s", text)
+	}
+}
+
+// TestNotFoundRendersFriendlyToolError verifies a missing entity comes back as
+// a tool error naming it, without the API path.
+func TestNotFoundRendersFriendlyToolError(t *testing.T) {
+	_, c, _ := fakeInstance(t, "Alpha")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []any{}, "")
+	}))
+	t.Cleanup(srv.Close)
+	cs := connect(t, NewServer(itportal.NewClient(srv.URL, "secret"), c))
+
+	res, err := cs.CallTool(context.Background(), &sdkmcp.CallToolParams{
+		Name: "get_entity_details", Arguments: map[string]any{"entity_type": "device", "id": "999"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	got := resultText(t, res)
+	if !res.IsError || !strings.Contains(got, "device 999 not found") {
+		t.Errorf("result = %q (error=%v), want a device 999 not found tool error", got, res.IsError)
+	}
+	if strings.Contains(got, "/api/") || strings.Contains(got, "devices/999") {
+		t.Errorf("result leaks the API path: %q", got)
+	}
+}
@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// InventoryResource serves itportal://inventory: every cached device as a compact
+// Markdown table, grouped by company and then site. It answers "what hardware
+// does X have" questions without paging through the devices section.
+func (h *Handler) InventoryResource(ctx context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+	if !h.snapshotReady() {
+		return nil, errors.New(snapshotNotReady)
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+	return h.resourceResult(req.Params.URI, "text/markdown", renderInventory(snap), len(snap.Devices)), nil
+}
+
+// inventoryURI is the inventory resource URI of this Handler's instance.
+func (h *Handler) inventoryURI() string {
+	return "itportal://" + h.uriPrefix + "inventory"
+}
+
+// inventoryGroup is one company or site heading in the inventory.
+type inventoryGroup struct {
+	id   int
+	name string
+}
+
+// renderInventory groups snap's devices by company then site, both ordered by
+// name with unassigned devices last, and renders one table per site.
+func renderInventory(snap *cache.Snapshot) string {
+	companyNames := make(map[int]string, len(snap.Companies))
+	for _, c := range snap.Companies {
+		companyNames[c.ID] = c.Name
+	}
+
+	type siteDevices struct {
+		site    inventoryGroup
+		devices []itportal.Device
+	}
+	type companyDevices struct {
+		company inventoryGroup
+		sites   map[int]*siteDevices
+	}
+	companies := map[int]*companyDevices{}
+	for _, d := range snap.Devices {
+		cg := inventoryGroup{name: "(no company)"}
+		if d.Company != nil && d.Company.ID != 0 {
+			cg = inventoryGroup{id: d.Company.ID, name: cache.FirstNonEmpty(d.Company.Name, companyNames[d.Company.ID], fmt.Sprintf("Company %d", d.Company.ID))}
+		}
+		sg := inventoryGroup{name: "(no site)"}
+		if d.Site != nil && d.Site.ID != 0 {
+			sg = inventoryGroup{id: d.Site.ID, name: cache.FirstNonEmpty(d.Site.Name, fmt.Sprintf("Site %d", d.Site.ID))}
+		}
+		cd := companies[cg.id]
+		if cd == nil {
+			cd = &companyDevices{company: cg, sites: map[int]*siteDevices{}}
+			companies[cg.id] = cd
+		}
+		sd := cd.sites[sg.id]
+		if sd == nil {
+			sd = &siteDevices{site: sg}
+			cd.sites[sg.id] = sd
+		}
+		sd.devices = append(sd.devices, d)
+	}
+
+	ordered := make([]*companyDevices, 0, len(companies))
+	for _, cd := range companies {
+		ordered = append(ordered, cd)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return groupLess(ordered[i].company, ordered[j].company) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Device inventory\n\n%d devices across %d companies (snapshot %s).\n",
+		len(snap.Devices), len(ordered), snap.GeneratedAt.Format("2006-01-02 15:04:05 UTC"))
+	for _, cd := range ordered {
+		fmt.Fprintf(&b, "\n## %s\n", cd.company.name)
+		sites := make([]*siteDevices, 0, len(cd.sites))
+		for _, sd := range cd.sites {
+			sites = append(sites, sd)
+		}
+		sort.Slice(sites, func(i, j int) bool { return groupLess(sites[i].site, sites[j].site) })
+		for _, sd := range sites {
+			sort.Slice(sd.devices, func(i, j int) bool {
+				a, c := strings.ToLower(sd.devices[i].Name), strings.ToLower(sd.devices[j].Name)
+				if a != c {
+					return a < c
+				}
+				return sd.devices[i].ID < sd.devices[j].ID
+			})
+			fmt.Fprintf(&b, "\n### %s\n\n", sd.site.name)
+			b.WriteString("| ID | Name | Type | Manufacturer | Model | Serial |\n")
+			b.WriteString("|---|---|---|---|---|---|\n")
+			for _, d := range sd.devices {
+				typ := ""
+				if d.Type != nil {
+					typ = d.Type.Name
+				}
+				fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n", d.ID,
+					tableCell(d.Name), tableCell(typ), tableCell(d.Manufacturer), tableCell(d.Model), tableCell(d.Serial))
+			}
+		}
+	}
+	return b.String()
+}
+
+// groupLess orders inventory groups by name, case-insensitively, with the
+// unassigned (ID 0) group last.
+func groupLess(a, b inventoryGroup) bool {
+	if (a.id == 0) != (b.id == 0) {
+		return b.id == 0
+	}
+	an, bn := strings.ToLower(a.name), strings.ToLower(b.name)
+	if an != bn {
+		return an < bn
+	}
+	return a.id < b.id
+}
+
+// tableCell makes s safe for a Markdown table cell.
+func tableCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestRenderInventoryGroupsByCompanyThenSite verifies companies and sites are
+// ordered by name with unassigned devices last, and every device is listed once.
+func TestRenderInventoryGroupsByCompanyThenSite(t *testing.T) {
+	snap := &cache.Snapshot{
+		Companies: []itportal.Company{{ID: 1, Name: "Zulu Corp"}, {ID: 2, Name: "Acme"}},
+		Devices: []itportal.Device{
+			{ID: 10, Name: "zfw01", Company: &itportal.CompanyReference{ID: 1}, Site: &itportal.SiteReference{ID: 5, Name: "Zulu HQ"},
+				Type: &itportal.TypeItem{Name: "Firewall"}, Manufacturer: "Fortinet", Model: "60F", Serial: "FGT60F"},
+			{ID: 11, Name: "sw|core", Company: &itportal.CompanyReference{ID: 2, Name: "Acme"}, Site: &itportal.SiteReference{ID: 7, Name: "Berlin"}},
+			{ID: 12, Name: "ap01", Company: &itportal.CompanyReference{ID: 2, Name: "Acme"}, Site: &itportal.SiteReference{ID: 6, Name: "Amsterdam"}},
+			{ID: 13, Name: "laptop", Company: &itportal.CompanyReference{ID: 2, Name: "Acme"}},
+			{ID: 14, Name: "orphan"},
+		},
+	}
+	out := renderInventory(snap)
+
+	order := []string{"## Acme", "### Amsterdam", "| 12 |", "### Berlin", "| 11 |", "### (no site)", "| 13 |",
+		"## Zulu Corp", "### Zulu HQ", "| 10 | zfw01 | Firewall | Fortinet | 60F | FGT60F |", "## (no company)", "| 14 |"}
+	pos := 0
+	for _, want := range order {
+		i := strings.Index(out[pos:], want)
+		if i < 0 {
+			t.Fatalf("%q missing or out of order in:\n%s", want, out)
+		}
+		pos += i + len(want)
+	}
+	for _, d := range snap.Devices {
+		if n := strings.Count(out, fmt.Sprintf("\n| %d |", d.ID)); n != 1 {
+			t.Errorf("device %d listed %d times", d.ID, n)
+		}
+	}
+	if !strings.Contains(out, `sw\|core`) {
+		t.Errorf("pipe in device name not escaped:\n%s", out)
+	}
+}
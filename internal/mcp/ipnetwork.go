@@ -0,0 +1,316 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// lookupIPNetwork returns IP network id from the snapshot, falling back to a
+// live fetch for networks created since the last refresh.
+func (h *Handler) lookupIPNetwork(ctx context.Context, id int) (*itportal.IPNetwork, error) {
+	if h.cache != nil {
+		if snap := h.cache.Get(); snap != nil {
+			for i := range snap.IPNetworks {
+				if snap.IPNetworks[i].ID == id {
+					return &snap.IPNetworks[i], nil
+				}
+			}
+		}
+	}
+	n, err := h.client.GetIPNetwork(ctx, strconv.Itoa(id))
+	if err != nil {
+		return nil, fmt.Errorf("get IP network %d: %w", id, err)
+	}
+	return n, nil
+}
+
+// networkPrefix parses n's address range. ITPortal stores the mask as a dotted
+// quad ("255.255.255.0"), but a prefix length ("24" or "/24") or a CIDR
+// networkAddress are accepted too. ok is false when the range is not recorded
+// or cannot be parsed.
+func networkPrefix(n *itportal.IPNetwork) (netip.Prefix, bool) {
+	addr := strings.TrimSpace(n.NetworkAddress)
+	if p, err := netip.ParsePrefix(addr); err == nil {
+		return p.Masked(), true
+	}
+	base, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	mask := strings.TrimPrefix(strings.TrimSpace(n.SubnetMask), "/")
+	bits, err := strconv.Atoi(mask)
+	if err != nil {
+		m, err := netip.ParseAddr(mask)
+		if err != nil || m.BitLen() != base.BitLen() {
+			return netip.Prefix{}, false
+		}
+		if bits = maskBits(m.AsSlice()); bits < 0 {
+			return netip.Prefix{}, false
+		}
+	}
+	p, err := base.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return p, true
+}
+
+// maskBits counts the leading one bits of a contiguous netmask, or returns -1
+// when the mask has holes.
+func maskBits(mask []byte) int {
+	bits, done := 0, false
+	for _, b := range mask {
+		for i := 7; i >= 0; i-- {
+			set := b&(1<<i) != 0
+			switch {
+			case set && done:
+				return -1
+			case set:
+				bits++
+			default:
+				done = true
+			}
+		}
+	}
+	return bits
+}
+
+// networkContext renders the addressing details of n an agent needs when
+// documenting a host on it.
+func networkContext(n *itportal.IPNetwork) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "IP network: %s (ID: %d)", n.Name, n.ID)
+	if p, ok := networkPrefix(n); ok {
+		fmt.Fprintf(&b, "\n- Network: %s", p)
+	}
+	if n.VlanID != 0 {
+		fmt.Fprintf(&b, "\n- VLAN: %d", n.VlanID)
+	}
+	if ip := ipRefAddr(n.DefaultGateway); ip != "" {
+		fmt.Fprintf(&b, "\n- Default gateway: %s", ip)
+	}
+	var dns []string
+	for _, r := range []*itportal.IPRef{n.DNSServer1, n.DNSServer2} {
+		if ip := ipRefAddr(r); ip != "" {
+			dns = append(dns, ip)
+		}
+	}
+	if len(dns) > 0 {
+		fmt.Fprintf(&b, "\n- DNS: %s", strings.Join(dns, ", "))
+	}
+	if ip := ipRefAddr(n.DHCPServer); ip != "" {
+		fmt.Fprintf(&b, "\n- DHCP server: %s", ip)
+	}
+	return b.String()
+}
+
+func ipRefAddr(r *itportal.IPRef) string {
+	if r == nil {
+		return ""
+	}
+	return r.IP
+}
+
+// ---- get_ipnetwork_by_vlan ----
+
+type GetIPNetworkByVLANInput struct {
+	VlanID    int `json:"vlan_id" jsonschema:"Required. VLAN ID to look up (1-4094)"`
+	CompanyID int `json:"company_id,omitempty" jsonschema:"Only networks of this company"`
+}
+
+// GetIPNetworkByVLAN lists the cached IP networks tagged with a VLAN ID.
+func (h *Handler) GetIPNetworkByVLAN(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetIPNetworkByVLANInput) (*sdkmcp.CallToolResult, any, error) {
+	var vlanCheck *fieldError
+	if input.VlanID < 1 || input.VlanID > 4094 {
+		vlanCheck = &fieldError{Field: "vlan_id", Reason: "between 1 and 4094"}
+	}
+	if res := validationResult(vlanCheck); res != nil {
+		return res, nil, nil
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	h.cache.EnsureFresh(ctx)
+	input.CompanyID = h.companyOr(input.CompanyID)
+	matches := ipNetworksByVLAN(h.cache.Get(), input.VlanID, input.CompanyID)
+	if len(matches) == 0 {
+		msg := fmt.Sprintf("no IP network in the snapshot has VLAN %d", input.VlanID)
+		if input.CompanyID != 0 {
+			msg += fmt.Sprintf(" for company_id %d", input.CompanyID)
+		}
+		return toolError(msg + "; networks created since the last refresh need refresh_snapshot"), nil, nil
+	}
+	for i := range matches {
+		if matches[i].URL == "" {
+			matches[i].URL = itportal.BuildPortalURL(h.baseURL, "ipnetwork", matches[i].ID)
+		}
+	}
+	return marshalResult(struct {
+		VlanID  int                  `json:"vlan_id"`
+		Count   int                  `json:"count"`
+		Matches []itportal.IPNetwork `json:"matches"`
+	}{input.VlanID, len(matches), matches})
+}
+
+// ipNetworksByVLAN returns copies of the networks in snap on VLAN vlan, limited
+// to companyID when it is set, ordered by company then network name.
+func ipNetworksByVLAN(snap *cache.Snapshot, vlan, companyID int) []itportal.IPNetwork {
+	var out []itportal.IPNetwork
+	for _, n := range snap.IPNetworks {
+		if n.VlanID != vlan {
+			continue
+		}
+		if companyID != 0 && (n.Company == nil || n.Company.ID != companyID) {
+			continue
+		}
+		out = append(out, n)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		ci, cj := "", ""
+		if out[i].Company != nil {
+			ci = out[i].Company.Name
+		}
+		if out[j].Company != nil {
+			cj = out[j].Company.Name
+		}
+		if !strings.EqualFold(ci, cj) {
+			return strings.ToLower(ci) < strings.ToLower(cj)
+		}
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	return out
+}
+
+// ---- create_ip_network ----
+
+type CreateIPNetworkInput struct {
+	Name        string `json:"name" jsonschema:"Required. Network name (e.g. 'HQ Servers')"`
+	CompanyID   int    `json:"company_id,omitempty" jsonschema:"ID of the company the network belongs to. Required unless the server has a default company."`
+	SiteID      int    `json:"site_id,omitempty" jsonschema:"ID of the site the network is at"`
+	Network     string `json:"network" jsonschema:"Required. Network address (10.0.20.0), or CIDR (10.0.20.0/24) in place of subnet_mask/cidr"`
+	SubnetMask  string `json:"subnet_mask,omitempty" jsonschema:"Subnet mask, e.g. 255.255.255.0"`
+	CIDR        int    `json:"cidr,omitempty" jsonschema:"Prefix length, e.g. 24, in place of subnet_mask"`
+	Gateway     string `json:"gateway,omitempty" jsonschema:"Default gateway IP address, inside the network"`
+	DNS1        string `json:"dns1,omitempty" jsonschema:"Primary DNS server IP address"`
+	DNS2        string `json:"dns2,omitempty" jsonschema:"Secondary DNS server IP address"`
+	VLAN        int    `json:"vlan,omitempty" jsonschema:"VLAN ID (1-4094)"`
+	Description string `json:"description,omitempty" jsonschema:"What the network is for"`
+}
+
+// CreateIPNetwork creates an IP network from plain values, building the
+// company/site references and the defaultGateway/dnsServer IP objects the
+// API expects, and storing the mask in ITPortal's dotted form.
+func (h *Handler) CreateIPNetwork(ctx context.Context, _ *sdkmcp.CallToolRequest, input CreateIPNetworkInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := h.checkWrite("ipnetwork"); res != nil {
+		return res, nil, nil
+	}
+	input.CompanyID = h.companyOr(input.CompanyID)
+	if res := validationResult(
+		validateRequired("name", input.Name),
+		validateRequired("company_id", input.CompanyID),
+		validateRequired("network", input.Network),
+	); res != nil {
+		return res, nil, nil
+	}
+	prefix, problem := createNetworkPrefix(input)
+	checks := []*fieldError{problem}
+	var refs [3]*itportal.IPRef
+	for i, f := range []struct{ field, value string }{{"gateway", input.Gateway}, {"dns1", input.DNS1}, {"dns2", input.DNS2}} {
+		v := strings.TrimSpace(f.value)
+		if v == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			checks = append(checks, &fieldError{Field: f.field, Reason: fmt.Sprintf("%q is not an IP address", v)})
+			continue
+		}
+		if f.field == "gateway" && problem == nil && !prefix.Contains(addr.Unmap()) {
+			checks = append(checks, &fieldError{Field: "gateway", Reason: fmt.Sprintf("%s is outside %s", addr, prefix)})
+		}
+		refs[i] = &itportal.IPRef{IP: addr.String()}
+	}
+	if input.VLAN < 0 || input.VLAN > 4094 {
+		checks = append(checks, &fieldError{Field: "vlan", Reason: "between 1 and 4094"})
+	}
+	if res := validationResult(checks...); res != nil {
+		return res, nil, nil
+	}
+
+	network := &itportal.IPNetwork{
+		Name:           strings.TrimSpace(input.Name),
+		Company:        &itportal.CompanyReference{ID: input.CompanyID},
+		Description:    input.Description,
+		NetworkAddress: prefix.Addr().String(),
+		SubnetMask:     prefixMask(prefix),
+		DefaultGateway: refs[0],
+		DNSServer1:     refs[1],
+		DNSServer2:     refs[2],
+		VlanID:         input.VLAN,
+	}
+	if input.SiteID != 0 {
+		network.Site = &itportal.SiteReference{ID: input.SiteID}
+	}
+	created, err := h.client.CreateIPNetwork(ctx, network)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create IP network: %w", err)
+	}
+	h.mergeWritten(created)
+	network.ID = created.ID
+	msg := fmt.Sprintf("IP network created. ID: %d  Portal: %s", created.ID, created.URL) + createdAtLine(created.Modified) +
+		"\n" + networkContext(network)
+	return toolText(msg), created, nil
+}
+
+// createNetworkPrefix reads create_ip_network's range from network plus
+// subnet_mask or cidr, exactly one of the three giving the prefix length.
+func createNetworkPrefix(input CreateIPNetworkInput) (netip.Prefix, *fieldError) {
+	network := strings.TrimSpace(input.Network)
+	mask := strings.TrimSpace(input.SubnetMask)
+	given := 0
+	for _, set := range []bool{strings.Contains(network, "/"), mask != "", input.CIDR != 0} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return netip.Prefix{}, &fieldError{Field: "network", Reason: "give the prefix length once: a CIDR network, subnet_mask or cidr"}
+	}
+	if input.CIDR != 0 {
+		mask = strconv.Itoa(input.CIDR)
+	}
+	var n itportal.IPNetwork
+	if strings.Contains(network, "/") {
+		n.NetworkAddress = network
+	} else {
+		n.NetworkAddress, n.SubnetMask = network, mask
+	}
+	p, ok := networkPrefix(&n)
+	if !ok {
+		return netip.Prefix{}, &fieldError{Field: "network", Reason: fmt.Sprintf("%q with mask %q is not a valid network", network, mask)}
+	}
+	raw, _, _ := strings.Cut(network, "/")
+	if addr, err := netip.ParseAddr(raw); err != nil || addr != p.Addr() {
+		return netip.Prefix{}, &fieldError{Field: "network", Reason: fmt.Sprintf("%s has host bits set; the network is %s", raw, p)}
+	}
+	return p, nil
+}
+
+// prefixMask renders p's length the way ITPortal stores masks: a dotted quad
+// for IPv4, the bare prefix length for IPv6.
+func prefixMask(p netip.Prefix) string {
+	if !p.Addr().Is4() {
+		return strconv.Itoa(p.Bits())
+	}
+	return net.IP(net.CIDRMask(p.Bits(), 32)).String()
+}
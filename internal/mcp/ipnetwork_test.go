@@ -0,0 +1,204 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ipNetworkServer serves IP network 5 (10.20.0.0/24) and counts the device IP
+// records posted to device 9.
+func ipNetworkServer(t *testing.T, posts *int) *Handler {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case r.Method == http.MethodPost && path == "/devices/9/ips/":
+			*posts++
+			w.Header().Set("Location", "/api/2.1/devices/9/ips/31/")
+			w.WriteHeader(http.StatusCreated)
+		case path == "/devices/9/ips/":
+			writeList(w, []itportal.DeviceIP{}, "")
+		case path == "/ipnetworks/5/":
+			writeList(w, []itportal.IPNetwork{{
+				ID: 5, Name: "Office LAN", NetworkAddress: "10.20.0.0", SubnetMask: "255.255.255.0", VlanID: 20,
+				DefaultGateway: &itportal.IPRef{IP: "10.20.0.1"},
+				DNSServer1:     &itportal.IPRef{IP: "10.20.0.10"},
+				DNSServer2:     &itportal.IPRef{IP: "1.1.1.1"},
+			}}, "")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return newHandler(srv.URL)
+}
+
+func TestAddDeviceIPRejectsAddressOutsideNetwork(t *testing.T) {
+	var posts int
+	h := ipNetworkServer(t, &posts)
+	res, _, err := h.AddDeviceIP(context.Background(), nil, AddDeviceIPInput{DeviceID: "9", IP: "10.20.1.5", IPNetworkID: 5})
+	if err != nil {
+		t.Fatalf("AddDeviceIP: %v", err)
+	}
+	if !res.IsError {
+		t.Fatal("expected a validation error for an out-of-range IP")
+	}
+	if got := resultText(t, res); !strings.Contains(got, "field ip") || !strings.Contains(got, "10.20.0.0/24") {
+		t.Errorf("error = %q, want the ip field and the network range", got)
+	}
+	if posts != 0 {
+		t.Errorf("out-of-range IP was posted %d times", posts)
+	}
+}
+
+func TestAddDeviceIPReturnsNetworkContext(t *testing.T) {
+	var posts int
+	h := ipNetworkServer(t, &posts)
+	res, _, err := h.AddDeviceIP(context.Background(), nil, AddDeviceIPInput{DeviceID: "9", IP: "10.20.0.50", IPNetworkID: 5, IncludeNetwork: true})
+	if err != nil {
+		t.Fatalf("AddDeviceIP: %v", err)
+	}
+	got := resultText(t, res)
+	if res.IsError || posts != 1 {
+		t.Fatalf("in-range IP not added (posts=%d): %s", posts, got)
+	}
+	for _, want := range []string{"Office LAN", "10.20.0.0/24", "VLAN: 20", "Default gateway: 10.20.0.1", "DNS: 10.20.0.10, 1.1.1.1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("result missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestNetworkPrefix(t *testing.T) {
+	cases := []struct {
+		addr, mask string
+		want       string
+	}{
+		{"192.168.1.0", "255.255.255.0", "192.168.1.0/24"},
+		{"192.168.1.0", "/26", "192.168.1.0/26"},
+		{"10.0.0.0/8", "", "10.0.0.0/8"},
+		{"2001:db8::", "64", "2001:db8::/64"},
+		{"192.168.1.0", "255.0.255.0", ""},
+		{"", "255.255.255.0", ""},
+	}
+	for _, c := range cases {
+		p, ok := networkPrefix(&itportal.IPNetwork{NetworkAddress: c.addr, SubnetMask: c.mask})
+		got := ""
+		if ok {
+			got = p.String()
+		}
+		if got != c.want {
+			t.Errorf("networkPrefix(%q, %q) = %q, want %q", c.addr, c.mask, got, c.want)
+		}
+	}
+}
+
+func TestIPNetworksByVLAN(t *testing.T) {
+	acme := &itportal.CompanyReference{ID: 1, Name: "Acme"}
+	globex := &itportal.CompanyReference{ID: 2, Name: "Globex"}
+	snap := &cache.Snapshot{IPNetworks: []itportal.IPNetwork{
+		{ID: 1, Name: "Voice", VlanID: 20, Company: globex},
+		{ID: 2, Name: "Office LAN", VlanID: 20, Company: acme, DHCPServer: &itportal.IPRef{IP: "10.20.0.2"}},
+		{ID: 3, Name: "Guest", VlanID: 30, Company: acme},
+		{ID: 4, Name: "Untagged", Company: acme},
+	}}
+
+	var ids []int
+	for _, n := range ipNetworksByVLAN(snap, 20, 0) {
+		ids = append(ids, n.ID)
+	}
+	if !slices.Equal(ids, []int{2, 1}) {
+		t.Errorf("VLAN 20 = %v, want [2 1] (Acme before Globex)", ids)
+	}
+	if got := ipNetworksByVLAN(snap, 20, 2); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("VLAN 20 for company 2 = %+v, want network 1", got)
+	}
+	if got := ipNetworksByVLAN(snap, 99, 0); len(got) != 0 {
+		t.Errorf("VLAN 99 = %+v, want none", got)
+	}
+}
+
+func TestNetworkContextIncludesDHCPServer(t *testing.T) {
+	out := networkContext(&itportal.IPNetwork{
+		ID: 5, Name: "Office LAN", VlanID: 20, DHCPServer: &itportal.IPRef{IP: "10.20.0.2"},
+	})
+	for _, want := range []string{"- VLAN: 20", "- DHCP server: 10.20.0.2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("network context missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCreateIPNetworkBuildsNestedReferences(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/2.1/ipnetworks/" {
+			data, _ := io.ReadAll(r.Body)
+			body = string(data)
+			w.Header().Set("Location", "/api/2.1/ipnetworks/77/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []itportal.IPNetwork{{ID: 77, Name: "HQ Servers"}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	res, _, err := h.CreateIPNetwork(context.Background(), nil, CreateIPNetworkInput{
+		Name: "HQ Servers", CompanyID: 3, SiteID: 4, Network: "10.0.20.0/24",
+		Gateway: "10.0.20.1", DNS1: "10.0.20.10", DNS2: "1.1.1.1", VLAN: 20,
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("CreateIPNetwork = %v, %v", res, err)
+	}
+	for _, want := range []string{
+		`"company":{"id":3}`, `"site":{"id":4}`,
+		`"networkAddress":"10.0.20.0"`, `"subnetMask":"255.255.255.0"`,
+		`"defaultGateway":{"ip":"10.0.20.1"}`, `"dnsServer1":{"ip":"10.0.20.10"}`, `"dnsServer2":{"ip":"1.1.1.1"}`,
+		`"vlanId":20`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("posted body lacks %s:\n%s", want, body)
+		}
+	}
+	if text := resultText(t, res); !strings.Contains(text, "ID: 77") || !strings.Contains(text, "Default gateway: 10.0.20.1") {
+		t.Errorf("result = %q", text)
+	}
+
+	body = ""
+	if res, _, _ := h.CreateIPNetwork(context.Background(), nil, CreateIPNetworkInput{
+		Name: "Lab", CompanyID: 3, Network: "192.168.4.0", CIDR: 23, Gateway: "192.168.5.254",
+	}); res.IsError || !strings.Contains(body, `"subnetMask":"255.255.254.0"`) || strings.Contains(body, "dnsServer") {
+		t.Errorf("cidr form: %s, body %s", resultText(t, res), body)
+	}
+}
+
+func TestCreateIPNetworkRejectsBadRanges(t *testing.T) {
+	h := newHandler("http://unused.invalid")
+	for name, c := range map[string]struct {
+		in   CreateIPNetworkInput
+		want string
+	}{
+		"no prefix":      {CreateIPNetworkInput{Network: "10.0.0.0"}, "field network"},
+		"two prefixes":   {CreateIPNetworkInput{Network: "10.0.0.0/24", SubnetMask: "255.255.255.0"}, "field network"},
+		"host bits":      {CreateIPNetworkInput{Network: "10.0.0.5/24"}, "the network is 10.0.0.0/24"},
+		"bad mask":       {CreateIPNetworkInput{Network: "10.0.0.0", SubnetMask: "255.0.255.0"}, "not a valid network"},
+		"gateway out":    {CreateIPNetworkInput{Network: "10.0.0.0/24", Gateway: "10.0.1.1"}, "outside 10.0.0.0/24"},
+		"dns not an IP":  {CreateIPNetworkInput{Network: "10.0.0.0/24", DNS1: "dns.example"}, "field dns1"},
+		"vlan too large": {CreateIPNetworkInput{Network: "10.0.0.0/24", VLAN: 5000}, "field vlan"},
+	} {
+		c.in.Name, c.in.CompanyID = "n", 1
+		res, _, err := h.CreateIPNetwork(context.Background(), nil, c.in)
+		if err != nil || !res.IsError || !strings.Contains(resultText(t, res), c.want) {
+			t.Errorf("%s: %v, %v; want an error mentioning %q", name, resultText(t, res), err, c.want)
+		}
+	}
+}
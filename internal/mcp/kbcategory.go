@@ -0,0 +1,175 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- list_kb_categories ----
+
+type ListKBCategoriesInput struct {
+	Name string `json:"name,omitempty" jsonschema:"Optional: only show categories whose name, or one of whose subcategory names, contains this text"`
+}
+
+// kbCategoriesResult is list_kb_categories' structured output; MCP wants an
+// object there, not a bare list.
+type kbCategoriesResult struct {
+	Categories []itportal.KBCategory `json:"categories"`
+}
+
+// ListKBCategories lists the KB categories with their subcategories nested
+// under them, as create_kb_article's category_id and sub_category_id need.
+func (h *Handler) ListKBCategories(ctx context.Context, _ *sdkmcp.CallToolRequest, input ListKBCategoriesInput) (*sdkmcp.CallToolResult, any, error) {
+	cats, err := h.client.ListKBCategories(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list KB categories: %w", err)
+	}
+	if q := strings.ToLower(strings.TrimSpace(input.Name)); q != "" {
+		var matched []itportal.KBCategory
+		for _, c := range cats {
+			if kbCategoryMatches(c, q) {
+				matched = append(matched, c)
+			}
+		}
+		cats = matched
+	}
+	if len(cats) == 0 {
+		if input.Name != "" {
+			return toolText(fmt.Sprintf("No KB category or subcategory matches %q.", input.Name)), nil, nil
+		}
+		return toolText("No KB categories are defined. Create one with manage_kb_category."), nil, nil
+	}
+	return toolText(fmt.Sprintf("KB categories (%d):\n%s\nPass category_id and sub_category_id to create_kb_article.",
+		len(cats), formatKBCategories(cats))), kbCategoriesResult{Categories: cats}, nil
+}
+
+func kbCategoryMatches(c itportal.KBCategory, q string) bool {
+	if strings.Contains(strings.ToLower(c.Name), q) {
+		return true
+	}
+	for _, s := range c.SubCategories {
+		if strings.Contains(strings.ToLower(s.Name), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatKBCategories renders categories as an indented tree, one line each.
+func formatKBCategories(cats []itportal.KBCategory) string {
+	var b strings.Builder
+	for _, c := range cats {
+		fmt.Fprintf(&b, "- %s (category_id %d)", c.Name, c.ID)
+		if len(c.SubCategories) == 0 {
+			b.WriteString(" — no subcategories")
+		}
+		b.WriteString("\n")
+		for _, s := range c.SubCategories {
+			fmt.Fprintf(&b, "  - %s (sub_category_id %d)\n", s.Name, s.ID)
+		}
+	}
+	return b.String()
+}
+
+// checkKBCategory verifies categoryID (and subCategoryID, when set) name a KB
+// category and one of its own subcategories. It returns nil when they do, or a
+// tool error listing the valid choices.
+func (h *Handler) checkKBCategory(ctx context.Context, categoryID, subCategoryID int) (*sdkmcp.CallToolResult, error) {
+	if categoryID == 0 && subCategoryID == 0 {
+		return nil, nil
+	}
+	if categoryID == 0 {
+		return validationResult(&fieldError{Field: "category_id", Reason: "required with sub_category_id"}), nil
+	}
+	cats, err := h.client.ListKBCategories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list KB categories: %w", err)
+	}
+	var problem string
+	for _, c := range cats {
+		if c.ID != categoryID {
+			continue
+		}
+		if subCategoryID == 0 {
+			return nil, nil
+		}
+		for _, s := range c.SubCategories {
+			if s.ID == subCategoryID {
+				return nil, nil
+			}
+		}
+		problem = fmt.Sprintf("sub_category_id %d is not a subcategory of %s (category_id %d).", subCategoryID, c.Name, c.ID)
+		break
+	}
+	if problem == "" {
+		problem = fmt.Sprintf("category_id %d is not a KB category.", categoryID)
+	}
+	if len(cats) == 0 {
+		return toolError(problem + " No KB categories are defined; create one with manage_kb_category."), nil
+	}
+	return toolError(problem + " Valid categories:\n" + formatKBCategories(cats)), nil
+}
+
+// ---- recategorize_kb ----
+
+type RecategorizeKBInput struct {
+	KBID          string `json:"kb_id" jsonschema:"Required. ID of the KB article to move"`
+	CategoryID    int    `json:"category_id,omitempty" jsonschema:"New KB category ID (see list_kb_categories)"`
+	SubCategoryID int    `json:"sub_category_id,omitempty" jsonschema:"New KB subcategory ID; must belong to category_id (see list_kb_categories)"`
+	CompanyID     int    `json:"company_id,omitempty" jsonschema:"Move the article to this company"`
+	Public        *bool  `json:"public,omitempty" jsonschema:"Optional: set (true) or clear (false) public visibility"`
+}
+
+// RecategorizeKB moves a KB article to another category, subcategory and/or
+// company, and optionally flips its public flag, in one PATCH of nested
+// references. The category pair is checked against the live category list.
+func (h *Handler) RecategorizeKB(ctx context.Context, _ *sdkmcp.CallToolRequest, input RecategorizeKBInput) (*sdkmcp.CallToolResult, any, error) {
+	var change *fieldError
+	if input.CategoryID == 0 && input.SubCategoryID == 0 && input.CompanyID == 0 && input.Public == nil {
+		change = &fieldError{Field: "category_id", Reason: "give at least one of category_id, sub_category_id, company_id or public"}
+	}
+	if res := validationResult(
+		validateRequired("kb_id", input.KBID),
+		validateNumericID("kb_id", input.KBID),
+		change,
+	); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite("kb"); res != nil {
+		return res, nil, nil
+	}
+	if res, err := h.checkKBCategory(ctx, input.CategoryID, input.SubCategoryID); res != nil || err != nil {
+		return res, nil, err
+	}
+
+	fields := map[string]interface{}{}
+	var changed []string
+	if input.CategoryID != 0 {
+		fields["category"] = map[string]int{"id": input.CategoryID}
+		changed = append(changed, fmt.Sprintf("category_id %d", input.CategoryID))
+	}
+	if input.SubCategoryID != 0 {
+		fields["subCategory"] = map[string]int{"id": input.SubCategoryID}
+		changed = append(changed, fmt.Sprintf("sub_category_id %d", input.SubCategoryID))
+	}
+	if input.CompanyID != 0 {
+		fields["company"] = map[string]int{"id": input.CompanyID}
+		changed = append(changed, fmt.Sprintf("company_id %d", input.CompanyID))
+	}
+	if input.Public != nil {
+		fields["public"] = *input.Public
+		changed = append(changed, fmt.Sprintf("public %t", *input.Public))
+	}
+
+	id := strings.TrimSpace(input.KBID)
+	if err := h.client.UpdateKB(ctx, id, fields); err != nil {
+		return nil, nil, fmt.Errorf("recategorize KB %s: %w", id, err)
+	}
+	h.mergeUpdated(ctx, "kb", id)
+	return toolText(fmt.Sprintf("KB article %s updated: %s.", id, strings.Join(changed, ", "))), nil, nil
+}
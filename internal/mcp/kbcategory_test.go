@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// kbCategoryServer defines Network (4: Firewalls 41, Switching 42) and
+// Procedures (5) and counts the KB articles posted.
+func kbCategoryServer(t *testing.T, posts *int) *Handler {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case path == "/categories/kb/":
+			writeList(w, []itportal.KBCategory{
+				{ID: 4, Name: "Network", SubCategories: []itportal.KBSubCategory{{ID: 41, Name: "Firewalls"}, {ID: 42, Name: "Switching"}}},
+				{ID: 5, Name: "Procedures"},
+			}, "")
+		case r.Method == http.MethodPost && path == "/kbs/":
+			*posts++
+			w.Header().Set("Location", "/api/2.1/kbs/60/")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeList(w, []itportal.KB{{ID: 60, Name: "VPN setup"}}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return newHandler(srv.URL)
+}
+
+func TestCreateKBArticleChecksCategory(t *testing.T) {
+	var posts int
+	h := kbCategoryServer(t, &posts)
+	ctx := context.Background()
+
+	res, _, err := h.CreateKBArticle(ctx, nil, CreateKBArticleInput{CompanyID: 1, Name: "VPN setup", CategoryID: 4, SubCategoryID: 41})
+	if err != nil || res.IsError || posts != 1 {
+		t.Fatalf("valid category refused: %v, %v (posts %d)", res, err, posts)
+	}
+
+	for name, c := range map[string]struct {
+		in   CreateKBArticleInput
+		want string
+	}{
+		"unknown category":    {CreateKBArticleInput{CompanyID: 1, Name: "x", CategoryID: 9, SubCategoryID: 41}, "category_id 9 is not a KB category"},
+		"foreign subcategory": {CreateKBArticleInput{CompanyID: 1, Name: "x", CategoryID: 5, SubCategoryID: 41}, "not a subcategory of Procedures"},
+		"subcategory alone":   {CreateKBArticleInput{CompanyID: 1, Name: "x", SubCategoryID: 41}, "field category_id"},
+	} {
+		res, _, err := h.CreateKBArticle(ctx, nil, c.in)
+		if err != nil || !res.IsError {
+			t.Errorf("%s: want a tool error, got %v, %v", name, res, err)
+			continue
+		}
+		if got := resultText(t, res); !strings.Contains(got, c.want) {
+			t.Errorf("%s: error %q lacks %q", name, got, c.want)
+		}
+	}
+	res, _, _ = h.CreateKBArticle(ctx, nil, CreateKBArticleInput{CompanyID: 1, Name: "x", CategoryID: 9})
+	if got := resultText(t, res); !strings.Contains(got, "Firewalls (sub_category_id 41)") {
+		t.Errorf("refusal does not list the valid options:\n%s", got)
+	}
+	if posts != 1 {
+		t.Errorf("invalid categories posted %d articles", posts-1)
+	}
+}
+
+func TestListKBCategoriesTree(t *testing.T) {
+	var posts int
+	h := kbCategoryServer(t, &posts)
+
+	res, out, err := h.ListKBCategories(context.Background(), nil, ListKBCategoriesInput{})
+	if err != nil {
+		t.Fatalf("ListKBCategories: %v", err)
+	}
+	if r, ok := out.(kbCategoriesResult); !ok || len(r.Categories) != 2 {
+		t.Errorf("structured output = %#v, want an object holding the two categories", out)
+	}
+	want := "- Network (category_id 4)\n  - Firewalls (sub_category_id 41)\n  - Switching (sub_category_id 42)\n- Procedures (category_id 5) — no subcategories\n"
+	if got := resultText(t, res); !strings.Contains(got, want) {
+		t.Errorf("tree = %q, want it to contain %q", got, want)
+	}
+
+	res, _, _ = h.ListKBCategories(context.Background(), nil, ListKBCategoriesInput{Name: "switch"})
+	if got := resultText(t, res); !strings.Contains(got, "Network") || strings.Contains(got, "Procedures") {
+		t.Errorf("name filter = %q, want only Network", got)
+	}
+}
+
+func TestRecategorizeKBSendsNestedReferences(t *testing.T) {
+	var patches []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case path == "/categories/kb/":
+			writeList(w, []itportal.KBCategory{
+				{ID: 4, Name: "Network", SubCategories: []itportal.KBSubCategory{{ID: 41, Name: "Firewalls"}}},
+			}, "")
+		case r.Method == http.MethodPatch && path == "/kbs/60/":
+			body, _ := io.ReadAll(r.Body)
+			patches = append(patches, string(body))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeList(w, []itportal.KB{{ID: 60, Name: "VPN setup"}}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	public := false
+	res, _, err := h.RecategorizeKB(ctx, nil, RecategorizeKBInput{KBID: "60", CategoryID: 4, SubCategoryID: 41, CompanyID: 7, Public: &public})
+	if err != nil || res.IsError {
+		t.Fatalf("RecategorizeKB: %v, %v", res, err)
+	}
+	if len(patches) != 1 {
+		t.Fatalf("want one PATCH, got %d", len(patches))
+	}
+	for _, want := range []string{`"category":{"id":4}`, `"subCategory":{"id":41}`, `"company":{"id":7}`, `"public":false`} {
+		if !strings.Contains(patches[0], want) {
+			t.Errorf("PATCH body %s lacks %s", patches[0], want)
+		}
+	}
+
+	for name, in := range map[string]RecategorizeKBInput{
+		"unknown category": {KBID: "60", CategoryID: 9},
+		"no change":        {KBID: "60"},
+		"bad id":           {KBID: "x", CompanyID: 7},
+	} {
+		res, _, err := h.RecategorizeKB(ctx, nil, in)
+		if err != nil || !res.IsError {
+			t.Errorf("%s: want a tool error, got %v, %v", name, res, err)
+		}
+	}
+	if len(patches) != 1 {
+		t.Errorf("rejected calls sent %d extra PATCHes", len(patches)-1)
+	}
+}
@@ -0,0 +1,99 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+)
+
+// ---- list_devices_by_lifecycle ----
+
+type ListDevicesByLifecycleInput struct {
+	State     string `json:"state" jsonschema:"Required. One of: active, retired, lease_ended, warranty_expired"`
+	CompanyID int    `json:"company_id,omitempty" jsonschema:"Optional: only devices of this company"`
+}
+
+// lifecycleDevice is one device in a list_devices_by_lifecycle result.
+type lifecycleDevice struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Company         string `json:"company,omitempty"`
+	RetireDate      string `json:"retire_date,omitempty"`
+	LeaseEndDate    string `json:"lease_end_date,omitempty"`
+	WarrantyExpires string `json:"warranty_expires,omitempty"`
+	URL             string `json:"url,omitempty"`
+}
+
+// lifecycleStates are the state argument spellings, keyed by their normalised form.
+var lifecycleStates = func() map[string]cache.Lifecycle {
+	m := map[string]cache.Lifecycle{}
+	for _, l := range cache.Lifecycles {
+		m[lifecycleKey(string(l))] = l
+	}
+	return m
+}()
+
+func lifecycleKey(s string) string {
+	return normType(strings.ReplaceAll(s, " ", ""))
+}
+
+// ListDevicesByLifecycle lists the cached devices in one derived lifecycle
+// state (see cache.DeviceLifecycle), as of the snapshot's build.
+func (h *Handler) ListDevicesByLifecycle(ctx context.Context, _ *sdkmcp.CallToolRequest, input ListDevicesByLifecycleInput) (*sdkmcp.CallToolResult, any, error) {
+	state, ok := lifecycleStates[lifecycleKey(input.State)]
+	if !ok {
+		return validationResult(validateOneOf("state", input.State, "active", "retired", "lease_ended", "warranty_expired")), nil, nil
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+
+	input.CompanyID = h.companyOr(input.CompanyID)
+	devices := []lifecycleDevice{}
+	for _, d := range snap.Devices {
+		if input.CompanyID != 0 && (d.Company == nil || d.Company.ID != input.CompanyID) {
+			continue
+		}
+		if snap.DeviceLifecycle(d.ID) != state {
+			continue
+		}
+		ld := lifecycleDevice{
+			ID:              d.ID,
+			Name:            d.Name,
+			RetireDate:      d.RetireDate,
+			LeaseEndDate:    d.LeaseEndDate,
+			WarrantyExpires: d.WarrantyExpires,
+			URL:             d.URL,
+		}
+		if d.Company != nil {
+			ld.Company = d.Company.Name
+		}
+		devices = append(devices, ld)
+	}
+	if len(devices) == 0 {
+		return toolText(fmt.Sprintf("No cached devices are in lifecycle state %q.", state)), nil, nil
+	}
+
+	out, err := json.MarshalIndent(struct {
+		State   cache.Lifecycle   `json:"state"`
+		AsOf    string            `json:"as_of"`
+		Count   int               `json:"count"`
+		Devices []lifecycleDevice `json:"devices"`
+	}{
+		State:   state,
+		AsOf:    snap.GeneratedAt.Format("2006-01-02"),
+		Count:   len(devices),
+		Devices: devices,
+	}, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal lifecycle devices: %w", err)
+	}
+	return toolText(string(out)), nil, nil
+}
@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestListDevicesByLifecycle(t *testing.T) {
+	past := time.Now().AddDate(0, -2, 0).Format("2006-01-02")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/devices/") {
+			writeList(w, []itportal.Device{
+				{ID: 1, Name: "nas", Company: &itportal.CompanyReference{ID: 5, Name: "Acme"}, LeaseEndDate: past},
+				{ID: 2, Name: "fw", Company: &itportal.CompanyReference{ID: 5, Name: "Acme"}},
+				{ID: 3, Name: "srv", Company: &itportal.CompanyReference{ID: 6, Name: "Other"}, LeaseEndDate: past},
+			}, "")
+			return
+		}
+		writeList(w, []any{}, "")
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c}
+
+	res, _, err := h.ListDevicesByLifecycle(context.Background(), nil, ListDevicesByLifecycleInput{State: "Lease ended", CompanyID: 5})
+	if err != nil || res.IsError {
+		t.Fatalf("ListDevicesByLifecycle: err=%v res=%v", err, res)
+	}
+	var out struct {
+		State   string            `json:"state"`
+		Devices []lifecycleDevice `json:"devices"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.State != "Lease ended" || len(out.Devices) != 1 || out.Devices[0].ID != 1 || out.Devices[0].Company != "Acme" {
+		t.Errorf("result = %+v, want just device 1", out)
+	}
+
+	res, _, _ = h.ListDevicesByLifecycle(context.Background(), nil, ListDevicesByLifecycleInput{State: "active"})
+	if text := resultText(t, res); !strings.Contains(text, `"id": 2`) || strings.Contains(text, `"id": 1`) {
+		t.Errorf("active devices = %s", text)
+	}
+	res, _, _ = h.ListDevicesByLifecycle(context.Background(), nil, ListDevicesByLifecycleInput{State: "broken"})
+	if !res.IsError {
+		t.Error("unknown state not rejected")
+	}
+}
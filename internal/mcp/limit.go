@@ -0,0 +1,66 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ToolLimiter caps how many tool calls run at once across every instance, so
+// one agent firing dozens of parallel calls cannot flood ITPortal. Calls over
+// the cap queue for a free slot and are rejected if none frees up in time.
+type ToolLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// NewToolLimiter returns a ToolLimiter running at most max calls at once. An
+// excess call waits up to wait for a slot; wait 0 rejects it at once. max <= 0
+// returns nil, which limits nothing.
+func NewToolLimiter(max int, wait time.Duration) *ToolLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ToolLimiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+// WithToolLimiter runs every tool call through l.
+func WithToolLimiter(l *ToolLimiter) Option {
+	return func(h *Handler) { h.limiter = l }
+}
+
+// WithToolTimeout gives every tool call a deadline of d; a call still running
+// then is cancelled and reported as timed out. d <= 0 sets no deadline.
+func WithToolTimeout(d time.Duration) Option {
+	return func(h *Handler) { h.toolTimeout = d }
+}
+
+// Acquire takes a slot for one tool call, queueing up to the configured wait.
+// It returns the func that frees the slot, or an error when the call should be
+// rejected: no slot freed in time, or ctx ended first.
+func (l *ToolLimiter) Acquire(ctx context.Context) (func(), error) {
+	release := func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if l.wait <= 0 {
+		return nil, l.busy()
+	}
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, l.busy()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// busy is the error for a call rejected over the limit.
+func (l *ToolLimiter) busy() error {
+	return fmt.Errorf("too many concurrent tool calls (limit %d); retry shortly or make fewer calls in parallel", cap(l.slots))
+}
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestToolLimiterRejectsOverLimit(t *testing.T) {
+	l := NewToolLimiter(2, 0)
+	ctx := context.Background()
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("call %d within the limit rejected: %v", i+1, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := l.Acquire(ctx); err == nil || !strings.Contains(err.Error(), "limit 2") {
+		t.Fatalf("third call = %v, want a too-many-calls error", err)
+	}
+
+	releases[0]()
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("call after a release rejected: %v", err)
+	}
+	release()
+	releases[1]()
+}
+
+func TestToolLimiterQueuesUntilSlotFrees(t *testing.T) {
+	l := NewToolLimiter(1, 2*time.Second)
+	ctx := context.Background()
+	first, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(30*time.Millisecond, first)
+
+	start := time.Now()
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("queued call rejected: %v", err)
+	}
+	defer release()
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("queued call ran after %s, before the slot freed", waited)
+	}
+
+	short := NewToolLimiter(1, 20*time.Millisecond)
+	hold, _ := short.Acquire(ctx)
+	defer hold()
+	if _, err := short.Acquire(ctx); err == nil {
+		t.Error("call queued past the wait was not rejected")
+	}
+}
+
+func TestNewToolLimiterUnlimited(t *testing.T) {
+	if l := NewToolLimiter(0, time.Second); l != nil {
+		t.Errorf("NewToolLimiter(0) = %v, want nil", l)
+	}
+}
+
+// TestToolTimeoutCancelsSlowCall runs a tool against an ITPortal that stalls
+// and verifies the call ends at the deadline with a timeout error.
+func TestToolTimeoutCancelsSlowCall(t *testing.T) {
+	_, c, _ := fakeInstance(t, "Alpha")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	server := NewServer(itportal.NewClient(srv.URL, "secret"), c, WithToolTimeout(100*time.Millisecond))
+	cs := connect(t, server)
+
+	start := time.Now()
+	res, err := cs.CallTool(context.Background(), &sdkmcp.CallToolParams{Name: "get_entity_details",
+		Arguments: map[string]any{"entity_type": "company", "id": "1"}})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("call took %s, want about the 100ms deadline", elapsed)
+	}
+	if got := resultText(t, res); !res.IsError || !strings.Contains(got, "get_entity_details timed out after 100ms") {
+		t.Errorf("result = %q (error %t), want a timeout error", got, res.IsError)
+	}
+}
+
+// TestToolTimeoutSparesMultiWriteTools verifies import_csv runs past the tool
+// deadline and reports every row it created.
+func TestToolTimeoutSparesMultiWriteTools(t *testing.T) {
+	_, c, _ := fakeInstance(t, "Alpha")
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeList(w, []itportal.Site{{ID: 100}}, "")
+			return
+		}
+		time.Sleep(80 * time.Millisecond)
+		w.Header().Set("Location", fmt.Sprintf("/api/2.1/sites/%d/", 100+posts.Add(1)))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	server := NewServer(itportal.NewClient(srv.URL, "secret"), c, WithToolTimeout(100*time.Millisecond))
+	cs := connect(t, server)
+
+	csv := base64.StdEncoding.EncodeToString([]byte("Site\nA\nB\nC\n"))
+	res, err := cs.CallTool(context.Background(), &sdkmcp.CallToolParams{Name: "import_csv",
+		Arguments: map[string]any{"entity_type": "site", "csv_base64": csv, "mapping": map[string]string{"Site": "name"}}})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if res.IsError || posts.Load() != 3 || !strings.Contains(resultText(t, res), `"created": 3`) {
+		t.Errorf("result = %q after %d POSTs, want all 3 rows created", resultText(t, res), posts.Load())
+	}
+}
@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Write merging: with SNAPSHOT_MERGE_WRITES the write tools patch the entity
+// they touched into the in-memory snapshot, so search_docs and the resources
+// reflect it straight away. Merging is best-effort; the next refresh replaces
+// the snapshot regardless.
+
+// mergeWritten merges a created or re-fetched entity into the snapshot.
+func (h *Handler) mergeWritten(v any) {
+	if h.cache != nil {
+		h.cache.Upsert(v)
+	}
+}
+
+// mergeUpdated re-fetches an entity after a PATCH and merges the result. The
+// fetch is skipped when merging is off; a failed fetch leaves the snapshot as
+// it was.
+func (h *Handler) mergeUpdated(ctx context.Context, entityType, id string) {
+	if h.cache == nil || !h.cache.MergesWrites() {
+		return
+	}
+	v, ok, err := h.getByType(ctx, entityType, strings.TrimSpace(id))
+	if ok && err == nil {
+		h.mergeWritten(v)
+	}
+}
+
+// getByType fetches one entity of entityType (any alias normType accepts) by
+// ID. ok is false for a type with no single-record endpoint.
+func (h *Handler) getByType(ctx context.Context, entityType, id string) (v any, ok bool, err error) {
+	switch normType(entityType) {
+	case "company":
+		v, err = h.client.GetCompany(ctx, id)
+	case "site":
+		v, err = h.client.GetSite(ctx, id)
+	case "device":
+		v, err = h.client.GetDevice(ctx, id)
+	case "kb", "knowledgebase":
+		v, err = h.client.GetKB(ctx, id)
+	case "contact":
+		v, err = h.client.GetContact(ctx, id)
+	case "account":
+		v, err = h.client.GetAccount(ctx, id)
+	case "agreement":
+		v, err = h.client.GetAgreement(ctx, id)
+	case "document":
+		v, err = h.client.GetDocument(ctx, id)
+	case "facility":
+		v, err = h.client.GetFacility(ctx, id)
+	case "cabinet":
+		v, err = h.client.GetCabinet(ctx, id)
+	case "configuration":
+		v, err = h.client.GetConfiguration(ctx, id)
+	case "ipnetwork":
+		v, err = h.client.GetIPNetwork(ctx, id)
+	default:
+		return nil, false, nil
+	}
+	return v, true, err
+}
+
+// mergeDeleted drops a deleted entity from the snapshot.
+func (h *Handler) mergeDeleted(entityType, id string) {
+	if h.cache == nil {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(id))
+	if err != nil {
+		return
+	}
+	h.cache.Remove(normType(entityType), n)
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// mergeHandler serves an empty tenant that accepts device 77 ("nas-backup01")
+// on create, and returns it renamed once a PATCH has been seen.
+func mergeHandler(t *testing.T, opts ...cache.Option) *Handler {
+	t.Helper()
+	renamed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case r.Method == http.MethodPost && path == "/devices/":
+			w.Header().Set("Location", "/api/2.1/devices/77/")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPatch && path == "/devices/77/":
+			renamed = true
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete && path == "/devices/77/":
+			w.WriteHeader(http.StatusNoContent)
+		case path == "/devices/77/":
+			name := "nas-backup01"
+			if renamed {
+				name = "nas-archive01"
+			}
+			writeList(w, []itportal.Device{{ID: 77, Name: name, HostName: "nas-backup01", Company: &itportal.CompanyReference{ID: 3}}}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := itportal.NewClient(srv.URL, "secret")
+	opts = append(opts, cache.WithStorePath(filepath.Join(t.TempDir(), "merge.db")))
+	c, err := cache.New(context.Background(), client, 100, 100, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), opts...)
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	return &Handler{client: client, cache: c, baseURL: srv.URL}
+}
+
+// searchFinds reports whether search_docs returns a hit for query.
+func searchFinds(t *testing.T, h *Handler, query string) bool {
+	t.Helper()
+	res, _, err := h.SearchDocs(context.Background(), nil, SearchDocsInput{Query: query})
+	if err != nil {
+		t.Fatalf("SearchDocs(%q): %v", query, err)
+	}
+	return !strings.HasPrefix(resultText(t, res), "No results")
+}
+
+func TestCreatedDeviceIsSearchableWithWriteMerge(t *testing.T) {
+	h := mergeHandler(t, cache.WithWriteMerge())
+	ctx := context.Background()
+
+	if searchFinds(t, h, "nas-backup01") {
+		t.Fatal("device found before it was created")
+	}
+	if _, _, err := h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 3, Name: "nas-backup01"}); err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+	if !searchFinds(t, h, "nas-backup01") {
+		t.Fatal("created device not found by search_docs")
+	}
+	if !strings.Contains(h.cache.Get().Markdown, "nas-backup01") {
+		t.Error("created device missing from the snapshot markdown")
+	}
+
+	if _, _, err := h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: "device", ID: "77", Fields: map[string]interface{}{"name": "nas-archive01"}}); err != nil {
+		t.Fatalf("UpdateEntity: %v", err)
+	}
+	if !searchFinds(t, h, "nas-archive01") {
+		t.Error("updated name not found by search_docs")
+	}
+	if n := len(h.cache.Get().Devices); n != 1 {
+		t.Errorf("update should replace the device, have %d devices", n)
+	}
+
+	if _, _, err := h.DeleteEntity(ctx, nil, DeleteEntityInput{EntityType: "device", ID: "77"}); err != nil {
+		t.Fatalf("DeleteEntity: %v", err)
+	}
+	if searchFinds(t, h, "nas-archive01") {
+		t.Error("deleted device still found by search_docs")
+	}
+}
+
+func TestWriteMergeOffByDefault(t *testing.T) {
+	h := mergeHandler(t)
+	if _, _, err := h.CreateDevice(context.Background(), nil, CreateDeviceInput{CompanyID: 3, Name: "nas-backup01"}); err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+	if searchFinds(t, h, "nas-backup01") {
+		t.Error("device merged into the snapshot without WithWriteMerge")
+	}
+}
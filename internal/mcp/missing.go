@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- devices_missing_data ----
+
+// missingChecks are the device fields devices_missing_data can check, each
+// reporting whether a device has it recorded. "ip" is absent: device IPs are
+// a sub-resource the snapshot does not cache.
+var missingChecks = map[string]func(d *itportal.Device) bool{
+	"serial":       func(d *itportal.Device) bool { return strings.TrimSpace(d.Serial) != "" },
+	"type":         func(d *itportal.Device) bool { return d.Type != nil && strings.TrimSpace(d.Type.Name) != "" },
+	"location":     func(d *itportal.Device) bool { return strings.TrimSpace(d.Location) != "" },
+	"site":         func(d *itportal.Device) bool { return d.Site != nil && d.Site.ID != 0 },
+	"manufacturer": func(d *itportal.Device) bool { return strings.TrimSpace(d.Manufacturer) != "" },
+	"model":        func(d *itportal.Device) bool { return strings.TrimSpace(d.Model) != "" },
+}
+
+// defaultMissingFields are checked when the fields input is empty.
+var defaultMissingFields = []string{"serial", "type", "ip", "location"}
+
+type DevicesMissingDataInput struct {
+	Fields    []string `json:"fields,omitempty" jsonschema:"Fields to check, any of: serial, type, ip, location, site, manufacturer, model (default serial, type, ip, location)"`
+	CompanyID int      `json:"company_id,omitempty" jsonschema:"Optional: only devices of this company"`
+}
+
+// missingDevice is one device lacking at least one checked field.
+type missingDevice struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Missing []string `json:"missing"`
+	URL     string   `json:"url,omitempty"`
+}
+
+// missingCompany groups a company's incomplete devices.
+type missingCompany struct {
+	CompanyID int             `json:"company_id,omitempty"`
+	Company   string          `json:"company"`
+	Devices   []missingDevice `json:"devices"`
+}
+
+// DevicesMissingData scans the cached devices for ones lacking the checked
+// fields and lists them grouped by company, for documentation clean-up.
+func (h *Handler) DevicesMissingData(ctx context.Context, _ *sdkmcp.CallToolRequest, input DevicesMissingDataInput) (*sdkmcp.CallToolResult, any, error) {
+	fields := input.Fields
+	if len(fields) == 0 {
+		fields = defaultMissingFields
+	}
+	var checked, unchecked []string
+	var errs []*fieldError
+	for _, f := range fields {
+		f = strings.ToLower(strings.TrimSpace(f))
+		switch {
+		case f == "ip":
+			unchecked = append(unchecked, f)
+		case missingChecks[f] != nil:
+			if !slices.Contains(checked, f) {
+				checked = append(checked, f)
+			}
+		default:
+			errs = append(errs, validateOneOf("fields", f, "serial", "type", "ip", "location", "site", "manufacturer", "model"))
+		}
+	}
+	if res := validationResult(errs...); res != nil {
+		return res, nil, nil
+	}
+	if len(checked) == 0 {
+		return toolError("device IPs are not cached in the snapshot, so ip cannot be checked on its own; add serial, type, location, site, manufacturer or model"), nil, nil
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+
+	input.CompanyID = h.companyOr(input.CompanyID)
+	groups, scanned := devicesMissingData(snap.Devices, checked, input.CompanyID)
+	count := 0
+	for _, g := range groups {
+		count += len(g.Devices)
+	}
+	var note string
+	if len(unchecked) > 0 {
+		note = "ip not checked: device IPs are not cached in the snapshot; use get_entity_details for a device's IPs"
+	}
+	return marshalResult(struct {
+		Checked   []string         `json:"checked"`
+		Note      string           `json:"note,omitempty"`
+		Scanned   int              `json:"scanned"`
+		Count     int              `json:"count"`
+		Companies []missingCompany `json:"companies"`
+	}{checked, note, scanned, count, groups})
+}
+
+// devicesMissingData collects the devices (of companyID, when set) lacking any
+// of fields, grouped by company. Companies are ordered by name and devices by
+// name; scanned is how many devices were checked.
+func devicesMissingData(devices []itportal.Device, fields []string, companyID int) (groups []missingCompany, scanned int) {
+	byCompany := map[int]*missingCompany{}
+	for i := range devices {
+		d := &devices[i]
+		if companyID != 0 && (d.Company == nil || d.Company.ID != companyID) {
+			continue
+		}
+		scanned++
+		var missing []string
+		for _, f := range fields {
+			if !missingChecks[f](d) {
+				missing = append(missing, f)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		key, name := 0, "(no company)"
+		if d.Company != nil && d.Company.ID != 0 {
+			key, name = d.Company.ID, cache.FirstNonEmpty(d.Company.Name, fmt.Sprintf("Company %d", d.Company.ID))
+		}
+		g := byCompany[key]
+		if g == nil {
+			g = &missingCompany{CompanyID: key, Company: name}
+			byCompany[key] = g
+		}
+		g.Devices = append(g.Devices, missingDevice{ID: d.ID, Name: d.Name, Missing: missing, URL: d.URL})
+	}
+
+	groups = make([]missingCompany, 0, len(byCompany))
+	for _, g := range byCompany {
+		sort.SliceStable(g.Devices, func(i, j int) bool {
+			return strings.ToLower(g.Devices[i].Name) < strings.ToLower(g.Devices[j].Name)
+		})
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].Company) < strings.ToLower(groups[j].Company)
+	})
+	return groups, scanned
+}
@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestDevicesMissingData verifies devices lacking a checked field are flagged
+// with what they miss, complete ones are not, and only the requested fields
+// are checked.
+func TestDevicesMissingData(t *testing.T) {
+	acme := &itportal.CompanyReference{ID: 1, Name: "Acme"}
+	beta := &itportal.CompanyReference{ID: 2, Name: "Beta"}
+	server := &itportal.TypeItem{Name: "Server"}
+	devices := []itportal.Device{
+		{ID: 1, Name: "complete", Company: acme, Serial: "S1", Type: server, Location: "Rack 1"},
+		{ID: 2, Name: "no-serial", Company: acme, Serial: " ", Type: server, Location: "Rack 2"},
+		{ID: 3, Name: "bare", Company: beta},
+		{ID: 4, Name: "no-type", Company: beta, Serial: "S4", Type: &itportal.TypeItem{}, Location: "Closet"},
+	}
+
+	groups, scanned := devicesMissingData(devices, []string{"serial", "type", "location"}, 0)
+	if scanned != 4 || len(groups) != 2 || groups[0].Company != "Acme" || groups[1].Company != "Beta" {
+		t.Fatalf("groups = %+v (scanned %d), want Acme then Beta", groups, scanned)
+	}
+	if got := groups[0].Devices; len(got) != 1 || got[0].ID != 2 || !slices.Equal(got[0].Missing, []string{"serial"}) {
+		t.Errorf("Acme devices = %+v, want only no-serial missing serial", got)
+	}
+	if got := groups[1].Devices; len(got) != 2 || got[0].ID != 3 || !slices.Equal(got[0].Missing, []string{"serial", "type", "location"}) ||
+		got[1].ID != 4 || !slices.Equal(got[1].Missing, []string{"type"}) {
+		t.Errorf("Beta devices = %+v", got)
+	}
+
+	groups, scanned = devicesMissingData(devices, []string{"serial"}, 2)
+	if scanned != 2 || len(groups) != 1 || len(groups[0].Devices) != 1 || groups[0].Devices[0].ID != 3 {
+		t.Errorf("serial for company 2 = %+v (scanned %d), want only bare", groups, scanned)
+	}
+}
+
+func TestDevicesMissingDataRejectsUnknownField(t *testing.T) {
+	h := &Handler{}
+	res, _, err := h.DevicesMissingData(context.Background(), nil, DevicesMissingDataInput{Fields: []string{"serial", "colour"}})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), `"colour" is not one of`) {
+		t.Errorf("unknown field accepted: %v %v", res, err)
+	}
+	res, _, _ = h.DevicesMissingData(context.Background(), nil, DevicesMissingDataInput{Fields: []string{"ip"}})
+	if !res.IsError || !strings.Contains(resultText(t, res), "not cached") {
+		t.Errorf("ip alone accepted: %s", resultText(t, res))
+	}
+}
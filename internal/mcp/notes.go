@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- append_note ----
+
+type AppendNoteInput struct {
+	EntityType string `json:"entity_type" jsonschema:"One of: company, contact, account, agreement, ip_network, facility, cabinet, configuration. For devices use add_device_note."`
+	EntityID   string `json:"entity_id" jsonschema:"Numeric ID of the entity"`
+	Note       string `json:"note" jsonschema:"Plain-text line to append; it is prefixed with a UTC timestamp"`
+}
+
+// notesAccess reads and writes the Notes field of one entity type.
+type notesAccess struct {
+	get    func(c *itportal.Client, ctx context.Context, id string) (notes string, isHTML bool, err error)
+	update func(c *itportal.Client, ctx context.Context, id string, fields map[string]interface{}) error
+}
+
+// notesTargets lists the entity types with a Notes field, keyed by normType.
+// Only companies report notesHtml; the others store plain text.
+var notesTargets = map[string]notesAccess{
+	"company": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetCompany(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, v.NotesHtml, nil
+		},
+		update: (*itportal.Client).UpdateCompany,
+	},
+	"contact": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetContact(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateContact,
+	},
+	"account": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetAccount(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateAccount,
+	},
+	"agreement": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetAgreement(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateAgreement,
+	},
+	"ipnetwork": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetIPNetwork(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateIPNetwork,
+	},
+	"facility": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetFacility(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateFacility,
+	},
+	"cabinet": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetCabinet(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateCabinet,
+	},
+	"configuration": {
+		get: func(c *itportal.Client, ctx context.Context, id string) (string, bool, error) {
+			v, err := c.GetConfiguration(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return v.Notes, false, nil
+		},
+		update: (*itportal.Client).UpdateConfiguration,
+	},
+}
+
+// AppendNote adds a timestamped line to an entity's Notes field, keeping what
+// is already there. The API only replaces the whole field, so the current
+// notes are read first and the combined value is PATCHed back. HTML notes get
+// the line as an escaped paragraph.
+func (h *Handler) AppendNote(ctx context.Context, _ *sdkmcp.CallToolRequest, input AppendNoteInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateRequired("entity_id", input.EntityID),
+		validateNumericID("entity_id", input.EntityID),
+		validateRequired("note", input.Note),
+	); res != nil {
+		return res, nil, nil
+	}
+	typ := normType(input.EntityType)
+	if typ == "device" {
+		return toolError("devices keep notes as separate records; use add_device_note"), nil, nil
+	}
+	target, ok := notesTargets[typ]
+	if !ok {
+		return toolError(fmt.Sprintf("entity_type %q has no notes field. Valid values: company, contact, account, agreement, ip_network, facility, cabinet, configuration", input.EntityType)), nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+
+	id := strings.TrimSpace(input.EntityID)
+	current, isHTML, err := target.get(h.client, ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get %s %s: %w", input.EntityType, id, err)
+	}
+	combined := appendNoteLine(current, input.Note, isHTML, time.Now())
+	if err := target.update(h.client, ctx, id, map[string]interface{}{"notes": combined}); err != nil {
+		return nil, nil, fmt.Errorf("update %s %s notes: %w", input.EntityType, id, err)
+	}
+	return toolText(fmt.Sprintf("Note appended to %s %s.", input.EntityType, id)), nil, nil
+}
+
+// appendNoteLine returns notes with "[<UTC timestamp>] line" added at the end,
+// as a new line of text or, for HTML notes, a new paragraph.
+func appendNoteLine(notes, line string, isHTML bool, now time.Time) string {
+	entry := fmt.Sprintf("[%s] %s", now.UTC().Format("2006-01-02 15:04 UTC"), strings.TrimSpace(line))
+	if isHTML {
+		return notes + "<p>" + html.EscapeString(entry) + "</p>"
+	}
+	notes = strings.TrimRight(notes, "\n")
+	if notes == "" {
+		return entry
+	}
+	return notes + "\n" + entry
+}
@@ -0,0 +1,76 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAppendNoteKeepsExistingNotes verifies append_note reads the current
+// notes and PATCHes them back with the new timestamped line at the end, as
+// plain text for accounts and as an HTML paragraph for HTML company notes.
+func TestAppendNoteKeepsExistingNotes(t *testing.T) {
+	cases := []struct {
+		entityType string
+		path       string
+		record     string
+		want       []string
+	}{
+		{"account", "/api/2.1/accounts/9/", `{"id":9,"notes":"Shared mailbox.\nOwner: IT"}`,
+			[]string{"Shared mailbox.\nOwner: IT\n[", "] Password rotated"}},
+		{"company", "/api/2.1/companies/9/", `{"id":9,"notes":"<p>VIP client</p>","notesHtml":true}`,
+			[]string{"<p>VIP client</p><p>[", "] Password rotated &amp; logged</p>"}},
+		{"ip_network", "/api/2.1/ipnetworks/9/", `{"id":9}`,
+			[]string{"] Password rotated"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.entityType, func(t *testing.T) {
+			var patched map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tc.path {
+					t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if r.Method == http.MethodPatch {
+					_ = json.NewDecoder(r.Body).Decode(&patched)
+					_, _ = w.Write([]byte(`{"success":true,"data":{}}`))
+					return
+				}
+				writeList(w, []json.RawMessage{json.RawMessage(tc.record)}, "")
+			}))
+			defer srv.Close()
+
+			note := "Password rotated"
+			if tc.entityType == "company" {
+				note = "Password rotated & logged"
+			}
+			res, _, err := newHandler(srv.URL).AppendNote(context.Background(), nil, AppendNoteInput{EntityType: tc.entityType, EntityID: "9", Note: note})
+			if err != nil || res.IsError {
+				t.Fatalf("AppendNote: err=%v res=%v", err, res)
+			}
+			got, _ := patched["notes"].(string)
+			for _, w := range tc.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("patched notes %q missing %q", got, w)
+				}
+			}
+			if len(patched) != 1 {
+				t.Errorf("PATCH body = %v, want only notes", patched)
+			}
+		})
+	}
+}
+
+func TestAppendNoteLine(t *testing.T) {
+	now := time.Date(2026, 3, 4, 5, 6, 0, 0, time.UTC)
+	if got := appendNoteLine("", "first", false, now); got != "[2026-03-04 05:06 UTC] first" {
+		t.Errorf("empty notes: %q", got)
+	}
+	if got := appendNoteLine("a\n", " b ", false, now); got != "a\n[2026-03-04 05:06 UTC] b" {
+		t.Errorf("plain notes: %q", got)
+	}
+}
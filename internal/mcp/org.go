@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- company_org ----
+
+// orgUnassigned heads the contacts that have no contact type.
+const orgUnassigned = "No role"
+
+type CompanyOrgInput struct {
+	CompanyID int `json:"company_id" jsonschema:"Required. ID of the company whose contacts to group by role"`
+}
+
+// CompanyOrg renders a company's cached contacts grouped by contact type (their
+// role, e.g. Technical, Billing, Management), with emails and phone numbers.
+func (h *Handler) CompanyOrg(ctx context.Context, _ *sdkmcp.CallToolRequest, input CompanyOrgInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(validateRequired("company_id", input.CompanyID)); res != nil {
+		return res, nil, nil
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+	out, ok := renderCompanyOrg(snap, input.CompanyID)
+	if !ok {
+		return toolError(fmt.Sprintf("company_id %d is not in the snapshot; check it with list_entities(entity_type=company)", input.CompanyID)), nil, nil
+	}
+	return toolText(out), nil, nil
+}
+
+// renderCompanyOrg renders the org overview of companyID, reporting false when
+// the snapshot knows neither the company nor any contact of it. Roles are
+// listed alphabetically with contacts that have none last; contacts within a
+// role are ordered by last then first name.
+func renderCompanyOrg(snap *cache.Snapshot, companyID int) (string, bool) {
+	name := ""
+	for _, c := range snap.Companies {
+		if c.ID == companyID {
+			name = c.Name
+			break
+		}
+	}
+	roles := map[string][]itportal.Contact{}
+	total := 0
+	for _, c := range snap.Contacts {
+		if c.Company == nil || c.Company.ID != companyID {
+			continue
+		}
+		if name == "" {
+			name = c.Company.Name
+		}
+		role := orgUnassigned
+		if c.Type != nil && strings.TrimSpace(c.Type.Name) != "" {
+			role = strings.TrimSpace(c.Type.Name)
+		}
+		roles[role] = append(roles[role], c)
+		total++
+	}
+	if name == "" && total == 0 {
+		return "", false
+	}
+
+	order := make([]string, 0, len(roles))
+	for role := range roles {
+		order = append(order, role)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if (order[i] == orgUnassigned) != (order[j] == orgUnassigned) {
+			return order[j] == orgUnassigned
+		}
+		return strings.ToLower(order[i]) < strings.ToLower(order[j])
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s — contacts by role\n\n", cache.FirstNonEmpty(name, fmt.Sprintf("Company %d", companyID)))
+	if total == 0 {
+		b.WriteString("No contacts are recorded for this company.\n")
+		return b.String(), true
+	}
+	fmt.Fprintf(&b, "_%d contacts in %d roles._\n", total, len(order))
+	for _, role := range order {
+		contacts := roles[role]
+		sort.SliceStable(contacts, func(i, j int) bool {
+			a, c := contacts[i], contacts[j]
+			if !strings.EqualFold(a.LastName, c.LastName) {
+				return strings.ToLower(a.LastName) < strings.ToLower(c.LastName)
+			}
+			return strings.ToLower(a.FirstName) < strings.ToLower(c.FirstName)
+		})
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", role, len(contacts))
+		for _, c := range contacts {
+			b.WriteString("- " + orgContactLine(c) + "\n")
+		}
+	}
+	return b.String(), true
+}
+
+// orgContactLine is one contact's entry: name, ID, site, email and phones.
+func orgContactLine(c itportal.Contact) string {
+	name := c.FullName()
+	if name == "" {
+		name = fmt.Sprintf("Contact #%d", c.ID)
+	}
+	line := fmt.Sprintf("**%s** (ID: %d)", name, c.ID)
+	if c.Site != nil && c.Site.Name != "" {
+		line += " · " + c.Site.Name
+	}
+	var reach []string
+	if c.Email != "" {
+		reach = append(reach, c.Email)
+	}
+	if c.DirectNumber != "" {
+		direct := "direct " + c.DirectNumber
+		if c.Extension != "" {
+			direct += " ext. " + c.Extension
+		}
+		reach = append(reach, direct)
+	}
+	if c.Mobile != "" {
+		reach = append(reach, "mobile "+c.Mobile)
+	}
+	if len(reach) > 0 {
+		line += " — " + strings.Join(reach, " · ")
+	}
+	return line
+}
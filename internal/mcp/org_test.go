@@ -0,0 +1,55 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestRenderCompanyOrgGroupsByRole(t *testing.T) {
+	acme := &itportal.CompanyReference{ID: 1, Name: "Acme"}
+	tech := &itportal.ContactType{ID: 1, Name: "Technical"}
+	billing := &itportal.ContactType{ID: 2, Name: "Billing"}
+	snap := &cache.Snapshot{
+		Companies: []itportal.Company{{ID: 1, Name: "Acme"}, {ID: 2, Name: "Zulu"}},
+		Contacts: []itportal.Contact{
+			{ID: 10, Company: acme, FirstName: "Zoe", LastName: "Young", Type: tech, Email: "zoe@acme.test", Mobile: "+1 555 0100"},
+			{ID: 11, Company: acme, FirstName: "Adam", LastName: "Baker", Type: tech, DirectNumber: "+1 555 0101", Extension: "12",
+				Site: &itportal.SiteReference{ID: 3, Name: "HQ"}},
+			{ID: 12, Company: acme, FirstName: "Bea", LastName: "Cole", Type: billing, Email: "ap@acme.test"},
+			{ID: 13, Company: acme, FirstName: "Nat", LastName: "Role"},
+			{ID: 14, Company: &itportal.CompanyReference{ID: 2}, FirstName: "Other", LastName: "Co", Type: tech},
+		},
+	}
+
+	out, ok := renderCompanyOrg(snap, 1)
+	if !ok {
+		t.Fatal("Acme not found")
+	}
+	for _, want := range []string{
+		"# Acme — contacts by role",
+		"_4 contacts in 3 roles._",
+		"## Billing (1)\n\n- **Bea Cole** (ID: 12) — ap@acme.test\n",
+		"## Technical (2)\n\n- **Adam Baker** (ID: 11) · HQ — direct +1 555 0101 ext. 12\n- **Zoe Young** (ID: 10) — zoe@acme.test · mobile +1 555 0100\n",
+		"## No role (1)\n\n- **Nat Role** (ID: 13)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("org lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "## Billing") > strings.Index(out, "## Technical") || strings.Index(out, "## Technical") > strings.Index(out, "## No role") {
+		t.Errorf("roles out of order:\n%s", out)
+	}
+	if strings.Contains(out, "Other Co") {
+		t.Errorf("another company's contact listed:\n%s", out)
+	}
+
+	if out, ok := renderCompanyOrg(snap, 2); !ok || !strings.Contains(out, "# Zulu") {
+		t.Errorf("Zulu org = %q, %t", out, ok)
+	}
+	if _, ok := renderCompanyOrg(snap, 99); ok {
+		t.Error("unknown company rendered")
+	}
+}
@@ -0,0 +1,76 @@
+package mcp
+
+import "strings"
+
+// contactPhoneFields are the Contact JSON fields normalised when phone
+// normalisation is enabled.
+var contactPhoneFields = []string{"directNumber", "directFax", "homePhone", "mobile"}
+
+// normalizeContactPhones rewrites the phone fields of a contact create/update
+// payload in place to E.164-style form. Values that cannot be parsed are left
+// untouched.
+func normalizeContactPhones(fields map[string]interface{}, countryCode string) {
+	for _, k := range contactPhoneFields {
+		if s, ok := fields[k].(string); ok {
+			fields[k] = normalizePhone(s, countryCode)
+		}
+	}
+}
+
+// minNationalDigits is the shortest national number normalizePhone prefixes
+// with a country code; shorter ones are local numbers missing an area code.
+const minNationalDigits = 8
+
+// normalizePhone formats a free-text phone number as +<country><number>.
+// Numbers already in international form (+… or 00…) keep their own country
+// code; national numbers get countryCode, dropping a single leading trunk 0,
+// once they are long enough to be complete (10 digits for NANP, at least
+// minNationalDigits elsewhere). Anything containing letters (extensions,
+// notes), too short to complete or falling outside the E.164 length range of
+// 8–15 digits is returned unchanged.
+func normalizePhone(s, countryCode string) string {
+	raw := strings.TrimSpace(s)
+	if raw == "" || countryCode == "" {
+		return s
+	}
+
+	var digits strings.Builder
+	international := false
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+		default:
+			return s
+		}
+	}
+
+	num := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(num, "00"):
+		num = num[2:]
+	case countryCode == "1":
+		// NANP numbers are often written with the leading 1 already; a local
+		// number without its area code cannot be completed.
+		national := strings.TrimPrefix(num, "1")
+		if len(national) != 10 {
+			return s
+		}
+		num = "1" + national
+	default:
+		national := strings.TrimPrefix(num, "0")
+		if len(national) < minNationalDigits {
+			return s
+		}
+		num = countryCode + national
+	}
+
+	if len(num) < 8 || len(num) > 15 {
+		return s
+	}
+	return "+" + num
+}
@@ -0,0 +1,76 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		name, in, cc, want string
+	}{
+		{"us formatted", "(555) 123-4567", "1", "+15551234567"},
+		{"us dotted with leading 1", "1.555.123.4567", "1", "+15551234567"},
+		{"international plus", "+44 20 7946 0958", "1", "+442079460958"},
+		{"international 00 prefix", "0044 20 7946 0958", "1", "+442079460958"},
+		{"national trunk zero", "020 7946 0958", "44", "+442079460958"},
+		{"extension left alone", "555-123-4567 ext 12", "1", "555-123-4567 ext 12"},
+		{"text left alone", "call reception", "1", "call reception"},
+		{"too short left alone", "1234", "1", "1234"},
+		{"us local number left alone", "555-1234", "1", "555-1234"},
+		{"short national number left alone", "0123 4567", "44", "0123 4567"},
+		{"empty", "", "1", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizePhone(tc.in, tc.cc); got != tc.want {
+				t.Errorf("normalizePhone(%q, %q) = %q, want %q", tc.in, tc.cc, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestCreateContactNormalizesPhones verifies create_entity rewrites contact
+// phone fields when normalisation is enabled, leaving unparseable ones intact.
+func TestCreateContactNormalizesPhones(t *testing.T) {
+	var posted itportal.Contact
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_ = json.NewDecoder(r.Body).Decode(&posted)
+			w.Header().Set("Location", "/api/2.1/contacts/9/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []itportal.Contact{{ID: 9, FirstName: "Ada"}}, "")
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	h.phoneCountryCode = "1"
+	res, _, err := h.CreateEntity(context.Background(), nil, CreateEntityInput{
+		EntityType: "contact",
+		Fields: map[string]interface{}{
+			"firstName":    "Ada",
+			"directNumber": "(555) 123-4567",
+			"mobile":       "+44 7700 900123",
+			"directFax":    "ask front desk",
+		},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("CreateEntity: err=%v res=%v", err, res)
+	}
+	if posted.DirectNumber != "+15551234567" {
+		t.Errorf("directNumber = %q, want +15551234567", posted.DirectNumber)
+	}
+	if posted.Mobile != "+447700900123" {
+		t.Errorf("mobile = %q, want +447700900123", posted.Mobile)
+	}
+	if posted.DirectFax != "ask front desk" {
+		t.Errorf("unparseable directFax changed: %q", posted.DirectFax)
+	}
+}
@@ -0,0 +1,44 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- get_contact_photo ----
+
+type GetContactPhotoInput struct {
+	ContactID string `json:"contact_id" jsonschema:"Numeric ID of the contact"`
+}
+
+// GetContactPhoto downloads a contact's photo and returns it base64-encoded
+// with its content type. Photos over maxFileBytes are refused, the same cap
+// upload_file applies.
+func (h *Handler) GetContactPhoto(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetContactPhotoInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(
+		validateRequired("contact_id", input.ContactID),
+		validateNumericID("contact_id", input.ContactID),
+	); res != nil {
+		return res, nil, nil
+	}
+	id := strings.TrimSpace(input.ContactID)
+	photo, err := h.client.GetContactPhoto(ctx, id, maxFileBytes)
+	if errors.Is(err, itportal.ErrFileTooLarge) {
+		return toolError(fmt.Sprintf("contact %s's photo is larger than the %d-byte file limit", id, maxFileBytes)), nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get contact photo: %w", err)
+	}
+	if photo == nil {
+		return toolText(fmt.Sprintf("Contact %s has no photo.", id)), nil, nil
+	}
+	return toolText(fmt.Sprintf("Photo of contact %s (%s, %d bytes), base64:\n%s",
+		id, photo.ContentType, len(photo.Data), base64.StdEncoding.EncodeToString(photo.Data))), nil, nil
+}
@@ -0,0 +1,41 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetContactPhoto(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0-fake-jpeg")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/2.1/contacts/7/file/" {
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write(jpeg)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	res, _, err := h.GetContactPhoto(context.Background(), nil, GetContactPhotoInput{ContactID: "7"})
+	if err != nil {
+		t.Fatalf("GetContactPhoto: %v", err)
+	}
+	text := resultText(t, res)
+	if !strings.Contains(text, "image/jpeg") || !strings.HasSuffix(text, base64.StdEncoding.EncodeToString(jpeg)) {
+		t.Errorf("unexpected result: %s", text)
+	}
+
+	res, _, err = h.GetContactPhoto(context.Background(), nil, GetContactPhotoInput{ContactID: "8"})
+	if err != nil {
+		t.Fatalf("GetContactPhoto without photo: %v", err)
+	}
+	if res.IsError || !strings.Contains(resultText(t, res), "has no photo") {
+		t.Errorf("no-photo case: %s", resultText(t, res))
+	}
+}
@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// WritePolicy restricts which entity types the write tools may create, update
+// or delete. The zero value permits every write.
+type WritePolicy struct {
+	// ReadOnly rejects every write regardless of Allowed.
+	ReadOnly bool
+	// Allowed, when non-empty, is the set of entity types writes are limited to,
+	// keyed by policyKey.
+	Allowed map[string]bool
+
+	// names preserves the allow-list as configured, for error messages.
+	names []string
+}
+
+// NewWritePolicy builds a WritePolicy from the configured read-only flag and
+// entity allow-list. Allow-list entries use the same friendly names the tools
+// accept (kb, device, ip_network, additional_credential, …).
+func NewWritePolicy(readOnly bool, allowed []string) WritePolicy {
+	p := WritePolicy{ReadOnly: readOnly}
+	for _, t := range allowed {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		if p.Allowed == nil {
+			p.Allowed = make(map[string]bool)
+		}
+		p.Allowed[policyKey(t)] = true
+		p.names = append(p.names, strings.TrimSpace(t))
+	}
+	return p
+}
+
+// policyKey maps a friendly entity type to a canonical key so aliases such as
+// kb/kbs/knowledge_base or ipnetwork/subnet compare equal.
+func policyKey(entityType string) string {
+	if path, ok := objectPathFor(entityType); ok {
+		return path
+	}
+	return normType(entityType)
+}
+
+// denied returns a policy message when writes to entityType are not permitted,
+// or "" when the write may proceed.
+func (p WritePolicy) denied(entityType string) string {
+	if p.ReadOnly {
+		return fmt.Sprintf("write policy: this server is read-only; writes to %q are not permitted", entityType)
+	}
+	if len(p.Allowed) > 0 && !p.Allowed[policyKey(entityType)] {
+		return fmt.Sprintf("write policy: writes to %q are not permitted on this server (allowed: %s)",
+			entityType, strings.Join(p.names, ", "))
+	}
+	return ""
+}
+
+// checkWrite returns a policy toolError when the configured WritePolicy forbids
+// writing entityType, or nil when the write may proceed. Write tools call it
+// before any API request is made.
+func (h *Handler) checkWrite(entityType string) *sdkmcp.CallToolResult {
+	if msg := h.policy.denied(entityType); msg != "" {
+		return toolError(msg)
+	}
+	return nil
+}
+
+// checkSecrets returns a policy toolError when the server denies secret access
+// (passwords, 2FA codes, credentials), or nil when secrets may be read or
+// written.
+func (h *Handler) checkSecrets() *sdkmcp.CallToolResult {
+	if h.denySecrets {
+		return toolError("credential policy: secret access is disabled on this server")
+	}
+	return nil
+}
+
+// readAction reports whether a manage_* action only reads, so it bypasses the
+// write policy.
+func readAction(action string) bool {
+	switch strings.ToLower(action) {
+	case "", "list", "get", "download":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestReadOnlyPolicyBlocksAllWrites verifies MCP_READONLY rejects every write
+// tool with a policy error before any request reaches the API.
+func TestReadOnlyPolicyBlocksAllWrites(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	h.policy = NewWritePolicy(true, nil)
+	ctx := context.Background()
+
+	calls := map[string]func() (bool, string){
+		"create_kb_article": func() (bool, string) {
+			res, _, _ := h.CreateKBArticle(ctx, nil, CreateKBArticleInput{CompanyID: 1, Name: "n"})
+			return res.IsError, resultText(t, res)
+		},
+		"create_device": func() (bool, string) {
+			res, _, _ := h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "n"})
+			return res.IsError, resultText(t, res)
+		},
+		"create_entity": func() (bool, string) {
+			res, _, _ := h.CreateEntity(ctx, nil, CreateEntityInput{EntityType: "company", Fields: map[string]interface{}{"name": "x"}})
+			return res.IsError, resultText(t, res)
+		},
+		"update_entity": func() (bool, string) {
+			res, _, _ := h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: "kb", ID: "1", Fields: map[string]interface{}{"name": "x"}})
+			return res.IsError, resultText(t, res)
+		},
+		"delete_entity": func() (bool, string) {
+			res, _, _ := h.DeleteEntity(ctx, nil, DeleteEntityInput{EntityType: "device", ID: "1"})
+			return res.IsError, resultText(t, res)
+		},
+		"manage_relationship": func() (bool, string) {
+			res, _, _ := h.ManageRelationship(ctx, nil, ManageRelationshipInput{Action: "create", ObjectType: "device", ObjectID: "1", TargetType: "Document", TargetID: 2})
+			return res.IsError, resultText(t, res)
+		},
+	}
+	for name, call := range calls {
+		isErr, text := call()
+		if !isErr || !strings.Contains(text, "write policy") {
+			t.Errorf("%s: want policy error, got isError=%v %q", name, isErr, text)
+		}
+	}
+	if hits != 0 {
+		t.Errorf("read-only policy let %d request(s) reach the API", hits)
+	}
+}
+
+// TestAllowListPermitsOnlyKB verifies MCP_WRITE_ALLOWED_ENTITIES=kb lets KB
+// writes through while rejecting every other entity type.
+func TestAllowListPermitsOnlyKB(t *testing.T) {
+	var posts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts = append(posts, r.URL.Path)
+			w.Header().Set("Location", "/api/2.1/kbs/7/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []itportal.KB{{ID: 7, Name: "Runbook"}}, "")
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	h.policy = NewWritePolicy(false, []string{"kb"})
+	ctx := context.Background()
+
+	res, _, err := h.CreateKBArticle(ctx, nil, CreateKBArticleInput{CompanyID: 1, Name: "Runbook"})
+	if err != nil {
+		t.Fatalf("CreateKBArticle: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("KB write rejected under kb allow-list: %s", resultText(t, res))
+	}
+
+	res, _, _ = h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "sw01"})
+	if !res.IsError || !strings.Contains(resultText(t, res), "allowed: kb") {
+		t.Errorf("device write not rejected by allow-list: %s", resultText(t, res))
+	}
+	res, _, _ = h.DeleteEntity(ctx, nil, DeleteEntityInput{EntityType: "contact", ID: "3"})
+	if !res.IsError {
+		t.Errorf("contact delete not rejected by allow-list: %s", resultText(t, res))
+	}
+
+	if len(posts) != 1 || !strings.Contains(posts[0], "/kbs") {
+		t.Errorf("expected exactly one KB POST, got %v", posts)
+	}
+}
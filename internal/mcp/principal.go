@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// WithPrincipalKeys pins MCP API keys to ITPortal instances: a call presenting
+// one of keys runs on the instance it maps to, with that instance's client and
+// snapshot, and may not reach any other. Keys not listed (the shared
+// MCP_API_KEY) keep the "instance" argument. Several instances may share one
+// base URL with per-tenant ITPortal API keys.
+func WithPrincipalKeys(keys map[string]string) Option {
+	return func(h *Handler) { h.principalKeys = keys }
+}
+
+// APIToken pulls the MCP API key from "Authorization: Bearer <key>", a raw
+// "Authorization: <key>" or "X-API-Key: <key>".
+func APIToken(header http.Header) string {
+	if h := strings.TrimSpace(header.Get("Authorization")); h != "" {
+		if len(h) >= 7 && strings.EqualFold(h[:7], "Bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+		return h // raw token without a scheme
+	}
+	if h := strings.TrimSpace(header.Get("X-API-Key")); h != "" {
+		return h
+	}
+	return ""
+}
+
+// pinned returns the instance the caller's MCP API key is pinned to, or "" when
+// the key is not a principal key or the request carries no HTTP headers.
+func (r *instanceRouter) pinned(extra *sdkmcp.RequestExtra) string {
+	if len(r.principals) == 0 || extra == nil || extra.Header == nil {
+		return ""
+	}
+	token := []byte(APIToken(extra.Header))
+	if len(token) == 0 {
+		return ""
+	}
+	for key, instance := range r.principals {
+		if subtle.ConstantTimeCompare(token, []byte(key)) == 1 {
+			return instance
+		}
+	}
+	return ""
+}
+
+// route returns the Handler a tool call runs on: the caller's pinned instance,
+// else the instance named by the "instance" argument.
+func (r *instanceRouter) route(req *sdkmcp.CallToolRequest) (*Handler, error) {
+	name := strings.TrimSpace(instanceArg(req))
+	var extra *sdkmcp.RequestExtra
+	if req != nil {
+		extra = req.Extra
+	}
+	pinned := r.pinned(extra)
+	if pinned == "" {
+		return r.resolve(name)
+	}
+	if name != "" && name != pinned {
+		return nil, fmt.Errorf("this API key is limited to instance %q", pinned)
+	}
+	return r.resolve(pinned)
+}
+
+// scoped guards a resource of instance so callers pinned to another instance
+// see it as not found.
+func (r *instanceRouter) scoped(instance string, fn sdkmcp.ResourceHandler) sdkmcp.ResourceHandler {
+	if len(r.principals) == 0 {
+		return fn
+	}
+	return func(ctx context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+		if req != nil {
+			if p := r.pinned(req.Extra); p != "" && p != instance {
+				return nil, sdkmcp.ResourceNotFoundError(req.Params.URI)
+			}
+		}
+		return fn(ctx, req)
+	}
+}
@@ -0,0 +1,140 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// keyTransport presents an MCP API key on every request.
+type keyTransport string
+
+func (k keyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+string(k))
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// TestPrincipalKeysSelectITPortalKey serves two tenants behind one ITPortal
+// base URL and checks each MCP key reaches ITPortal with its tenant's API key
+// only, while the shared key still routes by the instance argument.
+func TestPrincipalKeysSelectITPortalKey(t *testing.T) {
+	itp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, key, _ := r.BasicAuth()
+		if r.URL.Path == "/api/2.1/devices/1/" {
+			writeList(w, []itportal.Device{{ID: 1, Name: "seen-" + key}}, "")
+			return
+		}
+		writeList(w, []map[string]any{}, "")
+	}))
+	t.Cleanup(itp.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tenant := func(key string) (*itportal.Client, *cache.Cache) {
+		client := itportal.NewClient(itp.URL, key)
+		c, err := cache.New(context.Background(), client, 10, 10, time.Hour, logger,
+			cache.WithStorePath(filepath.Join(t.TempDir(), key+".db")))
+		if err != nil {
+			t.Fatalf("cache.New: %v", err)
+		}
+		return client, c
+	}
+	clientA, cacheA := tenant("itp-a")
+	clientB, cacheB := tenant("itp-b")
+	server := NewServer(clientA, cacheA, WithInstanceName("a"), WithInstance("b", clientB, cacheB),
+		WithPrincipalKeys(map[string]string{"mcp-a": "a", "mcp-b": "b"}))
+	mcpSrv := httptest.NewServer(sdkmcp.NewStreamableHTTPHandler(func(*http.Request) *sdkmcp.Server { return server }, nil))
+	t.Cleanup(mcpSrv.Close) // runs after the sessions below close
+
+	ctx := context.Background()
+	session := func(key string) *sdkmcp.ClientSession {
+		t.Helper()
+		cs, err := sdkmcp.NewClient(&sdkmcp.Implementation{Name: "test"}, nil).Connect(ctx, &sdkmcp.StreamableClientTransport{
+			Endpoint:   mcpSrv.URL,
+			HTTPClient: &http.Client{Transport: keyTransport(key)},
+		}, nil)
+		if err != nil {
+			t.Fatalf("connect %s: %v", key, err)
+		}
+		t.Cleanup(func() { _ = cs.Close() })
+		return cs
+	}
+	exists := func(cs *sdkmcp.ClientSession, instance string) (string, *sdkmcp.CallToolResult) {
+		t.Helper()
+		args := map[string]any{"entity_type": "device", "id": "1"}
+		if instance != "" {
+			args["instance"] = instance
+		}
+		res, err := cs.CallTool(ctx, &sdkmcp.CallToolParams{Name: "entity_exists", Arguments: args})
+		if err != nil {
+			t.Fatalf("entity_exists: %v", err)
+		}
+		if res.IsError {
+			return "", res
+		}
+		var got entityExistsResult
+		if err := json.Unmarshal([]byte(resultText(t, res)), &got); err != nil {
+			t.Fatalf("result not JSON: %v", err)
+		}
+		return got.Name, res
+	}
+
+	a, b, shared := session("mcp-a"), session("mcp-b"), session("shared")
+	for _, c := range []struct {
+		name     string
+		cs       *sdkmcp.ClientSession
+		instance string
+		want     string
+	}{
+		{"tenant a", a, "", "seen-itp-a"},
+		{"tenant b", b, "", "seen-itp-b"},
+		{"tenant b naming itself", b, "b", "seen-itp-b"},
+		{"shared default", shared, "", "seen-itp-a"},
+		{"shared routed", shared, "b", "seen-itp-b"},
+	} {
+		if got, res := exists(c.cs, c.instance); got != c.want {
+			t.Errorf("%s: device name = %q (%v), want %q", c.name, got, res.Content, c.want)
+		}
+	}
+
+	if _, res := exists(b, "a"); !res.IsError || !strings.Contains(resultText(t, res), `limited to instance "b"`) {
+		t.Errorf("tenant b reached instance a: %v", res.Content)
+	}
+	if _, err := b.ReadResource(ctx, &sdkmcp.ReadResourceParams{URI: "itportal://snapshot"}); err == nil {
+		t.Error("tenant b read tenant a's snapshot")
+	}
+	if _, err := b.ReadResource(ctx, &sdkmcp.ReadResourceParams{URI: "itportal://b/snapshot"}); err != nil {
+		t.Errorf("tenant b cannot read its own snapshot: %v", err)
+	}
+}
+
+// TestAPIToken covers the header forms an MCP API key may arrive in.
+func TestAPIToken(t *testing.T) {
+	for _, c := range []struct {
+		header, value, want string
+	}{
+		{"Authorization", "Bearer k1", "k1"},
+		{"Authorization", "bearer  k2 ", "k2"},
+		{"Authorization", "k3", "k3"},
+		{"X-API-Key", "k4", "k4"},
+		{"X-Other", "k5", ""},
+	} {
+		h := http.Header{}
+		h.Set(c.header, c.value)
+		if got := APIToken(h); got != c.want {
+			t.Errorf("APIToken(%s: %q) = %q, want %q", c.header, c.value, got, c.want)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
@@ -17,11 +19,35 @@ import (
 // page further with ?offset=N (and optional ?limit=N).
 const defaultSectionPageSize = 100
 
+// snapshotNotReady is reported by the snapshot-backed search and resources
+// until the first real snapshot exists: a non-blocking startup still warming
+// up, or an initial build that has not succeeded yet.
+const snapshotNotReady = "snapshot not ready yet; try again shortly or call refresh_snapshot"
+
+// snapshotReady reports whether a real snapshot has been built, as opposed to
+// the empty placeholder served before the first build succeeds.
+func (h *Handler) snapshotReady() bool {
+	if h.cache == nil || !h.cache.Ready() {
+		return false
+	}
+	snap := h.cache.Get()
+	return snap != nil && snap.Markdown != ""
+}
+
 // IndexResource serves the COMPACT documentation index: one short line per object
 // (type, id, name, summary, portal url) across every entity. This is the default
 // entry point — small enough to fit the output limit — from which the model drills
 // down via get_entity_details / search_docs / the per-section resources.
-func (h *Handler) IndexResource(_ context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+func (h *Handler) IndexResource(ctx context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+	if !h.snapshotReady() {
+		return nil, errors.New(snapshotNotReady)
+	}
+	h.cache.EnsureFresh(ctx)
+	if from, to, ok, err := parseRuneRange(req.Params.URI); err != nil {
+		return nil, err
+	} else if ok {
+		return h.markdownRange(req.Params.URI, from, to)
+	}
 	store := h.cache.Store()
 	if store == nil {
 		return nil, fmt.Errorf("snapshot store not ready")
@@ -36,10 +62,20 @@ func (h *Handler) IndexResource(_ context.Context, req *sdkmcp.ReadResourceReque
 	if err != nil {
 		return nil, fmt.Errorf("counts: %w", err)
 	}
+	snap := h.cache.Get()
 
+	// With a stable body the timestamp lives only in snapshot-meta, so an
+	// unchanged snapshot serves an identical index.
+	generatedAt := ""
+	if !h.cache.StableBody() {
+		generatedAt = snap.GeneratedAt.Format("2006-01-02 15:04:05 UTC")
+	}
 	payload := struct {
-		GeneratedAt string            `json:"generated_at"`
+		GeneratedAt string            `json:"generated_at,omitempty"`
+		Meta        string            `json:"meta"`
 		Counts      map[string]int    `json:"counts"`
+		Truncated   bool              `json:"truncated,omitempty"`
+		Capped      []string          `json:"truncated_sections,omitempty"`
 		Total       int               `json:"total"`
 		Returned    int               `json:"returned"`
 		Offset      int               `json:"offset"`
@@ -47,12 +83,15 @@ func (h *Handler) IndexResource(_ context.Context, req *sdkmcp.ReadResourceReque
 		Guidance    string            `json:"guidance"`
 		Index       []cache.IndexRow  `json:"index"`
 	}{
-		GeneratedAt: h.cache.Get().GeneratedAt.Format("2006-01-02 15:04:05 UTC"),
+		GeneratedAt: generatedAt,
+		Meta:        h.snapshotMetaURI(),
 		Counts:      counts,
+		Truncated:   len(snap.Truncated) > 0,
+		Capped:      snap.Truncated,
 		Total:       total,
 		Returned:    len(rows),
 		Offset:      offset,
-		Sections:    sectionURIs(),
+		Sections:    sectionURIs(h.snapshotURI()),
 		Guidance: "Compact index of every documented object. Use search_docs(query[,entity_type]) " +
 			"to find objects by keyword/IP/serial/name, get_entity_details(entity_type,id) for a full " +
 			"record, and the itportal://snapshot/<section> resources for a paginated full section. " +
@@ -64,17 +103,112 @@ func (h *Handler) IndexResource(_ context.Context, req *sdkmcp.ReadResourceReque
 	if err != nil {
 		return nil, fmt.Errorf("marshal index: %w", err)
 	}
-	return &sdkmcp.ReadResourceResult{
-		Contents: []*sdkmcp.ResourceContents{
-			{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)},
-		},
-	}, nil
+	return h.resourceResult(req.Params.URI, "application/json", string(data), len(rows)), nil
+}
+
+// SnapshotMetaResource serves the snapshot's volatile metadata — when it was
+// built, its age, which sections hit their cap and any refreshes failing since
+// — apart from the index and Markdown, which stay byte-identical while the
+// data does.
+func (h *Handler) SnapshotMetaResource(ctx context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+	if !h.snapshotReady() {
+		return nil, errors.New(snapshotNotReady)
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+	health := h.cache.RefreshHealth()
+	payload := struct {
+		GeneratedAt     string   `json:"generated_at"`
+		AgeSeconds      int      `json:"age_seconds"`
+		Truncated       bool     `json:"truncated,omitempty"`
+		Capped          []string `json:"truncated_sections,omitempty"`
+		Degraded        bool     `json:"degraded,omitempty"`
+		RefreshFailures int      `json:"refresh_failures,omitempty"`
+		LastError       string   `json:"last_refresh_error,omitempty"`
+		LastErrorAt     string   `json:"last_refresh_error_at,omitempty"`
+	}{
+		GeneratedAt:     snap.GeneratedAt.Format("2006-01-02 15:04:05 UTC"),
+		AgeSeconds:      int(h.cache.Age().Seconds()),
+		Truncated:       len(snap.Truncated) > 0,
+		Capped:          snap.Truncated,
+		Degraded:        h.cache.Degraded(),
+		RefreshFailures: health.ConsecutiveFailures,
+		LastError:       health.LastError,
+	}
+	if !health.LastErrorAt.IsZero() {
+		payload.LastErrorAt = health.LastErrorAt.Format("2006-01-02 15:04:05 UTC")
+	}
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal snapshot meta: %w", err)
+	}
+	return h.resourceResult(req.Params.URI, "application/json", string(data), -1), nil
+}
+
+// markdownRange serves runes [from, to) of the full Markdown snapshot, clamped
+// to its length, behind a one-line note giving the range and the next one.
+func (h *Handler) markdownRange(uri string, from, to int) (*sdkmcp.ReadResourceResult, error) {
+	snap := h.cache.Get()
+	runes := []rune(snap.Markdown)
+	total := len(runes)
+	if to < 0 || to > total {
+		to = total
+	}
+	from = min(from, to)
+
+	note := fmt.Sprintf("<!-- snapshot markdown runes %d-%d of %d", from, to, total)
+	if to < total {
+		note += fmt.Sprintf("; next: %s?from=%d&to=%d", h.snapshotURI(), to, min(to+(to-from), total))
+	}
+	note += " -->\n"
+	return h.resourceResult(uri, "text/markdown", note+string(runes[from:to]), -1), nil
+}
+
+// parseRuneRange reads the ?from=&to= rune range from a resource URI. ok is
+// false when neither is given; a missing to means the end (-1). Bounds must be
+// non-negative integers with from < to, so the range and the next one it
+// points to are never empty.
+func parseRuneRange(uri string) (from, to int, ok bool, err error) {
+	i := strings.IndexByte(uri, '?')
+	if i < 0 {
+		return 0, 0, false, nil
+	}
+	q, err := url.ParseQuery(uri[i+1:])
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid query %q: %w", uri[i+1:], err)
+	}
+	if !q.Has("from") && !q.Has("to") {
+		return 0, 0, false, nil
+	}
+	to = -1
+	for _, b := range []struct {
+		name string
+		dst  *int
+	}{{"from", &from}, {"to", &to}} {
+		v := q.Get(b.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, false, fmt.Errorf("invalid %s %q: want a non-negative rune offset", b.name, v)
+		}
+		*b.dst = n
+	}
+	if to >= 0 && from >= to {
+		return 0, 0, false, fmt.Errorf("invalid range: from %d must be before to %d", from, to)
+	}
+	return from, to, true, nil
 }
 
 // SectionResource serves one entity section as paginated JSON rows (full columns,
 // no secrets). The section is taken from the URI path, e.g.
 // itportal://snapshot/devices, with optional ?offset=&limit= query params.
-func (h *Handler) SectionResource(_ context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+func (h *Handler) SectionResource(ctx context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+	if !h.snapshotReady() {
+		return nil, errors.New(snapshotNotReady)
+	}
+	h.cache.EnsureFresh(ctx)
 	store := h.cache.Store()
 	if store == nil {
 		return nil, fmt.Errorf("snapshot store not ready")
@@ -108,25 +242,53 @@ func (h *Handler) SectionResource(_ context.Context, req *sdkmcp.ReadResourceReq
 		Items:    rows,
 	}
 	if offset+len(rows) < total {
-		payload.NextPage = fmt.Sprintf("itportal://snapshot/%s?offset=%d&limit=%d", section, offset+limit, limit)
+		payload.NextPage = fmt.Sprintf("%s/%s?offset=%d&limit=%d", h.snapshotURI(), section, offset+limit, limit)
 	}
 
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("marshal section: %w", err)
 	}
+	return h.resourceResult(req.Params.URI, "application/json", string(data), len(rows)), nil
+}
+
+// resourceResult wraps text as a resource read, cut to maxResultBytes like a
+// tool result. Its _meta gives the returned size in bytes, the item count when
+// items >= 0 and, when cut, truncated with the full size in total_bytes.
+func (h *Handler) resourceResult(uri, mimeType, text string, items int) *sdkmcp.ReadResourceResult {
+	total := len(text)
+	text = truncateResult(text, h.maxResultBytes)
+	meta := sdkmcp.Meta{"bytes": len(text)}
+	if items >= 0 {
+		meta["items"] = items
+	}
+	if len(text) < total {
+		meta["truncated"] = true
+		meta["total_bytes"] = total
+	}
 	return &sdkmcp.ReadResourceResult{
 		Contents: []*sdkmcp.ResourceContents{
-			{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)},
+			{URI: uri, MIMEType: mimeType, Text: text, Meta: meta},
 		},
-	}, nil
+	}
+}
+
+// snapshotURI is the root resource URI of this Handler's instance:
+// itportal://snapshot for the default instance, itportal://<name>/snapshot otherwise.
+func (h *Handler) snapshotURI() string {
+	return "itportal://" + h.uriPrefix + "snapshot"
+}
+
+// snapshotMetaURI is the snapshot-meta resource URI of this Handler's instance.
+func (h *Handler) snapshotMetaURI() string {
+	return "itportal://" + h.uriPrefix + "snapshot-meta"
 }
 
 // sectionURIs returns the section name → resource URI map advertised in the index.
-func sectionURIs() map[string]string {
+func sectionURIs(base string) map[string]string {
 	out := make(map[string]string, len(sectionNames))
 	for _, s := range sectionNames {
-		out[s] = "itportal://snapshot/" + s
+		out[s] = base + "/" + s
 	}
 	return out
 }
@@ -0,0 +1,283 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestIndexResourceFlagsTruncatedSnapshot(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sites/") {
+			writeList(w, []itportal.Site{{ID: 1, Name: "HQ"}, {ID: 2, Name: "Branch"}}, "")
+			return
+		}
+		writeList(w, []any{}, "")
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 2, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+
+	res, err := h.IndexResource(context.Background(), &sdkmcp.ReadResourceRequest{
+		Params: &sdkmcp.ReadResourceParams{URI: "itportal://snapshot"},
+	})
+	if err != nil {
+		t.Fatalf("IndexResource: %v", err)
+	}
+	var meta struct {
+		Truncated bool     `json:"truncated"`
+		Sections  []string `json:"truncated_sections"`
+	}
+	if err := json.Unmarshal([]byte(res.Contents[0].Text), &meta); err != nil {
+		t.Fatalf("index not JSON: %v", err)
+	}
+	if !meta.Truncated || len(meta.Sections) != 1 || meta.Sections[0] != "sites" {
+		t.Errorf("meta = %+v, want truncated sites", meta)
+	}
+
+	res, err = h.SnapshotMetaResource(context.Background(), &sdkmcp.ReadResourceRequest{
+		Params: &sdkmcp.ReadResourceParams{URI: "itportal://snapshot-meta"},
+	})
+	if err != nil {
+		t.Fatalf("SnapshotMetaResource: %v", err)
+	}
+	meta.Truncated, meta.Sections = false, nil
+	if err := json.Unmarshal([]byte(res.Contents[0].Text), &meta); err != nil {
+		t.Fatalf("snapshot-meta not JSON: %v", err)
+	}
+	if !meta.Truncated || len(meta.Sections) != 1 || meta.Sections[0] != "sites" {
+		t.Errorf("snapshot-meta = %+v, want truncated sites", meta)
+	}
+}
+
+// TestStableBodyMovesTimestampToMeta verifies that with a stable body the index
+// drops generated_at and itportal://snapshot-meta reports it.
+func TestStableBodyMovesTimestampToMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []any{}, "")
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")), cache.WithStableBody())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+	read := func(uri string, fn func(context.Context, *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error)) map[string]any {
+		t.Helper()
+		res, err := fn(context.Background(), &sdkmcp.ReadResourceRequest{Params: &sdkmcp.ReadResourceParams{URI: uri}})
+		if err != nil {
+			t.Fatalf("read %s: %v", uri, err)
+		}
+		var out map[string]any
+		if err := json.Unmarshal([]byte(res.Contents[0].Text), &out); err != nil {
+			t.Fatalf("%s not JSON: %v", uri, err)
+		}
+		return out
+	}
+
+	index := read("itportal://snapshot", h.IndexResource)
+	if _, ok := index["generated_at"]; ok {
+		t.Errorf("index carries generated_at with a stable body: %v", index["generated_at"])
+	}
+	if index["meta"] != "itportal://snapshot-meta" {
+		t.Errorf("index meta = %v, want itportal://snapshot-meta", index["meta"])
+	}
+	meta := read("itportal://snapshot-meta", h.SnapshotMetaResource)
+	if want := c.Get().GeneratedAt.Format("2006-01-02 15:04:05 UTC"); meta["generated_at"] != want {
+		t.Errorf("meta generated_at = %v, want %s", meta["generated_at"], want)
+	}
+}
+
+func TestIndexResourceRuneRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sites/") {
+			writeList(w, []itportal.Site{{ID: 1, Name: "Zürich HQ"}}, "")
+			return
+		}
+		writeList(w, []any{}, "")
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+	md := []rune(c.Get().Markdown)
+	n := len(md)
+	if n < 20 {
+		t.Fatalf("snapshot markdown too short to range over: %q", string(md))
+	}
+
+	read := func(query string) (string, error) {
+		res, err := h.IndexResource(context.Background(), &sdkmcp.ReadResourceRequest{
+			Params: &sdkmcp.ReadResourceParams{URI: "itportal://snapshot?" + query},
+		})
+		if err != nil {
+			return "", err
+		}
+		if res.Contents[0].MIMEType != "text/markdown" {
+			t.Errorf("%s: MIME type = %q", query, res.Contents[0].MIMEType)
+		}
+		return res.Contents[0].Text, nil
+	}
+
+	for query, want := range map[string]string{
+		"from=2&to=7":                            fmt.Sprintf("<!-- snapshot markdown runes 2-7 of %d; next: itportal://snapshot?from=7&to=12 -->\n%s", n, string(md[2:7])),
+		"to=5":                                   fmt.Sprintf("<!-- snapshot markdown runes 0-5 of %d; next: itportal://snapshot?from=5&to=10 -->\n%s", n, string(md[:5])),
+		fmt.Sprintf("from=%d", n-4):              fmt.Sprintf("<!-- snapshot markdown runes %d-%d of %d -->\n%s", n-4, n, n, string(md[n-4:])),
+		fmt.Sprintf("from=%d&to=%d", n-4, n+500): fmt.Sprintf("<!-- snapshot markdown runes %d-%d of %d -->\n%s", n-4, n, n, string(md[n-4:])),
+		fmt.Sprintf("from=%d&to=%d", n+10, n+20): fmt.Sprintf("<!-- snapshot markdown runes %d-%d of %d -->\n", n, n, n),
+	} {
+		got, err := read(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got != want {
+			t.Errorf("%s:\n got %q\nwant %q", query, got, want)
+		}
+	}
+
+	for _, query := range []string{"from=5&to=2", "from=0&to=0", "from=7&to=7", "from=-1", "to=abc"} {
+		if _, err := read(query); err == nil {
+			t.Errorf("%s: want an error", query)
+		}
+	}
+}
+
+// TestSnapshotNotReady covers a handler with no cache and one still warming up
+// after a non-blocking startup whose first build fails: search, the
+// snapshot-backed tools and resources say the snapshot is not ready rather than
+// reporting empty results.
+func TestSnapshotNotReady(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := cache.New(ctx, client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")), cache.WithNonBlockingStartup())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+
+	for name, h := range map[string]*Handler{
+		"nil cache": {client: client, baseURL: srv.URL},
+		"warming":   {client: client, cache: c, baseURL: srv.URL},
+	} {
+		res, _, err := h.SearchDocs(ctx, nil, SearchDocsInput{Query: "router"})
+		if err != nil || !res.IsError {
+			t.Fatalf("%s: SearchDocs want a tool error, got %v, %v", name, res, err)
+		}
+		if got := resultText(t, res); got != snapshotNotReady {
+			t.Errorf("%s: SearchDocs = %q, want %q", name, got, snapshotNotReady)
+		}
+		for tool, call := range map[string]func() (*sdkmcp.CallToolResult, any, error){
+			"company_org": func() (*sdkmcp.CallToolResult, any, error) {
+				return h.CompanyOrg(ctx, nil, CompanyOrgInput{CompanyID: 1})
+			},
+			"devices_missing_data": func() (*sdkmcp.CallToolResult, any, error) {
+				return h.DevicesMissingData(ctx, nil, DevicesMissingDataInput{})
+			},
+			"whats_new": func() (*sdkmcp.CallToolResult, any, error) {
+				return h.WhatsNew(ctx, nil, WhatsNewInput{})
+			},
+		} {
+			res, _, err := call()
+			if err != nil || !res.IsError || resultText(t, res) != snapshotNotReady {
+				t.Errorf("%s: %s = %v, %v; want %q", name, tool, res, err, snapshotNotReady)
+			}
+		}
+
+		for uri, read := range map[string]func(context.Context, *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error){
+			"itportal://snapshot":         h.IndexResource,
+			"itportal://snapshot?from=0":  h.IndexResource,
+			"itportal://snapshot/devices": h.SectionResource,
+			"itportal://inventory":        h.InventoryResource,
+			"itportal://summary":          h.SummaryResource,
+		} {
+			_, err := read(ctx, &sdkmcp.ReadResourceRequest{Params: &sdkmcp.ReadResourceParams{URI: uri}})
+			if err == nil || err.Error() != snapshotNotReady {
+				t.Errorf("%s: %s error = %v, want %q", name, uri, err, snapshotNotReady)
+			}
+		}
+	}
+}
+
+// TestResourceMetaMatchesPayload verifies a section read's _meta reports the
+// returned bytes and items, and flags a read cut by the max-bytes guard.
+func TestResourceMetaMatchesPayload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sites/") {
+			writeList(w, []itportal.Site{{ID: 1, Name: "HQ"}, {ID: 2, Name: "Branch"}, {ID: 3, Name: "Depot"}}, "")
+			return
+		}
+		writeList(w, []any{}, "")
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+	read := func() *sdkmcp.ResourceContents {
+		t.Helper()
+		res, err := h.SectionResource(context.Background(), &sdkmcp.ReadResourceRequest{
+			Params: &sdkmcp.ReadResourceParams{URI: "itportal://snapshot/sites?limit=2"},
+		})
+		if err != nil {
+			t.Fatalf("SectionResource: %v", err)
+		}
+		return res.Contents[0]
+	}
+
+	got := read()
+	var page struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(got.Text), &page); err != nil {
+		t.Fatalf("section not JSON: %v", err)
+	}
+	if got.Meta["bytes"] != len(got.Text) || got.Meta["items"] != len(page.Items) || len(page.Items) != 2 {
+		t.Errorf("meta = %v, want bytes %d, items %d", got.Meta, len(got.Text), len(page.Items))
+	}
+	if _, ok := got.Meta["truncated"]; ok {
+		t.Errorf("untruncated read flagged: %v", got.Meta)
+	}
+	full := len(got.Text)
+
+	h.maxResultBytes = 120
+	got = read()
+	if len(got.Text) > 120 || !strings.HasSuffix(got.Text, truncatedMarker) {
+		t.Errorf("text not cut to the guard: %d bytes", len(got.Text))
+	}
+	if got.Meta["truncated"] != true || got.Meta["total_bytes"] != full || got.Meta["bytes"] != len(got.Text) {
+		t.Errorf("meta = %v, want truncated from %d to %d bytes", got.Meta, full, len(got.Text))
+	}
+}
@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// reviewServer records the JSON body of every POST and PATCH by path and
+// answers GETs with record 77.
+func reviewServer(t *testing.T) (*Handler, map[string]map[string]any) {
+	t.Helper()
+	bodies := map[string]map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch r.Method {
+		case http.MethodPost, http.MethodPatch:
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			bodies[r.Method+" "+path] = body
+			w.Header().Set("Location", "/api/2.1"+path+"77/")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeList(w, []map[string]any{{"id": 77}}, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return newHandler(srv.URL), bodies
+}
+
+// assertReview checks body carries reviewBy {"id": 42} and dueDate 2026-12-31.
+func assertReview(t *testing.T, what string, body map[string]any) {
+	t.Helper()
+	review, _ := body["reviewBy"].(map[string]any)
+	if review["id"] != float64(42) || body["dueDate"] != "2026-12-31" {
+		t.Errorf("%s body = %v, want reviewBy {id: 42} and dueDate 2026-12-31", what, body)
+	}
+}
+
+func TestReviewFieldsReachRequestBodies(t *testing.T) {
+	h, bodies := reviewServer(t)
+	ctx := context.Background()
+
+	if res, _, err := h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "fw01", ReviewerUserID: 42, DueDate: "2026-12-31"}); err != nil || res.IsError {
+		t.Fatalf("CreateDevice = %v, %v", res, err)
+	}
+	assertReview(t, "create_device", bodies["POST /devices/"])
+
+	if res, _, err := h.CreateKBArticle(ctx, nil, CreateKBArticleInput{CompanyID: 1, Name: "Backups", ReviewerUserID: 42, DueDate: "2026-12-31"}); err != nil || res.IsError {
+		t.Fatalf("CreateKBArticle = %v, %v", res, err)
+	}
+	assertReview(t, "create_kb_article", bodies["POST /kbs/"])
+
+	if res, _, err := h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: "device", ID: "9", ReviewerUserID: 42, DueDate: "2026-12-31"}); err != nil || res.IsError {
+		t.Fatalf("UpdateEntity = %v, %v", res, err)
+	}
+	assertReview(t, "update_entity", bodies["PATCH /devices/9/"])
+}
+
+func TestReviewFieldsValidated(t *testing.T) {
+	h, bodies := reviewServer(t)
+	ctx := context.Background()
+
+	res, _, err := h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "fw01", DueDate: "31/12/2026"})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "due_date") {
+		t.Errorf("bad due_date: want a due_date field error, got %v, %v", res, err)
+	}
+	res, _, err = h.UpdateEntity(ctx, nil, UpdateEntityInput{EntityType: "contact", ID: "3", ReviewerUserID: 42})
+	if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "reviewBy") {
+		t.Errorf("contact review: want a refusal, got %v, %v", res, err)
+	}
+	if len(bodies) != 0 {
+		t.Errorf("invalid input reached the API: %v", bodies)
+	}
+}
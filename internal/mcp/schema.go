@@ -0,0 +1,53 @@
+package mcp
+
+import (
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// toolExamples are JSON Schema examples added to tool input properties, keyed
+// by tool name then property. They matter most for the free-form fields maps,
+// where models otherwise guess at reference shapes ("company": 5 instead of
+// {"id": 5}).
+var toolExamples = map[string]map[string][]any{
+	"create_entity": {
+		"fields": {
+			map[string]any{"name": "Main Office", "company": map[string]any{"id": 5}},
+			map[string]any{"name": "Rack-A1", "company": map[string]any{"id": 5}, "facility": map[string]any{"id": 12}},
+		},
+	},
+	"update_entity": {
+		"fields": {
+			map[string]any{"company": map[string]any{"id": 5}},
+			map[string]any{"name": "fw01-hq", "type": map[string]any{"id": 3}, "site": map[string]any{"id": 10}},
+		},
+	},
+	"bulk_update": {
+		"filter": {map[string]any{"company_id": "5"}},
+		"fields": {map[string]any{"site": map[string]any{"id": 10}}},
+	},
+	"import_csv": {
+		"mapping": {map[string]any{"Site": "name", "Customer ID": "company.id", "City": "address.city"}},
+	},
+	"list_entities": {
+		"extra_filters": {map[string]any{"inOut": "true", "foreignId": "123"}},
+	},
+}
+
+// inputSchema infers the input schema of tool name from In and adds its
+// toolExamples. It panics when In cannot be described, as the SDK does.
+func inputSchema[In any](name string) *jsonschema.Schema {
+	schema, err := jsonschema.For[In](nil)
+	if err != nil {
+		panic(fmt.Sprintf("tool %q: input schema: %v", name, err))
+	}
+	for prop, examples := range toolExamples[name] {
+		p, ok := schema.Properties[prop]
+		if !ok {
+			panic(fmt.Sprintf("tool %q: example for unknown property %q", name, prop))
+		}
+		p.Examples = append(p.Examples, examples...)
+	}
+	return schema
+}
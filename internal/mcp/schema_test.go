@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestToolSchemasCarryExamples checks the listed create_entity and
+// update_entity schemas show a {"id": N} reference inside their fields example.
+func TestToolSchemasCarryExamples(t *testing.T) {
+	_, c, _ := fakeInstance(t, "one")
+	cs := connect(t, NewServer(itportal.NewClient("http://itportal.invalid", "k"), c))
+	res, err := cs.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, tool := range res.Tools {
+		if tool.Name != "create_entity" && tool.Name != "update_entity" {
+			continue
+		}
+		seen[tool.Name] = true
+		data, err := json.Marshal(tool.InputSchema)
+		if err != nil {
+			t.Fatalf("marshal %s schema: %v", tool.Name, err)
+		}
+		var schema struct {
+			Properties map[string]struct {
+				Examples []map[string]any `json:"examples"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Fatalf("decode %s schema: %v", tool.Name, err)
+		}
+		examples := schema.Properties["fields"].Examples
+		if len(examples) == 0 {
+			t.Errorf("%s fields schema has no examples: %s", tool.Name, data)
+			continue
+		}
+		if ref, _ := json.Marshal(examples[0]["company"]); string(ref) != `{"id":5}` {
+			t.Errorf("%s first fields example company = %s, want {\"id\":5}", tool.Name, ref)
+		}
+	}
+	if !seen["create_entity"] || !seen["update_entity"] {
+		t.Fatalf("tools missing from list: %v", seen)
+	}
+}
+
+func TestInputSchemaRejectsUnknownExampleProperty(t *testing.T) {
+	toolExamples["test_tool"] = map[string][]any{"nope": {1}}
+	defer delete(toolExamples, "test_tool")
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), `"nope"`) {
+			t.Errorf("recover() = %v, want a panic naming the property", r)
+		}
+	}()
+	inputSchema[CreateEntityInput]("test_tool")
+}
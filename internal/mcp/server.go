@@ -4,6 +4,10 @@
 package mcp
 
 import (
+	"log/slog"
+	"strings"
+	"time"
+
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/alexfirilov/itportal-mcp/internal/cache"
@@ -15,11 +19,115 @@ type Handler struct {
 	client  *itportal.Client
 	cache   *cache.Cache
 	baseURL string
+	policy  WritePolicy
+	// phoneCountryCode enables contact phone normalisation when non-empty.
+	phoneCountryCode string
+	// defaultCompanyID, when non-zero, stands in for an omitted company_id on
+	// the create tools and company filters.
+	defaultCompanyID int
+
+	// instance names the ITPortal instance this Handler is bound to; uriPrefix
+	// ("" for the default instance, "<name>/" otherwise) scopes its resource URIs.
+	instance       string
+	uriPrefix      string
+	extraInstances []instanceSpec
+
+	// principalKeys maps MCP API keys to the instance each is pinned to.
+	principalKeys map[string]string
+
+	// denySecrets refuses tools and options that would return stored secrets.
+	denySecrets bool
+
+	// rawRequest registers the raw_request escape-hatch tool.
+	rawRequest bool
+
+	// drainer, when set, tracks in-flight tool calls for graceful shutdown.
+	drainer *Drainer
+
+	// limiter, when set, caps how many tool calls run at once.
+	limiter *ToolLimiter
+
+	// toolTimeout, when positive, is the deadline of each tool call.
+	toolTimeout time.Duration
+
+	// maxResultBytes, when positive, caps the size of tool text results and
+	// resource reads.
+	maxResultBytes int
+
+	// uploadExts, when set, replaces the default upload_file extension
+	// allow-list.
+	uploadExts UploadExtensions
+
+	// searchStemming lets search_docs match singular/plural word variants.
+	searchStemming bool
+
+	// validateDeviceTypes checks create_device's type_name against the
+	// instance's device types.
+	validateDeviceTypes bool
+
+	// logger, when set, receives a debug record of every tool call.
+	logger *slog.Logger
+
+	// deletes, when set, makes delete_entity a two-step call confirmed with a
+	// one-time token. NewServer always sets it.
+	deletes *pendingDeletes
+}
+
+// Option configures optional Handler behaviour.
+type Option func(*Handler)
+
+// WithWritePolicy restricts the write tools to the entity types p permits.
+func WithWritePolicy(p WritePolicy) Option {
+	return func(h *Handler) { h.policy = p }
+}
+
+// WithPhoneNormalization rewrites contact phone numbers to E.164-style form on
+// create/update, using countryCode for national numbers. Empty disables it.
+func WithPhoneNormalization(countryCode string) Option {
+	return func(h *Handler) { h.phoneCountryCode = strings.TrimPrefix(countryCode, "+") }
+}
+
+// WithDefaultCompany makes id the company_id of create tools and company
+// filters that omit one, for deployments documenting a single company. An
+// explicit company_id still wins. 0 disables it.
+func WithDefaultCompany(id int) Option {
+	return func(h *Handler) { h.defaultCompanyID = id }
+}
+
+// WithMaxResultBytes truncates any tool text result or resource read longer
+// than n bytes with a "[truncated; narrow your query]" marker. n <= 0 disables
+// the guard.
+func WithMaxResultBytes(n int) Option {
+	return func(h *Handler) { h.maxResultBytes = n }
+}
+
+// WithDenySecrets refuses every request for stored secrets: get_credentials,
+// reading credentials via manage_credential, export_company's include_secrets
+// and raw_request calls to credential endpoints. add_device_credential is
+// refused too.
+func WithDenySecrets(deny bool) Option {
+	return func(h *Handler) { h.denySecrets = deny }
+}
+
+// WithRawRequest registers the raw_request tool, which forwards arbitrary
+// requests under /api/2.0/ to ITPortal. It is off by default.
+func WithRawRequest(enabled bool) Option {
+	return func(h *Handler) { h.rawRequest = enabled }
+}
+
+// WithSearchStemming makes search_docs also match the singular/plural form of
+// each query word when the plain search finds fewer hits than requested.
+func WithSearchStemming(enabled bool) Option {
+	return func(h *Handler) { h.searchStemming = enabled }
 }
 
 // NewServer builds and configures the MCP server with all tools and resources.
-func NewServer(client *itportal.Client, c *cache.Cache) *sdkmcp.Server {
-	h := &Handler{client: client, cache: c, baseURL: client.BaseURL()}
+func NewServer(client *itportal.Client, c *cache.Cache, opts ...Option) *sdkmcp.Server {
+	h := &Handler{client: client, cache: c, baseURL: client.BaseURL(), deletes: newPendingDeletes()}
+	for _, o := range opts {
+		o(h)
+	}
+	r := newInstanceRouter(h)
 
 	instructions := `You are an ITPortal documentation assistant for a Managed Service Provider, backed by
 the ITPortal REST API v2.1 and an embedded SQLite index of the documentation.
@@ -31,7 +139,13 @@ You have access to:
    design and fits the tool-output limit. It is NOT the full environment — drill down for detail.
 2. Per-section resources (itportal://snapshot/devices, /configurations, /accounts, …) that return
    the full rows of one section as paginated JSON (use ?offset= & ?limit= to page).
-3. Tools to search, query, create, update and delete documentation in real time, backed by the
+3. A device inventory (itportal://inventory) — every device grouped by company then site, with
+   type, manufacturer, model and serial. Read it for "what hardware does X have" questions.
+4. An environment summary (itportal://summary) — counts, the companies with the most devices,
+   agreements and warranties running out, and records overdue for review. A cheap first briefing.
+5. A capability matrix (itportal://capabilities) — which tools list, get, create, update, delete
+   and upload each entity type. Check it before acting on an unfamiliar type.
+6. Tools to search, query, create, update and delete documentation in real time, backed by the
    SQLite index for fast, precise lookups.
 
 Workflow for answering questions:
@@ -42,22 +156,35 @@ Workflow for answering questions:
 3. For a full record (and, for devices, IPs/notes/management URLs), use get_entity_details(entity_type,id).
 4. To enumerate a whole section, read the matching itportal://snapshot/<section> resource and page it.
 5. The index auto-refreshes periodically. Call refresh_snapshot for guaranteed-fresh data, then
-   re-read itportal://snapshot.
+   re-read itportal://snapshot. A rebuild can take minutes: refresh_snapshot(async=true) returns a
+   job_id at once; poll refresh_status(job_id) until it reports completed or failed.
 
 Tool guide:
-- Read:    search_docs, list_entities, get_entity_details, get_logs, get_credentials.
+- Read:    search_docs, search_contacts, list_entities, get_entity_details, entity_exists,
+           get_by_foreign_id, get_device_by_ip, get_ipnetwork_by_vlan, export_company, company_org,
+           devices_expiring, devices_missing_data, list_devices_by_lifecycle, whats_new,
+           describe_entity, get_contact_photo, get_backlinks, get_logs, get_entity_history,
+           list_device_configs, get_credentials.
 - Create:  create_device, create_kb_article, create_entity (generic), add_device_ip, add_device_note,
-           add_interaction, upload_file.
-- Modify:  update_entity, delete_entity.
+           add_device_credential, add_interaction, append_note, upload_file,
+           create_ip_network (plain IPs and IDs; prefer it over create_entity for networks),
+           import_csv (one entity per CSV row, per-row errors).
+- Modify:  update_entity, upsert_entity (update the match or create it), update_address,
+           recategorize_kb (move a KB article's category/company),
+           bulk_update (filter + fields, capped by max_items),
+           validate_changeset (dry-run a batch of create/update/delete operations first),
+           delete_entity (two calls: preview + confirm token).
 - Linking & files: manage_relationship (link two objects), manage_folder + manage_folder_file
            (per-object document trees), manage_credential (additional credentials).
 - Switch ports: manage_switch_ports (a switch's Switch Ports tab — list/get/create/update/delete
            port ranges; per-port descriptions are read-only via the API, so record port notes in
            the range description).
-- Admin:   manage_type (custom type lists), manage_kb_category (KB categories/subcategories).
+- Admin:   manage_type (custom type lists), manage_kb_category (KB categories/subcategories),
+           list_kb_categories (the category tree), selftest (connectivity/auth and snapshot diagnostics).
 
 Field conventions:
-- Reference fields (company, site, type) use {"id": N} objects.
+- Reference fields (company, site, type) use {"id": N} objects. describe_entity lists every
+  field name, its type and which fields are references, for create/update calls.
 - Dates are YYYY-MM-DD strings.
 - The "url" field on entities is a read-only portal deep-link, not editable.
 - Relationship/credential targets use an itemType + id pair (e.g. {"itemType":"Device","id":42}).
@@ -69,6 +196,16 @@ Field conventions:
   heading and its "url" field; reuse it. Never invent a url, and never link an object that is not
   present in the snapshot or a tool result.`
 
+	if r.multi() {
+		instructions += `
+
+Instances:
+- This server fronts several ITPortal instances: ` + strings.Join(r.names, ", ") + `. Every tool takes an
+  optional "instance" argument (default: ` + r.names[0] + `). Records, ids and urls are per instance —
+  never mix ids across instances. Each non-default instance's resources live under
+  itportal://<instance>/snapshot (e.g. itportal://` + r.names[1] + `/snapshot).`
+	}
+
 	server := sdkmcp.NewServer(&sdkmcp.Implementation{
 		Name:    "itportal-mcp",
 		Version: "2.1.0",
@@ -77,19 +214,8 @@ Field conventions:
 	})
 
 	// ---- Resources ----
-	// itportal://snapshot — COMPACT index (default entry point). Small JSON: one
-	// line per object. Drill down with search_docs / get_entity_details / sections.
-	server.AddResource(&sdkmcp.Resource{
-		Name: "ITPortal Documentation Index",
-		Description: "COMPACT index of every documented object: type, id, name, one-line summary and portal " +
-			"url. Small enough to fit the output limit — read this first to see what exists, then drill " +
-			"down with search_docs and get_entity_details. NOT a full-environment dump. Supports " +
-			"?type=device&limit=&offset= query params.",
-		URI:      "itportal://snapshot",
-		MIMEType: "application/json",
-	}, h.IndexResource)
-
-	// itportal://snapshot/<section> — full rows of one section, paginated JSON.
+	// Registered once per instance: the default instance under itportal://snapshot,
+	// every other instance under itportal://<name>/snapshot.
 	sectionDescriptions := map[string]string{
 		"companies":      "Full company records",
 		"sites":          "Full site records",
@@ -104,135 +230,344 @@ Field conventions:
 		"cabinets":       "Full cabinet records",
 		"configurations": "Full configuration records",
 	}
-	for _, section := range sectionNames {
+	for _, name := range r.names {
+		ih := r.handlers[name]
+		label := ""
+		if r.multi() {
+			label = " [" + name + "]"
+		}
+
+		// itportal://snapshot — COMPACT index (default entry point). Small JSON: one
+		// line per object. Drill down with search_docs / get_entity_details / sections.
+		server.AddResource(&sdkmcp.Resource{
+			Name: "ITPortal Documentation Index" + label,
+			Description: "COMPACT index of every documented object: type, id, name, one-line summary and portal " +
+				"url. Small enough to fit the output limit — read this first to see what exists, then drill " +
+				"down with search_docs and get_entity_details. NOT a full-environment dump. Supports " +
+				"?type=device&limit=&offset= query params; ?from=&to= instead returns that rune range of the " +
+				"full Markdown snapshot.",
+			URI:      ih.snapshotURI(),
+			MIMEType: "application/json",
+		}, r.scoped(name, ih.IndexResource))
+
+		// itportal://snapshot-meta — build time and age, kept out of the index.
+		server.AddResource(&sdkmcp.Resource{
+			Name: "Snapshot metadata" + label,
+			Description: "When the cached snapshot was built, its age in seconds, any sections " +
+				"truncated at their cap and consecutive failed refreshes with the last error. Read this for freshness instead of the index's generated_at, " +
+				"which is omitted when SNAPSHOT_STABLE_BODY is on.",
+			URI:      ih.snapshotMetaURI(),
+			MIMEType: "application/json",
+		}, r.scoped(name, ih.SnapshotMetaResource))
+
+		// itportal://snapshot/<section> — full rows of one section, paginated JSON.
+		for _, section := range sectionNames {
+			server.AddResource(&sdkmcp.Resource{
+				Name: "Snapshot section: " + section + label,
+				Description: sectionDescriptions[section] + " as paginated JSON (default " +
+					"100 rows; page with ?offset= & ?limit=).",
+				URI:      ih.snapshotURI() + "/" + section,
+				MIMEType: "application/json",
+			}, r.scoped(name, ih.SectionResource))
+		}
+
+		// itportal://inventory — devices grouped by company then site, as Markdown tables.
+		server.AddResource(&sdkmcp.Resource{
+			Name: "Device inventory" + label,
+			Description: "Compact device inventory grouped by company, then site: one table row per device " +
+				"with ID, name, type, manufacturer, model and serial. Built from the cached snapshot; use " +
+				"it for quick inventory questions, and get_entity_details for a full record.",
+			URI:      ih.inventoryURI(),
+			MIMEType: "text/markdown",
+		}, r.scoped(name, ih.InventoryResource))
+
+		// itportal://summary — short executive briefing derived from the snapshot.
+		server.AddResource(&sdkmcp.Resource{
+			Name: "Environment summary" + label,
+			Description: "Short Markdown briefing on the documented environment: entity counts, the top " +
+				"companies by device count, agreements and device warranties expiring in the next 90 days, " +
+				"and records past their review due date. Built from the cached snapshot.",
+			URI:      ih.summaryURI(),
+			MIMEType: "text/markdown",
+		}, r.scoped(name, ih.SummaryResource))
+
+		// itportal://capabilities — which tools handle which operations on each entity type.
 		server.AddResource(&sdkmcp.Resource{
-			Name: "Snapshot section: " + section,
-			Description: sectionDescriptions[section] + " as paginated JSON (default " +
-				"100 rows; page with ?offset= & ?limit=).",
-			URI:      "itportal://snapshot/" + section,
+			Name: "Entity capabilities" + label,
+			Description: "JSON matrix of every supported entity type and the tools that list, get, create, " +
+				"update, delete and upload it, derived from the wired handlers, plus any write-policy " +
+				"refusal. Read it before calling a tool on an unfamiliar entity type.",
+			URI:      ih.capabilitiesURI(),
 			MIMEType: "application/json",
-		}, h.SectionResource)
+		}, r.scoped(name, ih.CapabilitiesResource))
 	}
 
 	// ---- Read tools ----
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "search_docs",
-		Description: "Search the documentation via the embedded SQLite index. Resolves exact lookups by IP address, serial number and name, plus full-text keyword search over names, summaries, notes and identifiers. Returns compact hits (type, id, name, summary, portal url, match snippet) — drill into any with get_entity_details. Fast and token-efficient; does not hit the live API.",
-	}, h.SearchDocs)
+		Description: "Search the documentation via the embedded SQLite index. Resolves exact lookups by IP address, serial number and name, plus full-text keyword search over names, summaries, notes and identifiers. Returns compact hits (type, id, name, summary, portal url, match snippet) — drill into any with get_entity_details. company_id narrows hits to one company and its entities. Fast and token-efficient; does not hit the live API.",
+	}, r, (*Handler).SearchDocs)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
+		Name:        "search_contacts",
+		Description: "Find contacts by name, email address, phone number (any formatting) or note text. Searches the cached contact records directly and returns ranked matches with IDs, the field that matched, and portal url. Use when search_docs misses a contact known only by email or phone.",
+	}, r, (*Handler).SearchContacts)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "company_org",
+		Description: "Who's who at a company: its cached contacts grouped by contact type (role, e.g. Technical, Billing, Management) as Markdown, with each contact's ID, site, email and phone numbers.",
+	}, r, (*Handler).CompanyOrg)
+
+	addTool(server, &sdkmcp.Tool{
 		Name:        "list_entities",
 		Description: "List entities of a given type from ITPortal with optional filters. Returns paginated live results directly from the API. Use for targeted queries where snapshot search isn't precise enough.",
-	}, h.ListEntities)
+	}, r, (*Handler).ListEntities)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "get_entity_details",
-		Description: "Fetch full details for a single entity by type and ID. For devices, also returns IP addresses, management URLs and notes. Use when you need complete structured data for a specific record.",
-	}, h.GetEntityDetails)
+		Description: "Fetch full details for a single entity by type and ID. For devices, also returns IP addresses, management URLs and notes; for KBs, raw_html=true returns the description and article HTML exactly as stored. Use when you need complete structured data for a specific record.",
+	}, r, (*Handler).GetEntityDetails)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "entity_exists",
+		Description: "Cheaply confirm an entity exists before updating or deleting it: one GET by type and ID, returning exists (true/false), its name and portal url. A missing ID answers exists=false rather than an error.",
+	}, r, (*Handler).EntityExists)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "get_by_foreign_id",
+		Description: "Find the ITPortal record linked to an external system (PSA/RMM) by its foreign ID. Supports company, site, device and agreement. Pass foreign_type (sites, devices, agreements) when several external systems share IDs. Returns the matched entity, or every match when the ID is not unique.",
+	}, r, (*Handler).GetByForeignID)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "get_device_by_ip",
+		Description: "Find the device that holds an IP address (live lookup). A unique match returns the full device with IPs, notes and management URLs; several matches are listed for disambiguation.",
+	}, r, (*Handler).GetDeviceByIP)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "get_ipnetwork_by_vlan",
+		Description: "Find the IP networks tagged with a VLAN ID in the cached snapshot, optionally within one company. Returns each network's range, gateway, DNS and DHCP servers, site and portal url.",
+	}, r, (*Handler).GetIPNetworkByVLAN)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "export_company",
+		Description: "Export one company's full documentation (sites, devices with live IPs/notes/management URLs, contacts, accounts, agreements, documents, networks, facilities, cabinets, configurations, KB articles) as a single Markdown or JSON file, returned base64-encoded for the client to save. Secrets are omitted unless include_secrets=true.",
+	}, r, (*Handler).ExportCompany)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "devices_expiring",
+		Description: "Report devices whose warranty, lease end or retire date falls within the next within_days days (default 90), grouped by company and sorted soonest first. Reads the cached snapshot; optionally filter by company_id or include already-passed dates.",
+	}, r, (*Handler).DevicesExpiring)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "devices_missing_data",
+		Description: "Documentation quality check: list cached devices lacking a serial, type, location, site, manufacturer or model (fields; default serial, type, ip, location), grouped by company with what each is missing. Device IPs are not cached, so ip is reported as unchecked. Optionally filter by company_id.",
+	}, r, (*Handler).DevicesMissingData)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "list_devices_by_lifecycle",
+		Description: "List cached devices in one lifecycle state: active, retired (marked out or past its retire date), lease_ended or warranty_expired. States are derived from the device dates when the snapshot is built, the most final one winning; optionally filter by company_id.",
+	}, r, (*Handler).ListDevicesByLifecycle)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "whats_new",
+		Description: "List what changed recently: cached entities whose modified time is later than when the previous snapshot was built (or than since), grouped by type, oldest change first. Use it to catch up without scanning everything; it sees changes as of the current snapshot.",
+	}, r, (*Handler).WhatsNew)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "describe_entity",
+		Description: "Describe the fields of an entity type as the API accepts them: JSON field names, types, which are reference objects (set with {\"id\": N}) and which are read-only. Derived from the server's own models; call it before create_entity or update_entity instead of guessing field names.",
+	}, r, (*Handler).DescribeEntity)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "get_contact_photo",
+		Description: "Download a contact's photo (the image upload_file stores with entity_type=contact_photo). Returns it base64-encoded with its content type, or says the contact has no photo. Files over 10 MiB are refused.",
+	}, r, (*Handler).GetContactPhoto)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "get_backlinks",
+		Description: "List the cached entities that reference a company, site, facility, cabinet or device through their reference fields — e.g. every device, contact and cabinet at a site, or the configurations of a device. Each entry names the field (via) it references through.",
+	}, r, (*Handler).GetBacklinks)
 
 	// ---- Write tools ----
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "create_kb_article",
 		Description: "Create a new knowledge base article for a company. Use this to document procedures, configurations, troubleshooting guides or any other reference information. The 'description' field is a short synopsis; put the full note/document body in 'article' (HTML) or 'article_markdown' (Markdown, auto-converted).",
-	}, h.CreateKBArticle)
+	}, r, (*Handler).CreateKBArticle)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "create_device",
-		Description: "Create a new device record in ITPortal. Optionally adds a primary IP, management URL and an initial note in a single call. Use for onboarding new hardware.",
-	}, h.CreateDevice)
+		Description: "Create a new device record in ITPortal. Optionally adds a primary IP, management URL, an initial note and (link_site_contact) a note naming the site's main contact in a single call. Use for onboarding new hardware.",
+	}, r, (*Handler).CreateDevice)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "create_entity",
 		Description: "Create any other entity type (company, site, contact, account, agreement, document, facility, cabinet, configuration, ip_network). Provide fields as a JSON object. Refer to the snapshot for field names and reference object structure.",
-	}, h.CreateEntity)
+	}, r, (*Handler).CreateEntity)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
-		Name:        "update_entity",
-		Description: "Update (PATCH) an existing entity. Only include fields that should change. Reference fields use {\"id\": N} format. Entity types: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, additional_credential. For kb, the note/document body is the 'article' field (HTML); pass 'article_markdown' instead to author in Markdown (auto-converted to article). 'description' is only the short synopsis.",
-	}, h.UpdateEntity)
+	addTool(server, &sdkmcp.Tool{
+		Name:        "create_ip_network",
+		Description: "Create an IP network from plain values: name, company_id, optional site_id, network (address or CIDR) with subnet_mask or cidr, gateway, dns1, dns2 and vlan. Builds the company/site references and the defaultGateway/dnsServer IP objects for you; prefer it over create_entity for IP networks.",
+	}, r, (*Handler).CreateIPNetwork)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "import_csv",
+		Description: "Import a spreadsheet: create one entity (any create_entity type) per row of a base64 CSV, using mapping to turn column headers into fields (dotted paths like company.id set references). Rows that fail are reported with their line and error without stopping the rest. Files over max_rows (default 100) are refused.",
+	}, r, (*Handler).ImportCSV)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
+		Name:        "update_entity",
+		Description: "Update (PATCH) an existing entity. Only include fields that should change. Reference fields use {\"id\": N} format. Entity types: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, additional_credential. For kb, the note/document body is the 'article' field (HTML); pass 'article_markdown' instead to author in Markdown (auto-converted to article). 'description' is only the short synopsis. reviewer_user_id and due_date (YYYY-MM-DD) set reviewBy/dueDate on entities that have them.",
+	}, r, (*Handler).UpdateEntity)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "upsert_entity",
+		Description: "Ensure a record exists with the given fields: looks up the entity of entity_type matching every field in match (e.g. {\"name\": \"fw01\", \"company\": {\"id\": 3}}), patches it with fields when exactly one matches, or creates one from match plus fields when none does. Reports which happened; several matches are refused with their IDs. Works for devices and every create_entity type.",
+	}, r, (*Handler).UpsertEntity)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "update_address",
+		Description: "Update the address of a company, site, facility or cabinet. Give only the parts that change (address1, address2, city, state, zip, country); the nested address object is built for you, so prefer this over update_entity for addresses.",
+	}, r, (*Handler).UpdateAddress)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "bulk_update",
+		Description: "Set the same fields on every record of one entity type matching a filter (the list_entities filters), e.g. a status on all sites of a company. max_items is required: when more records match, nothing is changed. Returns each matched record's ID, name and whether its update succeeded.",
+	}, r, (*Handler).BulkUpdate)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "validate_changeset",
+		Description: "Dry-run a batch of proposed create/update/delete operations without applying any. Checks each one's entity type, the write policy, required fields, field names and types, YYYY-MM-DD dates, and that the target record and every referenced record exist, and returns a per-operation valid flag with field-level errors. Use before a multi-entity change.",
+	}, r, (*Handler).ValidateChangeset)
+
+	addTool(server, &sdkmcp.Tool{
 		Name:        "add_device_ip",
-		Description: "Add an IP address record to an existing device. Optionally associates it with a MAC address, description and IP network.",
-	}, h.AddDeviceIP)
+		Description: "Add an IP address record to an existing device. Optionally associates it with a MAC address, description and IP network; with ip_network_id the IP must lie in that network, and include_network also returns its gateway, DNS servers and VLAN. An IP already on the device is reported instead of duplicated unless force=true.",
+	}, r, (*Handler).AddDeviceIP)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "add_device_note",
 		Description: "Add a timestamped note to an existing device. Supports plain text or HTML.",
-	}, h.AddDeviceNote)
+	}, r, (*Handler).AddDeviceNote)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "add_device_credential",
+		Description: "Store a login (username, password, optional domain, description and 2FA) on an existing device. Returns the new credential ID; the password is never echoed. Refused when the server denies secret access.",
+	}, r, (*Handler).AddDeviceCredential)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "upload_file",
-		Description: "Upload a file or image to an ITPortal entity. Accepts base64-encoded content. Useful for attaching network diagrams, screenshots, configuration files or contact photos.",
-	}, h.UploadFile)
+		Description: "Upload a file or image to an ITPortal entity. Accepts base64-encoded content. Useful for attaching network diagrams, screenshots, configuration files or contact photos. Files are limited to 10 MiB.",
+	}, r, (*Handler).UploadFile)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "list_device_configs",
+		Description: "List the configuration files stored on a device: file name, ID, date and description. Check it before uploading a config with upload_file(entity_type=device_config), to avoid duplicates.",
+	}, r, (*Handler).ListDeviceConfigs)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "refresh_snapshot",
-		Description: "Force an immediate rebuild of the documentation snapshot from ITPortal. Use after making bulk changes or when you need guaranteed up-to-date data. The snapshot normally auto-refreshes on a schedule.",
-	}, h.RefreshSnapshot)
+		Description: "Force an immediate rebuild of the documentation snapshot from ITPortal. Use after making bulk changes or when you need guaranteed up-to-date data. The snapshot normally auto-refreshes on a schedule. Set async=true to return a job_id immediately instead of waiting; concurrent requests share one rebuild.",
+	}, r, (*Handler).RefreshSnapshot)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
+		Name:        "refresh_status",
+		Description: "Report the state (running, completed or failed) of a snapshot rebuild started with refresh_snapshot, with per-type record counts once it completes. Omit job_id for the most recent rebuild.",
+	}, r, (*Handler).RefreshStatus)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "selftest",
+		Description: "Diagnose the server setup: checks connectivity and authentication to ITPortal with a one-row list, and reports the configured base URL, snapshot age and whether background refresh is running. Use when tools fail unexpectedly or to confirm a new deployment.",
+	}, r, (*Handler).SelfTest)
+
+	addTool(server, &sdkmcp.Tool{
 		Name:        "delete_entity",
-		Description: "Delete an entity by type and ID. Supports company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address, additional_credential and interaction. Deletes are permanent — confirm the target first.",
-	}, h.DeleteEntity)
+		Description: "Delete an entity by type and ID. Supports company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address, additional_credential and interaction. Deletes are permanent, so this takes two calls: the first (without confirm) only previews the entity and returns a one-time confirm token; repeat the call with that token within 5 minutes to delete.",
+	}, r, (*Handler).DeleteEntity)
 
 	// ---- v2.1: relationships, folders, files ----
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_relationship",
 		Description: "List, create, update or delete relationships (links) between two portal objects. Links are symmetric — a device↔document link appears from both sides. Use action=create with object_type/object_id as the source and target_type/target_id as the destination.",
-	}, h.ManageRelationship)
+	}, r, (*Handler).ManageRelationship)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_switch_ports",
 		Description: "Read and manage a switch's Switch Ports tab. Actions: list (all switch-port ranges for a device, each with its full nested port list — port numbers, per-port descriptions and device/IP assignments), get (one range by range_id), create (a new port range — needs name, starting_port, ending_port; ITPortal auto-provisions the ports), update (range fields incl. description), delete (a range). IMPORTANT: the ITPortal API only supports writing the RANGE container (name, port span, description, multiple_devices). Individual per-port descriptions and port-to-device assignments are READ-ONLY over the API and can only be edited in the ITPortal web UI — to record an uplink/port note when the per-port field isn't writable, put it in the range description.",
-	}, h.ManageSwitchPorts)
+	}, r, (*Handler).ManageSwitchPorts)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_folder",
 		Description: "Manage the folder tree attached to an object (defaults to documents). Actions: list, get, create, update, delete. The first list call auto-creates Root_Folder; create child folders by passing parent_folder_id.",
-	}, h.ManageFolder)
+	}, r, (*Handler).ManageFolder)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_folder_file",
 		Description: "Upload, list, download, rename or delete files inside an object's folder. Upload takes base64-encoded content; download returns base64. A folder cannot be deleted while it still contains files.",
-	}, h.ManageFolderFile)
+	}, r, (*Handler).ManageFolderFile)
 
 	// ---- v2.1: admin / metadata ----
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_type",
 		Description: "List, create, rename or delete the custom type lists used by entities (kinds: account, agreement, company, contact, device, document, facility, configuration). A type in use cannot be deleted.",
-	}, h.ManageType)
+	}, r, (*Handler).ManageType)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_kb_category",
 		Description: "Manage knowledge-base categories and subcategories: list, create, update, delete, and create_subcategory/update_subcategory/delete_subcategory. A category containing articles cannot be deleted.",
-	}, h.ManageKBCategory)
+	}, r, (*Handler).ManageKBCategory)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "list_kb_categories",
+		Description: "List the KB categories with their subcategories nested under them, optionally filtered by name. create_kb_article needs a category_id and sub_category_id from this list; unknown IDs are refused there with the valid options.",
+	}, r, (*Handler).ListKBCategories)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
+		Name:        "recategorize_kb",
+		Description: "Move a KB article to another category/subcategory and/or company, and optionally set or clear its public flag. Builds the nested category, subCategory and company references for you; the category pair is checked against list_kb_categories first.",
+	}, r, (*Handler).RecategorizeKB)
+
+	addTool(server, &sdkmcp.Tool{
 		Name:        "add_interaction",
 		Description: "Add (or list) timeline interaction notes on an object. Valid object types: account, agreement, cabinet, configuration, contact, device, document, facility, ipnetwork, kb, site. Company/client is not supported.",
-	}, h.AddInteraction)
+	}, r, (*Handler).AddInteraction)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "append_note",
+		Description: "Append a timestamped line to the notes of a company, contact, account, agreement, IP network, facility, cabinet or configuration, keeping the existing notes. For devices use add_device_note.",
+	}, r, (*Handler).AppendNote)
 
 	// ---- v2.1: credentials & logs ----
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "manage_credential",
 		Description: "Create, read, update or delete additional credentials and attach them to any object via portal_object_type/portal_object_id. Handles secrets — only call when explicitly asked to store or change a credential.",
-	}, h.ManageCredential)
+	}, r, (*Handler).ManageCredential)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "get_credentials",
 		Description: "Retrieve the stored credentials (username/password/2FA) for an account, device or configuration. Returns secrets, so only call when the user explicitly needs them. Requires the server's encryption key for custom-encryption orgs.",
-	}, h.GetCredentials)
+	}, r, (*Handler).GetCredentials)
 
-	sdkmcp.AddTool(server, &sdkmcp.Tool{
+	addTool(server, &sdkmcp.Tool{
 		Name:        "get_logs",
 		Description: "Query ITPortal audit logs: userAccess, adminAccess, loginLogout, passwordAccess, passwordChanges. Most require a start_date/end_date range (YYYY-MM-DD).",
-	}, h.GetLogs)
+	}, r, (*Handler).GetLogs)
+
+	addTool(server, &sdkmcp.Tool{
+		Name:        "get_entity_history",
+		Description: "Show an entity's change history as a timeline, oldest first: when, who, and what changed (field: old → new). Not every ITPortal exposes per-entity history; those answer with a clear unsupported message.",
+	}, r, (*Handler).GetEntityHistory)
+
+	if h.rawRequest {
+		addTool(server, &sdkmcp.Tool{
+			Name:        "raw_request",
+			Description: "Advanced escape hatch: send a raw request (GET, POST, PUT, PATCH or DELETE) to an ITPortal endpoint or field the other tools don't model, and get the raw HTTP status and body back. The path must start with /api/2.0/. Prefer the dedicated tools whenever they cover the task.",
+		}, r, (*Handler).RawRequest)
+	}
 
 	return server
 }
@@ -0,0 +1,98 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// lookupSite returns site id from the snapshot, falling back to a live fetch
+// for sites created since the last refresh.
+func (h *Handler) lookupSite(ctx context.Context, id int) (*itportal.Site, error) {
+	if h.cache != nil {
+		if snap := h.cache.Get(); snap != nil {
+			for i := range snap.Sites {
+				if snap.Sites[i].ID == id {
+					return &snap.Sites[i], nil
+				}
+			}
+		}
+	}
+	s, err := h.client.GetSite(ctx, strconv.Itoa(id))
+	if err != nil {
+		return nil, fmt.Errorf("get site %d: %w", id, err)
+	}
+	return s, nil
+}
+
+// lookupContact returns contact id from the snapshot, or nil when it is not
+// cached.
+func (h *Handler) lookupContact(id int) *itportal.Contact {
+	if h.cache == nil {
+		return nil
+	}
+	snap := h.cache.Get()
+	if snap == nil {
+		return nil
+	}
+	for i := range snap.Contacts {
+		if snap.Contacts[i].ID == id {
+			return &snap.Contacts[i]
+		}
+	}
+	return nil
+}
+
+// linkSiteContact records site siteID's main contact on device deviceID as a
+// note, ITPortal devices having no contact field of their own. It returns the
+// create_device side-effect line reporting the outcome, or a warning when the
+// link failed.
+func (h *Handler) linkSiteContact(ctx context.Context, deviceID string, siteID int) (line, warning string) {
+	site, err := h.lookupSite(ctx, siteID)
+	if err != nil {
+		return "", fmt.Sprintf("Could not resolve the site contact: %v", err)
+	}
+	if site.Contact == nil || site.Contact.ID == 0 {
+		return fmt.Sprintf("ℹ Site %s (ID: %d) has no contact to link", site.Name, site.ID), ""
+	}
+	text := siteContactNote(site, h.lookupContact(site.Contact.ID))
+	added, err := h.client.AddDeviceNote(ctx, deviceID, &itportal.DeviceNote{Notes: text})
+	if err != nil {
+		return "", fmt.Sprintf("Could not add the site contact note: %v", err)
+	}
+	return fmt.Sprintf("✓ Site contact linked: %s (note ID: %d)", strings.TrimPrefix(text, "On-site contact: "), added.ID), ""
+}
+
+// siteContactNote is the device note naming site's contact, with the email and
+// phone numbers of c, the cached contact record, when there is one.
+func siteContactNote(site *itportal.Site, c *itportal.Contact) string {
+	name := site.Contact.Name
+	if c != nil {
+		name = cache.FirstNonEmpty(c.FullName(), name)
+	}
+	if name == "" {
+		name = fmt.Sprintf("Contact #%d", site.Contact.ID)
+	}
+	line := fmt.Sprintf("On-site contact: %s (contact ID: %d, from site %s)", name, site.Contact.ID, site.Name)
+	if c == nil {
+		return line
+	}
+	var reach []string
+	if c.Email != "" {
+		reach = append(reach, c.Email)
+	}
+	if c.DirectNumber != "" {
+		reach = append(reach, "direct "+c.DirectNumber)
+	}
+	if c.Mobile != "" {
+		reach = append(reach, "mobile "+c.Mobile)
+	}
+	if len(reach) > 0 {
+		line += " — " + strings.Join(reach, " · ")
+	}
+	return line
+}
@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+func TestCreateDeviceLinksSiteContact(t *testing.T) {
+	var notes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/2.1")
+		switch {
+		case r.Method == http.MethodPost && path == "/devices/":
+			w.Header().Set("Location", "/api/2.1/devices/42/")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && path == "/devices/42/notes/":
+			var n itportal.DeviceNote
+			_ = json.NewDecoder(r.Body).Decode(&n)
+			notes = append(notes, n.Notes)
+			w.Header().Set("Location", "/api/2.1/devices/42/notes/77/")
+			w.WriteHeader(http.StatusCreated)
+		case path == "/sites/":
+			writeList(w, []itportal.Site{
+				{ID: 4, Name: "HQ", Contact: &itportal.ContactReference{ID: 12, Name: "Ada Byte"}},
+				{ID: 5, Name: "Depot"},
+			}, "")
+		case path == "/contacts/":
+			writeList(w, []itportal.Contact{{ID: 12, FirstName: "Ada", LastName: "Byte", Email: "ada@acme.example", Mobile: "555-0100"}}, "")
+		case path == "/devices/42/":
+			writeList(w, []itportal.Device{{ID: 42, Name: "fw01"}}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+	ctx := context.Background()
+
+	res, _, err := h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, SiteID: 4, Name: "fw01", LinkSiteContact: true})
+	if err != nil || res.IsError {
+		t.Fatalf("CreateDevice: %v, %v", res, err)
+	}
+	want := "On-site contact: Ada Byte (contact ID: 12, from site HQ) — ada@acme.example · mobile 555-0100"
+	if len(notes) != 1 || notes[0] != want {
+		t.Errorf("notes = %q, want [%q]", notes, want)
+	}
+	if text := resultText(t, res); !strings.Contains(text, "✓ Site contact linked: Ada Byte (contact ID: 12") || !strings.Contains(text, "note ID: 77") {
+		t.Errorf("result does not report the linked contact:\n%s", text)
+	}
+
+	notes = nil
+	res, _, _ = h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, SiteID: 5, Name: "fw02", LinkSiteContact: true})
+	if len(notes) != 0 || !strings.Contains(resultText(t, res), "has no contact to link") {
+		t.Errorf("site without a contact: notes %q, result %s", notes, resultText(t, res))
+	}
+
+	res, _, _ = h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "fw03", LinkSiteContact: true})
+	if !res.IsError || !strings.Contains(resultText(t, res), "field site_id") {
+		t.Errorf("link_site_contact without site_id accepted: %s", resultText(t, res))
+	}
+}
@@ -0,0 +1,186 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+)
+
+// summaryTopCompanies is how many companies the summary ranks by device count.
+const summaryTopCompanies = 10
+
+// summaryOverdueListed caps how many overdue reviews the summary names.
+const summaryOverdueListed = 10
+
+// SummaryResource serves itportal://summary: a short Markdown briefing on the
+// cached environment — entity counts, the companies with the most devices,
+// agreements and warranties running out, and records overdue for review.
+func (h *Handler) SummaryResource(ctx context.Context, req *sdkmcp.ReadResourceRequest) (*sdkmcp.ReadResourceResult, error) {
+	if !h.snapshotReady() {
+		return nil, errors.New(snapshotNotReady)
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+	return h.resourceResult(req.Params.URI, "text/markdown", renderSummary(snap, time.Now()), -1), nil
+}
+
+// summaryURI is the summary resource URI of this Handler's instance.
+func (h *Handler) summaryURI() string {
+	return "itportal://" + h.uriPrefix + "summary"
+}
+
+// overdueReview is one record whose review due date has passed.
+type overdueReview struct {
+	typ  string
+	id   int
+	name string
+	due  time.Time
+}
+
+// renderSummary renders the environment briefing for snap as of now. Expiry
+// counts use the devices_expiring window (defaultExpiryWindowDays).
+func renderSummary(snap *cache.Snapshot, now time.Time) string {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	limit := today.AddDate(0, 0, defaultExpiryWindowDays)
+
+	var b strings.Builder
+	b.WriteString("# ITPortal environment summary\n\n")
+	fmt.Fprintf(&b, "_Snapshot of %s; dates as of %s._\n\n",
+		snap.GeneratedAt.Format("2006-01-02 15:04 UTC"), today.Format("2006-01-02"))
+	fmt.Fprintf(&b, "- **Companies**: %d · **Sites**: %d · **Devices**: %d · **Contacts**: %d\n",
+		len(snap.Companies), len(snap.Sites), len(snap.Devices), len(snap.Contacts))
+	fmt.Fprintf(&b, "- **Agreements**: %d · **KB articles**: %d · **Documents**: %d · **Accounts**: %d\n",
+		len(snap.Agreements), len(snap.KBs), len(snap.Documents), len(snap.Accounts))
+	if len(snap.Truncated) > 0 {
+		fmt.Fprintf(&b, "- **Incomplete**: %s hit the snapshot cap; figures for them are lower bounds\n",
+			strings.Join(snap.Truncated, ", "))
+	}
+
+	// ---- Top companies ----
+	names := make(map[int]string, len(snap.Companies))
+	for _, c := range snap.Companies {
+		names[c.ID] = c.Name
+	}
+	perCompany := map[int]int{}
+	for _, d := range snap.Devices {
+		if d.Company != nil && d.Company.ID != 0 {
+			perCompany[d.Company.ID]++
+			if names[d.Company.ID] == "" {
+				names[d.Company.ID] = d.Company.Name
+			}
+		}
+	}
+	ids := make([]int, 0, len(perCompany))
+	for id := range perCompany {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if perCompany[ids[i]] != perCompany[ids[j]] {
+			return perCompany[ids[i]] > perCompany[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	b.WriteString("\n## Top companies by device count\n\n")
+	if len(ids) == 0 {
+		b.WriteString("No devices are assigned to a company.\n")
+	}
+	for i, id := range ids {
+		if i == summaryTopCompanies {
+			fmt.Fprintf(&b, "- …and %d more companies with devices\n", len(ids)-i)
+			break
+		}
+		noun := "devices"
+		if perCompany[id] == 1 {
+			noun = "device"
+		}
+		fmt.Fprintf(&b, "%d. %s (ID: %d) — %d %s\n", i+1,
+			cache.FirstNonEmpty(names[id], fmt.Sprintf("Company %d", id)), id, perCompany[id], noun)
+	}
+
+	// ---- Expiring ----
+	count := func(dates ...string) (soon, passed int) {
+		for _, s := range dates {
+			t, ok := cache.ParseDate(s)
+			switch {
+			case !ok:
+			case t.Before(today):
+				passed++
+			case !t.After(limit):
+				soon++
+			}
+		}
+		return soon, passed
+	}
+	agreementDates := make([]string, 0, len(snap.Agreements))
+	for _, a := range snap.Agreements {
+		agreementDates = append(agreementDates, a.DateExpires)
+	}
+	warrantyDates := make([]string, 0, len(snap.Devices))
+	for _, d := range snap.Devices {
+		warrantyDates = append(warrantyDates, d.WarrantyExpires)
+	}
+	agSoon, agPassed := count(agreementDates...)
+	wSoon, wPassed := count(warrantyDates...)
+	fmt.Fprintf(&b, "\n## Expiring in the next %d days\n\n", defaultExpiryWindowDays)
+	fmt.Fprintf(&b, "- **Agreements**: %d expiring, %d already expired\n", agSoon, agPassed)
+	fmt.Fprintf(&b, "- **Device warranties**: %d expiring, %d already expired\n", wSoon, wPassed)
+	b.WriteString("\nUse devices_expiring for the device list.\n")
+
+	// ---- Overdue reviews ----
+	var overdue []overdueReview
+	add := func(typ string, id int, name, due string) {
+		if t, ok := cache.ParseDate(due); ok && t.Before(today) {
+			overdue = append(overdue, overdueReview{typ: typ, id: id, name: name, due: t})
+		}
+	}
+	for _, v := range snap.Sites {
+		add("site", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.Devices {
+		add("device", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.KBs {
+		add("kb", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.Accounts {
+		add("account", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.Agreements {
+		add("agreement", v.ID, cache.FirstNonEmpty(v.Description, fmt.Sprintf("Agreement #%d", v.ID)), v.DueDate)
+	}
+	for _, v := range snap.Documents {
+		add("document", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.IPNetworks {
+		add("ipnetwork", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.Facilities {
+		add("facility", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.Cabinets {
+		add("cabinet", v.ID, v.Name, v.DueDate)
+	}
+	for _, v := range snap.Configurations {
+		add("configuration", v.ID, v.Name, v.DueDate)
+	}
+	sort.SliceStable(overdue, func(i, j int) bool { return overdue[i].due.Before(overdue[j].due) })
+	fmt.Fprintf(&b, "\n## Overdue for review (%d)\n\n", len(overdue))
+	if len(overdue) == 0 {
+		b.WriteString("Nothing is past its review due date.\n")
+	}
+	for i, o := range overdue {
+		if i == summaryOverdueListed {
+			fmt.Fprintf(&b, "- …and %d more\n", len(overdue)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %s %s (ID: %d) — due %s\n", o.typ, o.name, o.id, o.due.Format("2006-01-02"))
+	}
+	return b.String()
+}
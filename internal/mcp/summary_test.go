@@ -0,0 +1,55 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestRenderSummaryReflectsSnapshot verifies the counts, company ranking,
+// expiry tallies and overdue reviews all come from the snapshot data.
+func TestRenderSummaryReflectsSnapshot(t *testing.T) {
+	now := time.Date(2026, 6, 15, 9, 0, 0, 0, time.UTC)
+	acme := &itportal.CompanyReference{ID: 1, Name: "Acme"}
+	zulu := &itportal.CompanyReference{ID: 2, Name: "Zulu"}
+	snap := &cache.Snapshot{
+		GeneratedAt: now,
+		Companies:   []itportal.Company{{ID: 1, Name: "Acme"}, {ID: 2, Name: "Zulu"}, {ID: 3, Name: "Empty"}},
+		Devices: []itportal.Device{
+			{ID: 10, Name: "a1", Company: acme, WarrantyExpires: "2026-07-01"},
+			{ID: 11, Name: "a2", Company: acme, WarrantyExpires: "2026-01-01", DueDate: "2026-03-01"},
+			{ID: 12, Name: "z1", Company: zulu, WarrantyExpires: "2027-06-01"},
+			{ID: 13, Name: "a3", Company: acme},
+		},
+		Agreements: []itportal.Agreement{
+			{ID: 20, Description: "Support", DateExpires: "2026-08-01"},
+			{ID: 21, Description: "Old lease", DateExpires: "2025-12-31", DueDate: "2026-06-14"},
+			{ID: 22, DateExpires: "2026-12-31"},
+		},
+		Sites:     []itportal.Site{{ID: 30, Name: "HQ", DueDate: "2026-06-15"}},
+		Truncated: []string{"devices"},
+	}
+	out := renderSummary(snap, now)
+
+	for _, want := range []string{
+		"**Companies**: 3 · **Sites**: 1 · **Devices**: 4",
+		"**Incomplete**: devices hit the snapshot cap",
+		"1. Acme (ID: 1) — 3 devices\n2. Zulu (ID: 2) — 1 device\n",
+		"**Agreements**: 1 expiring, 1 already expired",
+		"**Device warranties**: 1 expiring, 1 already expired",
+		"## Overdue for review (2)\n\n- device a2 (ID: 11) — due 2026-03-01\n- agreement Old lease (ID: 21) — due 2026-06-14\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Empty") {
+		t.Error("company without devices ranked")
+	}
+	if strings.Contains(out, "site HQ") {
+		t.Error("review due today counted as overdue")
+	}
+}
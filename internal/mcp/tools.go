@@ -1,12 +1,20 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
@@ -22,42 +30,56 @@ type SearchDocsInput struct {
 	Query      string `json:"query" jsonschema:"Search query: a keyword/topic, exact IP address, serial number, or object name. Multiple words are ANDed and prefix-matched."`
 	EntityType string `json:"entity_type,omitempty" jsonschema:"Optional: restrict to one entity type. Values: company, site, device, kb, contact, agreement, ipnetwork, document, account, facility, cabinet, configuration"`
 	Limit      int    `json:"limit,omitempty" jsonschema:"Max results to return. Default 50."`
+	CompanyID  string `json:"company_id,omitempty" jsonschema:"Optional: only return the company with this ID and entities belonging to it"`
 }
 
 type ListEntitiesInput struct {
-	EntityType     string `json:"entity_type" jsonschema:"Required. One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
-	Name           string `json:"name,omitempty" jsonschema:"Filter by exact name"`
-	NameStartsWith string `json:"name_starts_with,omitempty" jsonschema:"Filter by name prefix"`
-	CompanyID      string `json:"company_id,omitempty" jsonschema:"Filter by company ID (for sites, devices, contacts, accounts, KBs, agreements)"`
-	SiteID         string `json:"site_id,omitempty" jsonschema:"Filter by site ID (for devices, contacts)"`
-	TypeName       string `json:"type_name,omitempty" jsonschema:"Filter by entity type name (e.g. 'Server', 'Managed Services')"`
-	IPAddress      string `json:"ip_address,omitempty" jsonschema:"Filter devices by IP address"`
-	SerialNumber   string `json:"serial_number,omitempty" jsonschema:"Filter devices by serial number"`
-	Manufacturer   string `json:"manufacturer,omitempty" jsonschema:"Filter devices by manufacturer"`
-	ModifiedSince  string `json:"modified_since,omitempty" jsonschema:"Return items modified since this date (ISO 8601 format: YYYY-MM-DD)"`
-	Limit          int    `json:"limit,omitempty" jsonschema:"Max results to return. Default 50, max 500."`
-	Offset         int    `json:"offset,omitempty" jsonschema:"Results to skip (for pagination)"`
+	EntityType     string            `json:"entity_type" jsonschema:"Required. One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
+	Name           string            `json:"name,omitempty" jsonschema:"Filter by exact name"`
+	NameStartsWith string            `json:"name_starts_with,omitempty" jsonschema:"Filter by name prefix"`
+	CompanyID      string            `json:"company_id,omitempty" jsonschema:"Filter by company ID (for sites, devices, contacts, accounts, KBs, agreements)"`
+	SiteID         string            `json:"site_id,omitempty" jsonschema:"Filter by site ID (for devices, contacts)"`
+	TypeName       string            `json:"type_name,omitempty" jsonschema:"Filter by entity type name (e.g. 'Server', 'Managed Services')"`
+	IPAddress      string            `json:"ip_address,omitempty" jsonschema:"Filter devices by IP address"`
+	MacAddress     string            `json:"mac_address,omitempty" jsonschema:"Filter devices by MAC address, in any common notation (00:1a:2b:3c:4d:5e, 00-1A-2B-3C-4D-5E, 001a.2b3c.4d5e)"`
+	SerialNumber   string            `json:"serial_number,omitempty" jsonschema:"Filter devices by serial number"`
+	Manufacturer   string            `json:"manufacturer,omitempty" jsonschema:"Filter devices by manufacturer"`
+	ModifiedSince  string            `json:"modified_since,omitempty" jsonschema:"Return items modified since this date (ISO 8601 format: YYYY-MM-DD)"`
+	Limit          int               `json:"limit,omitempty" jsonschema:"Max results to return. Default 50, max 500."`
+	Offset         int               `json:"offset,omitempty" jsonschema:"Results to skip (for pagination)"`
+	Format         string            `json:"format,omitempty" jsonschema:"Output format: json (default), markdown (compact, readable) or yaml"`
+	ExtraFilters   map[string]string `json:"extra_filters,omitempty" jsonschema:"Optional: further ITPortal query parameters for this endpoint, e.g. {\"inOut\": \"true\", \"foreignId\": \"123\"}. Keys and values are sent verbatim as query parameters and override the filters above; unknown keys are ignored or rejected by ITPortal."`
+	ExcludeIDs     []int             `json:"exclude_ids,omitempty" jsonschema:"IDs to leave out of the results, e.g. those search_docs already returned. The page is fetched as usual, then these are dropped."`
 }
 
 type GetEntityInput struct {
 	EntityType string `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
 	ID         string `json:"id" jsonschema:"The numeric ID of the entity"`
+	Format     string `json:"format,omitempty" jsonschema:"Output format: json (default), markdown (compact, readable) or yaml"`
+	NotesLimit int    `json:"notes_limit,omitempty" jsonschema:"Devices only: return at most this many notes, newest first"`
+	NotesSince string `json:"notes_since,omitempty" jsonschema:"Devices only: return only notes dated on or after this day (YYYY-MM-DD), newest first"`
+	RawHTML    bool   `json:"raw_html,omitempty" jsonschema:"KBs only: return description and article as the exact stored HTML, unescaped and never cut to the result-size cap, for faithful editing. Always JSON; format is ignored."`
 }
 
+// uncapped exempts raw_html reads from the result-size cap.
+func (in GetEntityInput) uncapped() bool { return in.RawHTML }
+
 type CreateKBArticleInput struct {
-	CompanyID       int    `json:"company_id" jsonschema:"ID of the company this article belongs to"`
+	CompanyID       int    `json:"company_id,omitempty" jsonschema:"ID of the company this article belongs to (required unless the server has a default company)"`
 	Name            string `json:"name" jsonschema:"Title of the knowledge base article"`
 	Description     string `json:"description,omitempty" jsonschema:"Short synopsis of the article's purpose (max 3000 chars). This is NOT the document body — put the main content in article or article_markdown."`
 	Article         string `json:"article,omitempty" jsonschema:"The KB note / document body as HTML. This is the main content shown in the article/note area (distinct from description). Use article_markdown instead if you prefer to author in Markdown."`
 	ArticleMarkdown string `json:"article_markdown,omitempty" jsonschema:"The KB note / document body as Markdown (GitHub-Flavored: headings, lists, tables, links, code). Converted to HTML automatically. Takes precedence over article."`
-	CategoryID      int    `json:"category_id,omitempty" jsonschema:"KB category ID. Use list_entities with entity_type=kb_category to discover categories and their subcategories. The API requires BOTH category_id and sub_category_id."`
-	SubCategoryID   int    `json:"sub_category_id,omitempty" jsonschema:"KB subcategory ID (required by the API alongside category_id). Discover via list_entities entity_type=kb_category — each category lists its subCategories."`
+	CategoryID      int    `json:"category_id,omitempty" jsonschema:"KB category ID. Use list_kb_categories to discover categories and their subcategories. The API requires BOTH category_id and sub_category_id."`
+	SubCategoryID   int    `json:"sub_category_id,omitempty" jsonschema:"KB subcategory ID (required by the API alongside category_id). Discover via list_kb_categories."`
 	Public          bool   `json:"public,omitempty" jsonschema:"Set true to make the article publicly visible (default: false)"`
 	Expires         string `json:"expires,omitempty" jsonschema:"Expiration date in YYYY-MM-DD format"`
+	ReviewerUserID  int    `json:"reviewer_user_id,omitempty" jsonschema:"ID of the ITPortal user who should review the article (sets reviewBy)"`
+	DueDate         string `json:"due_date,omitempty" jsonschema:"Review due date in YYYY-MM-DD format"`
 }
 
 type CreateDeviceInput struct {
-	CompanyID       int     `json:"company_id" jsonschema:"ID of the company this device belongs to (required)"`
+	CompanyID       int     `json:"company_id,omitempty" jsonschema:"ID of the company this device belongs to (required unless the server has a default company)"`
 	SiteID          int     `json:"site_id,omitempty" jsonschema:"ID of the site where this device is located"`
 	Name            string  `json:"name" jsonschema:"Device hostname or display name (required)"`
 	HostName        string  `json:"host_name,omitempty" jsonschema:"Device hostName (required by the API). Defaults to name when omitted."`
@@ -79,6 +101,11 @@ type CreateDeviceInput struct {
 	ManagementURL   string  `json:"management_url,omitempty" jsonschema:"Management interface URL (e.g. https://192.168.1.1)"`
 	ManagementTitle string  `json:"management_url_title,omitempty" jsonschema:"Label for the management URL (e.g. Web Interface, SSH)"`
 	InitialNote     string  `json:"initial_note,omitempty" jsonschema:"Initial note to attach to the device (plain text or HTML)"`
+	ReviewerUserID  int     `json:"reviewer_user_id,omitempty" jsonschema:"ID of the ITPortal user who should review the device (sets reviewBy)"`
+	DueDate         string  `json:"due_date,omitempty" jsonschema:"Review due date in YYYY-MM-DD format"`
+	ForeignID       int     `json:"foreign_id,omitempty" jsonschema:"ID of this device in an external system (PSA/RMM), stored as foreignId"`
+	ForeignType     string  `json:"foreign_type,omitempty" jsonschema:"Which external system foreign_id comes from (e.g. 'ConnectWise'), stored as foreignType"`
+	LinkSiteContact bool    `json:"link_site_contact,omitempty" jsonschema:"With site_id: record the site's main contact on the new device as an 'On-site contact' note"`
 }
 
 type CreateEntityInput struct {
@@ -87,17 +114,21 @@ type CreateEntityInput struct {
 }
 
 type UpdateEntityInput struct {
-	EntityType string                 `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, additional_credential"`
-	ID         string                 `json:"id" jsonschema:"Numeric ID of the entity to update"`
-	Fields     map[string]interface{} `json:"fields" jsonschema:"JSON object with only the fields to change. Unchanged fields can be omitted. Reference fields use {\"id\": N} format."`
+	EntityType     string                 `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, additional_credential"`
+	ID             string                 `json:"id" jsonschema:"Numeric ID of the entity to update"`
+	Fields         map[string]interface{} `json:"fields,omitempty" jsonschema:"JSON object with only the fields to change. Unchanged fields can be omitted. Reference fields use {\"id\": N} format."`
+	ReviewerUserID int                    `json:"reviewer_user_id,omitempty" jsonschema:"Shortcut for fields.reviewBy: ID of the ITPortal user who should review the entity"`
+	DueDate        string                 `json:"due_date,omitempty" jsonschema:"Shortcut for fields.dueDate: review due date in YYYY-MM-DD format"`
 }
 
 type AddDeviceIPInput struct {
-	DeviceID    string `json:"device_id" jsonschema:"ID of the device"`
-	IP          string `json:"ip" jsonschema:"IP address to add (e.g. 10.0.0.50)"`
-	MAC         string `json:"mac,omitempty" jsonschema:"MAC address (e.g. aa:bb:cc:dd:ee:ff)"`
-	Description string `json:"description,omitempty" jsonschema:"Description (e.g. LAN Interface, iDRAC, Mgmt Port)"`
-	IPNetworkID int    `json:"ip_network_id,omitempty" jsonschema:"ID of the IP Network this address belongs to"`
+	DeviceID       string `json:"device_id" jsonschema:"ID of the device"`
+	IP             string `json:"ip" jsonschema:"IP address to add (e.g. 10.0.0.50)"`
+	MAC            string `json:"mac,omitempty" jsonschema:"MAC address (e.g. aa:bb:cc:dd:ee:ff)"`
+	Description    string `json:"description,omitempty" jsonschema:"Description (e.g. LAN Interface, iDRAC, Mgmt Port)"`
+	IPNetworkID    int    `json:"ip_network_id,omitempty" jsonschema:"ID of the IP Network this address belongs to. The IP must fall within the network's range."`
+	IncludeNetwork bool   `json:"include_network,omitempty" jsonschema:"Set true to also return the IP network's gateway, DNS servers and VLAN (needs ip_network_id)"`
+	Force          bool   `json:"force,omitempty" jsonschema:"Set true to add the IP even when the device already has a record for it"`
 }
 
 type AddDeviceNoteInput struct {
@@ -106,39 +137,75 @@ type AddDeviceNoteInput struct {
 	NotesHTML bool   `json:"notes_html,omitempty" jsonschema:"Set true if notes is HTML content"`
 }
 
+type AddDeviceCredentialInput struct {
+	DeviceID    string `json:"device_id" jsonschema:"ID of the device"`
+	Username    string `json:"username" jsonschema:"Login username"`
+	Password    string `json:"password,omitempty" jsonschema:"Login password. Stored in ITPortal; never echoed back."`
+	Description string `json:"description,omitempty" jsonschema:"What the credential is for, e.g. \"local admin\" or \"web UI\""`
+	Domain      string `json:"domain,omitempty" jsonschema:"Optional logon domain"`
+	TwoFACode   string `json:"2fa,omitempty" jsonschema:"Optional 2FA seed/code"`
+}
+
 type UploadFileInput struct {
 	EntityType  string `json:"entity_type" jsonschema:"Target entity: device_config (device configuration file), kb (KB attachment), contact_photo (contact image), document_file (document), agreement_file (agreement)"`
 	EntityID    string `json:"entity_id" jsonschema:"Numeric ID of the entity to attach the file to"`
-	FileName    string `json:"file_name" jsonschema:"Filename with extension (e.g. network-diagram.png, config.txt)"`
+	FileName    string `json:"file_name" jsonschema:"Filename with extension (e.g. network-diagram.png, config.txt). Each entity_type accepts only its allowed extensions: images for contact_photo, text/config files for device_config, office/text/image files for the rest"`
 	ContentType string `json:"content_type" jsonschema:"MIME type (e.g. image/png, image/jpeg, application/pdf, text/plain)"`
 	Base64Data  string `json:"base64_data" jsonschema:"Base64-encoded file content"`
 }
 
-type RefreshSnapshotInput struct{}
+type RefreshSnapshotInput struct {
+	Async bool `json:"async,omitempty" jsonschema:"Set true to start the rebuild in the background and return a job_id immediately; poll refresh_status for the outcome"`
+}
+
+type RefreshStatusInput struct {
+	JobID string `json:"job_id,omitempty" jsonschema:"Job ID returned by refresh_snapshot. Omit for the most recent rebuild."`
+}
 
 // ---- Handler methods ----
 
 // SearchDocs queries the embedded SQLite index: exact lookups by IP/serial/name
 // first, then FTS5 keyword search. It returns compact hits the model can drill
 // into with get_entity_details.
-func (h *Handler) SearchDocs(_ context.Context, _ *sdkmcp.CallToolRequest, input SearchDocsInput) (*sdkmcp.CallToolResult, any, error) {
-	if strings.TrimSpace(input.Query) == "" {
-		return toolError("query must not be empty"), nil, nil
-	}
+func (h *Handler) SearchDocs(ctx context.Context, _ *sdkmcp.CallToolRequest, input SearchDocsInput) (*sdkmcp.CallToolResult, any, error) {
+	input.CompanyID = h.companyFilterOr(input.CompanyID)
+	if res := validationResult(
+		validateRequired("query", input.Query),
+		validateNumericID("company_id", input.CompanyID),
+	); res != nil {
+		return res, nil, nil
+	}
+	if !h.snapshotReady() || h.cache.Store() == nil {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	age := h.cache.EnsureFresh(ctx)
 	store := h.cache.Store()
-	if store == nil {
-		return toolError("documentation index not ready; try refresh_snapshot"), nil, nil
-	}
 
 	typ := strings.ToLower(strings.ReplaceAll(input.EntityType, "_", ""))
 	if typ == "knowledgebase" {
 		typ = "kb"
 	}
 
-	results, err := store.Search(input.Query, typ, input.Limit)
+	search := store.Search
+	if h.searchStemming {
+		search = store.SearchStemmed
+	}
+	limit := input.Limit
+	if input.CompanyID != "" {
+		limit = companySearchLimit
+	}
+	results, err := search(input.Query, typ, limit)
 	if err != nil {
 		return nil, nil, fmt.Errorf("search docs: %w", err)
 	}
+	if input.CompanyID != "" {
+		companyID, _ := strconv.Atoi(strings.TrimSpace(input.CompanyID))
+		results = h.inCompany(results, companyID, input.Limit)
+		if len(results) == 0 {
+			return toolText(fmt.Sprintf("No results for %q within company %d. Try without company_id, or fewer/looser keywords.\nSnapshot age: %s",
+				input.Query, companyID, formatAge(age))), nil, nil
+		}
+	}
 
 	if len(results) == 0 {
 		counts, _ := store.Counts()
@@ -146,20 +213,24 @@ func (h *Handler) SearchDocs(_ context.Context, _ *sdkmcp.CallToolRequest, input
 		for k, v := range counts {
 			coverage = append(coverage, fmt.Sprintf("%s=%d", k, v))
 		}
-		return toolText(fmt.Sprintf("No results for %q. Try fewer/looser keywords or a different entity_type.\nIndex coverage: %s",
-			input.Query, strings.Join(coverage, ", "))), nil, nil
+		return toolText(fmt.Sprintf("No results for %q. Try fewer/looser keywords or a different entity_type.\nIndex coverage: %s\nSnapshot age: %s",
+			input.Query, strings.Join(coverage, ", "), formatAge(age))), nil, nil
 	}
 
+	h.linkSearchResults(results)
+
 	out, err := json.MarshalIndent(struct {
-		Query   string               `json:"query"`
-		Count   int                  `json:"count"`
-		Hint    string               `json:"hint"`
-		Results []cache.SearchResult `json:"results"`
+		Query       string               `json:"query"`
+		Count       int                  `json:"count"`
+		Hint        string               `json:"hint"`
+		Results     []cache.SearchResult `json:"results"`
+		SnapshotAge string               `json:"snapshot_age"`
 	}{
-		Query:   input.Query,
-		Count:   len(results),
-		Hint:    "Use get_entity_details(entity_type=<type>, id=<id>) for the full record of any hit.",
-		Results: results,
+		Query:       input.Query,
+		Count:       len(results),
+		Hint:        "Use get_entity_details(entity_type=<type>, id=<id>) for the full record of any hit.",
+		Results:     results,
+		SnapshotAge: formatAge(age),
 	}, "", "  ")
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal search results: %w", err)
@@ -167,6 +238,51 @@ func (h *Handler) SearchDocs(_ context.Context, _ *sdkmcp.CallToolRequest, input
 	return toolText(string(out)), nil, nil
 }
 
+// companySearchLimit is how many hits search_docs considers before narrowing
+// them to one company, so the filter doesn't starve the caller's limit.
+const companySearchLimit = 1000
+
+// inCompany keeps the results that are the company itself or reference it, up
+// to limit (default 50).
+func (h *Handler) inCompany(results []cache.SearchResult, companyID, limit int) []cache.SearchResult {
+	if limit <= 0 {
+		limit = 50
+	}
+	snap := h.cache.Get()
+	if snap == nil {
+		return nil
+	}
+	members := map[string]bool{fmt.Sprintf("company/%d", companyID): true}
+	for _, b := range snap.Backlinks("company", companyID) {
+		members[fmt.Sprintf("%s/%d", b.Type, b.ID)] = true
+	}
+	var out []cache.SearchResult
+	for _, r := range results {
+		if members[fmt.Sprintf("%s/%d", r.Type, r.ID)] && len(out) < limit {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// linkSearchResults fills in the portal URL of every hit the index holds none
+// for: from the matching cached entity, or else constructed from its type and ID.
+func (h *Handler) linkSearchResults(results []cache.SearchResult) {
+	var snap *cache.Snapshot
+	if h.cache != nil {
+		snap = h.cache.Get()
+	}
+	for i := range results {
+		r := &results[i]
+		if r.URL == "" && snap != nil {
+			r.URL = snap.PortalURL(r.Type, r.ID)
+		}
+		if r.URL == "" && h.baseURL != "" {
+			r.URL = itportal.BuildPortalURL(h.baseURL, r.Type, r.ID)
+		}
+	}
+}
+
 // ListEntities lists entities of the given type from ITPortal with optional filters.
 func (h *Handler) ListEntities(ctx context.Context, _ *sdkmcp.CallToolRequest, input ListEntitiesInput) (*sdkmcp.CallToolResult, any, error) {
 	if input.Limit <= 0 {
@@ -175,7 +291,24 @@ func (h *Handler) ListEntities(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 	if input.Limit > 500 {
 		input.Limit = 500
 	}
+	if res := validationResult(
+		validateFormat(input.Format),
+		validateExtraFilters("extra_filters", input.ExtraFilters),
+		validatePageOffset(h.client.Pagination(), input.Offset, input.Limit),
+	); res != nil {
+		return res, nil, nil
+	}
+	mac := ""
+	if input.MacAddress != "" {
+		var ok bool
+		if mac, ok = normalizeMAC(input.MacAddress); !ok {
+			return toolError(fmt.Sprintf("mac_address %q is not a valid MAC address", input.MacAddress)), nil, nil
+		}
+	}
 
+	if hasCompany(input.EntityType) {
+		input.CompanyID = h.companyFilterOr(input.CompanyID)
+	}
 	opts := &itportal.ListOptions{
 		Name:           input.Name,
 		NameStartsWith: input.NameStartsWith,
@@ -183,250 +316,365 @@ func (h *Handler) ListEntities(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		SiteID:         input.SiteID,
 		TypeName:       input.TypeName,
 		IPAddress:      input.IPAddress,
+		MacAddress:     mac,
 		SerialNumber:   input.SerialNumber,
 		Manufacturer:   input.Manufacturer,
 		ModifiedSince:  input.ModifiedSince,
 		Limit:          input.Limit,
 		Offset:         input.Offset,
+		Extra:          input.ExtraFilters,
+	}
+
+	items, total, ok, err := h.listByType(ctx, input.EntityType, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return toolError(fmt.Sprintf("unknown entity_type %q. Valid values: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address, form, additional_credential, kb_category, device_type, template, user, country, security_group, main_contact", input.EntityType)), nil, nil
 	}
 
-	type result struct {
-		Total  int         `json:"total"`
-		Offset int         `json:"offset"`
-		Limit  int         `json:"limit"`
-		Items  interface{} `json:"items"`
+	items, excluded := excludeByID(items, input.ExcludeIDs)
+	result := listResult{Total: total, Offset: input.Offset, Limit: input.Limit, Items: items, Excluded: excluded}
+	if rv := reflect.ValueOf(items); rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		if excluded > 0 {
+			result.Note = fmt.Sprintf("All %d results on this page are in exclude_ids. Raise offset to %d for the next page.", excluded, input.Offset+input.Limit)
+		} else {
+			result.Note = emptyListNote(input, mac, total)
+		}
 	}
+	return formatResult(input.Format, result)
+}
 
-	var items interface{}
-	var total int
+// excludeByID drops the elements of items, a slice of entities, whose ID is in
+// ids, and reports how many it dropped. Anything else is returned unchanged.
+func excludeByID(items any, ids []int) (any, int) {
+	rv := reflect.ValueOf(items)
+	if len(ids) == 0 || rv.Kind() != reflect.Slice {
+		return items, 0
+	}
+	skip := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		skip[int64(id)] = true
+	}
+	kept := reflect.MakeSlice(rv.Type(), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		el := reflect.Indirect(rv.Index(i))
+		if el.Kind() == reflect.Struct {
+			if id := el.FieldByName("ID"); id.IsValid() && id.CanInt() && skip[id.Int()] {
+				continue
+			}
+		}
+		kept = reflect.Append(kept, rv.Index(i))
+	}
+	return kept.Interface(), rv.Len() - kept.Len()
+}
 
-	switch strings.ToLower(strings.ReplaceAll(input.EntityType, "_", "")) {
+// listByType fetches one page of entityType with opts. ok is false for an
+// entity type it does not know.
+func (h *Handler) listByType(ctx context.Context, entityType string, opts *itportal.ListOptions) (items any, total int, ok bool, err error) {
+	switch strings.ToLower(strings.ReplaceAll(entityType, "_", "")) {
 	case "company":
 		v, t, err := h.client.ListCompanies(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list companies: %w", err)
+			return nil, 0, true, fmt.Errorf("list companies: %w", err)
 		}
 		items, total = v, t
 	case "site":
 		v, t, err := h.client.ListSites(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list sites: %w", err)
+			return nil, 0, true, fmt.Errorf("list sites: %w", err)
 		}
 		items, total = v, t
 	case "device":
 		v, t, err := h.client.ListDevices(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list devices: %w", err)
+			return nil, 0, true, fmt.Errorf("list devices: %w", err)
 		}
 		items, total = v, t
 	case "kb", "knowledgebase":
 		v, t, err := h.client.ListKBs(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list KBs: %w", err)
+			return nil, 0, true, fmt.Errorf("list KBs: %w", err)
 		}
 		items, total = v, t
 	case "contact":
 		v, t, err := h.client.ListContacts(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list contacts: %w", err)
+			return nil, 0, true, fmt.Errorf("list contacts: %w", err)
 		}
 		items, total = v, t
 	case "account":
 		v, t, err := h.client.ListAccounts(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list accounts: %w", err)
+			return nil, 0, true, fmt.Errorf("list accounts: %w", err)
 		}
 		items, total = v, t
 	case "agreement":
 		v, t, err := h.client.ListAgreements(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list agreements: %w", err)
+			return nil, 0, true, fmt.Errorf("list agreements: %w", err)
 		}
 		items, total = v, t
 	case "document":
 		v, t, err := h.client.ListDocuments(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list documents: %w", err)
+			return nil, 0, true, fmt.Errorf("list documents: %w", err)
 		}
 		items, total = v, t
 	case "facility":
 		v, t, err := h.client.ListFacilities(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list facilities: %w", err)
+			return nil, 0, true, fmt.Errorf("list facilities: %w", err)
 		}
 		items, total = v, t
 	case "cabinet":
 		v, t, err := h.client.ListCabinets(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list cabinets: %w", err)
+			return nil, 0, true, fmt.Errorf("list cabinets: %w", err)
 		}
 		items, total = v, t
 	case "configuration":
 		v, t, err := h.client.ListConfigurations(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list configurations: %w", err)
+			return nil, 0, true, fmt.Errorf("list configurations: %w", err)
 		}
 		items, total = v, t
 	case "ipnetwork":
 		v, t, err := h.client.ListIPNetworks(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list IP networks: %w", err)
+			return nil, 0, true, fmt.Errorf("list IP networks: %w", err)
 		}
 		items, total = v, t
 	case "kbcategory":
 		v, err := h.client.ListKBCategories(ctx)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list KB categories: %w", err)
+			return nil, 0, true, fmt.Errorf("list KB categories: %w", err)
 		}
 		items, total = v, len(v)
 	case "devicetype":
 		v, err := h.client.ListDeviceTypes(ctx)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list device types: %w", err)
+			return nil, 0, true, fmt.Errorf("list device types: %w", err)
 		}
 		items, total = v, len(v)
 	case "template":
 		v, t, err := h.client.ListTemplates(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list templates: %w", err)
+			return nil, 0, true, fmt.Errorf("list templates: %w", err)
 		}
 		items, total = v, t
 	case "address":
 		v, t, err := h.client.ListAddresses(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list addresses: %w", err)
+			return nil, 0, true, fmt.Errorf("list addresses: %w", err)
 		}
 		items, total = v, t
 	case "form":
 		v, t, err := h.client.ListForms(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list forms: %w", err)
+			return nil, 0, true, fmt.Errorf("list forms: %w", err)
 		}
 		items, total = v, t
 	case "additionalcredential":
 		v, t, err := h.client.ListAdditionalCredentials(ctx, opts)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list additional credentials: %w", err)
+			return nil, 0, true, fmt.Errorf("list additional credentials: %w", err)
 		}
 		items, total = v, t
 	case "user":
 		v, err := h.client.ListUsers(ctx)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list users: %w", err)
+			return nil, 0, true, fmt.Errorf("list users: %w", err)
 		}
 		items, total = v, len(v)
 	case "country":
 		v, err := h.client.ListCountries(ctx)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list countries: %w", err)
+			return nil, 0, true, fmt.Errorf("list countries: %w", err)
 		}
 		items, total = v, len(v)
 	case "securitygroup":
 		v, err := h.client.ListSecurityGroups(ctx)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list security groups: %w", err)
+			return nil, 0, true, fmt.Errorf("list security groups: %w", err)
 		}
 		items, total = v, len(v)
 	case "maincontact":
 		v, err := h.client.ListMainContacts(ctx)
 		if err != nil {
-			return nil, nil, fmt.Errorf("list main contacts: %w", err)
+			return nil, 0, true, fmt.Errorf("list main contacts: %w", err)
 		}
 		items, total = v, len(v)
 	default:
-		return toolError(fmt.Sprintf("unknown entity_type %q. Valid values: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address, form, additional_credential, kb_category, device_type, template, user, country, security_group, main_contact", input.EntityType)), nil, nil
+		return nil, 0, false, nil
 	}
+	return items, total, true, nil
+}
 
-	out, err := json.MarshalIndent(result{Total: total, Offset: input.Offset, Limit: input.Limit, Items: items}, "", "  ")
-	if err != nil {
-		return nil, nil, fmt.Errorf("marshal result: %w", err)
+// emptyListNote explains a list_entities call that returned nothing, echoing
+// the filters sent so an over-narrow filter is easy to spot.
+func emptyListNote(input ListEntitiesInput, mac string, total int) string {
+	if input.Offset > 0 && total > 0 {
+		return fmt.Sprintf("0 results at offset %d; only %d match. Lower offset to page back.", input.Offset, total)
+	}
+	var applied []string
+	for _, f := range []struct{ name, value string }{
+		{"name", input.Name},
+		{"name_starts_with", input.NameStartsWith},
+		{"company_id", input.CompanyID},
+		{"site_id", input.SiteID},
+		{"type_name", input.TypeName},
+		{"ip_address", input.IPAddress},
+		{"mac_address", mac},
+		{"serial_number", input.SerialNumber},
+		{"manufacturer", input.Manufacturer},
+		{"modified_since", input.ModifiedSince},
+	} {
+		if f.value != "" {
+			applied = append(applied, f.name+"="+f.value)
+		}
 	}
-	return toolText(string(out)), nil, nil
+	keys := make([]string, 0, len(input.ExtraFilters))
+	for k := range input.ExtraFilters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		applied = append(applied, "extra_filters."+k+"="+input.ExtraFilters[k])
+	}
+	if input.Offset > 0 {
+		applied = append(applied, fmt.Sprintf("offset=%d", input.Offset))
+	}
+	if len(applied) == 0 {
+		return fmt.Sprintf("0 results; no filters applied, so there are no %s records.", input.EntityType)
+	}
+	return "0 results; filters applied: " + strings.Join(applied, ", ") +
+		". name and type_name match exactly; drop or loosen a filter (e.g. name_starts_with, or search_docs) if matches were expected."
+}
+
+// normalizeMAC rewrites a 48-bit MAC address in any common notation (colons,
+// dashes, Cisco dotted, or bare hex) to upper-case colon-separated form, the
+// way ITPortal displays it.
+func normalizeMAC(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) == 12 {
+		if _, err := hex.DecodeString(s); err == nil {
+			s = s[0:2] + ":" + s[2:4] + ":" + s[4:6] + ":" + s[6:8] + ":" + s[8:10] + ":" + s[10:12]
+		}
+	}
+	hw, err := net.ParseMAC(s)
+	if err != nil || len(hw) != 6 {
+		return "", false
+	}
+	return strings.ToUpper(hw.String()), true
 }
 
 // GetEntityDetails fetches a single entity and, for devices, also fetches sub-resources.
 func (h *Handler) GetEntityDetails(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetEntityInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.ID == "" {
-		return toolError("id must not be empty"), nil, nil
+	var notesLimit *fieldError
+	if input.NotesLimit < 0 {
+		notesLimit = &fieldError{Field: "notes_limit", Reason: "must not be negative"}
+	}
+	if res := validationResult(
+		validateRequired("id", input.ID),
+		validateFormat(input.Format),
+		notesLimit,
+		validateDate("notes_since", input.NotesSince),
+	); res != nil {
+		return res, nil, nil
 	}
 
 	norm := strings.ToLower(strings.ReplaceAll(input.EntityType, "_", ""))
+	if input.RawHTML && norm != "kb" && norm != "knowledgebase" {
+		return validationResult(&fieldError{Field: "raw_html", Reason: "only supported for entity_type kb"}), nil, nil
+	}
 	switch norm {
 	case "company":
 		v, err := h.client.GetCompany(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get company: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "site":
 		v, err := h.client.GetSite(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get site: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		h.linkDiagram(v.Diagram)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "device":
-		return h.getDeviceDetails(ctx, input.ID)
+		since, _ := cache.ParseDate(input.NotesSince)
+		return h.getDeviceDetails(ctx, input.ID, input.Format, noteFilter{limit: input.NotesLimit, since: since})
 	case "kb", "knowledgebase":
 		v, err := h.client.GetKB(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get KB: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		if input.RawHTML {
+			if v.URL == "" {
+				v.URL = itportal.BuildPortalURL(h.baseURL, norm, v.ID)
+			}
+			return rawHTMLResult(v)
+		}
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "contact":
 		v, err := h.client.GetContact(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get contact: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "account":
 		v, err := h.client.GetAccount(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get account: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "agreement":
 		v, err := h.client.GetAgreement(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get agreement: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "document":
 		v, err := h.client.GetDocument(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get document: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "facility":
 		v, err := h.client.GetFacility(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get facility: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		h.linkDiagram(v.Diagram)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "cabinet":
 		v, err := h.client.GetCabinet(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get cabinet: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		h.linkDiagram(v.Diagram)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "configuration":
 		v, err := h.client.GetConfiguration(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get configuration: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	case "ipnetwork":
 		v, err := h.client.GetIPNetwork(ctx, input.ID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get IP network: %w", err)
 		}
-		return h.marshalWithURL(norm, v.ID, &v.URL, v)
+		return h.formatWithURL(input.Format, norm, v.ID, &v.URL, v)
 	default:
 		return toolError(fmt.Sprintf("unknown entity_type %q", input.EntityType)), nil, nil
 	}
 }
 
-// getDeviceDetails fetches a device plus all its sub-resources (IPs, management URLs, notes).
-func (h *Handler) getDeviceDetails(ctx context.Context, id string) (*sdkmcp.CallToolResult, any, error) {
+// getDeviceDetails fetches a device plus all its sub-resources (IPs, management
+// URLs, notes) and renders them in format, with the notes narrowed by nf.
+func (h *Handler) getDeviceDetails(ctx context.Context, id, format string, nf noteFilter) (*sdkmcp.CallToolResult, any, error) {
 	device, err := h.client.GetDevice(ctx, id)
 	if err != nil {
 		return nil, nil, fmt.Errorf("get device: %w", err)
@@ -449,19 +697,53 @@ func (h *Handler) getDeviceDetails(ctx context.Context, id string) (*sdkmcp.Call
 	}
 	mgmtURLs = dedupeManagementURLs(mgmtURLs)
 
-	type deviceDetail struct {
-		Device         *itportal.Device      `json:"device"`
-		IPAddresses    []itportal.DeviceIP   `json:"ip_addresses"`
-		Notes          []itportal.DeviceNote `json:"notes"`
-		ManagementURLs []itportal.DeviceMUrl `json:"management_urls"`
-	}
+	total := len(notes)
+	notes = nf.apply(notes)
+
 	detail := deviceDetail{
 		Device:         device,
 		IPAddresses:    ips,
 		Notes:          notes,
+		NotesOmitted:   total - len(notes),
 		ManagementURLs: mgmtURLs,
 	}
-	return marshalResult(detail)
+	return formatResult(format, detail)
+}
+
+// noteFilter narrows the notes get_entity_details returns for a device. The
+// zero value keeps every note in API order.
+type noteFilter struct {
+	limit int       // at most this many notes; 0 = all
+	since time.Time // only notes dated on or after this day; zero = any date
+}
+
+// apply returns the notes nf keeps, newest first. Undated notes sort last and
+// are dropped by a since filter, which cannot place them.
+func (nf noteFilter) apply(notes []itportal.DeviceNote) []itportal.DeviceNote {
+	if nf.limit <= 0 && nf.since.IsZero() {
+		return notes
+	}
+	type dated struct {
+		note itportal.DeviceNote
+		at   time.Time
+	}
+	kept := make([]dated, 0, len(notes))
+	for _, n := range notes {
+		at, ok := cache.ParseTimestamp(n.DateTime)
+		if !nf.since.IsZero() && (!ok || at.Before(nf.since)) {
+			continue
+		}
+		kept = append(kept, dated{n, at})
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].at.After(kept[j].at) })
+	if nf.limit > 0 && len(kept) > nf.limit {
+		kept = kept[:nf.limit]
+	}
+	out := make([]itportal.DeviceNote, len(kept))
+	for i, d := range kept {
+		out[i] = d.note
+	}
+	return out
 }
 
 // dedupeManagementURLs removes duplicate management-URL records. Some ITPortal
@@ -538,11 +820,19 @@ func dedupeSwitchPortRanges(ranges []itportal.SwitchPortRange) []itportal.Switch
 
 // CreateKBArticle creates a new knowledge base article.
 func (h *Handler) CreateKBArticle(ctx context.Context, _ *sdkmcp.CallToolRequest, input CreateKBArticleInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.CompanyID == 0 {
-		return toolError("company_id is required"), nil, nil
+	if res := h.checkWrite("kb"); res != nil {
+		return res, nil, nil
+	}
+	input.CompanyID = h.companyOr(input.CompanyID)
+	if res := validationResult(
+		validateRequired("company_id", input.CompanyID),
+		validateRequired("name", input.Name),
+		validateDate("due_date", input.DueDate),
+	); res != nil {
+		return res, nil, nil
 	}
-	if input.Name == "" {
-		return toolError("name is required"), nil, nil
+	if res, err := h.checkKBCategory(ctx, input.CategoryID, input.SubCategoryID); res != nil || err != nil {
+		return res, nil, err
 	}
 
 	article := input.Article
@@ -557,6 +847,10 @@ func (h *Handler) CreateKBArticle(ctx context.Context, _ *sdkmcp.CallToolRequest
 		Company:     &itportal.CompanyReference{ID: input.CompanyID},
 		Public:      input.Public,
 		Expires:     input.Expires,
+		DueDate:     strings.TrimSpace(input.DueDate),
+	}
+	if input.ReviewerUserID != 0 {
+		kb.ReviewBy = &itportal.UserReference{ID: input.ReviewerUserID}
 	}
 	if input.CategoryID != 0 {
 		kb.Category = &itportal.KBCategory{ID: input.CategoryID}
@@ -569,17 +863,50 @@ func (h *Handler) CreateKBArticle(ctx context.Context, _ *sdkmcp.CallToolRequest
 	if err != nil {
 		return nil, nil, fmt.Errorf("create KB article: %w", err)
 	}
-	return toolText(fmt.Sprintf("KB article created successfully.\nID: %d\nTitle: %s\nPortal: %s",
-		created.ID, created.Name, created.URL)), nil, nil
+	h.mergeWritten(created)
+	msg := fmt.Sprintf("KB article created successfully.\nID: %d\nTitle: %s\nPortal: %s",
+		created.ID, created.Name, created.URL) + createdAtLine(created.Modified)
+	return toolText(msg), created, nil
 }
 
 // CreateDevice creates a device and optionally adds an IP, management URL, and initial note.
 func (h *Handler) CreateDevice(ctx context.Context, _ *sdkmcp.CallToolRequest, input CreateDeviceInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.CompanyID == 0 {
-		return toolError("company_id is required"), nil, nil
-	}
-	if input.Name == "" {
-		return toolError("name is required"), nil, nil
+	if res := h.checkWrite("device"); res != nil {
+		return res, nil, nil
+	}
+	input.CompanyID = h.companyOr(input.CompanyID)
+	var foreignCheck *fieldError
+	if input.ForeignType != "" && input.ForeignID == 0 {
+		foreignCheck = &fieldError{Field: "foreign_id", Reason: "required with foreign_type"}
+	}
+	var siteContactCheck *fieldError
+	if input.LinkSiteContact && input.SiteID == 0 {
+		siteContactCheck = &fieldError{Field: "site_id", Reason: "required with link_site_contact"}
+	}
+	if res := validationResult(
+		validateRequired("company_id", input.CompanyID),
+		validateRequired("name", input.Name),
+		validateDate("due_date", input.DueDate),
+		foreignCheck,
+		siteContactCheck,
+	); res != nil {
+		return res, nil, nil
+	}
+
+	var typeNote string
+	if input.TypeName != "" && h.validateDeviceTypes {
+		valid, err := deviceTypeNames(ctx, h.client)
+		if err != nil {
+			return nil, nil, err
+		}
+		match, exact := closestName(input.TypeName, valid)
+		if match == "" {
+			return toolError(fmt.Sprintf("unknown device type %q. Valid types: %s", input.TypeName, strings.Join(valid, ", "))), nil, nil
+		}
+		if !exact {
+			typeNote = fmt.Sprintf("ℹ Type %q mapped to the defined type %q", input.TypeName, match)
+		}
+		input.TypeName = match
 	}
 
 	// hostName is a required field on the devices endpoint. Default it to name
@@ -605,6 +932,12 @@ func (h *Handler) CreateDevice(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		WarrantyExpires: input.WarrantyExpires,
 		PurchaseDate:    input.PurchaseDate,
 		PurchasePrice:   input.PurchasePrice,
+		DueDate:         strings.TrimSpace(input.DueDate),
+		ForeignID:       input.ForeignID,
+		ForeignType:     strings.TrimSpace(input.ForeignType),
+	}
+	if input.ReviewerUserID != 0 {
+		device.ReviewBy = &itportal.UserReference{ID: input.ReviewerUserID}
 	}
 	if input.SiteID != 0 {
 		device.Site = &itportal.SiteReference{ID: input.SiteID}
@@ -617,8 +950,14 @@ func (h *Handler) CreateDevice(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 	if err != nil {
 		return nil, nil, fmt.Errorf("create device: %w", err)
 	}
+	h.mergeWritten(created)
 
-	var sideEffects []string
+	// Sub-steps run after the device exists: their successes are reported
+	// with it, their failures as warnings.
+	var sideEffects, warnings []string
+	if typeNote != "" {
+		sideEffects = append(sideEffects, typeNote)
+	}
 	devIDStr := strconv.Itoa(created.ID)
 
 	if input.IPAddress != "" {
@@ -626,10 +965,10 @@ func (h *Handler) CreateDevice(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 			IP:  input.IPAddress,
 			MAC: input.MACAddress,
 		}
-		if _, err := h.client.AddDeviceIP(ctx, devIDStr, ip); err != nil {
-			sideEffects = append(sideEffects, fmt.Sprintf("⚠ Could not add IP %s: %v", input.IPAddress, err))
+		if added, err := h.client.AddDeviceIP(ctx, devIDStr, ip); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Could not add IP %s: %v", input.IPAddress, err))
 		} else {
-			sideEffects = append(sideEffects, fmt.Sprintf("✓ IP added: %s", input.IPAddress))
+			sideEffects = append(sideEffects, fmt.Sprintf("✓ IP added: %s (IP record ID: %d)", input.IPAddress, added.ID))
 		}
 	}
 
@@ -639,38 +978,55 @@ func (h *Handler) CreateDevice(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 			title = "Management Interface"
 		}
 		murl := &itportal.DeviceMUrl{Title: title, URL: input.ManagementURL}
-		if _, err := h.client.AddDeviceManagementURL(ctx, devIDStr, murl); err != nil {
-			sideEffects = append(sideEffects, fmt.Sprintf("⚠ Could not add management URL: %v", err))
+		if added, err := h.client.AddDeviceManagementURL(ctx, devIDStr, murl); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Could not add management URL: %v", err))
 		} else {
-			sideEffects = append(sideEffects, fmt.Sprintf("✓ Management URL added: %s", input.ManagementURL))
+			sideEffects = append(sideEffects, fmt.Sprintf("✓ Management URL added: %s (management URL ID: %d)", input.ManagementURL, added.ID))
 		}
 	}
 
 	if input.InitialNote != "" {
 		note := &itportal.DeviceNote{Notes: input.InitialNote}
-		if _, err := h.client.AddDeviceNote(ctx, devIDStr, note); err != nil {
-			sideEffects = append(sideEffects, fmt.Sprintf("⚠ Could not add note: %v", err))
+		if added, err := h.client.AddDeviceNote(ctx, devIDStr, note); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Could not add note: %v", err))
+		} else {
+			sideEffects = append(sideEffects, fmt.Sprintf("✓ Initial note added (note ID: %d)", added.ID))
+		}
+	}
+
+	if input.LinkSiteContact {
+		if line, warning := h.linkSiteContact(ctx, devIDStr, input.SiteID); warning != "" {
+			warnings = append(warnings, warning)
 		} else {
-			sideEffects = append(sideEffects, "✓ Initial note added")
+			sideEffects = append(sideEffects, line)
 		}
 	}
 
 	msg := fmt.Sprintf("Device created successfully.\nID: %d\nName: %s\nPortal: %s",
-		created.ID, created.Name, created.URL)
+		created.ID, created.Name, created.URL) + createdAtLine(created.Modified)
 	if len(sideEffects) > 0 {
 		msg += "\n\n" + strings.Join(sideEffects, "\n")
 	}
-	return toolText(msg), nil, nil
+	return outcomeResult(msg, created, warnings)
 }
 
 // CreateEntity creates any supported entity type from a generic fields map.
 func (h *Handler) CreateEntity(ctx context.Context, _ *sdkmcp.CallToolRequest, input CreateEntityInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.EntityType == "" {
-		return toolError("entity_type is required"), nil, nil
+	if res := validationResult(validateRequired("entity_type", input.EntityType)); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+	if res := validationResult(validateRequired("fields", input.Fields)); res != nil {
+		return res, nil, nil
 	}
-	if len(input.Fields) == 0 {
-		return toolError("fields must not be empty"), nil, nil
+
+	if normType(input.EntityType) == "contact" && h.phoneCountryCode != "" {
+		normalizeContactPhones(input.Fields, h.phoneCountryCode)
 	}
+	h.defaultCompanyField(input.EntityType, input.Fields)
+	coerceScalarFields(input.Fields, entityModel(input.EntityType))
 
 	// Re-marshal fields to the appropriate concrete type.
 	fieldsJSON, err := json.Marshal(input.Fields)
@@ -678,121 +1034,127 @@ func (h *Handler) CreateEntity(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		return nil, nil, fmt.Errorf("marshal fields: %w", err)
 	}
 
+	// createResult carries what the create response reports back; record is the
+	// full created entity, returned as the tool's structured output.
 	type createResult struct {
-		ID  int    `json:"id"`
-		URL string `json:"url,omitempty"`
+		id       int
+		url      string
+		modified string
+		record   interface{}
 	}
 
-	unmarshalAndCreate := func(target interface{}, createFn func() (int, string, error)) (*sdkmcp.CallToolResult, any, error) {
+	unmarshalAndCreate := func(target interface{}, createFn func() (createResult, error)) (*sdkmcp.CallToolResult, any, error) {
 		if err := json.Unmarshal(fieldsJSON, target); err != nil {
 			return toolError(fmt.Sprintf("invalid fields for %s: %v", input.EntityType, err)), nil, nil
 		}
-		id, url, err := createFn()
+		res, err := createFn()
 		if err != nil {
 			return nil, nil, err
 		}
-		return toolText(fmt.Sprintf("%s created. ID: %d  Portal: %s", input.EntityType, id, url)), nil, nil
+		h.mergeWritten(res.record)
+		msg := fmt.Sprintf("%s created. ID: %d  Portal: %s", input.EntityType, res.id, res.url) + createdAtLine(res.modified)
+		return toolText(msg), res.record, nil
 	}
 
 	switch strings.ToLower(strings.ReplaceAll(input.EntityType, "_", "")) {
 	case "company":
 		var v itportal.Company
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateCompany(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create company: %w", err)
+				return createResult{}, fmt.Errorf("create company: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "site":
 		var v itportal.Site
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateSite(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create site: %w", err)
+				return createResult{}, fmt.Errorf("create site: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "contact":
 		var v itportal.Contact
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateContact(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create contact: %w", err)
+				return createResult{}, fmt.Errorf("create contact: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "account":
 		var v itportal.Account
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateAccount(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create account: %w", err)
+				return createResult{}, fmt.Errorf("create account: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "agreement":
 		var v itportal.Agreement
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateAgreement(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create agreement: %w", err)
+				return createResult{}, fmt.Errorf("create agreement: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "document":
 		var v itportal.Document
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateDocument(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create document: %w", err)
+				return createResult{}, fmt.Errorf("create document: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "ipnetwork":
 		var v itportal.IPNetwork
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateIPNetwork(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create IP network: %w", err)
+				return createResult{}, fmt.Errorf("create IP network: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "facility":
 		var v itportal.Facility
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateFacility(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create facility: %w", err)
+				return createResult{}, fmt.Errorf("create facility: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "cabinet":
 		var v itportal.Cabinet
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateCabinet(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create cabinet: %w", err)
+				return createResult{}, fmt.Errorf("create cabinet: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "configuration":
 		var v itportal.Configuration
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateConfiguration(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create configuration: %w", err)
+				return createResult{}, fmt.Errorf("create configuration: %w", err)
 			}
-			return created.ID, created.URL, nil
+			return createResult{id: created.ID, url: created.URL, modified: created.Modified, record: created}, nil
 		})
 	case "address":
 		var v itportal.Address
-		return unmarshalAndCreate(&v, func() (int, string, error) {
+		return unmarshalAndCreate(&v, func() (createResult, error) {
 			created, err := h.client.CreateAddress(ctx, &v)
 			if err != nil {
-				return 0, "", fmt.Errorf("create address: %w", err)
+				return createResult{}, fmt.Errorf("create address: %w", err)
 			}
-			return created.ID, "", nil
+			return createResult{id: created.ID, record: created}, nil
 		})
 	default:
 		return toolError(fmt.Sprintf("entity_type %q is not supported for create_entity. Use create_device or create_kb_article for those types.", input.EntityType)), nil, nil
@@ -801,58 +1163,122 @@ func (h *Handler) CreateEntity(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 
 // UpdateEntity patches an existing entity with the given fields.
 func (h *Handler) UpdateEntity(ctx context.Context, _ *sdkmcp.CallToolRequest, input UpdateEntityInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.ID == "" {
-		return toolError("id is required"), nil, nil
+	review := input.ReviewerUserID != 0 || strings.TrimSpace(input.DueDate) != ""
+	var fieldsCheck, reviewCheck *fieldError
+	if !review {
+		fieldsCheck = validateRequired("fields", input.Fields)
+	} else if !hasReviewFields(input.EntityType) {
+		reviewCheck = &fieldError{Field: "reviewer_user_id", Reason: fmt.Sprintf("%q has no reviewBy/dueDate fields", input.EntityType)}
+	}
+	if res := validationResult(
+		validateRequired("id", input.ID),
+		fieldsCheck,
+		reviewCheck,
+		validateDate("due_date", input.DueDate),
+	); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+	if review {
+		input.Fields = withReviewFields(input.Fields, input.ReviewerUserID, input.DueDate)
+	}
+
+	ok, err := h.patchByType(ctx, input.EntityType, input.ID, input.Fields)
+	if !ok {
+		return toolError(fmt.Sprintf("unknown entity_type %q for update", input.EntityType)), nil, nil
 	}
-	if len(input.Fields) == 0 {
-		return toolError("fields must not be empty"), nil, nil
+	if err != nil {
+		return nil, nil, fmt.Errorf("update %s %s: %w", input.EntityType, input.ID, err)
 	}
+	h.mergeUpdated(ctx, input.EntityType, input.ID)
+	return toolText(fmt.Sprintf("%s ID %s updated successfully.", input.EntityType, input.ID)), nil, nil
+}
 
-	var err error
-	switch strings.ToLower(strings.ReplaceAll(input.EntityType, "_", "")) {
+// patchByType PATCHes fields onto the entityType record id, normalising KB
+// article and contact phone fields the way update_entity documents and numeric
+// strings in number fields. ok is false for an entity type it cannot update.
+func (h *Handler) patchByType(ctx context.Context, entityType, id string, fields map[string]interface{}) (ok bool, err error) {
+	coerceScalarFields(fields, entityModel(entityType))
+	switch strings.ToLower(strings.ReplaceAll(entityType, "_", "")) {
 	case "company":
-		err = h.client.UpdateCompany(ctx, input.ID, input.Fields)
+		err = h.client.UpdateCompany(ctx, id, fields)
 	case "site":
-		err = h.client.UpdateSite(ctx, input.ID, input.Fields)
+		err = h.client.UpdateSite(ctx, id, fields)
 	case "device":
-		err = h.client.UpdateDevice(ctx, input.ID, input.Fields)
+		err = h.client.UpdateDevice(ctx, id, fields)
 	case "kb", "knowledgebase":
-		resolveKBArticleField(input.Fields)
-		err = h.client.UpdateKB(ctx, input.ID, input.Fields)
+		resolveKBArticleField(fields)
+		err = h.client.UpdateKB(ctx, id, fields)
 	case "contact":
-		err = h.client.UpdateContact(ctx, input.ID, input.Fields)
+		if h.phoneCountryCode != "" {
+			normalizeContactPhones(fields, h.phoneCountryCode)
+		}
+		err = h.client.UpdateContact(ctx, id, fields)
 	case "account":
-		err = h.client.UpdateAccount(ctx, input.ID, input.Fields)
+		err = h.client.UpdateAccount(ctx, id, fields)
 	case "agreement":
-		err = h.client.UpdateAgreement(ctx, input.ID, input.Fields)
+		err = h.client.UpdateAgreement(ctx, id, fields)
 	case "document":
-		err = h.client.UpdateDocument(ctx, input.ID, input.Fields)
+		err = h.client.UpdateDocument(ctx, id, fields)
 	case "facility":
-		err = h.client.UpdateFacility(ctx, input.ID, input.Fields)
+		err = h.client.UpdateFacility(ctx, id, fields)
 	case "cabinet":
-		err = h.client.UpdateCabinet(ctx, input.ID, input.Fields)
+		err = h.client.UpdateCabinet(ctx, id, fields)
 	case "configuration":
-		err = h.client.UpdateConfiguration(ctx, input.ID, input.Fields)
+		err = h.client.UpdateConfiguration(ctx, id, fields)
 	case "ipnetwork":
-		err = h.client.UpdateIPNetwork(ctx, input.ID, input.Fields)
+		err = h.client.UpdateIPNetwork(ctx, id, fields)
 	case "additionalcredential":
-		err = h.client.UpdateAdditionalCredential(ctx, input.ID, input.Fields)
+		err = h.client.UpdateAdditionalCredential(ctx, id, fields)
 	default:
-		return toolError(fmt.Sprintf("unknown entity_type %q for update", input.EntityType)), nil, nil
+		return false, nil
 	}
-	if err != nil {
-		return nil, nil, fmt.Errorf("update %s %s: %w", input.EntityType, input.ID, err)
+	return true, err
+}
+
+// hasReviewFields reports whether entityType's model carries reviewBy and
+// dueDate, so update_entity's review shortcuts apply to it.
+func hasReviewFields(entityType string) bool {
+	typ := normType(entityType)
+	if typ == "knowledgebase" {
+		typ = "kb"
 	}
-	return toolText(fmt.Sprintf("%s ID %s updated successfully.", input.EntityType, input.ID)), nil, nil
+	m, ok := describedModels[typ]
+	if !ok {
+		return false
+	}
+	_, review := m.FieldByName("ReviewBy")
+	_, due := m.FieldByName("DueDate")
+	return review && due
+}
+
+// withReviewFields returns fields with reviewBy ({"id": N}) and dueDate set
+// from the review shortcuts that were given.
+func withReviewFields(fields map[string]interface{}, reviewerID int, dueDate string) map[string]interface{} {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	if reviewerID != 0 {
+		fields["reviewBy"] = map[string]interface{}{"id": reviewerID}
+	}
+	if d := strings.TrimSpace(dueDate); d != "" {
+		fields["dueDate"] = d
+	}
+	return fields
 }
 
 // AddDeviceIP adds an IP address record to a device.
 func (h *Handler) AddDeviceIP(ctx context.Context, _ *sdkmcp.CallToolRequest, input AddDeviceIPInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.DeviceID == "" {
-		return toolError("device_id is required"), nil, nil
+	if res := h.checkWrite("device"); res != nil {
+		return res, nil, nil
 	}
-	if input.IP == "" {
-		return toolError("ip is required"), nil, nil
+	if res := validationResult(
+		validateRequired("device_id", input.DeviceID),
+		validateRequired("ip", input.IP),
+	); res != nil {
+		return res, nil, nil
 	}
 
 	ip := &itportal.DeviceIP{
@@ -860,24 +1286,77 @@ func (h *Handler) AddDeviceIP(ctx context.Context, _ *sdkmcp.CallToolRequest, in
 		MAC:         input.MAC,
 		Description: input.Description,
 	}
+	var network *itportal.IPNetwork
 	if input.IPNetworkID != 0 {
+		addr, err := netip.ParseAddr(strings.TrimSpace(input.IP))
+		if err != nil {
+			return validationResult(&fieldError{Field: "ip", Reason: fmt.Sprintf("%q is not an IP address", input.IP)}), nil, nil
+		}
+		if network, err = h.lookupIPNetwork(ctx, input.IPNetworkID); err != nil {
+			return nil, nil, err
+		}
+		if p, ok := networkPrefix(network); ok && !p.Contains(addr.Unmap()) {
+			return validationResult(&fieldError{Field: "ip", Reason: fmt.Sprintf("%s is outside IP network %d (%s)", addr, network.ID, p)}), nil, nil
+		}
 		ip.IPNetwork = &itportal.IPNetworkReference{ID: input.IPNetworkID}
 	}
 
+	if !input.Force {
+		existing, err := h.client.GetDeviceIPs(ctx, input.DeviceID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list device IPs: %w", err)
+		}
+		if dup := findDeviceIP(existing, input.IP); dup != nil {
+			msg := fmt.Sprintf("IP %s already present on device %s (IP record ID %d", dup.IP, input.DeviceID, dup.ID)
+			if dup.MAC != "" {
+				msg += ", MAC " + dup.MAC
+			}
+			return toolText(msg + "). Nothing was added; pass force=true to add a second record anyway."), nil, nil
+		}
+	}
+
 	created, err := h.client.AddDeviceIP(ctx, input.DeviceID, ip)
 	if err != nil {
 		return nil, nil, fmt.Errorf("add device IP: %w", err)
 	}
-	return toolText(fmt.Sprintf("IP %s added to device %s (IP record ID: %d).", created.IP, input.DeviceID, created.ID)), nil, nil
+	msg := fmt.Sprintf("IP %s added to device %s (IP record ID: %d).", created.IP, input.DeviceID, created.ID)
+	if input.IncludeNetwork && network != nil {
+		msg += "\n\n" + networkContext(network)
+	}
+	return toolText(msg), nil, nil
+}
+
+// findDeviceIP returns the record in ips holding the address ip, comparing
+// parsed addresses so differently written IPv6 and IPv4-mapped forms match, or
+// nil.
+func findDeviceIP(ips []itportal.DeviceIP, ip string) *itportal.DeviceIP {
+	ip = strings.TrimSpace(ip)
+	want, wantErr := netip.ParseAddr(ip)
+	for i := range ips {
+		have := strings.TrimSpace(ips[i].IP)
+		if a, err := netip.ParseAddr(have); err == nil && wantErr == nil {
+			if a.Unmap() == want.Unmap() {
+				return &ips[i]
+			}
+			continue
+		}
+		if strings.EqualFold(have, ip) {
+			return &ips[i]
+		}
+	}
+	return nil
 }
 
 // AddDeviceNote adds a timestamped note to a device.
 func (h *Handler) AddDeviceNote(ctx context.Context, _ *sdkmcp.CallToolRequest, input AddDeviceNoteInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.DeviceID == "" {
-		return toolError("device_id is required"), nil, nil
+	if res := h.checkWrite("device"); res != nil {
+		return res, nil, nil
 	}
-	if input.Notes == "" {
-		return toolError("notes must not be empty"), nil, nil
+	if res := validationResult(
+		validateRequired("device_id", input.DeviceID),
+		validateRequired("notes", input.Notes),
+	); res != nil {
+		return res, nil, nil
 	}
 
 	note := &itportal.DeviceNote{
@@ -891,16 +1370,48 @@ func (h *Handler) AddDeviceNote(ctx context.Context, _ *sdkmcp.CallToolRequest,
 	return toolText(fmt.Sprintf("Note added to device %s (note ID: %d).", input.DeviceID, created.ID)), nil, nil
 }
 
-// UploadFile decodes a base64 payload and uploads it to an ITPortal entity.
-func (h *Handler) UploadFile(ctx context.Context, _ *sdkmcp.CallToolRequest, input UploadFileInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.EntityID == "" {
-		return toolError("entity_id is required"), nil, nil
+// AddDeviceCredential stores a login on a device. It is a secret write, so the
+// credential policy applies as well as the device write policy; the password is
+// never echoed in the result.
+func (h *Handler) AddDeviceCredential(ctx context.Context, _ *sdkmcp.CallToolRequest, input AddDeviceCredentialInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := h.checkWrite("device"); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkSecrets(); res != nil {
+		return res, nil, nil
+	}
+	if res := validationResult(
+		validateRequired("device_id", input.DeviceID),
+		validateNumericID("device_id", input.DeviceID),
+		validateRequired("username", input.Username),
+	); res != nil {
+		return res, nil, nil
 	}
-	if input.FileName == "" {
-		return toolError("file_name is required"), nil, nil
+
+	cred := &itportal.Credential{
+		Username:    input.Username,
+		Password:    input.Password,
+		Description: input.Description,
+		Domain:      input.Domain,
+		TwoFACode:   input.TwoFACode,
 	}
-	if input.Base64Data == "" {
-		return toolError("base64_data is required"), nil, nil
+	deviceID := strings.TrimSpace(input.DeviceID)
+	created, err := h.client.AddDeviceCredential(ctx, deviceID, cred)
+	if err != nil {
+		return nil, nil, fmt.Errorf("add device credential: %w", err)
+	}
+	return toolText(fmt.Sprintf("Credential for %q added to device %s (credential ID: %d).", input.Username, deviceID, created.ID)), nil, nil
+}
+
+// UploadFile decodes a base64 payload and uploads it to an ITPortal entity.
+func (h *Handler) UploadFile(ctx context.Context, _ *sdkmcp.CallToolRequest, input UploadFileInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(
+		validateRequired("entity_id", input.EntityID),
+		validateNumericID("entity_id", input.EntityID),
+		validateRequired("file_name", input.FileName),
+		validateRequired("base64_data", input.Base64Data),
+	); res != nil {
+		return res, nil, nil
 	}
 
 	fileData, err := base64.StdEncoding.DecodeString(input.Base64Data)
@@ -911,32 +1422,79 @@ func (h *Handler) UploadFile(ctx context.Context, _ *sdkmcp.CallToolRequest, inp
 			return toolError(fmt.Sprintf("base64_data is not valid base64: %v", err)), nil, nil
 		}
 	}
+	if len(fileData) > maxFileBytes {
+		return toolError(fmt.Sprintf("file is %d bytes; the limit is %d", len(fileData), maxFileBytes)), nil, nil
+	}
 
-	var uploadPath string
-	switch strings.ToLower(strings.ReplaceAll(input.EntityType, "_", "")) {
-	case "deviceconfig":
-		uploadPath = fmt.Sprintf("/api/2.0/devices/%s/configurationFiles/", input.EntityID)
-	case "kb":
-		uploadPath = fmt.Sprintf("/api/2.0/kbs/%s/file/", input.EntityID)
-	case "contactphoto":
-		uploadPath = fmt.Sprintf("/api/2.0/contacts/%s/file/", input.EntityID)
-	case "documentfile":
-		uploadPath = fmt.Sprintf("/api/2.0/documents/%s/file/", input.EntityID)
-	case "agreementfile":
-		uploadPath = fmt.Sprintf("/api/2.0/agreements/%s/file/", input.EntityID)
-	default:
+	target, ok := uploadTargets[uploadKind(input.EntityType)]
+	if !ok {
 		return toolError(fmt.Sprintf("unknown entity_type %q for upload. Valid values: device_config, kb, contact_photo, document_file, agreement_file", input.EntityType)), nil, nil
 	}
+	entityID := strings.TrimSpace(input.EntityID)
+	uploadPath := fmt.Sprintf(target.path, entityID)
+	if res := h.checkWrite(target.owner); res != nil {
+		return res, nil, nil
+	}
+	if msg := h.checkUploadExtension(target.kind, input.FileName); msg != "" {
+		return toolError(msg), nil, nil
+	}
 
 	if err := h.client.UploadFile(ctx, uploadPath, input.FileName, input.ContentType, fileData); err != nil {
 		return nil, nil, fmt.Errorf("upload file to %s: %w", uploadPath, err)
 	}
-	return toolText(fmt.Sprintf("File %q (%d bytes) uploaded to %s ID %s.", input.FileName, len(fileData), input.EntityType, input.EntityID)), nil, nil
+	return toolText(fmt.Sprintf("File %q (%d bytes) uploaded to %s ID %s.", input.FileName, len(fileData), input.EntityType, entityID)), nil, nil
+}
+
+// maxFileBytes caps the files upload_file sends and get_contact_photo fetches.
+const maxFileBytes = 10 << 20
+
+// uploadTarget is where upload_file sends a file: path is a format string taking
+// the entity ID, owner is the entity type checked against the write policy, and
+// kind is the canonical upload kind whose extension allow-list applies.
+type uploadTarget struct {
+	path  string
+	owner string
+	kind  string
+}
+
+// uploadTargets maps upload_file entity types (as keyed by uploadKind) to their
+// upload endpoints. Aliases cover the spellings the other tools accept.
+var uploadTargets = map[string]uploadTarget{
+	"deviceconfig":        {"/api/2.0/devices/%s/configurationFiles/", "device", uploadDeviceConfig},
+	"deviceconfiguration": {"/api/2.0/devices/%s/configurationFiles/", "device", uploadDeviceConfig},
+	"configfile":          {"/api/2.0/devices/%s/configurationFiles/", "device", uploadDeviceConfig},
+	"kb":                  {"/api/2.0/kbs/%s/file/", "kb", uploadKB},
+	"kbs":                 {"/api/2.0/kbs/%s/file/", "kb", uploadKB},
+	"kbarticle":           {"/api/2.0/kbs/%s/file/", "kb", uploadKB},
+	"knowledgebase":       {"/api/2.0/kbs/%s/file/", "kb", uploadKB},
+	"contactphoto":        {"/api/2.0/contacts/%s/file/", "contact", uploadContactPhoto},
+	"contact":             {"/api/2.0/contacts/%s/file/", "contact", uploadContactPhoto},
+	"documentfile":        {"/api/2.0/documents/%s/file/", "document", uploadDocumentFile},
+	"document":            {"/api/2.0/documents/%s/file/", "document", uploadDocumentFile},
+	"agreementfile":       {"/api/2.0/agreements/%s/file/", "agreement", uploadAgreementFile},
+	"agreement":           {"/api/2.0/agreements/%s/file/", "agreement", uploadAgreementFile},
+}
+
+// uploadKind normalises an upload_file entity_type like normType, additionally
+// ignoring hyphens and spaces ("Device-Config", "kb article").
+func uploadKind(s string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(normType(s))
 }
 
 // RefreshSnapshot forces an immediate documentation snapshot rebuild.
-func (h *Handler) RefreshSnapshot(ctx context.Context, _ *sdkmcp.CallToolRequest, _ RefreshSnapshotInput) (*sdkmcp.CallToolResult, any, error) {
-	snap, err := h.cache.Refresh(ctx)
+func (h *Handler) RefreshSnapshot(ctx context.Context, _ *sdkmcp.CallToolRequest, input RefreshSnapshotInput) (*sdkmcp.CallToolResult, any, error) {
+	job, joined := h.cache.StartRefresh(ctx)
+	if input.Async {
+		hint := "Rebuild started. Poll refresh_status(job_id=" + job.ID + ") until it reports completed or failed."
+		if joined {
+			hint = "A rebuild was already running; joined it. Poll refresh_status(job_id=" + job.ID + ") until it reports completed or failed."
+		}
+		return marshalResult(struct {
+			cache.RefreshJob
+			Hint string `json:"hint"`
+		}{job, hint})
+	}
+	snap, err := h.cache.WaitRefresh(ctx, job.ID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("refresh snapshot: %w", err)
 	}
@@ -949,14 +1507,83 @@ func (h *Handler) RefreshSnapshot(ctx context.Context, _ *sdkmcp.CallToolRequest
 	)), nil, nil
 }
 
+// RefreshStatus reports a snapshot rebuild job started by refresh_snapshot.
+func (h *Handler) RefreshStatus(_ context.Context, _ *sdkmcp.CallToolRequest, input RefreshStatusInput) (*sdkmcp.CallToolResult, any, error) {
+	var (
+		job cache.RefreshJob
+		ok  bool
+	)
+	if id := strings.TrimSpace(input.JobID); id != "" {
+		job, ok = h.cache.RefreshStatus(id)
+		if !ok {
+			return toolError(fmt.Sprintf("unknown refresh job %q; it may have been forgotten — only the latest rebuilds are kept", id)), nil, nil
+		}
+	} else if job, ok = h.cache.LatestRefresh(); !ok {
+		return toolText("No snapshot rebuild has been requested yet. The snapshot is " + formatAge(h.cache.Age()) + " old."), nil, nil
+	}
+	return marshalResult(job)
+}
+
 // ---- Helpers ----
 
+// formatAge renders a snapshot age to the second, e.g. "1h5m0s".
+func formatAge(age time.Duration) string {
+	return age.Round(time.Second).String()
+}
+
+// truncatedMarker is appended to tool results cut down to maxResultBytes.
+const truncatedMarker = "\n…[truncated; narrow your query]"
+
+// uncappedInput is implemented by tool inputs that can ask for a result
+// exempt from maxResultBytes.
+type uncappedInput interface {
+	uncapped() bool
+}
+
+// capResult cuts every text content of a successful tool result to
+// h.maxResultBytes. addTool applies it to each call's result.
+func (h *Handler) capResult(res *sdkmcp.CallToolResult) {
+	if res == nil || res.IsError || h.maxResultBytes <= 0 {
+		return
+	}
+	for _, c := range res.Content {
+		if tc, ok := c.(*sdkmcp.TextContent); ok {
+			tc.Text = truncateResult(tc.Text, h.maxResultBytes)
+		}
+	}
+}
+
 func toolText(text string) *sdkmcp.CallToolResult {
 	return &sdkmcp.CallToolResult{
 		Content: []sdkmcp.Content{&sdkmcp.TextContent{Text: text}},
 	}
 }
 
+// truncateResult cuts text to at most max bytes (marker included), backing off
+// to a UTF-8 rune boundary. max <= 0 disables truncation.
+func truncateResult(text string, max int) string {
+	if max <= 0 || len(text) <= max {
+		return text
+	}
+	cut := max - len(truncatedMarker)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + truncatedMarker
+}
+
+// createdAtLine renders the "Created at" line for a create response, or "" when
+// the API did not report a modified timestamp.
+func createdAtLine(modified string) string {
+	if modified == "" {
+		return ""
+	}
+	return "\nCreated at: " + modified
+}
+
 func toolError(msg string) *sdkmcp.CallToolResult {
 	return &sdkmcp.CallToolResult{
 		IsError: true,
@@ -964,20 +1591,49 @@ func toolError(msg string) *sdkmcp.CallToolResult {
 	}
 }
 
+// rawHTMLResult renders v as indented JSON whose HTML is left as stored: not
+// escaped to \u003c and friends, and not cut to maxResultBytes, so an article
+// can be edited and written back faithfully.
+func rawHTMLResult(v interface{}) (*sdkmcp.CallToolResult, any, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, nil, fmt.Errorf("marshal result: %w", err)
+	}
+	return &sdkmcp.CallToolResult{
+		Content: []sdkmcp.Content{&sdkmcp.TextContent{Text: strings.TrimSuffix(buf.String(), "\n")}},
+	}, nil, nil
+}
+
 func marshalResult(v interface{}) (*sdkmcp.CallToolResult, any, error) {
-	data, err := json.MarshalIndent(v, "", "  ")
+	data, err := guardedMarshal(v)
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal result: %w", err)
 	}
 	return toolText(string(data)), nil, nil
 }
 
+// linkDiagram fills a referenced diagram document's portal link so the
+// assistant can point users straight at the site/facility/cabinet diagram.
+func (h *Handler) linkDiagram(d *itportal.DocumentReference) {
+	if d != nil && d.ID != 0 && d.URL == "" {
+		d.URL = itportal.BuildPortalURL(h.baseURL, "document", d.ID)
+	}
+}
+
 // marshalWithURL backfills a constructed portal deep-link onto an entity whose
 // API-provided url is empty, then marshals it. url must point at the entity's URL
 // field so the backfill is reflected in the marshalled output.
 func (h *Handler) marshalWithURL(itemType string, id int, url *string, v interface{}) (*sdkmcp.CallToolResult, any, error) {
+	return h.formatWithURL("", itemType, id, url, v)
+}
+
+// formatWithURL is marshalWithURL rendering in the given output format.
+func (h *Handler) formatWithURL(format, itemType string, id int, url *string, v interface{}) (*sdkmcp.CallToolResult, any, error) {
 	if *url == "" {
 		*url = itportal.BuildPortalURL(h.baseURL, itemType, id)
 	}
-	return marshalResult(v)
+	return formatResult(format, v)
 }
@@ -2,11 +2,19 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/alexfirilov/itportal-mcp/internal/itportal"
 )
@@ -221,3 +229,854 @@ func TestGetDeviceDetailsDedupesIPs(t *testing.T) {
 		t.Errorf("device IP appears %d times in output, want 1:\n%s", n, out)
 	}
 }
+
+// TestGetDeviceDetailsFiltersNotes verifies notes_limit and notes_since cap and
+// date-filter a device's notes, newest first, and report how many were dropped.
+func TestGetDeviceDetailsFiltersNotes(t *testing.T) {
+	var notes []itportal.DeviceNote
+	for day := 1; day <= 200; day++ {
+		at := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC).AddDate(0, 0, day-1)
+		notes = append(notes, itportal.DeviceNote{ID: day, Notes: fmt.Sprintf("note %d", day), DateTime: at.Format("2006-01-02T15:04:05")})
+	}
+	notes = append(notes, itportal.DeviceNote{ID: 999, Notes: "undated"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/ips/"):
+			writeList(w, []itportal.DeviceIP{}, "")
+		case strings.HasSuffix(r.URL.Path, "/managementUrls/"):
+			writeList(w, []itportal.DeviceMUrl{}, "")
+		case strings.HasSuffix(r.URL.Path, "/notes/"):
+			writeList(w, notes, "")
+		default:
+			writeList(w, []itportal.Device{{ID: 139, Name: "fw01"}}, "")
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	get := func(in GetEntityInput) deviceDetail {
+		t.Helper()
+		in.EntityType, in.ID = "device", "139"
+		res, _, err := h.GetEntityDetails(ctx, nil, in)
+		if err != nil || res.IsError {
+			t.Fatalf("GetEntityDetails(%+v): %v, %v", in, res, err)
+		}
+		var d deviceDetail
+		if err := json.Unmarshal([]byte(resultText(t, res)), &d); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return d
+	}
+	ids := func(d deviceDetail) []int {
+		out := make([]int, len(d.Notes))
+		for i, n := range d.Notes {
+			out[i] = n.ID
+		}
+		return out
+	}
+
+	if d := get(GetEntityInput{}); len(d.Notes) != 201 || d.NotesOmitted != 0 {
+		t.Errorf("unfiltered: %d notes, %d omitted; want 201, 0", len(d.Notes), d.NotesOmitted)
+	}
+	if d := get(GetEntityInput{NotesLimit: 3}); !slices.Equal(ids(d), []int{200, 199, 198}) || d.NotesOmitted != 198 {
+		t.Errorf("notes_limit 3: ids %v, %d omitted; want [200 199 198], 198", ids(d), d.NotesOmitted)
+	}
+	// Day 195 is 2024-07-13.
+	if d := get(GetEntityInput{NotesSince: "2024-07-13"}); !slices.Equal(ids(d), []int{200, 199, 198, 197, 196, 195}) {
+		t.Errorf("notes_since: ids %v, want 200 down to 195", ids(d))
+	}
+	if d := get(GetEntityInput{NotesSince: "2024-07-13", NotesLimit: 2}); !slices.Equal(ids(d), []int{200, 199}) || d.NotesOmitted != 199 {
+		t.Errorf("both: ids %v, %d omitted; want [200 199], 199", ids(d), d.NotesOmitted)
+	}
+
+	for _, in := range []GetEntityInput{{NotesLimit: -1}, {NotesSince: "last week"}} {
+		in.EntityType, in.ID = "device", "139"
+		if res, _, err := h.GetEntityDetails(ctx, nil, in); err != nil || !res.IsError {
+			t.Errorf("%+v accepted: %v, %v", in, res, err)
+		}
+	}
+}
+
+// TestGetByForeignIDSendsFilter verifies get_by_foreign_id passes the external
+// ID as the foreignId query param and returns the single matching entity.
+func TestGetByForeignIDSendsFilter(t *testing.T) {
+	var gotForeignID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotForeignID = r.URL.Query().Get("foreignId")
+		writeList(w, []itportal.Device{{ID: 42, Name: "core-sw", ForeignID: 9001}}, "")
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	res, _, err := h.GetByForeignID(context.Background(), nil, GetByForeignIDInput{EntityType: "device", ForeignID: "9001"})
+	if err != nil {
+		t.Fatalf("GetByForeignID: %v", err)
+	}
+	if gotForeignID != "9001" {
+		t.Errorf("foreignId query param = %q, want 9001", gotForeignID)
+	}
+	var dev itportal.Device
+	if err := json.Unmarshal([]byte(resultText(t, res)), &dev); err != nil {
+		t.Fatalf("result is not a single device: %v", err)
+	}
+	if dev.ID != 42 || dev.ForeignID != 9001 {
+		t.Errorf("unexpected match: %+v", dev)
+	}
+}
+
+// TestGetByForeignIDSendsForeignType verifies foreign_type is sent as
+// foreignType together with foreignId, and refused for companies.
+func TestGetByForeignIDSendsForeignType(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		writeList(w, []itportal.Site{{ID: 8, Name: "HQ", ForeignID: 9001, ForeignType: "ConnectWise"}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	res, _, err := h.GetByForeignID(ctx, nil, GetByForeignIDInput{EntityType: "site", ForeignID: "9001", ForeignType: "ConnectWise"})
+	if err != nil || res.IsError {
+		t.Fatalf("GetByForeignID: %v, %v", res, err)
+	}
+	if got.Get("foreignId") != "9001" || got.Get("foreignType") != "ConnectWise" {
+		t.Errorf("query = %v, want foreignId=9001 and foreignType=ConnectWise", got)
+	}
+
+	got = nil
+	res, _, _ = h.GetByForeignID(ctx, nil, GetByForeignIDInput{EntityType: "company", ForeignID: "9001", ForeignType: "ConnectWise"})
+	if !res.IsError || got != nil {
+		t.Errorf("foreign_type accepted for a company: %v (query %v)", res, got)
+	}
+}
+
+// TestCreateDeviceSendsForeignReference verifies create_device stores
+// foreign_id and foreign_type, and refuses a type without an ID.
+func TestCreateDeviceSendsForeignReference(t *testing.T) {
+	var posted itportal.Device
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/2.1/devices/" {
+			_ = json.NewDecoder(r.Body).Decode(&posted)
+			w.Header().Set("Location", "/api/2.1/devices/42/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []itportal.Device{{ID: 42, Name: "fw01"}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	res, _, err := h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "fw01", ForeignID: 9001, ForeignType: "Datto RMM"})
+	if err != nil || res.IsError {
+		t.Fatalf("CreateDevice: %v, %v", res, err)
+	}
+	if posted.ForeignID != 9001 || posted.ForeignType != "Datto RMM" {
+		t.Errorf("posted foreignId/foreignType = %d/%q", posted.ForeignID, posted.ForeignType)
+	}
+
+	res, _, _ = h.CreateDevice(ctx, nil, CreateDeviceInput{CompanyID: 1, Name: "fw02", ForeignType: "Datto RMM"})
+	if !res.IsError || !strings.Contains(resultText(t, res), "field foreign_id") {
+		t.Errorf("foreign_type without foreign_id accepted: %v", res)
+	}
+}
+
+// TestCreateDeviceReportsSubResourceIDs verifies create_device's side-effect
+// lines carry the IDs of the IP record, management URL and note it created.
+func TestCreateDeviceReportsSubResourceIDs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			id := map[string]string{
+				"/api/2.1/devices/":                   "42",
+				"/api/2.1/devices/42/ips/":            "501",
+				"/api/2.1/devices/42/managementUrls/": "502",
+				"/api/2.1/devices/42/notes/":          "503",
+			}[r.URL.Path]
+			w.Header().Set("Location", r.URL.Path+id+"/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []itportal.Device{{ID: 42, Name: "fw01"}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	res, _, err := h.CreateDevice(context.Background(), nil, CreateDeviceInput{
+		CompanyID: 1, Name: "fw01", IPAddress: "10.0.0.1",
+		ManagementURL: "https://10.0.0.1", InitialNote: "racked",
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("CreateDevice: %v, %v", res, err)
+	}
+	text := resultText(t, res)
+	for _, want := range []string{
+		"✓ IP added: 10.0.0.1 (IP record ID: 501)",
+		"✓ Management URL added: https://10.0.0.1 (management URL ID: 502)",
+		"✓ Initial note added (note ID: 503)",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result missing %q:\n%s", want, text)
+		}
+	}
+}
+
+// TestGetDeviceByIPFetchesSubResources verifies get_device_by_ip filters the
+// device list by ipAddress and, on a unique match, loads the device detail with
+// its sub-resources.
+func TestGetDeviceByIPFetchesSubResources(t *testing.T) {
+	var gotIP string
+	paths := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths[r.URL.Path] = true
+		switch r.URL.Path {
+		case "/api/2.1/devices/":
+			gotIP = r.URL.Query().Get("ipAddress")
+			writeList(w, []itportal.Device{{ID: 7, Name: "fw01"}}, "")
+		case "/api/2.1/devices/7/":
+			writeList(w, []itportal.Device{{ID: 7, Name: "fw01"}}, "")
+		case "/api/2.1/devices/7/ips/":
+			writeList(w, []itportal.DeviceIP{{ID: 1, IP: "10.0.0.5"}}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	defer srv.Close()
+
+	res, _, err := newHandler(srv.URL).GetDeviceByIP(context.Background(), nil, GetDeviceByIPInput{IPAddress: " 10.0.0.5 "})
+	if err != nil || res.IsError {
+		t.Fatalf("GetDeviceByIP: err=%v res=%v", err, res)
+	}
+	if gotIP != "10.0.0.5" {
+		t.Errorf("ipAddress query param = %q, want 10.0.0.5", gotIP)
+	}
+	for _, p := range []string{"/api/2.1/devices/7/ips/", "/api/2.1/devices/7/notes/", "/api/2.1/devices/7/managementUrls/"} {
+		if !paths[p] {
+			t.Errorf("sub-resource %s not fetched (got %v)", p, paths)
+		}
+	}
+	if text := resultText(t, res); !strings.Contains(text, `"ip_addresses"`) || !strings.Contains(text, "10.0.0.5") {
+		t.Errorf("detail missing IPs: %s", text)
+	}
+}
+
+// TestCapResultTruncatesOversizedResult verifies TOOL_MAX_RESULT_BYTES cuts an
+// oversized result down with the truncation marker and leaves small ones alone.
+func TestCapResultTruncatesOversizedResult(t *testing.T) {
+	h := &Handler{maxResultBytes: 100}
+	capped := func(text string) *sdkmcp.CallToolResult {
+		res := toolText(text)
+		h.capResult(res)
+		return res
+	}
+
+	big := strings.Repeat("é", 500)
+	got := resultText(t, capped(big))
+	if len(got) > 100 {
+		t.Errorf("truncated result is %d bytes, want <= 100", len(got))
+	}
+	if !strings.HasSuffix(got, "[truncated; narrow your query]") {
+		t.Errorf("missing truncation marker: %q", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Error("truncation split a multi-byte rune")
+	}
+
+	small := "ok"
+	if got := resultText(t, capped(small)); got != small {
+		t.Errorf("small result changed: %q", got)
+	}
+}
+
+// TestCreateEchoesModifiedTimestamp verifies create tools surface the created
+// record's modified timestamp in text and return the record as structured output.
+func TestCreateEchoesModifiedTimestamp(t *testing.T) {
+	const modified = "2026-03-01T10:15:00Z"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", "/api/2.1/sites/5/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		writeList(w, []itportal.Site{{ID: 5, Name: "Branch", Modified: modified, NumberOfPCs: 3}}, "")
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	res, out, err := h.CreateEntity(context.Background(), nil, CreateEntityInput{
+		EntityType: "site", Fields: map[string]interface{}{"name": "Branch"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	if text := resultText(t, res); !strings.Contains(text, "Created at: "+modified) {
+		t.Errorf("modified timestamp not echoed in text: %q", text)
+	}
+	site, ok := out.(*itportal.Site)
+	if !ok {
+		t.Fatalf("structured output is %T, want *itportal.Site", out)
+	}
+	if site.Modified != modified || site.NumberOfPCs != 3 {
+		t.Errorf("structured output missing server fields: %+v", site)
+	}
+}
+
+// TestSelfTestReport verifies selftest reports PASS with the base URL against a
+// healthy backend and FAIL with the API error when authentication is rejected.
+func TestSelfTestReport(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("limit"); got != "1" {
+			t.Errorf("selftest list limit = %q, want 1", got)
+		}
+		writeList(w, []itportal.Company{{ID: 1, Name: "Acme"}}, "")
+	}))
+	defer healthy.Close()
+
+	res, _, err := newHandler(healthy.URL).SelfTest(context.Background(), nil, SelfTestInput{})
+	if err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	text := resultText(t, res)
+	for _, want := range []string{"Base URL: " + healthy.URL, "✓ OK", "Result: PASS"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("healthy report missing %q:\n%s", want, text)
+		}
+	}
+	if res.IsError {
+		t.Error("healthy report flagged as error")
+	}
+
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer denied.Close()
+
+	res, _, err = newHandler(denied.URL).SelfTest(context.Background(), nil, SelfTestInput{})
+	if err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	text = resultText(t, res)
+	if !res.IsError || !strings.Contains(text, "401") || !strings.Contains(text, "Result: FAIL") {
+		t.Errorf("auth failure not reported:\n%s", text)
+	}
+}
+
+// TestRawRequestPathRestriction verifies raw_request refuses anything outside
+// /api/2.0/ before a request is made, and forwards permitted calls intact.
+func TestRawRequestPathRestriction(t *testing.T) {
+	var calls int
+	var gotMethod, gotPath, gotLimit string
+	var gotBody map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		gotMethod, gotPath, gotLimit = r.Method, r.URL.Path, r.URL.Query().Get("limit")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	for _, p := range []string{
+		"/admin/settings",
+		"https://evil.example/api/2.0/devices/",
+		"/api/2.0/../../etc/passwd",
+		"/api/2.0/%2e%2e/%2e%2e/secret",
+		"/api/2.0/devices/?limit=1",
+		"api/2.0/devices/",
+	} {
+		res, _, err := h.RawRequest(context.Background(), nil, RawRequestInput{Method: "GET", Path: p})
+		if err != nil || !res.IsError {
+			t.Errorf("path %q not rejected: err=%v res=%v", p, err, res)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("blocked paths still reached the API %d times", calls)
+	}
+
+	res, _, err := h.RawRequest(context.Background(), nil, RawRequestInput{
+		Method: "patch",
+		Path:   "/api/2.0/devices/42/",
+		Body:   map[string]interface{}{"customField": "x"},
+		Query:  map[string]string{"limit": "5"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("permitted call failed: err=%v res=%v", err, res)
+	}
+	if gotMethod != http.MethodPatch || gotPath != "/api/2.1/devices/42/" || gotLimit != "5" || gotBody["customField"] != "x" {
+		t.Errorf("forwarded %s %s limit=%q body=%v", gotMethod, gotPath, gotLimit, gotBody)
+	}
+	if text := resultText(t, res); !strings.HasPrefix(text, "HTTP 200") || !strings.Contains(text, `"ok": true`) {
+		t.Errorf("unexpected raw response: %s", text)
+	}
+}
+
+// TestRawRequestDeniesCredentialPaths verifies MCP_DENY_SECRETS also keeps
+// raw_request away from credential endpoints, encoded or not.
+func TestRawRequestDeniesCredentialPaths(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(`{"code":200,"data":{}}`))
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	WithDenySecrets(true)(h)
+
+	for _, p := range []string{
+		"/api/2.0/devices/7/credentials/",
+		"/api/2.0/devices/7/additional_credentials/3/",
+		"/api/2.0/devices/7/%63redentials/",
+	} {
+		res, _, err := h.RawRequest(context.Background(), nil, RawRequestInput{Method: "GET", Path: p})
+		if err != nil || !res.IsError || !strings.Contains(resultText(t, res), "credential policy") {
+			t.Errorf("path %q not refused: err=%v res=%v", p, err, res)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("credential paths still reached the API %d times", calls)
+	}
+	if res, _, err := h.RawRequest(context.Background(), nil, RawRequestInput{Method: "GET", Path: "/api/2.0/devices/7/"}); err != nil || res.IsError {
+		t.Errorf("non-credential path refused: err=%v res=%v", err, res)
+	}
+}
+
+// TestEntityDetailsLinksDiagram verifies get_entity_details fills the portal
+// link of a site's diagram document.
+func TestEntityDetailsLinksDiagram(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []itportal.Site{{ID: 5, Name: "HQ", Diagram: &itportal.DocumentReference{ID: 600, Name: "HQ LAN"}}}, "")
+	}))
+	defer srv.Close()
+
+	res, _, err := newHandler(srv.URL).GetEntityDetails(context.Background(), nil, GetEntityInput{EntityType: "site", ID: "5"})
+	if err != nil {
+		t.Fatalf("GetEntityDetails: %v", err)
+	}
+	var site itportal.Site
+	if err := json.Unmarshal([]byte(resultText(t, res)), &site); err != nil {
+		t.Fatalf("decode site: %v", err)
+	}
+	if want := srv.URL + "/v4/app/documents/600"; site.Diagram == nil || site.Diagram.URL != want {
+		t.Errorf("diagram = %+v, want url %s", site.Diagram, want)
+	}
+}
+
+// TestEntityDetailsRawKBHTML checks raw_html returns a KB's description and
+// article byte for byte, past the result-size cap, while the default JSON
+// still escapes and truncates.
+func TestEntityDetailsRawKBHTML(t *testing.T) {
+	desc := `<p>Restore <b>&amp;</b> verify</p>` + strings.Repeat("<br/>x", 40)
+	article := `<h2>Steps</h2><ol><li>Stop "svc"</li></ol>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []itportal.KB{{ID: 8, Name: "Backups", Description: desc, Article: article}}, "")
+	}))
+	defer srv.Close()
+	_, c, _ := fakeInstance(t, "Alpha")
+	cs := connect(t, NewServer(itportal.NewClient(srv.URL, "secret"), c, WithMaxResultBytes(200)))
+	call := func(args map[string]any) *sdkmcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &sdkmcp.CallToolParams{Name: "get_entity_details", Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool(%v): %v", args, err)
+		}
+		return res
+	}
+
+	res := call(map[string]any{"entity_type": "kb", "id": "8", "raw_html": true, "format": "markdown"})
+	if res.IsError {
+		t.Fatalf("get_entity_details raw_html: %s", resultText(t, res))
+	}
+	text := resultText(t, res)
+	if !strings.Contains(text, desc) || !strings.Contains(text, `<h2>Steps</h2><ol><li>Stop \"svc\"</li></ol>`) {
+		t.Errorf("raw result lacks the stored HTML:\n%s", text)
+	}
+	var kb itportal.KB
+	if err := json.Unmarshal([]byte(text), &kb); err != nil {
+		t.Fatalf("raw result is not JSON: %v", err)
+	}
+	if kb.Description != desc || kb.Article != article || kb.URL == "" {
+		t.Errorf("decoded = %+v", kb)
+	}
+
+	res = call(map[string]any{"entity_type": "kb", "id": "8"})
+	if text := resultText(t, res); strings.Contains(text, "<p>") || !strings.HasSuffix(text, truncatedMarker) {
+		t.Errorf("default result should stay escaped and capped:\n%s", text)
+	}
+
+	res = call(map[string]any{"entity_type": "site", "id": "8", "raw_html": true})
+	if !res.IsError || !strings.Contains(resultText(t, res), "field raw_html") {
+		t.Errorf("raw_html on a site accepted: %s", resultText(t, res))
+	}
+}
+
+// TestListEntitiesNormalizesMAC verifies mac_address is normalised to
+// upper-case colon form and forwarded as the macAddress filter.
+func TestListEntitiesNormalizesMAC(t *testing.T) {
+	var gotMAC string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMAC = r.URL.Query().Get("macAddress")
+		writeList(w, []itportal.Device{{ID: 1, Name: "ap01"}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	for _, in := range []string{"00-1a-2b-3c-4d-5e", "001a.2b3c.4d5e", "001A2B3C4D5E", " 00:1a:2b:3c:4d:5e "} {
+		gotMAC = ""
+		res, _, err := h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", MacAddress: in})
+		if err != nil || res.IsError {
+			t.Fatalf("ListEntities(%q): err=%v res=%v", in, err, res)
+		}
+		if gotMAC != "00:1A:2B:3C:4D:5E" {
+			t.Errorf("mac %q forwarded as %q, want 00:1A:2B:3C:4D:5E", in, gotMAC)
+		}
+	}
+
+	res, _, _ := h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", MacAddress: "not-a-mac"})
+	if !res.IsError {
+		t.Error("invalid MAC not rejected")
+	}
+}
+
+// TestUploadFileEntityTypeAliases verifies upload_file accepts the entity_type
+// spellings the other tools do and rejects a non-numeric entity_id before any
+// request is made.
+func TestUploadFileEntityTypeAliases(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+
+	for typ, want := range map[string]string{
+		"device_configuration": "/api/2.1/devices/7/configurationFiles/",
+		"Device-Config":        "/api/2.1/devices/7/configurationFiles/",
+		"kbarticle":            "/api/2.1/kbs/7/file/",
+		"knowledge_base":       "/api/2.1/kbs/7/file/",
+		"Contact_Photo":        "/api/2.1/contacts/7/file/",
+	} {
+		gotPath = ""
+		name := "a.txt"
+		if typ == "Contact_Photo" {
+			name = "a.png"
+		}
+		res, _, err := h.UploadFile(context.Background(), nil, UploadFileInput{EntityType: typ, EntityID: "7", FileName: name, Base64Data: data})
+		if err != nil || res.IsError {
+			t.Fatalf("UploadFile(%q): err=%v res=%v", typ, err, res)
+		}
+		if gotPath != want {
+			t.Errorf("%q uploaded to %q, want %q", typ, gotPath, want)
+		}
+	}
+
+	gotPath = ""
+	res, _, _ := h.UploadFile(context.Background(), nil, UploadFileInput{EntityType: "kb", EntityID: "7/../1", FileName: "a.txt", Base64Data: data})
+	if !res.IsError || !strings.Contains(resultText(t, res), "field entity_id") {
+		t.Errorf("non-numeric entity_id not rejected: %v", res)
+	}
+	if gotPath != "" {
+		t.Errorf("request sent for invalid entity_id: %s", gotPath)
+	}
+}
+
+// TestAddDeviceCredentialPostsBodyWithoutEchoingPassword verifies the credential
+// is POSTed to the device's credentials endpoint, the password (even when the
+// API echoes it back) never reaches the result, and the secret policy blocks it.
+func TestAddDeviceCredentialPostsBodyWithoutEchoingPassword(t *testing.T) {
+	var gotPath string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.Method + " " + r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"success":true,"data":{"id":77,"username":"admin","password":"hunter2"}}`))
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	res, _, err := h.AddDeviceCredential(context.Background(), nil, AddDeviceCredentialInput{
+		DeviceID: "42", Username: "admin", Password: "hunter2", Description: "local admin", Domain: "CORP", TwoFACode: "JBSWY3DP",
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("AddDeviceCredential: err=%v res=%v", err, res)
+	}
+	if gotPath != "POST /api/2.1/devices/42/credentials/" {
+		t.Errorf("request = %s", gotPath)
+	}
+	want := map[string]any{"username": "admin", "password": "hunter2", "description": "local admin", "domain": "CORP", "2faCode": "JBSWY3DP"}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("body[%s] = %v, want %v", k, body[k], v)
+		}
+	}
+	text := resultText(t, res)
+	if !strings.Contains(text, "credential ID: 77") || strings.Contains(text, "hunter2") || strings.Contains(text, "JBSWY3DP") {
+		t.Errorf("result = %q", text)
+	}
+
+	gotPath = ""
+	h.denySecrets = true
+	res, _, _ = h.AddDeviceCredential(context.Background(), nil, AddDeviceCredentialInput{DeviceID: "42", Username: "admin"})
+	if !res.IsError || gotPath != "" {
+		t.Errorf("secret policy not enforced: res=%v request=%q", res, gotPath)
+	}
+}
+
+// TestListEntitiesForwardsExtraFilters checks extra_filters reach the query
+// string verbatim alongside the mapped filters.
+func TestListEntitiesForwardsExtraFilters(t *testing.T) {
+	var query map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		writeList(w, []itportal.Device{{ID: 1, Name: "sw01"}}, "")
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	res, _, err := h.ListEntities(context.Background(), nil, ListEntitiesInput{
+		EntityType:   "device",
+		CompanyID:    "3",
+		ExtraFilters: map[string]string{"inOut": "true", "foreignType": "RMM & PSA"},
+	})
+	if err != nil {
+		t.Fatalf("ListEntities: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %s", resultText(t, res))
+	}
+	for k, want := range map[string]string{"inOut": "true", "foreignType": "RMM & PSA", "companyId": "3"} {
+		if got := query[k]; len(got) != 1 || got[0] != want {
+			t.Errorf("query %s = %v, want %q", k, got, want)
+		}
+	}
+}
+
+// TestListEntitiesExplainsEmptyResult checks a zero-item list carries a note
+// echoing the filters that were applied, and none when items came back.
+// TestListEntitiesExcludesIDs verifies exclude_ids drops those entities from
+// the page and reports how many were left out.
+func TestListEntitiesExcludesIDs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeList(w, []itportal.Device{{ID: 1, Name: "fw01"}, {ID: 2, Name: "sw02"}, {ID: 3, Name: "ap03"}}, "")
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	list := func(in ListEntitiesInput) string {
+		t.Helper()
+		res, _, err := h.ListEntities(context.Background(), nil, in)
+		if err != nil || res.IsError {
+			t.Fatalf("ListEntities: err=%v res=%v", err, res)
+		}
+		return resultText(t, res)
+	}
+
+	var out struct {
+		Items    []itportal.Device `json:"items"`
+		Excluded int               `json:"excluded"`
+	}
+	if err := json.Unmarshal([]byte(list(ListEntitiesInput{EntityType: "device", ExcludeIDs: []int{1, 3, 99}})), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Items) != 1 || out.Items[0].ID != 2 || out.Excluded != 2 {
+		t.Errorf("items = %+v, excluded = %d; want only device 2 with 2 excluded", out.Items, out.Excluded)
+	}
+
+	md := list(ListEntitiesInput{EntityType: "device", Format: "markdown", ExcludeIDs: []int{1, 2, 3}})
+	if strings.Contains(md, "fw01") || strings.Contains(md, "sw02") || strings.Contains(md, "ap03") {
+		t.Errorf("excluded devices rendered:\n%s", md)
+	}
+	if !strings.Contains(md, "3 excluded") || !strings.Contains(md, "All 3 results on this page are in exclude_ids") {
+		t.Errorf("markdown does not explain the exclusion:\n%s", md)
+	}
+}
+
+func TestListEntitiesExplainsEmptyResult(t *testing.T) {
+	var items []itportal.Device
+	total := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type data struct {
+			Results []itportal.Device `json:"results"`
+			Total   int               `json:"total"`
+		}
+		_ = json.NewEncoder(w).Encode(struct {
+			Code int  `json:"code"`
+			Data data `json:"data"`
+		}{200, data{Results: items, Total: total}})
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+
+	note := func(in ListEntitiesInput) string {
+		t.Helper()
+		res, _, err := h.ListEntities(context.Background(), nil, in)
+		if err != nil || res.IsError {
+			t.Fatalf("ListEntities: err=%v res=%v", err, res)
+		}
+		var out listResult
+		if err := json.Unmarshal([]byte(resultText(t, res)), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out.Note
+	}
+
+	got := note(ListEntitiesInput{EntityType: "device", CompanyID: "5", TypeName: "Server", ExtraFilters: map[string]string{"inOut": "true"}})
+	if !strings.Contains(got, "0 results; filters applied: company_id=5, type_name=Server, extra_filters.inOut=true") {
+		t.Errorf("note = %q, want the applied filters", got)
+	}
+	if got := note(ListEntitiesInput{EntityType: "device"}); !strings.Contains(got, "no filters applied") {
+		t.Errorf("unfiltered note = %q", got)
+	}
+	total = 40
+	if got := note(ListEntitiesInput{EntityType: "device", Offset: 100}); !strings.Contains(got, "only 40 match") {
+		t.Errorf("past-the-end note = %q", got)
+	}
+
+	items = []itportal.Device{{ID: 1, Name: "srv01"}}
+	if got := note(ListEntitiesInput{EntityType: "device", CompanyID: "5"}); got != "" {
+		t.Errorf("non-empty result carries note %q", got)
+	}
+	res, _, _ := h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", CompanyID: "5", Format: "markdown"})
+	if text := resultText(t, res); strings.Contains(text, "filters applied") {
+		t.Errorf("markdown for a non-empty list has a note: %q", text)
+	}
+	items = nil
+	res, _, _ = h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", CompanyID: "5", Format: "markdown"})
+	if text := resultText(t, res); !strings.Contains(text, "filters applied: company_id=5") {
+		t.Errorf("markdown for an empty list lacks the note: %q", text)
+	}
+}
+
+// TestListEntitiesRejectsUnsafeExtraFilters checks header/CRLF-style injection
+// and reserved keys are refused before any request is made.
+func TestListEntitiesRejectsUnsafeExtraFilters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request made despite unsafe filters: %s", r.URL)
+		writeList(w, []itportal.Device{}, "")
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	for _, filters := range []map[string]string{
+		{"inOut\r\nX-Injected: 1": "true"},
+		{"name=x&admin": "1"},
+		{"": "x"},
+		{"tag": "a\r\nX-Injected: 1"},
+		{"limit": "100000"},
+		{"pageSize": "100000"},
+		{"page": "3"},
+	} {
+		res, _, err := h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", ExtraFilters: filters})
+		if err != nil {
+			t.Fatalf("ListEntities(%q): %v", filters, err)
+		}
+		if !res.IsError || !strings.Contains(resultText(t, res), "extra_filters") {
+			t.Errorf("filters %q not rejected: %s", filters, resultText(t, res))
+		}
+	}
+}
+
+// TestListEntitiesRejectsUnalignedPageOffset checks that under page pagination
+// an offset between page boundaries is refused rather than rounded down.
+func TestListEntitiesRejectsUnalignedPageOffset(t *testing.T) {
+	var pages []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("page"))
+		writeList(w, []itportal.Device{}, "")
+	}))
+	defer srv.Close()
+	h := &Handler{client: itportal.NewClient(srv.URL, "secret", itportal.WithPagination(itportal.PaginationPage)), baseURL: srv.URL}
+
+	res, _, err := h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", Offset: 25, Limit: 50})
+	if err != nil {
+		t.Fatalf("ListEntities: %v", err)
+	}
+	if !res.IsError || !strings.Contains(resultText(t, res), "multiple of limit (50)") || len(pages) != 0 {
+		t.Errorf("offset 25 with limit 50 not refused: %s (requests for pages %v)", resultText(t, res), pages)
+	}
+
+	res, _, err = h.ListEntities(context.Background(), nil, ListEntitiesInput{EntityType: "device", Offset: 100, Limit: 50})
+	if err != nil || res.IsError || !slices.Equal(pages, []string{"3"}) {
+		t.Errorf("offset 100 with limit 50: %v, %v; pages requested %v, want [3]", res, err, pages)
+	}
+}
+
+// TestRefreshSnapshotAsyncThenStatus checks async=true hands back a job ID that
+// refresh_status follows to completion.
+func TestRefreshSnapshotAsyncThenStatus(t *testing.T) {
+	h := mergeHandler(t)
+	ctx := context.Background()
+
+	res, _, err := h.RefreshSnapshot(ctx, nil, RefreshSnapshotInput{Async: true})
+	if err != nil {
+		t.Fatalf("RefreshSnapshot: %v", err)
+	}
+	var started struct {
+		JobID string `json:"job_id"`
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &started); err != nil || started.JobID == "" {
+		t.Fatalf("async result = %s (%v), want a job_id", resultText(t, res), err)
+	}
+
+	if _, err := h.cache.WaitRefresh(ctx, started.JobID); err != nil {
+		t.Fatalf("WaitRefresh: %v", err)
+	}
+	for _, in := range []RefreshStatusInput{{JobID: started.JobID}, {}} {
+		res, _, err = h.RefreshStatus(ctx, nil, in)
+		if err != nil {
+			t.Fatalf("RefreshStatus(%+v): %v", in, err)
+		}
+		if got := resultText(t, res); !strings.Contains(got, `"state": "completed"`) || !strings.Contains(got, started.JobID) {
+			t.Errorf("RefreshStatus(%+v) = %s, want the completed job", in, got)
+		}
+	}
+
+	res, _, _ = h.RefreshStatus(ctx, nil, RefreshStatusInput{JobID: "refresh-404"})
+	if !res.IsError {
+		t.Errorf("unknown job not reported as an error: %s", resultText(t, res))
+	}
+}
+
+func TestAddDeviceIPSkipsDuplicateUnlessForced(t *testing.T) {
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/2.1/devices/9/ips/":
+			posts++
+			w.Header().Set("Location", "/api/2.1/devices/9/ips/31/")
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/api/2.1/devices/9/ips/":
+			writeList(w, []itportal.DeviceIP{{ID: 12, IP: "10.0.0.50", MAC: "aa:bb:cc:dd:ee:ff"}, {ID: 13, IP: "2001:db8::1"}}, "")
+		default:
+			writeList(w, []itportal.DeviceIP{{ID: 31, IP: "10.0.0.50"}}, "")
+		}
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	ctx := context.Background()
+
+	for _, ip := range []string{"10.0.0.50", " 10.0.0.50 ", "2001:0db8:0:0:0:0:0:1"} {
+		res, _, err := h.AddDeviceIP(ctx, nil, AddDeviceIPInput{DeviceID: "9", IP: ip})
+		if err != nil || res.IsError {
+			t.Fatalf("AddDeviceIP(%q) = %v, %v", ip, res, err)
+		}
+		if got := resultText(t, res); !strings.Contains(got, "already present") || !strings.Contains(got, "record ID 1") {
+			t.Errorf("AddDeviceIP(%q) = %q, want the existing record", ip, got)
+		}
+	}
+	if posts != 0 {
+		t.Fatalf("duplicate IP posted %d times", posts)
+	}
+
+	res, _, err := h.AddDeviceIP(ctx, nil, AddDeviceIPInput{DeviceID: "9", IP: "10.0.0.50", Force: true})
+	if err != nil || res.IsError || posts != 1 {
+		t.Fatalf("forced AddDeviceIP = %v, %v (posts %d)", res, err, posts)
+	}
+	if _, _, err := h.AddDeviceIP(ctx, nil, AddDeviceIPInput{DeviceID: "9", IP: "10.0.0.51"}); err != nil || posts != 2 {
+		t.Errorf("new IP not added: %v (posts %d)", err, posts)
+	}
+}
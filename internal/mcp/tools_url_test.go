@@ -1,10 +1,20 @@
 package mcp
 
 import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
 )
 
 // fakeEntity mimics the {ID, URL} shape every ITPortal entity shares, so the test
@@ -59,3 +69,93 @@ func TestMarshalWithURLPreservesExisting(t *testing.T) {
 		t.Errorf("marshalled output dropped API url:\n%s", out)
 	}
 }
+
+func TestSearchDocsLinksMatchedDevice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/2.1/devices/" {
+			writeList(w, []itportal.Device{{ID: 77, Name: "fw-edge01", Company: &itportal.CompanyReference{ID: 3}}}, "")
+			return
+		}
+		writeList(w, []any{}, "")
+	}))
+	defer srv.Close()
+
+	client := itportal.NewClient(srv.URL, "secret")
+	c, err := cache.New(context.Background(), client, 100, 100, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "search.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+
+	res, _, err := h.SearchDocs(context.Background(), nil, SearchDocsInput{Query: "fw-edge01"})
+	if err != nil {
+		t.Fatalf("SearchDocs: %v", err)
+	}
+	want := `"url": "` + srv.URL + `/v4/app/devices/77"`
+	if out := resultText(t, res); !strings.Contains(out, want) {
+		t.Errorf("device hit missing portal link %s:\n%s", want, out)
+	}
+}
+
+func TestLinkSearchResultsFillsMissingURL(t *testing.T) {
+	h := &Handler{baseURL: "https://portal.example"}
+	results := []cache.SearchResult{
+		{Type: "device", ID: 42},
+		{Type: "kb", ID: 7, URL: "https://api-given/kb"},
+	}
+	h.linkSearchResults(results)
+	if results[0].URL != "https://portal.example/v4/app/devices/42" {
+		t.Errorf("device url = %q", results[0].URL)
+	}
+	if results[1].URL != "https://api-given/kb" {
+		t.Errorf("existing kb url overwritten: %q", results[1].URL)
+	}
+}
+
+func TestSearchDocsScopedToCompany(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.1/companies/":
+			writeList(w, []itportal.Company{{ID: 1, Name: "Acme"}, {ID: 2, Name: "Globex"}}, "")
+		case "/api/2.1/devices/":
+			writeList(w, []itportal.Device{
+				{ID: 10, Name: "core-router-acme", Company: &itportal.CompanyReference{ID: 1}},
+				{ID: 20, Name: "core-router-globex", Company: &itportal.CompanyReference{ID: 2}},
+			}, "")
+		case "/api/2.1/kbs/":
+			writeList(w, []itportal.KB{{ID: 30, Name: "router upgrade runbook", Company: &itportal.CompanyReference{ID: 2}}}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	defer srv.Close()
+
+	client := itportal.NewClient(srv.URL, "secret")
+	c, err := cache.New(context.Background(), client, 100, 100, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "search.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+
+	res, _, err := h.SearchDocs(context.Background(), nil, SearchDocsInput{Query: "router", CompanyID: "2"})
+	if err != nil {
+		t.Fatalf("SearchDocs: %v", err)
+	}
+	out := resultText(t, res)
+	if !strings.Contains(out, "core-router-globex") || !strings.Contains(out, "router upgrade runbook") {
+		t.Errorf("company 2 hits missing:\n%s", out)
+	}
+	if strings.Contains(out, "core-router-acme") {
+		t.Errorf("company 1 device leaked into company 2 search:\n%s", out)
+	}
+
+	res, _, _ = h.SearchDocs(context.Background(), nil, SearchDocsInput{Query: "runbook", CompanyID: "1"})
+	if out := resultText(t, res); !strings.HasPrefix(out, "No results") {
+		t.Errorf("company 1 search found another company's KB:\n%s", out)
+	}
+	if res, _, _ := h.SearchDocs(context.Background(), nil, SearchDocsInput{Query: "router", CompanyID: "acme"}); !res.IsError {
+		t.Error("non-numeric company_id accepted")
+	}
+}
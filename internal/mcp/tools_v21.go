@@ -1,14 +1,21 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
 	"github.com/alexfirilov/itportal-mcp/internal/itportal"
 )
 
@@ -54,53 +61,106 @@ func objectPathFor(entityType string) (string, bool) {
 type DeleteEntityInput struct {
 	EntityType string `json:"entity_type" jsonschema:"One of: company, site, device, kb, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork, address, additional_credential, interaction"`
 	ID         string `json:"id" jsonschema:"Numeric ID of the entity to delete"`
+	Confirm    string `json:"confirm,omitempty" jsonschema:"One-time token returned by a previous delete_entity call for this same entity. Without it the call only previews the entity and returns a token."`
 }
 
-func (h *Handler) DeleteEntity(ctx context.Context, _ *sdkmcp.CallToolRequest, input DeleteEntityInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.ID == "" {
-		return toolError("id is required"), nil, nil
-	}
-	var err error
-	switch normType(input.EntityType) {
+// deleter returns the client call deleting an entity of the normalised type.
+func (h *Handler) deleter(typ string) (func(context.Context, string) error, bool) {
+	switch typ {
 	case "company":
-		err = h.client.DeleteCompany(ctx, input.ID)
+		return h.client.DeleteCompany, true
 	case "site":
-		err = h.client.DeleteSite(ctx, input.ID)
+		return h.client.DeleteSite, true
 	case "device":
-		err = h.client.DeleteDevice(ctx, input.ID)
+		return h.client.DeleteDevice, true
 	case "kb", "knowledgebase":
-		err = h.client.DeleteKB(ctx, input.ID)
+		return h.client.DeleteKB, true
 	case "contact":
-		err = h.client.DeleteContact(ctx, input.ID)
+		return h.client.DeleteContact, true
 	case "account":
-		err = h.client.DeleteAccount(ctx, input.ID)
+		return h.client.DeleteAccount, true
 	case "agreement":
-		err = h.client.DeleteAgreement(ctx, input.ID)
+		return h.client.DeleteAgreement, true
 	case "document":
-		err = h.client.DeleteDocument(ctx, input.ID)
+		return h.client.DeleteDocument, true
 	case "facility":
-		err = h.client.DeleteFacility(ctx, input.ID)
+		return h.client.DeleteFacility, true
 	case "cabinet":
-		err = h.client.DeleteCabinet(ctx, input.ID)
+		return h.client.DeleteCabinet, true
 	case "configuration":
-		err = h.client.DeleteConfiguration(ctx, input.ID)
+		return h.client.DeleteConfiguration, true
 	case "ipnetwork":
-		err = h.client.DeleteIPNetwork(ctx, input.ID)
+		return h.client.DeleteIPNetwork, true
 	case "address":
-		err = h.client.DeleteAddress(ctx, input.ID)
+		return h.client.DeleteAddress, true
 	case "additionalcredential":
-		err = h.client.DeleteAdditionalCredential(ctx, input.ID)
+		return h.client.DeleteAdditionalCredential, true
 	case "interaction":
-		err = h.client.DeleteInteraction(ctx, input.ID)
-	default:
+		return h.client.DeleteInteraction, true
+	}
+	return nil, false
+}
+
+// DeleteEntity deletes an entity. With delete confirmation on, a call without
+// a confirm token only previews the entity and issues a one-time token that a
+// second call must echo back.
+func (h *Handler) DeleteEntity(ctx context.Context, _ *sdkmcp.CallToolRequest, input DeleteEntityInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(validateRequired("id", input.ID)); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+	del, ok := h.deleter(normType(input.EntityType))
+	if !ok {
 		return toolError(fmt.Sprintf("unknown or non-deletable entity_type %q", input.EntityType)), nil, nil
 	}
-	if err != nil {
+	if h.deletes != nil {
+		if strings.TrimSpace(input.Confirm) == "" {
+			return h.previewDelete(ctx, input)
+		}
+		if !h.deletes.redeem(input.EntityType, input.ID, input.Confirm) {
+			return toolError(fmt.Sprintf("confirm token is invalid or expired for %s %s. Call delete_entity without confirm to preview it and get a new token.", input.EntityType, input.ID)), nil, nil
+		}
+	}
+	if err := del(ctx, input.ID); err != nil {
 		return nil, nil, fmt.Errorf("delete %s %s: %w", input.EntityType, input.ID, err)
 	}
+	h.mergeDeleted(input.EntityType, input.ID)
 	return toolText(fmt.Sprintf("%s ID %s deleted.", input.EntityType, input.ID)), nil, nil
 }
 
+// previewDelete shows the entity delete_entity is about to remove, where
+// get_entity_details supports its type, and issues the token confirming it.
+func (h *Handler) previewDelete(ctx context.Context, input DeleteEntityInput) (*sdkmcp.CallToolResult, any, error) {
+	preview := "(no preview available for this entity type)"
+	res, _, err := h.GetEntityDetails(ctx, nil, GetEntityInput{EntityType: input.EntityType, ID: input.ID, Format: "markdown"})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !res.IsError && len(res.Content) > 0 {
+		if tc, ok := res.Content[0].(*sdkmcp.TextContent); ok {
+			preview = tc.Text
+		}
+	}
+	token := h.deletes.issue(input.EntityType, input.ID)
+	return marshalResult(struct {
+		EntityType string `json:"entity_type"`
+		ID         string `json:"id"`
+		Confirm    string `json:"confirm"`
+		ExpiresIn  string `json:"expires_in"`
+		Preview    string `json:"preview"`
+		Hint       string `json:"hint"`
+	}{
+		EntityType: input.EntityType,
+		ID:         strings.TrimSpace(input.ID),
+		Confirm:    token,
+		ExpiresIn:  deleteConfirmTTL.String(),
+		Preview:    preview,
+		Hint:       "Nothing was deleted. Check the preview is the intended entity, then call delete_entity again with the same entity_type and id and this confirm token.",
+	})
+}
+
 // ---- manage_relationship ----
 
 type ManageRelationshipInput struct {
@@ -118,8 +178,13 @@ func (h *Handler) ManageRelationship(ctx context.Context, _ *sdkmcp.CallToolRequ
 	if !ok {
 		return toolError(fmt.Sprintf("unknown object_type %q", input.ObjectType)), nil, nil
 	}
-	if input.ObjectID == "" {
-		return toolError("object_id is required"), nil, nil
+	if res := validationResult(validateRequired("object_id", input.ObjectID)); res != nil {
+		return res, nil, nil
+	}
+	if !readAction(input.Action) {
+		if res := h.checkWrite(input.ObjectType); res != nil {
+			return res, nil, nil
+		}
 	}
 
 	switch strings.ToLower(input.Action) {
@@ -130,8 +195,8 @@ func (h *Handler) ManageRelationship(ctx context.Context, _ *sdkmcp.CallToolRequ
 		}
 		return marshalResult(rels)
 	case "get":
-		if input.LinkID == "" {
-			return toolError("link_id is required for get"), nil, nil
+		if res := validationResult(validateRequiredFor("link_id", input.LinkID, "get")); res != nil {
+			return res, nil, nil
 		}
 		rel, err := h.client.GetRelationship(ctx, objPath, input.ObjectID, input.LinkID)
 		if err != nil {
@@ -139,8 +204,11 @@ func (h *Handler) ManageRelationship(ctx context.Context, _ *sdkmcp.CallToolRequ
 		}
 		return marshalResult(rel)
 	case "create":
-		if input.TargetType == "" || input.TargetID == 0 {
-			return toolError("target_type and target_id are required for create"), nil, nil
+		if res := validationResult(
+			validateRequiredFor("target_type", input.TargetType, "create"),
+			validateRequiredFor("target_id", input.TargetID, "create"),
+		); res != nil {
+			return res, nil, nil
 		}
 		rel := &itportal.Relationship{
 			Target: &itportal.RelationshipTarget{ItemType: input.TargetType, ID: input.TargetID},
@@ -153,16 +221,16 @@ func (h *Handler) ManageRelationship(ctx context.Context, _ *sdkmcp.CallToolRequ
 		return toolText(fmt.Sprintf("Relationship created (link ID: %d): %s %s ↔ %s %d.",
 			created.ID, input.ObjectType, input.ObjectID, input.TargetType, input.TargetID)), nil, nil
 	case "update":
-		if input.LinkID == "" {
-			return toolError("link_id is required for update"), nil, nil
+		if res := validationResult(validateRequiredFor("link_id", input.LinkID, "update")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.UpdateRelationship(ctx, objPath, input.ObjectID, input.LinkID, map[string]interface{}{"notes": input.Notes}); err != nil {
 			return nil, nil, fmt.Errorf("update relationship: %w", err)
 		}
 		return toolText(fmt.Sprintf("Relationship %s updated.", input.LinkID)), nil, nil
 	case "delete":
-		if input.LinkID == "" {
-			return toolError("link_id is required for delete"), nil, nil
+		if res := validationResult(validateRequiredFor("link_id", input.LinkID, "delete")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteRelationship(ctx, objPath, input.ObjectID, input.LinkID); err != nil {
 			return nil, nil, fmt.Errorf("delete relationship: %w", err)
@@ -194,8 +262,13 @@ func (h *Handler) ManageFolder(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 	if !ok {
 		return toolError(fmt.Sprintf("unknown object_type %q", objType)), nil, nil
 	}
-	if input.ObjectID == "" {
-		return toolError("object_id is required"), nil, nil
+	if res := validationResult(validateRequired("object_id", input.ObjectID)); res != nil {
+		return res, nil, nil
+	}
+	if !readAction(input.Action) {
+		if res := h.checkWrite(objType); res != nil {
+			return res, nil, nil
+		}
 	}
 
 	switch strings.ToLower(input.Action) {
@@ -206,8 +279,8 @@ func (h *Handler) ManageFolder(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		}
 		return marshalResult(folders)
 	case "get":
-		if input.FolderID == "" {
-			return toolError("folder_id is required for get"), nil, nil
+		if res := validationResult(validateRequiredFor("folder_id", input.FolderID, "get")); res != nil {
+			return res, nil, nil
 		}
 		folder, err := h.client.GetFolder(ctx, objPath, input.ObjectID, input.FolderID)
 		if err != nil {
@@ -215,8 +288,8 @@ func (h *Handler) ManageFolder(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		}
 		return marshalResult(folder)
 	case "create":
-		if input.Name == "" {
-			return toolError("name is required for create"), nil, nil
+		if res := validationResult(validateRequiredFor("name", input.Name, "create")); res != nil {
+			return res, nil, nil
 		}
 		folder := &itportal.Folder{Name: input.Name, Description: input.Description, ParentFolderID: input.ParentFolderID}
 		created, err := h.client.CreateFolder(ctx, objPath, input.ObjectID, folder)
@@ -225,8 +298,8 @@ func (h *Handler) ManageFolder(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		}
 		return toolText(fmt.Sprintf("Folder %q created (ID: %d).", input.Name, created.ID)), nil, nil
 	case "update":
-		if input.FolderID == "" {
-			return toolError("folder_id is required for update"), nil, nil
+		if res := validationResult(validateRequiredFor("folder_id", input.FolderID, "update")); res != nil {
+			return res, nil, nil
 		}
 		fields := map[string]interface{}{}
 		if input.Name != "" {
@@ -240,8 +313,8 @@ func (h *Handler) ManageFolder(ctx context.Context, _ *sdkmcp.CallToolRequest, i
 		}
 		return toolText(fmt.Sprintf("Folder %s updated.", input.FolderID)), nil, nil
 	case "delete":
-		if input.FolderID == "" {
-			return toolError("folder_id is required for delete"), nil, nil
+		if res := validationResult(validateRequiredFor("folder_id", input.FolderID, "delete")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteFolder(ctx, objPath, input.ObjectID, input.FolderID); err != nil {
 			return nil, nil, fmt.Errorf("delete folder: %w", err)
@@ -275,8 +348,16 @@ func (h *Handler) ManageFolderFile(ctx context.Context, _ *sdkmcp.CallToolReques
 	if !ok {
 		return toolError(fmt.Sprintf("unknown object_type %q", objType)), nil, nil
 	}
-	if input.ObjectID == "" || input.FolderID == "" {
-		return toolError("object_id and folder_id are required"), nil, nil
+	if res := validationResult(
+		validateRequired("object_id", input.ObjectID),
+		validateRequired("folder_id", input.FolderID),
+	); res != nil {
+		return res, nil, nil
+	}
+	if !readAction(input.Action) {
+		if res := h.checkWrite(objType); res != nil {
+			return res, nil, nil
+		}
 	}
 
 	switch strings.ToLower(input.Action) {
@@ -287,8 +368,14 @@ func (h *Handler) ManageFolderFile(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return marshalResult(files)
 	case "upload":
-		if input.FileName == "" || input.Base64Data == "" {
-			return toolError("file_name and base64_data are required for upload"), nil, nil
+		if res := validationResult(
+			validateRequiredFor("file_name", input.FileName, "upload"),
+			validateRequiredFor("base64_data", input.Base64Data, "upload"),
+		); res != nil {
+			return res, nil, nil
+		}
+		if msg := h.checkUploadExtension(uploadDocumentFile, input.FileName); msg != "" {
+			return toolError(msg), nil, nil
 		}
 		data, err := decodeBase64(input.Base64Data)
 		if err != nil {
@@ -300,8 +387,8 @@ func (h *Handler) ManageFolderFile(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("Uploaded %q (%d bytes) to folder %s (file ID: %d).", input.FileName, len(data), input.FolderID, id)), nil, nil
 	case "download":
-		if input.FileID == "" {
-			return toolError("file_id is required for download"), nil, nil
+		if res := validationResult(validateRequiredFor("file_id", input.FileID, "download")); res != nil {
+			return res, nil, nil
 		}
 		raw, err := h.client.DownloadFolderFile(ctx, objPath, input.ObjectID, input.FolderID, input.FileID)
 		if err != nil {
@@ -309,11 +396,14 @@ func (h *Handler) ManageFolderFile(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("File %s (%d bytes), base64:\n%s", input.FileID, len(raw), base64.StdEncoding.EncodeToString(raw))), nil, nil
 	case "update":
-		if input.FileID == "" {
-			return toolError("file_id is required for update"), nil, nil
+		if res := validationResult(validateRequiredFor("file_id", input.FileID, "update")); res != nil {
+			return res, nil, nil
 		}
 		fields := map[string]interface{}{}
 		if input.FileName != "" {
+			if msg := h.checkUploadExtension(uploadDocumentFile, input.FileName); msg != "" {
+				return toolError(msg), nil, nil
+			}
 			fields["fileName"] = input.FileName
 		}
 		if input.Description != "" {
@@ -324,8 +414,8 @@ func (h *Handler) ManageFolderFile(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("File %s updated.", input.FileID)), nil, nil
 	case "delete":
-		if input.FileID == "" {
-			return toolError("file_id is required for delete"), nil, nil
+		if res := validationResult(validateRequiredFor("file_id", input.FileID, "delete")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteFolderFile(ctx, objPath, input.ObjectID, input.FolderID, input.FileID); err != nil {
 			return nil, nil, fmt.Errorf("delete folder file: %w", err)
@@ -350,8 +440,13 @@ type ManageSwitchPortsInput struct {
 }
 
 func (h *Handler) ManageSwitchPorts(ctx context.Context, _ *sdkmcp.CallToolRequest, input ManageSwitchPortsInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.DeviceID == "" {
-		return toolError("device_id is required"), nil, nil
+	if res := validationResult(validateRequired("device_id", input.DeviceID)); res != nil {
+		return res, nil, nil
+	}
+	if !readAction(input.Action) {
+		if res := h.checkWrite("device"); res != nil {
+			return res, nil, nil
+		}
 	}
 
 	switch strings.ToLower(input.Action) {
@@ -362,8 +457,8 @@ func (h *Handler) ManageSwitchPorts(ctx context.Context, _ *sdkmcp.CallToolReque
 		}
 		return marshalResult(dedupeSwitchPortRanges(ranges))
 	case "get":
-		if input.RangeID == "" {
-			return toolError("range_id is required for get"), nil, nil
+		if res := validationResult(validateRequiredFor("range_id", input.RangeID, "get")); res != nil {
+			return res, nil, nil
 		}
 		ranges, err := h.client.ListSwitchPortRanges(ctx, input.DeviceID)
 		if err != nil {
@@ -376,8 +471,12 @@ func (h *Handler) ManageSwitchPorts(ctx context.Context, _ *sdkmcp.CallToolReque
 		}
 		return toolError(fmt.Sprintf("no switch port range %s on device %s", input.RangeID, input.DeviceID)), nil, nil
 	case "create":
-		if input.Name == "" || input.StartingPort == 0 || input.EndingPort == 0 {
-			return toolError("name, starting_port and ending_port are required for create"), nil, nil
+		if res := validationResult(
+			validateRequiredFor("name", input.Name, "create"),
+			validateRequiredFor("starting_port", input.StartingPort, "create"),
+			validateRequiredFor("ending_port", input.EndingPort, "create"),
+		); res != nil {
+			return res, nil, nil
 		}
 		r := &itportal.SwitchPortRange{
 			Name:            input.Name,
@@ -397,8 +496,8 @@ func (h *Handler) ManageSwitchPorts(ctx context.Context, _ *sdkmcp.CallToolReque
 		return toolText(fmt.Sprintf("Switch port range %q (ports %d-%d) created on device %s (range ID: %d).",
 			input.Name, input.StartingPort, input.EndingPort, input.DeviceID, id)), nil, nil
 	case "update":
-		if input.RangeID == "" {
-			return toolError("range_id is required for update"), nil, nil
+		if res := validationResult(validateRequiredFor("range_id", input.RangeID, "update")); res != nil {
+			return res, nil, nil
 		}
 		fields := map[string]interface{}{}
 		if input.Name != "" {
@@ -421,8 +520,8 @@ func (h *Handler) ManageSwitchPorts(ctx context.Context, _ *sdkmcp.CallToolReque
 		}
 		return toolText(fmt.Sprintf("Switch port range %s updated.", input.RangeID)), nil, nil
 	case "delete":
-		if input.RangeID == "" {
-			return toolError("range_id is required for delete"), nil, nil
+		if res := validationResult(validateRequiredFor("range_id", input.RangeID, "delete")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteSwitchPortRange(ctx, input.DeviceID, input.RangeID); err != nil {
 			return nil, nil, fmt.Errorf("delete switch port range: %w", err)
@@ -452,6 +551,11 @@ func (h *Handler) ManageType(ctx context.Context, _ *sdkmcp.CallToolRequest, inp
 	if !validTypeKinds[kind] {
 		return toolError(fmt.Sprintf("unknown type kind %q. Valid: account, agreement, company, contact, device, document, facility, configuration", input.Kind)), nil, nil
 	}
+	if !readAction(input.Action) {
+		if res := h.checkWrite("type"); res != nil {
+			return res, nil, nil
+		}
+	}
 	switch strings.ToLower(input.Action) {
 	case "list", "":
 		types, err := h.client.ListTypes(ctx, kind)
@@ -460,8 +564,8 @@ func (h *Handler) ManageType(ctx context.Context, _ *sdkmcp.CallToolRequest, inp
 		}
 		return marshalResult(types)
 	case "create":
-		if input.Name == "" {
-			return toolError("name is required for create"), nil, nil
+		if res := validationResult(validateRequiredFor("name", input.Name, "create")); res != nil {
+			return res, nil, nil
 		}
 		id, err := h.client.CreateType(ctx, kind, input.Name)
 		if err != nil {
@@ -469,16 +573,19 @@ func (h *Handler) ManageType(ctx context.Context, _ *sdkmcp.CallToolRequest, inp
 		}
 		return toolText(fmt.Sprintf("%s type %q created (ID: %d).", kind, input.Name, id)), nil, nil
 	case "update":
-		if input.TypeID == "" || input.Name == "" {
-			return toolError("type_id and name are required for update"), nil, nil
+		if res := validationResult(
+			validateRequiredFor("type_id", input.TypeID, "update"),
+			validateRequiredFor("name", input.Name, "update"),
+		); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.UpdateType(ctx, kind, input.TypeID, map[string]interface{}{"name": input.Name}); err != nil {
 			return nil, nil, fmt.Errorf("update %s type: %w", kind, err)
 		}
 		return toolText(fmt.Sprintf("%s type %s renamed to %q.", kind, input.TypeID, input.Name)), nil, nil
 	case "delete":
-		if input.TypeID == "" {
-			return toolError("type_id is required for delete"), nil, nil
+		if res := validationResult(validateRequiredFor("type_id", input.TypeID, "delete")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteType(ctx, kind, input.TypeID); err != nil {
 			return nil, nil, fmt.Errorf("delete %s type: %w", kind, err)
@@ -499,6 +606,11 @@ type ManageKBCategoryInput struct {
 }
 
 func (h *Handler) ManageKBCategory(ctx context.Context, _ *sdkmcp.CallToolRequest, input ManageKBCategoryInput) (*sdkmcp.CallToolResult, any, error) {
+	if !readAction(input.Action) {
+		if res := h.checkWrite("kb_category"); res != nil {
+			return res, nil, nil
+		}
+	}
 	switch strings.ToLower(input.Action) {
 	case "list", "":
 		cats, err := h.client.ListKBCategories(ctx)
@@ -507,8 +619,8 @@ func (h *Handler) ManageKBCategory(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return marshalResult(cats)
 	case "create":
-		if input.Name == "" {
-			return toolError("name is required"), nil, nil
+		if res := validationResult(validateRequired("name", input.Name)); res != nil {
+			return res, nil, nil
 		}
 		id, err := h.client.CreateKBCategory(ctx, input.Name)
 		if err != nil {
@@ -516,24 +628,30 @@ func (h *Handler) ManageKBCategory(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("KB category %q created (ID: %d).", input.Name, id)), nil, nil
 	case "update":
-		if input.CategoryID == "" || input.Name == "" {
-			return toolError("category_id and name are required"), nil, nil
+		if res := validationResult(
+			validateRequired("category_id", input.CategoryID),
+			validateRequired("name", input.Name),
+		); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.UpdateKBCategory(ctx, input.CategoryID, map[string]interface{}{"name": input.Name}); err != nil {
 			return nil, nil, fmt.Errorf("update KB category: %w", err)
 		}
 		return toolText(fmt.Sprintf("KB category %s renamed to %q.", input.CategoryID, input.Name)), nil, nil
 	case "delete":
-		if input.CategoryID == "" {
-			return toolError("category_id is required"), nil, nil
+		if res := validationResult(validateRequired("category_id", input.CategoryID)); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteKBCategory(ctx, input.CategoryID); err != nil {
 			return nil, nil, fmt.Errorf("delete KB category: %w", err)
 		}
 		return toolText(fmt.Sprintf("KB category %s deleted.", input.CategoryID)), nil, nil
 	case "createsubcategory", "create_subcategory":
-		if input.CategoryID == "" || input.Name == "" {
-			return toolError("category_id and name are required"), nil, nil
+		if res := validationResult(
+			validateRequired("category_id", input.CategoryID),
+			validateRequired("name", input.Name),
+		); res != nil {
+			return res, nil, nil
 		}
 		id, err := h.client.CreateKBSubCategory(ctx, input.CategoryID, input.Name)
 		if err != nil {
@@ -541,16 +659,23 @@ func (h *Handler) ManageKBCategory(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("KB subcategory %q created under category %s (ID: %d).", input.Name, input.CategoryID, id)), nil, nil
 	case "updatesubcategory", "update_subcategory":
-		if input.CategoryID == "" || input.SubCategoryID == "" || input.Name == "" {
-			return toolError("category_id, sub_category_id and name are required"), nil, nil
+		if res := validationResult(
+			validateRequired("category_id", input.CategoryID),
+			validateRequired("sub_category_id", input.SubCategoryID),
+			validateRequired("name", input.Name),
+		); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.UpdateKBSubCategory(ctx, input.CategoryID, input.SubCategoryID, map[string]interface{}{"name": input.Name}); err != nil {
 			return nil, nil, fmt.Errorf("update KB subcategory: %w", err)
 		}
 		return toolText(fmt.Sprintf("KB subcategory %s renamed to %q.", input.SubCategoryID, input.Name)), nil, nil
 	case "deletesubcategory", "delete_subcategory":
-		if input.CategoryID == "" || input.SubCategoryID == "" {
-			return toolError("category_id and sub_category_id are required"), nil, nil
+		if res := validationResult(
+			validateRequired("category_id", input.CategoryID),
+			validateRequired("sub_category_id", input.SubCategoryID),
+		); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteKBSubCategory(ctx, input.CategoryID, input.SubCategoryID); err != nil {
 			return nil, nil, fmt.Errorf("delete KB subcategory: %w", err)
@@ -572,11 +697,11 @@ type AddInteractionInput struct {
 
 func (h *Handler) AddInteraction(ctx context.Context, _ *sdkmcp.CallToolRequest, input AddInteractionInput) (*sdkmcp.CallToolResult, any, error) {
 	objType := normType(input.ObjectType)
-	if objType == "" {
-		return toolError("object_type is required"), nil, nil
-	}
-	if input.ObjectID == "" {
-		return toolError("object_id is required"), nil, nil
+	if res := validationResult(
+		validateRequired("object_type", objType),
+		validateRequired("object_id", input.ObjectID),
+	); res != nil {
+		return res, nil, nil
 	}
 	switch strings.ToLower(input.Action) {
 	case "list":
@@ -586,8 +711,11 @@ func (h *Handler) AddInteraction(ctx context.Context, _ *sdkmcp.CallToolRequest,
 		}
 		return marshalResult(items)
 	case "create", "":
-		if input.Note == "" {
-			return toolError("note is required for create"), nil, nil
+		if res := validationResult(validateRequiredFor("note", input.Note, "create")); res != nil {
+			return res, nil, nil
+		}
+		if res := h.checkWrite(input.ObjectType); res != nil {
+			return res, nil, nil
 		}
 		created, err := h.client.CreateInteraction(ctx, objType, input.ObjectID, &itportal.Interaction{Note: input.Note})
 		if err != nil {
@@ -613,10 +741,18 @@ type ManageCredentialInput struct {
 }
 
 func (h *Handler) ManageCredential(ctx context.Context, _ *sdkmcp.CallToolRequest, input ManageCredentialInput) (*sdkmcp.CallToolResult, any, error) {
+	if !readAction(input.Action) {
+		if res := h.checkWrite("additional_credential"); res != nil {
+			return res, nil, nil
+		}
+	}
 	switch strings.ToLower(input.Action) {
 	case "get":
-		if input.CredentialID == "" {
-			return toolError("credential_id is required for get"), nil, nil
+		if res := validationResult(validateRequiredFor("credential_id", input.CredentialID, "get")); res != nil {
+			return res, nil, nil
+		}
+		if res := h.checkSecrets(); res != nil {
+			return res, nil, nil
 		}
 		cred, err := h.client.GetAdditionalCredential(ctx, input.CredentialID)
 		if err != nil {
@@ -639,8 +775,8 @@ func (h *Handler) ManageCredential(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("Credential created (ID: %d).", created.ID)), nil, nil
 	case "update":
-		if input.CredentialID == "" {
-			return toolError("credential_id is required for update"), nil, nil
+		if res := validationResult(validateRequiredFor("credential_id", input.CredentialID, "update")); res != nil {
+			return res, nil, nil
 		}
 		fields := map[string]interface{}{}
 		if input.Type != "" {
@@ -663,8 +799,8 @@ func (h *Handler) ManageCredential(ctx context.Context, _ *sdkmcp.CallToolReques
 		}
 		return toolText(fmt.Sprintf("Credential %s updated.", input.CredentialID)), nil, nil
 	case "delete":
-		if input.CredentialID == "" {
-			return toolError("credential_id is required for delete"), nil, nil
+		if res := validationResult(validateRequiredFor("credential_id", input.CredentialID, "delete")); res != nil {
+			return res, nil, nil
 		}
 		if err := h.client.DeleteAdditionalCredential(ctx, input.CredentialID); err != nil {
 			return nil, nil, fmt.Errorf("delete credential: %w", err)
@@ -683,8 +819,11 @@ type GetCredentialsInput struct {
 }
 
 func (h *Handler) GetCredentials(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetCredentialsInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.ObjectID == "" {
-		return toolError("object_id is required"), nil, nil
+	if res := validationResult(validateRequired("object_id", input.ObjectID)); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkSecrets(); res != nil {
+		return res, nil, nil
 	}
 	var (
 		creds []itportal.Credential
@@ -706,6 +845,320 @@ func (h *Handler) GetCredentials(ctx context.Context, _ *sdkmcp.CallToolRequest,
 	return marshalResult(creds)
 }
 
+// ---- search_contacts ----
+
+type SearchContactsInput struct {
+	Query string `json:"query" jsonschema:"Name, email address, phone number (any format) or note text to look for"`
+	Limit int    `json:"limit,omitempty" jsonschema:"Max results to return. Default 25."`
+}
+
+// SearchContacts searches the cached contacts' names, emails, phone numbers and
+// notes directly, returning ranked matches with IDs.
+func (h *Handler) SearchContacts(_ context.Context, _ *sdkmcp.CallToolRequest, input SearchContactsInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(validateRequired("query", input.Query)); res != nil {
+		return res, nil, nil
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	snap := h.cache.Get()
+	matches := snap.SearchContacts(input.Query, input.Limit)
+	if len(matches) == 0 {
+		return toolText(fmt.Sprintf("No contacts match %q (searched %d contacts by name, email, phone and notes).",
+			input.Query, len(snap.Contacts))), nil, nil
+	}
+	return marshalResult(struct {
+		Query   string               `json:"query"`
+		Count   int                  `json:"count"`
+		Results []cache.ContactMatch `json:"results"`
+	}{Query: input.Query, Count: len(matches), Results: matches})
+}
+
+// ---- get_by_foreign_id ----
+
+type GetByForeignIDInput struct {
+	EntityType  string `json:"entity_type" jsonschema:"One of: company, site, device, agreement"`
+	ForeignID   string `json:"foreign_id" jsonschema:"External system ID (PSA/RMM) stored in the entity's foreignId field"`
+	ForeignType string `json:"foreign_type,omitempty" jsonschema:"Optional: the external system the ID belongs to (the foreignType field, e.g. 'ConnectWise'), so IDs shared by several systems resolve to one record. Sites, devices and agreements only."`
+}
+
+// GetByForeignID resolves an external-system ID to the matching ITPortal record
+// via the foreignId list filter. A single match is returned as the full entity;
+// several matches are returned as a list so the caller can disambiguate.
+func (h *Handler) GetByForeignID(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetByForeignIDInput) (*sdkmcp.CallToolResult, any, error) {
+	var typeCheck *fieldError
+	if input.ForeignType != "" && normType(input.EntityType) == "company" {
+		typeCheck = &fieldError{Field: "foreign_type", Reason: "companies have no foreignType; omit it"}
+	}
+	if res := validationResult(validateRequired("foreign_id", input.ForeignID), typeCheck); res != nil {
+		return res, nil, nil
+	}
+	opts := &itportal.ListOptions{
+		ForeignID:   strings.TrimSpace(input.ForeignID),
+		ForeignType: strings.TrimSpace(input.ForeignType),
+		Limit:       10,
+	}
+	// key names the lookup in messages: the foreign_id, qualified by its type.
+	key := fmt.Sprintf("foreign_id %q", input.ForeignID)
+	if opts.ForeignType != "" {
+		key += fmt.Sprintf(" (foreign_type %q)", opts.ForeignType)
+	}
+
+	var (
+		matches interface{}
+		n       int
+	)
+	norm := normType(input.EntityType)
+	switch norm {
+	case "company":
+		v, _, err := h.client.ListCompanies(ctx, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list companies by foreign id: %w", err)
+		}
+		if len(v) == 1 {
+			return h.marshalWithURL(norm, v[0].ID, &v[0].URL, &v[0])
+		}
+		matches, n = v, len(v)
+	case "site":
+		v, _, err := h.client.ListSites(ctx, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list sites by foreign id: %w", err)
+		}
+		if len(v) == 1 {
+			return h.marshalWithURL(norm, v[0].ID, &v[0].URL, &v[0])
+		}
+		matches, n = v, len(v)
+	case "device":
+		v, _, err := h.client.ListDevices(ctx, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list devices by foreign id: %w", err)
+		}
+		if len(v) == 1 {
+			return h.marshalWithURL(norm, v[0].ID, &v[0].URL, &v[0])
+		}
+		matches, n = v, len(v)
+	case "agreement":
+		v, _, err := h.client.ListAgreements(ctx, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list agreements by foreign id: %w", err)
+		}
+		if len(v) == 1 {
+			return h.marshalWithURL(norm, v[0].ID, &v[0].URL, &v[0])
+		}
+		matches, n = v, len(v)
+	default:
+		return toolError(fmt.Sprintf("unknown entity_type %q for foreign id lookup (use company, site, device, agreement)", input.EntityType)), nil, nil
+	}
+
+	if n == 0 {
+		return toolError(fmt.Sprintf("no %s found with %s", input.EntityType, key)), nil, nil
+	}
+	return marshalResult(struct {
+		Note    string      `json:"note"`
+		Matches interface{} `json:"matches"`
+	}{
+		Note:    fmt.Sprintf("%d %s records share %s", n, input.EntityType, key),
+		Matches: matches,
+	})
+}
+
+// ---- get_device_by_ip ----
+
+type GetDeviceByIPInput struct {
+	IPAddress string `json:"ip_address" jsonschema:"IPv4 or IPv6 address assigned to the device, e.g. 10.0.0.5"`
+}
+
+// GetDeviceByIP finds the device(s) holding an IP address via the live
+// ipAddress device filter. A unique match returns the full device detail with
+// its sub-resources, as get_entity_details does; several matches are listed so
+// the caller can pick one.
+func (h *Handler) GetDeviceByIP(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetDeviceByIPInput) (*sdkmcp.CallToolResult, any, error) {
+	ip := strings.TrimSpace(input.IPAddress)
+	if res := validationResult(validateRequired("ip_address", ip)); res != nil {
+		return res, nil, nil
+	}
+	if net.ParseIP(ip) == nil {
+		return toolError(fmt.Sprintf("ip_address %q is not a valid IP address", ip)), nil, nil
+	}
+	devices, _, err := h.client.ListDevices(ctx, &itportal.ListOptions{IPAddress: ip, Limit: 10})
+	if err != nil {
+		return nil, nil, fmt.Errorf("list devices by IP: %w", err)
+	}
+	switch len(devices) {
+	case 0:
+		return toolError(fmt.Sprintf("no device found with IP address %s", ip)), nil, nil
+	case 1:
+		return h.getDeviceDetails(ctx, strconv.Itoa(devices[0].ID), "", noteFilter{})
+	}
+	for i := range devices {
+		if devices[i].URL == "" {
+			devices[i].URL = itportal.BuildPortalURL(h.baseURL, "device", devices[i].ID)
+		}
+	}
+	return marshalResult(struct {
+		Note    string            `json:"note"`
+		Matches []itportal.Device `json:"matches"`
+	}{
+		Note:    fmt.Sprintf("%d devices have IP address %s; call get_entity_details with the right id", len(devices), ip),
+		Matches: devices,
+	})
+}
+
+// ---- raw_request ----
+
+// rawRequestPrefix is the only path prefix raw_request may reach.
+const rawRequestPrefix = "/api/2.0/"
+
+type RawRequestInput struct {
+	Method string                 `json:"method" jsonschema:"HTTP method: GET, POST, PUT, PATCH or DELETE"`
+	Path   string                 `json:"path" jsonschema:"API path starting with /api/2.0/, e.g. /api/2.0/devices/42/ (rewritten to the configured API version)"`
+	Body   map[string]interface{} `json:"body,omitempty" jsonschema:"Optional JSON object sent as the request body"`
+	Query  map[string]string      `json:"query,omitempty" jsonschema:"Optional query parameters, e.g. {\"limit\": \"5\"}"`
+}
+
+// RawRequest forwards a request to an arbitrary ITPortal endpoint under
+// /api/2.0/ and returns the raw status and body. Non-GET requests are subject
+// to the write policy, keyed by the path's top-level collection, and
+// credential endpoints to the credential policy.
+func (h *Handler) RawRequest(ctx context.Context, _ *sdkmcp.CallToolRequest, input RawRequestInput) (*sdkmcp.CallToolResult, any, error) {
+	method := strings.ToUpper(strings.TrimSpace(input.Method))
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return toolError(fmt.Sprintf("unsupported method %q (use GET, POST, PUT, PATCH or DELETE)", input.Method)), nil, nil
+	}
+	path, err := rawRequestPath(input.Path)
+	if err != nil {
+		return toolError(err.Error()), nil, nil
+	}
+	if credentialPath(path) {
+		if denied := h.checkSecrets(); denied != nil {
+			return denied, nil, nil
+		}
+	}
+	if method != http.MethodGet {
+		collection, _, _ := strings.Cut(strings.TrimPrefix(path, rawRequestPrefix), "/")
+		if denied := h.checkWrite(collection); denied != nil {
+			return denied, nil, nil
+		}
+	}
+
+	var query url.Values
+	if len(input.Query) > 0 {
+		query = url.Values{}
+		for k, v := range input.Query {
+			query.Set(k, v)
+		}
+	}
+	var body interface{}
+	if input.Body != nil {
+		body = input.Body
+	}
+	status, data, err := h.client.RawRequest(ctx, method, path, body, query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("raw request %s %s: %w", method, path, err)
+	}
+
+	text := fmt.Sprintf("HTTP %d", status)
+	if len(data) > 0 {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, data, "", "  ") == nil {
+			data = pretty.Bytes()
+		}
+		text += "\n\n" + string(data)
+	}
+	if status < 200 || status >= 300 {
+		return toolError(text), nil, nil
+	}
+	return toolText(text), nil, nil
+}
+
+// rawRequestPath validates a raw_request path: it must sit under
+// rawRequestPrefix and may not climb out of it or smuggle a query or fragment.
+func rawRequestPath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	decoded, err := url.PathUnescape(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %v", p, err)
+	}
+	if !strings.HasPrefix(p, rawRequestPrefix) || !strings.HasPrefix(decoded, rawRequestPrefix) {
+		return "", fmt.Errorf("path %q is not permitted: raw_request only reaches %s…", p, rawRequestPrefix)
+	}
+	if strings.Contains(decoded, "..") || strings.ContainsAny(decoded, "?#\\") {
+		return "", fmt.Errorf("path %q is not permitted: no '..', '?', '#' or backslashes (pass query parameters via query)", p)
+	}
+	return p, nil
+}
+
+// credentialPath reports whether a raw_request path reaches a credential
+// endpoint (a device's credentials or additional_credentials), which returns
+// stored passwords.
+func credentialPath(p string) bool {
+	decoded, err := url.PathUnescape(p)
+	if err != nil {
+		decoded = p
+	}
+	for _, seg := range strings.Split(strings.ToLower(decoded), "/") {
+		if strings.Contains(seg, "credential") {
+			return true
+		}
+	}
+	return false
+}
+
+// ---- selftest ----
+
+type SelfTestInput struct{}
+
+// SelfTest checks connectivity and authentication against ITPortal with a
+// one-row company list and reports the configured base URL, snapshot age and
+// background refresh state. The result is flagged as an error when the API
+// check fails.
+func (h *Handler) SelfTest(ctx context.Context, _ *sdkmcp.CallToolRequest, _ SelfTestInput) (*sdkmcp.CallToolResult, any, error) {
+	var b strings.Builder
+	b.WriteString("ITPortal MCP self-test\n")
+	if h.instance != "" {
+		fmt.Fprintf(&b, "Instance: %s\n", h.instance)
+	}
+	fmt.Fprintf(&b, "Base URL: %s\n", h.baseURL)
+
+	ok := true
+	start := time.Now()
+	_, total, err := h.client.ListCompanies(ctx, &itportal.ListOptions{Limit: 1})
+	if err != nil {
+		ok = false
+		fmt.Fprintf(&b, "API connectivity/auth: ✗ FAILED — %v\n", err)
+	} else {
+		fmt.Fprintf(&b, "API connectivity/auth: ✓ OK (%d companies visible, %s)\n",
+			total, time.Since(start).Round(time.Millisecond))
+	}
+
+	if h.cache == nil || h.cache.Get() == nil {
+		b.WriteString("Snapshot: not built\n")
+	} else {
+		gen := h.cache.Get().GeneratedAt
+		fmt.Fprintf(&b, "Snapshot: generated %s UTC (age %s)\n",
+			gen.UTC().Format("2006-01-02 15:04:05"), time.Since(gen).Round(time.Second))
+	}
+	switch {
+	case h.cache == nil:
+		b.WriteString("Background refresh: not configured\n")
+	case h.cache.BackgroundRefreshRunning():
+		fmt.Fprintf(&b, "Background refresh: running (every %s)\n", h.cache.RefreshInterval())
+	default:
+		b.WriteString("Background refresh: not running\n")
+	}
+
+	if !ok {
+		b.WriteString("Result: FAIL — check ITPORTAL_BASE_URL and ITPORTAL_API_KEY")
+		return toolError(b.String()), nil, nil
+	}
+	b.WriteString("Result: PASS")
+	return toolText(b.String()), nil, nil
+}
+
 // ---- get_logs ----
 
 type GetLogsInput struct {
@@ -716,8 +1169,8 @@ type GetLogsInput struct {
 }
 
 func (h *Handler) GetLogs(ctx context.Context, _ *sdkmcp.CallToolRequest, input GetLogsInput) (*sdkmcp.CallToolResult, any, error) {
-	if input.LogType == "" {
-		return toolError("log_type is required"), nil, nil
+	if res := validationResult(validateRequired("log_type", input.LogType)); res != nil {
+		return res, nil, nil
 	}
 	limit := input.Limit
 	if limit <= 0 {
@@ -0,0 +1,108 @@
+package mcp
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Upload kinds: the canonical upload_file entity types, which uploadTargets'
+// aliases resolve to and UPLOAD_ALLOWED_EXTENSIONS is keyed by.
+const (
+	uploadDeviceConfig  = "device_config"
+	uploadKB            = "kb"
+	uploadContactPhoto  = "contact_photo"
+	uploadDocumentFile  = "document_file"
+	uploadAgreementFile = "agreement_file"
+)
+
+// documentExtensions are the office, text and image files ITPortal documents,
+// KB attachments and agreements usually hold.
+var documentExtensions = []string{
+	".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt", ".ods", ".odp",
+	".rtf", ".txt", ".md", ".csv", ".json", ".xml", ".yaml", ".yml", ".log",
+	".vsd", ".vsdx", ".png", ".jpg", ".jpeg", ".gif", ".webp",
+}
+
+// defaultUploadExtensions is the extension allow-list per upload kind. Nothing
+// executable or scriptable (.exe, .php, .js, .svg, .html) is on it.
+var defaultUploadExtensions = map[string][]string{
+	uploadContactPhoto: {".png", ".jpg", ".jpeg", ".gif", ".webp", ".bmp"},
+	uploadDeviceConfig: {
+		".txt", ".cfg", ".conf", ".config", ".ini", ".json", ".xml", ".yaml", ".yml",
+		".log", ".rsc", ".backup", ".bak", ".csv", ".pdf",
+	},
+	uploadKB:            documentExtensions,
+	uploadDocumentFile:  documentExtensions,
+	uploadAgreementFile: documentExtensions,
+}
+
+// UploadExtensions is the file-extension allow-list upload_file enforces, per
+// upload kind. A nil list lets the kind take any extension.
+type UploadExtensions map[string][]string
+
+// NewUploadExtensions returns the default allow-list with overrides applied.
+// Override keys are upload_file entity types (any alias, e.g. contact_photo or
+// kb) and values their full extension list, dot optional; a list of just "*"
+// lifts the check for that kind.
+func NewUploadExtensions(overrides map[string][]string) (UploadExtensions, error) {
+	u := make(UploadExtensions, len(defaultUploadExtensions))
+	for kind, exts := range defaultUploadExtensions {
+		u[kind] = exts
+	}
+	for name, exts := range overrides {
+		target, ok := uploadTargets[uploadKind(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown upload entity type %q (want device_config, kb, contact_photo, document_file or agreement_file)", name)
+		}
+		if len(exts) == 1 && strings.TrimSpace(exts[0]) == "*" {
+			u[target.kind] = nil
+			continue
+		}
+		list := make([]string, 0, len(exts))
+		for _, e := range exts {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e == "" {
+				continue
+			}
+			if !strings.HasPrefix(e, ".") {
+				e = "." + e
+			}
+			list = append(list, e)
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("upload entity type %q: empty extension list", name)
+		}
+		u[target.kind] = list
+	}
+	return u, nil
+}
+
+// WithUploadExtensions replaces the default upload_file extension allow-list.
+func WithUploadExtensions(u UploadExtensions) Option {
+	return func(h *Handler) { h.uploadExts = u }
+}
+
+// checkUploadExtension returns a tool-error message when fileName's extension
+// is not allowed for kind, or "" when the upload may proceed.
+func (h *Handler) checkUploadExtension(kind, fileName string) string {
+	allowed := h.uploadExts
+	if allowed == nil {
+		allowed = defaultUploadExtensions
+	}
+	list, ok := allowed[kind]
+	if ok && list == nil {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(strings.TrimSpace(fileName)))
+	if ext != "" && slices.Contains(list, ext) {
+		return ""
+	}
+	if ext == "" {
+		return fmt.Sprintf("file_name %q has no extension; %s uploads must be one of: %s",
+			fileName, kind, strings.Join(list, ", "))
+	}
+	return fmt.Sprintf("file extension %s is not allowed for %s uploads; allowed: %s",
+		ext, kind, strings.Join(list, ", "))
+}
@@ -0,0 +1,127 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadFileExtensionAllowList(t *testing.T) {
+	var uploads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+
+	for _, c := range []struct {
+		entityType, fileName string
+		allowed              bool
+	}{
+		{"contact_photo", "jane.JPG", true},
+		{"contact_photo", "jane.pdf", false},
+		{"contact_photo", "jane.svg", false},
+		{"device_config", "fw01-running.cfg", true},
+		{"device_config", "startup.rsc", true},
+		{"device_config", "payload.exe", false},
+		{"kb", "runbook.docx", true},
+		{"kb", "shell.php", false},
+		{"kb", "shell.php.", false},
+		{"document_file", "contract.pdf", true},
+		{"document_file", "README", false},
+		{"agreement_file", "sla.xlsx", true},
+		{"agreement_file", "install.sh", false},
+	} {
+		uploads = 0
+		res, _, err := h.UploadFile(context.Background(), nil, UploadFileInput{EntityType: c.entityType, EntityID: "7", FileName: c.fileName, Base64Data: data})
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.entityType, c.fileName, err)
+		}
+		if c.allowed && (res.IsError || uploads != 1) {
+			t.Errorf("%s %s refused: %s", c.entityType, c.fileName, resultText(t, res))
+		}
+		if !c.allowed {
+			if !res.IsError || uploads != 0 {
+				t.Errorf("%s %s uploaded, want it blocked", c.entityType, c.fileName)
+			} else if got := resultText(t, res); !strings.Contains(got, c.entityType) {
+				t.Errorf("%s %s: error %q does not name the entity type", c.entityType, c.fileName, got)
+			}
+		}
+	}
+}
+
+func TestManageFolderFileExtensionAllowList(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	h := newHandler(srv.URL)
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+
+	for _, c := range []struct {
+		action, fileName string
+		allowed          bool
+	}{
+		{"upload", "contract.pdf", true},
+		{"upload", "shell.php", false},
+		{"update", "minutes.docx", true},
+		{"update", "payload.exe", false},
+	} {
+		requests = 0
+		res, _, _ := h.ManageFolderFile(context.Background(), nil, ManageFolderFileInput{
+			Action: c.action, ObjectID: "7", FolderID: "3", FileID: "9", FileName: c.fileName, Base64Data: data,
+		})
+		if c.allowed && requests == 0 {
+			t.Errorf("%s %s refused: %v", c.action, c.fileName, res)
+		}
+		if !c.allowed {
+			if res == nil || !res.IsError || requests != 0 {
+				t.Errorf("%s %s sent, want it blocked", c.action, c.fileName)
+			} else if got := resultText(t, res); !strings.Contains(got, "not allowed") {
+				t.Errorf("%s %s: error %q", c.action, c.fileName, got)
+			}
+		}
+	}
+}
+
+func TestNewUploadExtensionsOverrides(t *testing.T) {
+	u, err := NewUploadExtensions(map[string][]string{
+		"Contact-Photo": {"png", " .HEIC "},
+		"kb":            {"*"},
+	})
+	if err != nil {
+		t.Fatalf("NewUploadExtensions: %v", err)
+	}
+	h := &Handler{uploadExts: u}
+	for _, c := range []struct {
+		kind, fileName string
+		allowed        bool
+	}{
+		{uploadContactPhoto, "a.heic", true},
+		{uploadContactPhoto, "a.png", true},
+		{uploadContactPhoto, "a.jpg", false},
+		{uploadKB, "tool.exe", true},
+		{uploadDeviceConfig, "a.cfg", true},
+		{uploadDeviceConfig, "a.exe", false},
+	} {
+		if got := h.checkUploadExtension(c.kind, c.fileName) == ""; got != c.allowed {
+			t.Errorf("%s %s allowed = %t, want %t", c.kind, c.fileName, got, c.allowed)
+		}
+	}
+
+	for name, overrides := range map[string]map[string][]string{
+		"unknown type": {"firmware": {".bin"}},
+		"empty list":   {"kb": {" ", ""}},
+	} {
+		if _, err := NewUploadExtensions(overrides); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
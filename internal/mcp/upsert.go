@@ -0,0 +1,228 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// ---- upsert_entity ----
+
+// upsertScanLimit caps how many listed records upsert_entity compares against
+// match before giving up.
+const upsertScanLimit = 1000
+
+type UpsertEntityInput struct {
+	EntityType string                 `json:"entity_type" jsonschema:"One of: company, site, device, contact, account, agreement, document, facility, cabinet, configuration, ipnetwork"`
+	Match      map[string]interface{} `json:"match" jsonschema:"Fields identifying the record, by API field name, e.g. {\"name\": \"fw01\", \"company\": {\"id\": 3}}. Strings compare case-insensitively; references compare by id."`
+	Fields     map[string]interface{} `json:"fields" jsonschema:"Desired field values. An existing match is patched with them; otherwise a record is created from match plus fields."`
+}
+
+// upsertFilters maps match fields to the list filter narrowing the lookup.
+var upsertFilters = map[string]func(o *itportal.ListOptions, v string){
+	"name":        func(o *itportal.ListOptions, v string) { o.Name = v },
+	"company":     func(o *itportal.ListOptions, v string) { o.CompanyID = v },
+	"site":        func(o *itportal.ListOptions, v string) { o.SiteID = v },
+	"serial":      func(o *itportal.ListOptions, v string) { o.SerialNumber = v },
+	"tag":         func(o *itportal.ListOptions, v string) { o.Tag = v },
+	"foreignId":   func(o *itportal.ListOptions, v string) { o.ForeignID = v },
+	"foreignType": func(o *itportal.ListOptions, v string) { o.ForeignType = v },
+}
+
+// UpsertEntity looks up the one record of entity_type matching match and
+// patches it with fields, or creates a record from match plus fields when none
+// matches. Several matches are refused with their IDs.
+func (h *Handler) UpsertEntity(ctx context.Context, req *sdkmcp.CallToolRequest, input UpsertEntityInput) (*sdkmcp.CallToolResult, any, error) {
+	if res := validationResult(
+		validateRequired("entity_type", input.EntityType),
+		validateRequired("match", input.Match),
+		validateRequired("fields", input.Fields),
+	); res != nil {
+		return res, nil, nil
+	}
+	if res := h.checkWrite(input.EntityType); res != nil {
+		return res, nil, nil
+	}
+	typ := normType(input.EntityType)
+	if typ == "kb" || typ == "knowledgebase" || entityModel(typ) == nil || !updatableTypes[typ] {
+		return toolError(fmt.Sprintf("entity_type %q is not supported for upsert_entity", input.EntityType)), nil, nil
+	}
+
+	ids, err := h.upsertMatches(ctx, input.EntityType, input.Match)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := describeMatch(input.Match)
+	switch len(ids) {
+	case 0:
+		fields := make(map[string]interface{}, len(input.Match)+len(input.Fields))
+		for k, v := range input.Match {
+			fields[k] = v
+		}
+		for k, v := range input.Fields {
+			fields[k] = v
+		}
+		res, out, err := h.upsertCreate(ctx, req, input.EntityType, fields)
+		if err != nil || res.IsError {
+			return res, out, err
+		}
+		msg := fmt.Sprintf("Upsert: no %s matched %s, so one was created.", input.EntityType, matched)
+		if len(res.Content) > 0 {
+			if tc, ok := res.Content[0].(*sdkmcp.TextContent); ok {
+				msg += "\n" + tc.Text
+			}
+		}
+		return toolText(msg), out, nil
+	case 1:
+		id := strconv.Itoa(ids[0])
+		ok, err := h.patchByType(ctx, input.EntityType, id, input.Fields)
+		if !ok {
+			return toolError(fmt.Sprintf("entity_type %q is not supported for upsert_entity", input.EntityType)), nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("update %s %s: %w", input.EntityType, id, err)
+		}
+		h.mergeUpdated(ctx, input.EntityType, id)
+		return toolText(fmt.Sprintf("Upsert: %s ID %s matched %s and was updated.", input.EntityType, id, matched)), nil, nil
+	default:
+		strs := make([]string, len(ids))
+		for i, id := range ids {
+			strs[i] = strconv.Itoa(id)
+		}
+		return toolError(fmt.Sprintf("%d %s records match %s (IDs: %s); add match fields to single one out, or use update_entity",
+			len(ids), input.EntityType, matched, strings.Join(strs, ", "))), nil, nil
+	}
+}
+
+// upsertMatches lists entityType narrowed by the filterable match fields and
+// returns the IDs of the records equal to match on every field.
+func (h *Handler) upsertMatches(ctx context.Context, entityType string, match map[string]interface{}) ([]int, error) {
+	opts := &itportal.ListOptions{Limit: 200}
+	for k, v := range match {
+		if set := upsertFilters[k]; set != nil {
+			set(opts, matchValue(v))
+		}
+	}
+	var ids []int
+	for {
+		items, total, _, err := h.listByType(ctx, entityType, opts)
+		if err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(items)
+		if rv.Kind() != reflect.Slice || rv.Len() == 0 {
+			return ids, nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if id, ok := matchesRecord(rv.Index(i).Interface(), match); ok {
+				ids = append(ids, id)
+			}
+		}
+		opts.Offset += rv.Len()
+		// Some endpoints report no total, and List* then reports the page's
+		// length, so only a short page or a total beyond it ends the scan.
+		if rv.Len() < opts.Limit || (total > rv.Len() && opts.Offset >= total) {
+			return ids, nil
+		}
+		if opts.Offset >= upsertScanLimit {
+			return nil, fmt.Errorf("more than %d %s records to compare; add name or another filterable match field (%s)",
+				upsertScanLimit, entityType, strings.Join(upsertFilterNames(), ", "))
+		}
+	}
+}
+
+// matchesRecord reports whether record equals match on every field, and
+// returns its ID.
+func matchesRecord(record any, match map[string]interface{}) (int, bool) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return 0, false
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return 0, false
+	}
+	for k, want := range match {
+		if !strings.EqualFold(matchValue(m[k]), matchValue(want)) {
+			return 0, false
+		}
+	}
+	id, _ := m["id"].(float64)
+	return int(id), true
+}
+
+// matchValue renders a match or record value for comparison: a reference
+// ({"id": N}) as its id, anything else trimmed.
+func matchValue(v interface{}) string {
+	if ref, ok := v.(map[string]interface{}); ok {
+		v = ref["id"]
+	}
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return strings.TrimSpace(x)
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+// describeMatch renders match as "name=fw01, company=3" in key order.
+func describeMatch(match map[string]interface{}) string {
+	keys := make([]string, 0, len(match))
+	for k := range match {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + matchValue(match[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// upsertFilterNames lists the match fields narrowed by a list filter.
+func upsertFilterNames() []string {
+	names := make([]string, 0, len(upsertFilters))
+	for k := range upsertFilters {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// upsertCreate creates entityType from fields: devices directly, with hostName
+// defaulting to name as in create_device, everything else via create_entity.
+func (h *Handler) upsertCreate(ctx context.Context, req *sdkmcp.CallToolRequest, entityType string, fields map[string]interface{}) (*sdkmcp.CallToolResult, any, error) {
+	if normType(entityType) != "device" {
+		return h.CreateEntity(ctx, req, CreateEntityInput{EntityType: entityType, Fields: fields})
+	}
+	coerceScalarFields(fields, entityModel(entityType))
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal fields: %w", err)
+	}
+	var d itportal.Device
+	if err := json.Unmarshal(data, &d); err != nil {
+		return toolError(fmt.Sprintf("invalid fields for device: %v", err)), nil, nil
+	}
+	if d.HostName == "" {
+		d.HostName = d.Name
+	}
+	created, err := h.client.CreateDevice(ctx, &d)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create device: %w", err)
+	}
+	h.mergeWritten(created)
+	msg := fmt.Sprintf("device created. ID: %d  Portal: %s", created.ID, created.URL) + createdAtLine(created.Modified)
+	return toolText(msg), created, nil
+}
@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// upsertServer stands in for the devices endpoint: GETs list devices, POST and
+// PATCH bodies are recorded by path.
+func upsertServer(t *testing.T, devices []itportal.Device) (*httptest.Server, map[string]map[string]any) {
+	t.Helper()
+	writes := map[string]map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPatch:
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			writes[r.Method+" "+r.URL.Path] = body
+			if r.Method == http.MethodPost {
+				w.Header().Set("Location", "/api/2.1/devices/42/")
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			if r.URL.Path == "/api/2.1/devices/42/" {
+				writeList(w, []itportal.Device{{ID: 42, Name: "fw01"}}, "")
+				return
+			}
+			writeList(w, devices, "")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, writes
+}
+
+func TestUpsertEntityCreatesWhenNothingMatches(t *testing.T) {
+	srv, writes := upsertServer(t, []itportal.Device{
+		{ID: 7, Name: "fw01", Company: &itportal.CompanyReference{ID: 9}},
+		{ID: 8, Name: "fw01-old", Company: &itportal.CompanyReference{ID: 3}},
+	})
+	h := newHandler(srv.URL)
+	res, _, err := h.UpsertEntity(context.Background(), nil, UpsertEntityInput{
+		EntityType: "device",
+		Match:      map[string]any{"name": "fw01", "company": map[string]any{"id": 3}},
+		Fields:     map[string]any{"serial": "SN-1"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("UpsertEntity = %v, %v", res, err)
+	}
+	if got := resultText(t, res); !strings.Contains(got, "was created") || !strings.Contains(got, "ID: 42") {
+		t.Errorf("result = %q, want the create reported", got)
+	}
+	posted := writes["POST /api/2.1/devices/"]
+	if posted == nil {
+		t.Fatalf("no device POSTed; writes = %v", writes)
+	}
+	if posted["name"] != "fw01" || posted["hostName"] != "fw01" || posted["serial"] != "SN-1" {
+		t.Errorf("posted = %v, want match plus fields with hostName defaulted", posted)
+	}
+	if c, _ := posted["company"].(map[string]any); c["id"] != float64(3) {
+		t.Errorf("posted company = %v, want id 3", posted["company"])
+	}
+}
+
+func TestUpsertEntityUpdatesTheMatch(t *testing.T) {
+	srv, writes := upsertServer(t, []itportal.Device{
+		{ID: 7, Name: "FW01 ", Company: &itportal.CompanyReference{ID: 3}},
+		{ID: 8, Name: "fw01", Company: &itportal.CompanyReference{ID: 9}},
+	})
+	h := newHandler(srv.URL)
+	res, _, err := h.UpsertEntity(context.Background(), nil, UpsertEntityInput{
+		EntityType: "device",
+		Match:      map[string]any{"name": "fw01", "company": "3"},
+		Fields:     map[string]any{"serial": "SN-2"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("UpsertEntity = %v, %v", res, err)
+	}
+	if got := resultText(t, res); !strings.Contains(got, "device ID 7 matched company=3, name=fw01 and was updated") {
+		t.Errorf("result = %q", got)
+	}
+	if patched := writes["PATCH /api/2.1/devices/7/"]; patched["serial"] != "SN-2" {
+		t.Errorf("writes = %v, want serial patched onto device 7", writes)
+	}
+	if _, ok := writes["POST /api/2.1/devices/"]; ok {
+		t.Error("a device was created despite the match")
+	}
+}
+
+func TestUpsertEntityRefusesAmbiguousMatch(t *testing.T) {
+	srv, writes := upsertServer(t, []itportal.Device{{ID: 7, Name: "fw01"}, {ID: 8, Name: "fw01"}})
+	h := newHandler(srv.URL)
+	res, _, err := h.UpsertEntity(context.Background(), nil, UpsertEntityInput{
+		EntityType: "device",
+		Match:      map[string]any{"name": "fw01"},
+		Fields:     map[string]any{"serial": "SN-3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || !strings.Contains(resultText(t, res), "IDs: 7, 8") {
+		t.Errorf("result = %q, want both IDs refused", resultText(t, res))
+	}
+	if len(writes) != 0 {
+		t.Errorf("writes = %v, want none", writes)
+	}
+}
+
+func TestUpsertEntityRefusesTypesItCannotUpdate(t *testing.T) {
+	srv, writes := upsertServer(t, nil)
+	h := newHandler(srv.URL)
+	res, _, err := h.UpsertEntity(context.Background(), nil, UpsertEntityInput{
+		EntityType: "address",
+		Match:      map[string]any{"name": "HQ"},
+		Fields:     map[string]any{"city": "Oslo"},
+	})
+	if err != nil || !res.IsError {
+		t.Fatalf("UpsertEntity = %v, %v; want a tool error", res, err)
+	}
+	if got := resultText(t, res); !strings.Contains(got, "not supported") {
+		t.Errorf("result = %q", got)
+	}
+	if len(writes) != 0 {
+		t.Errorf("writes = %v, want none", writes)
+	}
+}
+
+// TestUpsertEntityScansPastFirstPageWithoutTotal verifies a match beyond the
+// first page is found on an endpoint that reports no total, instead of the
+// scan ending early and upsert creating a duplicate.
+func TestUpsertEntityScansPastFirstPageWithoutTotal(t *testing.T) {
+	var posted bool
+	var patched string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			posted = true
+			w.Header().Set("Location", "/api/2.1/devices/999/")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPatch:
+			patched = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			devices := []itportal.Device{}
+			for id := offset + 1; id <= 250 && id <= offset+limit; id++ {
+				devices = append(devices, itportal.Device{ID: id, Name: "dev", Serial: "SN-" + strconv.Itoa(id)})
+			}
+			writeList(w, devices, "")
+		}
+	}))
+	defer srv.Close()
+
+	res, _, err := newHandler(srv.URL).UpsertEntity(context.Background(), nil, UpsertEntityInput{
+		EntityType: "device",
+		Match:      map[string]any{"name": "dev", "serial": "SN-230"},
+		Fields:     map[string]any{"notes": "x"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("UpsertEntity = %v, %v", res, err)
+	}
+	if posted || patched != "/api/2.1/devices/230/" {
+		t.Errorf("posted = %v, patched = %q; want device 230 updated", posted, patched)
+	}
+}
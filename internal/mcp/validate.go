@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// fieldError is one invalid tool input, reported as "field <Field>: <Reason>"
+// so the caller can map it back to the argument it sent.
+type fieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (e fieldError) String() string {
+	return fmt.Sprintf("field %s: %s", e.Field, e.Reason)
+}
+
+// validateRequired reports field as missing when value is its zero value; a
+// string is also missing when it is only whitespace.
+func validateRequired(field string, value any) *fieldError {
+	return validateRequiredFor(field, value, "")
+}
+
+// validateRequiredFor is validateRequired for a field only needed by one
+// action, naming that action in the reason.
+func validateRequiredFor(field string, value any, action string) *fieldError {
+	missing := false
+	switch v := value.(type) {
+	case string:
+		missing = strings.TrimSpace(v) == ""
+	case nil:
+		missing = true
+	default:
+		rv := reflect.ValueOf(v)
+		missing = rv.IsZero() || ((rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.Len() == 0)
+	}
+	if !missing {
+		return nil
+	}
+	reason := "is required"
+	if action != "" {
+		reason += " for " + action
+	}
+	return &fieldError{Field: field, Reason: reason}
+}
+
+// validateOneOf reports field as invalid when value is set but not one of
+// allowed (compared case-insensitively, ignoring underscores). An empty value
+// passes; pair it with validateRequired when the field is mandatory.
+func validateOneOf(field, value string, allowed ...string) *fieldError {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if normType(value) == normType(a) {
+			return nil
+		}
+	}
+	return &fieldError{Field: field, Reason: fmt.Sprintf("%q is not one of: %s", value, strings.Join(allowed, ", "))}
+}
+
+// validateNumericID reports field as invalid when value is set but is not a
+// positive integer ID. An empty value passes.
+func validateNumericID(field, value string) *fieldError {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+		return &fieldError{Field: field, Reason: fmt.Sprintf("%q is not a numeric ID", value)}
+	}
+	return nil
+}
+
+// validateDate reports field as invalid when value is set but is not a
+// YYYY-MM-DD date. An empty value passes.
+func validateDate(field, value string) *fieldError {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return &fieldError{Field: field, Reason: fmt.Sprintf("%q is not a YYYY-MM-DD date", value)}
+	}
+	return nil
+}
+
+// filterKeyPattern is the shape of an ITPortal query parameter name.
+var filterKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+
+// reservedFilterKeys are query parameters the list tools set themselves,
+// lowercased: pageSize and page take their place under page pagination.
+var reservedFilterKeys = map[string]bool{"limit": true, "offset": true, "cursor": true, "page": true, "pagesize": true}
+
+// validateExtraFilters checks a map of caller-supplied query parameters that
+// is forwarded verbatim: keys must look like parameter names and neither keys
+// nor values may carry control characters (CR/LF in particular). Keys are
+// checked in sorted order so the reported problem is stable.
+func validateExtraFilters(field string, filters map[string]string) *fieldError {
+	keys := make([]string, 0, len(filters))
+	for k := range filters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch {
+		case !filterKeyPattern.MatchString(k):
+			return &fieldError{Field: field, Reason: fmt.Sprintf("key %q is not a valid query parameter name", k)}
+		case reservedFilterKeys[strings.ToLower(k)]:
+			return &fieldError{Field: field, Reason: fmt.Sprintf("key %q is set by the tool; use its own argument", k)}
+		case strings.IndexFunc(filters[k], unicode.IsControl) >= 0:
+			return &fieldError{Field: field, Reason: fmt.Sprintf("value for %q contains control characters", k)}
+		}
+	}
+	return nil
+}
+
+// validationResult collects the failed checks into one tool error listing every
+// problem, or returns nil when all checks passed. The failures are also
+// attached as structured content ({"errors": [{field, reason}]}).
+func validationResult(checks ...*fieldError) *sdkmcp.CallToolResult {
+	var errs []fieldError
+	for _, c := range checks {
+		if c != nil {
+			errs = append(errs, *c)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	var msg string
+	if len(errs) == 1 {
+		msg = "invalid input: " + errs[0].String()
+	} else {
+		lines := make([]string, len(errs))
+		for i, e := range errs {
+			lines[i] = "- " + e.String()
+		}
+		msg = fmt.Sprintf("invalid input (%d problems):\n%s", len(errs), strings.Join(lines, "\n"))
+	}
+	res := toolError(msg)
+	res.StructuredContent = map[string]any{"errors": errs}
+	return res
+}
+
+// validatePageOffset checks offset lands on a page boundary when the client
+// pages by page number, where an offset between boundaries cannot be sent.
+func validatePageOffset(p itportal.Pagination, offset, limit int) *fieldError {
+	if p != itportal.PaginationPage || limit <= 0 || offset%limit == 0 {
+		return nil
+	}
+	return &fieldError{Field: "offset", Reason: fmt.Sprintf("must be a multiple of limit (%d): ITPortal is paged by page number", limit)}
+}
@@ -0,0 +1,66 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidationReportsEveryMissingField verifies a tool call missing several
+// required arguments gets one error naming all of them, before any API call.
+func TestValidationReportsEveryMissingField(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	h := newHandler(srv.URL)
+	res, _, err := h.UploadFile(context.Background(), nil, UploadFileInput{FileName: "  "})
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	if !res.IsError {
+		t.Fatal("missing fields accepted")
+	}
+	text := resultText(t, res)
+	for _, want := range []string{
+		"invalid input (3 problems)",
+		"field entity_id: is required",
+		"field file_name: is required",
+		"field base64_data: is required",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("error missing %q:\n%s", want, text)
+		}
+	}
+	errs, _ := res.StructuredContent.(map[string]any)["errors"].([]fieldError)
+	if len(errs) != 3 {
+		t.Errorf("structured errors = %+v, want 3", res.StructuredContent)
+	}
+	if hits != 0 {
+		t.Errorf("API called %d times despite invalid input", hits)
+	}
+
+	res, _, _ = h.ManageSwitchPorts(context.Background(), nil, ManageSwitchPortsInput{DeviceID: "1", Action: "create", Name: "uplinks"})
+	text = resultText(t, res)
+	if !strings.Contains(text, "field starting_port: is required for create") ||
+		!strings.Contains(text, "field ending_port: is required for create") || strings.Contains(text, "field name") {
+		t.Errorf("action-specific errors wrong:\n%s", text)
+	}
+}
+
+func TestValidateOneOf(t *testing.T) {
+	if e := validateOneOf("format", "Markdown", "markdown", "json"); e != nil {
+		t.Errorf("case-insensitive match rejected: %v", e)
+	}
+	if e := validateOneOf("format", "", "markdown", "json"); e != nil {
+		t.Errorf("empty value rejected: %v", e)
+	}
+	e := validateOneOf("format", "xml", "markdown", "json")
+	if e == nil || e.String() != `field format: "xml" is not one of: markdown, json` {
+		t.Errorf("got %v", e)
+	}
+}
@@ -0,0 +1,28 @@
+package mcp
+
+import (
+	"strings"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// toolOutcome is the structured content of a tool whose primary action can
+// succeed while sub-steps fail: the outcome itself, and the sub-step failures
+// as warnings of their own, so clients can show them apart from the result.
+type toolOutcome struct {
+	Result   any      `json:"result"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// outcomeResult reports a successful primary action. text describes it as the
+// first content block; warnings, when there are any, follow in a second block
+// and in the structured content's warnings field, next to result.
+func outcomeResult(text string, result any, warnings []string) (*sdkmcp.CallToolResult, any, error) {
+	res := toolText(text)
+	if len(warnings) > 0 {
+		res.Content = append(res.Content, &sdkmcp.TextContent{
+			Text: "⚠ Warnings:\n- " + strings.Join(warnings, "\n- "),
+		})
+	}
+	return res, toolOutcome{Result: result, Warnings: warnings}, nil
+}
@@ -0,0 +1,75 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestCreateDeviceSeparatesWarnings fails the IP sub-step of a create_device
+// whose note succeeds: the create is still reported as a success, and the IP
+// failure appears only as a warning.
+func TestCreateDeviceSeparatesWarnings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/2.1/devices/":
+			w.Header().Set("Location", "/api/2.1/devices/42/")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/2.1/devices/42/ips/":
+			http.Error(w, "duplicate IP", http.StatusConflict)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/2.1/devices/42/notes/":
+			w.Header().Set("Location", "/api/2.1/devices/42/notes/7/")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeList(w, []itportal.Device{{ID: 42, Name: "fw01"}}, "")
+		}
+	}))
+	defer srv.Close()
+
+	res, out, err := newHandler(srv.URL).CreateDevice(context.Background(), nil, CreateDeviceInput{
+		CompanyID: 1, Name: "fw01", IPAddress: "10.0.0.1", InitialNote: "racked",
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("CreateDevice = %v, %v", res, err)
+	}
+	primary := resultText(t, res)
+	if !strings.Contains(primary, "Device created successfully.") || !strings.Contains(primary, "✓ Initial note added") {
+		t.Errorf("primary text = %q, want the create and the note reported", primary)
+	}
+	if strings.Contains(primary, "10.0.0.1") {
+		t.Errorf("primary text mentions the failed IP:\n%s", primary)
+	}
+
+	outcome, ok := out.(toolOutcome)
+	if !ok {
+		t.Fatalf("structured content is %T, want toolOutcome", out)
+	}
+	if d, _ := outcome.Result.(*itportal.Device); d == nil || d.ID != 42 {
+		t.Errorf("result = %#v, want device 42", outcome.Result)
+	}
+	if len(outcome.Warnings) != 1 || !strings.HasPrefix(outcome.Warnings[0], "Could not add IP 10.0.0.1:") {
+		t.Errorf("warnings = %q, want the IP failure only", outcome.Warnings)
+	}
+	if len(res.Content) != 2 {
+		t.Fatalf("got %d content blocks, want the outcome and a warnings block", len(res.Content))
+	}
+	if w := res.Content[1].(*sdkmcp.TextContent).Text; !strings.Contains(w, "Could not add IP 10.0.0.1") {
+		t.Errorf("warnings block = %q", w)
+	}
+}
+
+func TestOutcomeResultWithoutWarnings(t *testing.T) {
+	res, out, _ := outcomeResult("done", 1, nil)
+	if len(res.Content) != 1 || resultText(t, res) != "done" {
+		t.Errorf("content = %v, want the outcome only", res.Content)
+	}
+	if o := out.(toolOutcome); o.Result != 1 || o.Warnings != nil {
+		t.Errorf("outcome = %+v", o)
+	}
+}
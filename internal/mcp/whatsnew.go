@@ -0,0 +1,74 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+)
+
+// ---- whats_new ----
+
+type WhatsNewInput struct {
+	Since string `json:"since,omitempty" jsonschema:"Optional cutoff (YYYY-MM-DD or RFC 3339). Defaults to when the previous snapshot was built."`
+}
+
+// WhatsNew lists the cached entities modified after the previous snapshot was
+// built (or after since), grouped by section, oldest change first, so an agent
+// can catch up without scanning everything.
+func (h *Handler) WhatsNew(ctx context.Context, _ *sdkmcp.CallToolRequest, input WhatsNewInput) (*sdkmcp.CallToolResult, any, error) {
+	var since time.Time
+	source := "since argument"
+	if s := strings.TrimSpace(input.Since); s != "" {
+		t, ok := cache.ParseTimestamp(s)
+		if !ok {
+			return validationResult(&fieldError{Field: "since", Reason: fmt.Sprintf("%q is not a date (YYYY-MM-DD) or RFC 3339 timestamp", s)}), nil, nil
+		}
+		since = t
+	}
+	if !h.snapshotReady() {
+		return toolError(snapshotNotReady), nil, nil
+	}
+	h.cache.EnsureFresh(ctx)
+	snap := h.cache.Get()
+	if since.IsZero() {
+		if snap.PreviousGeneratedAt.IsZero() {
+			return toolText("There is no previous snapshot to compare against yet: the current one is the first built since the server started. " +
+				"Pass since (YYYY-MM-DD or RFC 3339) to list what changed after a given time."), nil, nil
+		}
+		since, source = snap.PreviousGeneratedAt, "previous snapshot"
+	}
+
+	changes := snap.ModifiedSince(since)
+	total := 0
+	for _, list := range changes {
+		total += len(list)
+	}
+	if total == 0 {
+		return toolText(fmt.Sprintf("Nothing was modified after %s (%s), as of the snapshot built %s.",
+			since.Format(time.RFC3339), source, snap.GeneratedAt.Format(time.RFC3339))), nil, nil
+	}
+
+	out, err := json.MarshalIndent(struct {
+		Since       string                     `json:"since"`
+		SinceSource string                     `json:"since_source"`
+		SnapshotAt  string                     `json:"snapshot_generated_at"`
+		Total       int                        `json:"total"`
+		Changes     map[string][]cache.Changed `json:"changes"`
+	}{
+		Since:       since.Format(time.RFC3339),
+		SinceSource: source,
+		SnapshotAt:  snap.GeneratedAt.Format(time.RFC3339),
+		Total:       total,
+		Changes:     changes,
+	}, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal changes: %w", err)
+	}
+	return toolText(string(out)), nil, nil
+}
@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexfirilov/itportal-mcp/internal/cache"
+	"github.com/alexfirilov/itportal-mcp/internal/itportal"
+)
+
+// TestWhatsNewSelectsChangesAfterPreviousSnapshot builds two snapshots and
+// checks only the records modified after the first one are reported, grouped
+// by type and oldest first.
+func TestWhatsNewSelectsChangesAfterPreviousSnapshot(t *testing.T) {
+	stamp := func(d time.Duration) string { return time.Now().Add(d).UTC().Format(time.RFC3339) }
+	before, after1, after2 := stamp(-time.Hour), stamp(time.Hour), stamp(2*time.Hour)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.1/devices/":
+			writeList(w, []itportal.Device{
+				{ID: 1, Name: "old-fw", Modified: before},
+				{ID: 2, Name: "new-sw", Modified: after2},
+				{ID: 3, Name: "new-fw", Modified: after1},
+				{ID: 4, Name: "undated"},
+			}, "")
+		case "/api/2.1/kbs/":
+			writeList(w, []itportal.KB{{ID: 9, Name: "Runbook", Modified: after1}}, "")
+		case "/api/2.1/companies/":
+			writeList(w, []itportal.Company{{ID: 5, Name: "Acme", Modified: before}}, "")
+		default:
+			writeList(w, []any{}, "")
+		}
+	}))
+	defer srv.Close()
+	client := itportal.NewClient(srv.URL, "k")
+	c, err := cache.New(context.Background(), client, 10, 10, time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), cache.WithStorePath(filepath.Join(t.TempDir(), "x.db")))
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	h := &Handler{client: client, cache: c, baseURL: srv.URL}
+	ctx := context.Background()
+
+	res, _, _ := h.WhatsNew(ctx, nil, WhatsNewInput{})
+	if res.IsError || !strings.Contains(resultText(t, res), "no previous snapshot") {
+		t.Errorf("first snapshot: %s", resultText(t, res))
+	}
+
+	if _, err := c.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	res, _, err = h.WhatsNew(ctx, nil, WhatsNewInput{})
+	if err != nil || res.IsError {
+		t.Fatalf("WhatsNew = %v, %v", res, err)
+	}
+	var got struct {
+		SinceSource string                     `json:"since_source"`
+		Total       int                        `json:"total"`
+		Changes     map[string][]cache.Changed `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, res)), &got); err != nil {
+		t.Fatalf("decode: %v\n%s", err, resultText(t, res))
+	}
+	if got.SinceSource != "previous snapshot" || got.Total != 3 || len(got.Changes) != 2 {
+		t.Errorf("got %+v, want 3 changes in devices and kbs", got)
+	}
+	if d := got.Changes["devices"]; len(d) != 2 || d[0].ID != 3 || d[1].ID != 2 {
+		t.Errorf("devices = %+v, want 3 then 2", d)
+	}
+	if k := got.Changes["kbs"]; len(k) != 1 || k[0].Name != "Runbook" {
+		t.Errorf("kbs = %+v", k)
+	}
+
+	// An explicit since reaches back past the previous snapshot.
+	res, _, _ = h.WhatsNew(ctx, nil, WhatsNewInput{Since: time.Now().Add(-2 * time.Hour).Format("2006-01-02T15:04:05Z07:00")})
+	if err := json.Unmarshal([]byte(resultText(t, res)), &got); err != nil || got.Total != 5 || got.SinceSource != "since argument" {
+		t.Errorf("since 2h ago: total %d (%v), want 5", got.Total, err)
+	}
+	if res, _, _ = h.WhatsNew(ctx, nil, WhatsNewInput{Since: "last week"}); !res.IsError {
+		t.Errorf("bad since accepted: %s", resultText(t, res))
+	}
+}